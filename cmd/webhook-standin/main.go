@@ -0,0 +1,112 @@
+// Command webhook-standin is a local webhook receiver to try deliveries against. It verifies the signature of every
+// delivery when WEBHOOK_SECRET is set, logs what it receives and lists it at GET /events. Setting
+// WEBHOOK_STANDIN_FAIL_FIRST answers the first deliveries with a 500, and WEBHOOK_STANDIN_STATUS answers every
+// delivery with the given status, to exercise retries and dead lettering.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robinloh/wallet-backend/webhooks"
+)
+
+const DEFAULT_ADDR = ":9090"
+
+type received struct {
+	DeliveryID string          `json:"delivery_id"`
+	EventType  string          `json:"event_type"`
+	Verified   bool            `json:"verified"`
+	Answered   int             `json:"answered"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type standIn struct {
+	logger    *slog.Logger
+	secret    string
+	failFirst int
+	status    int
+
+	mu       sync.Mutex
+	requests int
+	events   []received
+}
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	addr := os.Getenv("WEBHOOK_STANDIN_ADDR")
+	if len(addr) == 0 {
+		addr = DEFAULT_ADDR
+	}
+
+	s := &standIn{
+		logger: logger,
+		secret: os.Getenv("WEBHOOK_SECRET"),
+	}
+	s.failFirst, _ = strconv.Atoi(os.Getenv("WEBHOOK_STANDIN_FAIL_FIRST"))
+	s.status, _ = strconv.Atoi(os.Getenv("WEBHOOK_STANDIN_STATUS"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", s.listEvents)
+	mux.HandleFunc("POST /", s.receive)
+
+	logger.Info(fmt.Sprintf("webhook stand-in listening on '%s'", addr))
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error(fmt.Sprintf("webhook stand-in stopped : %v", err))
+		os.Exit(1)
+	}
+}
+
+func (s *standIn) receive(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	event := received{
+		DeliveryID: r.Header.Get(webhooks.HEADER_ID),
+		EventType:  r.Header.Get(webhooks.HEADER_EVENT),
+		ReceivedAt: time.Now(),
+		Payload:    body,
+	}
+	if len(s.secret) > 0 {
+		event.Verified = webhooks.Verify(s.secret, r.Header.Get(webhooks.HEADER_TIMESTAMP), r.Header.Get(webhooks.HEADER_SIGNATURE),
+			body, event.ReceivedAt, webhooks.DEFAULT_TOLERANCE)
+	}
+
+	s.mu.Lock()
+	s.requests++
+	switch {
+	case len(s.secret) > 0 && !event.Verified:
+		event.Answered = http.StatusUnauthorized
+	case s.requests <= s.failFirst:
+		event.Answered = http.StatusInternalServerError
+	case s.status > 0:
+		event.Answered = s.status
+	default:
+		event.Answered = http.StatusNoContent
+	}
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+
+	s.logger.Info(fmt.Sprintf("received '%s' delivery '%s', verified %t, answering %d : %s", event.EventType, event.DeliveryID, event.Verified, event.Answered, body))
+	w.WriteHeader(event.Answered)
+}
+
+func (s *standIn) listEvents(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.events)
+}
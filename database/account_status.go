@@ -0,0 +1,386 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+type AccountStatus string
+
+const (
+	AccountStatusActive AccountStatus = "active"
+	AccountStatusFrozen AccountStatus = "frozen"
+	AccountStatusClosed AccountStatus = "closed"
+)
+
+var (
+	ErrAccountFrozen       = errors.New("account is frozen")
+	ErrAccountClosed       = errors.New("account is closed")
+	ErrAccountNotEmpty     = errors.New("account still has a balance or active holds")
+	ErrInvalidStatusChange = errors.New("account status cannot be changed this way")
+)
+
+// AccountState is what decides whether money may move in or out of an account. Frozen accounts refuse debits, and
+// credits too when FreezeCredits is set; closed accounts refuse both.
+type AccountState struct {
+	Status        AccountStatus
+	FreezeCredits bool
+}
+
+// StatusChangeParams moves an account to Status. Closing sweeps any remaining balances to SweepTo, and is refused
+// while balances remain and no SweepTo is given.
+type StatusChangeParams struct {
+	AccountID     string
+	Status        AccountStatus
+	Reason        string
+	FreezeCredits bool
+	SweepTo       string
+}
+
+func (s *AccountState) CanDebit() error {
+	switch s.Status {
+	case AccountStatusClosed:
+		return ErrAccountClosed
+	case AccountStatusFrozen:
+		return ErrAccountFrozen
+	}
+	return nil
+}
+
+func (s *AccountState) CanCredit() error {
+	switch {
+	case s.Status == AccountStatusClosed:
+		return ErrAccountClosed
+	case s.Status == AccountStatusFrozen && s.FreezeCredits:
+		return ErrAccountFrozen
+	}
+	return nil
+}
+
+// checkStatusChange allows freezing (again, to change FreezeCredits) and closing any open account, and
+// unfreezing a frozen one. Closed accounts stay closed.
+func (s *AccountState) checkStatusChange(params *StatusChangeParams) error {
+	if s.Status == AccountStatusClosed {
+		return ErrAccountClosed
+	}
+	if params.Status == AccountStatusActive && s.Status != AccountStatusFrozen {
+		return ErrInvalidStatusChange
+	}
+	return nil
+}
+
+// sweepTransfers empties every currency balance of a closing account into the sweep account.
+func sweepTransfers(params *StatusChangeParams, balances map[string]decimal.Decimal) ([]*TransferParams, error) {
+	currencies := make([]string, 0, len(balances))
+	for currency, balance := range balances {
+		if !balance.IsZero() {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+
+	if len(currencies) > 0 && len(params.SweepTo) == 0 {
+		return nil, ErrAccountNotEmpty
+	}
+
+	transfers := make([]*TransferParams, 0, len(currencies))
+	for _, currency := range currencies {
+		if balances[currency].IsNegative() {
+			return nil, fmt.Errorf("%w : negative %s balance cannot be swept", ErrAccountNotEmpty, currency)
+		}
+		transfers = append(transfers, &TransferParams{
+			TxnID:      uuid.NewString(),
+			From:       params.AccountID,
+			To:         params.SweepTo,
+			Amount:     balances[currency],
+			Currency:   currency,
+			ToCurrency: currency,
+		})
+	}
+	return transfers, nil
+}
+
+// LockAccount returns the state of a customer account, holding a share lock on it until the transaction ends so
+// that it cannot be frozen or closed while money is moving.
+func LockAccount(ctx context.Context, tx pgx.Tx, accountID string) (*AccountState, error) {
+	return lockAccount(ctx, tx, LOCK_ACCOUNT_QUERY, accountID)
+}
+
+// lockCustomerAccount is LockAccount for accounts that may be missing without that being an error, such as the
+// receiver of a transfer or the system side of a posting: it returns a nil state when there is no customer account.
+func lockCustomerAccount(ctx context.Context, tx pgx.Tx, accountID string) (*AccountState, error) {
+	state, err := LockAccount(ctx, tx, accountID)
+	if errors.Is(err, ErrAccountNotFound) {
+		return nil, nil
+	}
+	return state, err
+}
+
+// checkPostings locks every customer account an entry touches and refuses the entry when one of them may not be
+// debited or credited the way it posts.
+func checkPostings(ctx context.Context, tx pgx.Tx, postings []Posting) error {
+	for _, posting := range postings {
+		state, err := lockCustomerAccount(ctx, tx, posting.AccountID)
+		if err != nil {
+			return err
+		}
+		if err = state.checkPosting(posting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AccountState) checkPosting(posting Posting) error {
+	switch {
+	case s == nil:
+		return nil
+	case posting.Amount.IsNegative():
+		return s.CanDebit()
+	default:
+		return s.CanCredit()
+	}
+}
+
+func lockAccount(ctx context.Context, tx pgx.Tx, query string, accountID string) (*AccountState, error) {
+	state := new(AccountState)
+
+	err := tx.QueryRow(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"id": accountID,
+		},
+	).Scan(&state.Status, &state.FreezeCredits)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to find account '%s' : %w", accountID, err)
+	}
+
+	return state, nil
+}
+
+func (p *Postgres) ChangeAccountStatus(ctx context.Context, params *StatusChangeParams) ([]*TransactionRecord, error) {
+	var sweeps []*TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		sweeps, err = p.changeAccountStatus(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to change status of account '%s' : %w", params.AccountID, err)
+	}
+
+	return sweeps, nil
+}
+
+// changeAccountStatus moves the account to its new status within tx, sweeping its balances when it closes.
+func (p *Postgres) changeAccountStatus(ctx context.Context, tx pgx.Tx, params *StatusChangeParams) ([]*TransactionRecord, error) {
+	state, err := lockAccount(ctx, tx, LOCK_ACCOUNT_FOR_UPDATE_QUERY, params.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = state.checkStatusChange(params); err != nil {
+		return nil, err
+	}
+
+	sweeps := make([]*TransactionRecord, 0)
+	if params.Status == AccountStatusClosed {
+		sweeps, err = p.closeAccount(ctx, tx, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		UPDATE_ACCOUNT_STATUS_QUERY,
+		pgx.NamedArgs{
+			"id":             params.AccountID,
+			"status":         params.Status,
+			"reason":         params.Reason,
+			"freeze_credits": params.Status == AccountStatusFrozen && params.FreezeCredits,
+			"from_status":    state.Status,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update status of account '%s' : %v", params.AccountID, err)
+	}
+
+	if err = p.queueAccountStatusEvent(ctx, tx, params); err != nil {
+		return nil, err
+	}
+	if err = p.queueTransactionEvents(ctx, tx, sweeps...); err != nil {
+		return nil, err
+	}
+
+	return sweeps, nil
+}
+
+func (p *Postgres) closeAccount(ctx context.Context, tx pgx.Tx, params *StatusChangeParams) ([]*TransactionRecord, error) {
+	var activeHolds int
+	err := tx.QueryRow(
+		ctx,
+		COUNT_ACTIVE_HOLDS_QUERY,
+		pgx.NamedArgs{
+			"account_id": params.AccountID,
+		},
+	).Scan(&activeHolds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to count holds of account '%s' : %v", params.AccountID, err)
+	}
+	if activeHolds > 0 {
+		return nil, ErrAccountNotEmpty
+	}
+
+	results, err := tx.Query(
+		ctx,
+		LOCK_ACCOUNT_BALANCES_QUERY,
+		pgx.NamedArgs{
+			"account_id": params.AccountID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query balances of account '%s' : %v", params.AccountID, err)
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	for results.Next() {
+		var (
+			currency string
+			balance  decimal.Decimal
+		)
+		if err = results.Scan(&currency, &balance); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("unable to parse balances of account '%s' : %v", params.AccountID, err)
+		}
+		balances[currency] = balance
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read balances of account '%s' : %v", params.AccountID, err)
+	}
+
+	transfers, err := sweepTransfers(params, balances)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transfers) > 0 {
+		target, err := LockAccount(ctx, tx, params.SweepTo)
+		if err != nil {
+			return nil, fmt.Errorf("unable to sweep to account '%s' : %w", params.SweepTo, err)
+		}
+		if err = target.CanCredit(); err != nil {
+			return nil, fmt.Errorf("unable to sweep to account '%s' : %w", params.SweepTo, err)
+		}
+	}
+
+	sweeps := make([]*TransactionRecord, 0, 2*len(transfers))
+	for _, transfer := range transfers {
+		result, err := newTransferResult(transfer, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     transfer.TxnID,
+			Operation: transferEntryOperation,
+			Postings:  transferPostings(transfer, transfer.Amount),
+		}
+		if err = PostJournalEntry(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+		result.complete(entry.ID)
+
+		for _, txn := range []*TransactionRecord{result.Sender, result.Receiver} {
+			if err = InsertTransaction(ctx, tx, txn); err != nil {
+				return nil, err
+			}
+			sweeps = append(sweeps, txn)
+		}
+	}
+
+	return sweeps, nil
+}
+
+func (m *MemoryStore) ChangeAccountStatus(_ context.Context, params *StatusChangeParams) ([]*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.customerAccount(params.AccountID)
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+
+	if err := acc.state().checkStatusChange(params); err != nil {
+		return nil, err
+	}
+
+	sweeps := make([]*TransactionRecord, 0)
+	if params.Status == AccountStatusClosed {
+		for _, hold := range m.holds {
+			hold.expire(time.Now())
+			if hold.AccountID == params.AccountID && hold.Status == HoldStatusActive {
+				return nil, ErrAccountNotEmpty
+			}
+		}
+
+		transfers, err := sweepTransfers(params, acc.balances)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(transfers) > 0 {
+			target := m.customerAccount(params.SweepTo)
+			if target == nil {
+				return nil, fmt.Errorf("unable to sweep to account '%s' : %w", params.SweepTo, ErrAccountNotFound)
+			}
+			if err = target.state().CanCredit(); err != nil {
+				return nil, fmt.Errorf("unable to sweep to account '%s' : %w", params.SweepTo, err)
+			}
+		}
+
+		for _, transfer := range transfers {
+			result, err := newTransferResult(transfer, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			entry := &JournalEntry{
+				ID:        uuid.NewString(),
+				TxnID:     transfer.TxnID,
+				Operation: transferEntryOperation,
+				Postings:  transferPostings(transfer, transfer.Amount),
+			}
+			if err = m.postJournalEntry(entry); err != nil {
+				return nil, err
+			}
+			result.complete(entry.ID)
+
+			m.insertTransaction(result.Sender)
+			m.insertTransaction(result.Receiver)
+			sweeps = append(sweeps, result.Sender, result.Receiver)
+		}
+	}
+
+	acc.status = params.Status
+	acc.statusReason = params.Reason
+	acc.freezeCredits = params.Status == AccountStatusFrozen && params.FreezeCredits
+	m.queueAccountStatusEvent(params)
+	m.queueTransactionEvents(sweeps...)
+
+	return sweeps, nil
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+type AccountType string
+
+const (
+	AccountTypeChecking AccountType = "checking"
+	AccountTypeSavings  AccountType = "savings"
+	AccountTypeBusiness AccountType = "business"
+)
+
+const (
+	DEFAULT_FIND_ACCOUNTS_LIMIT = 50
+	MAX_FIND_ACCOUNTS_LIMIT     = 200
+)
+
+// AccountParams describes an account to create. Every field is optional; the type defaults to checking.
+type AccountParams struct {
+	OwnerID     string
+	Type        AccountType
+	DisplayName string
+	Metadata    map[string]string
+}
+
+// AccountFilter selects the accounts of OwnerID, or those whose metadata holds every key and value of Metadata,
+// or both.
+type AccountFilter struct {
+	OwnerID  string
+	Metadata map[string]string
+	Limit    int
+}
+
+func IsAccountType(accountType string) bool {
+	switch AccountType(accountType) {
+	case AccountTypeChecking, AccountTypeSavings, AccountTypeBusiness:
+		return true
+	}
+	return false
+}
+
+// newAccount is a freshly created, active account with no balances.
+func newAccount(accountID string, params *AccountParams) *Account {
+	account := &Account{
+		ID:          accountID,
+		Status:      AccountStatusActive,
+		OwnerID:     params.OwnerID,
+		Type:        params.Type,
+		DisplayName: params.DisplayName,
+		Metadata:    maps.Clone(params.Metadata),
+		Balances:    make([]Balance, 0),
+	}
+	if len(account.Type) == 0 {
+		account.Type = AccountTypeChecking
+	}
+	return account
+}
+
+func (f *AccountFilter) matches(account *Account) bool {
+	if len(f.OwnerID) > 0 && account.OwnerID != f.OwnerID {
+		return false
+	}
+	for key, value := range f.Metadata {
+		if existing, ok := account.Metadata[key]; !ok || existing != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Postgres) FindAccounts(ctx context.Context, filter *AccountFilter) ([]*Account, error) {
+	metadata := filter.Metadata
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	results, err := p.Db.Query(
+		ctx,
+		FIND_ACCOUNTS_QUERY,
+		pgx.NamedArgs{
+			"owner_id": filter.OwnerID,
+			"metadata": metadata,
+			"limit":    filter.Limit,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query accounts : %v", err)
+	}
+	defer results.Close()
+
+	return scanAccounts(results)
+}
+
+// scanAccounts reads rows of ACCOUNT_COLUMNS, one per account and currency, into accounts in the order they come.
+func scanAccounts(results pgx.Rows) ([]*Account, error) {
+	accounts := make([]*Account, 0)
+
+	for results.Next() {
+		var (
+			account     Account
+			currency    pgtype.Text
+			balance     decimal.NullDecimal
+			available   decimal.NullDecimal
+			creditLimit decimal.NullDecimal
+		)
+		err := results.Scan(&account.ID, &account.Status, &account.StatusReason, &account.FreezeCredits, &account.OwnerID,
+			&account.Type, &account.DisplayName, &account.Metadata, &account.CreatedAt, &currency, &balance, &available,
+			&creditLimit)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse account : %v", err)
+		}
+
+		if len(accounts) == 0 || accounts[len(accounts)-1].ID != account.ID {
+			account.Balances = make([]Balance, 0)
+			accounts = append(accounts, &account)
+		}
+
+		if currency.Valid && balance.Valid {
+			last := accounts[len(accounts)-1]
+			last.Balances = append(last.Balances, Balance{
+				Currency:    currency.String,
+				Balance:     balance.Decimal,
+				Available:   available.Decimal,
+				CreditLimit: creditLimit.Decimal,
+			})
+		}
+	}
+
+	if err := results.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read accounts : %v", err)
+	}
+
+	return accounts, nil
+}
+
+func (m *MemoryStore) FindAccounts(_ context.Context, filter *AccountFilter) ([]*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts := make([]*Account, 0)
+	for accountID, acc := range m.accounts {
+		if acc.isSystem {
+			continue
+		}
+		if account := m.account(accountID, acc); filter.matches(account) {
+			accounts = append(accounts, account)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].CreatedAt.Equal(accounts[j].CreatedAt) {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		}
+		return accounts[i].ID < accounts[j].ID
+	})
+	if len(accounts) > filter.Limit {
+		accounts = accounts[:filter.Limit]
+	}
+
+	return accounts, nil
+}
+
+// account copies a memory account out from under the lock, with its balances in currency order.
+func (m *MemoryStore) account(accountID string, acc *memoryAccount) *Account {
+	account := &Account{
+		ID:            accountID,
+		Status:        acc.status,
+		StatusReason:  acc.statusReason,
+		FreezeCredits: acc.freezeCredits,
+		OwnerID:       acc.details.OwnerID,
+		Type:          acc.details.Type,
+		DisplayName:   acc.details.DisplayName,
+		Metadata:      maps.Clone(acc.details.Metadata),
+		CreatedAt:     acc.createdAt,
+		Balances:      make([]Balance, 0, len(acc.balances)),
+	}
+	for currency, balance := range acc.balances {
+		available, _ := m.available(accountID, currency)
+		account.Balances = append(account.Balances, Balance{
+			Currency:    currency,
+			Balance:     balance,
+			Available:   available,
+			CreditLimit: acc.creditLimits[currency],
+		})
+	}
+	sort.Slice(account.Balances, func(i, j int) bool {
+		return account.Balances[i].Currency < account.Balances[j].Currency
+	})
+
+	return account
+}
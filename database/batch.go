@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// BatchMode decides what happens to the other legs of a batch transfer when one of them fails.
+type BatchMode string
+
+const (
+	// BatchModeAtomic moves the money of every leg or of none: the first leg that fails rolls the batch back.
+	BatchModeAtomic BatchMode = "atomic"
+	// BatchModeBestEffort runs every leg on its own, so a failed leg leaves the others in place.
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+func IsBatchMode(mode string) bool {
+	switch BatchMode(mode) {
+	case BatchModeAtomic, BatchModeBestEffort:
+		return true
+	}
+	return false
+}
+
+// BatchTransferParams describes a batch transfer. Every leg carries its own transaction ID and the BatchID.
+type BatchTransferParams struct {
+	BatchID string
+	Mode    BatchMode
+	Legs    []*TransferParams
+}
+
+// BatchLegResult is the outcome of one leg: the transfer as recorded, or the error that kept it from being recorded.
+type BatchLegResult struct {
+	Result *TransferResult
+	Err    error
+}
+
+// BatchLegError is returned for an atomic batch that was rolled back, naming the leg that failed it.
+type BatchLegError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchLegError) Error() string {
+	return fmt.Sprintf("leg %d of the batch failed : %v", e.Index, e.Err)
+}
+
+func (e *BatchLegError) Unwrap() error {
+	return e.Err
+}
+
+// err is the error an atomic batch fails with when a leg would be recorded as failed for this reason.
+func (r FailureReason) err() error {
+	switch r {
+	case FailureInsufficientFunds:
+		return ErrInsufficientFunds
+	case FailureDestinationNotFound:
+		return ErrDestinationNotFound
+	}
+	if r.IsLimit() {
+		return fmt.Errorf("%w : %s", ErrLimitExceeded, r)
+	}
+	return nil
+}
+
+// BatchTransfer runs the legs of a best-effort batch as separate transfers. An atomic batch runs in one
+// serializable transaction that locks every account and balance of the batch in ID order before the first leg.
+func (p *Postgres) BatchTransfer(ctx context.Context, params *BatchTransferParams) ([]BatchLegResult, error) {
+	if params.Mode == BatchModeBestEffort {
+		results := make([]BatchLegResult, 0, len(params.Legs))
+		for _, leg := range params.Legs {
+			result, err := p.Transfer(ctx, leg)
+			results = append(results, BatchLegResult{Result: result, Err: err})
+		}
+		return results, nil
+	}
+
+	var results []BatchLegResult
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		results = make([]BatchLegResult, 0, len(params.Legs))
+
+		if err := lockBatch(ctx, tx, params.Legs); err != nil {
+			return err
+		}
+
+		for i, leg := range params.Legs {
+			result, err := p.transfer(ctx, tx, leg)
+			if err == nil {
+				err = result.Sender.FailureReason.err()
+			}
+			if err != nil {
+				return &BatchLegError{Index: i, Err: err}
+			}
+			results = append(results, BatchLegResult{Result: result})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to run batch '%s' : %w", params.BatchID, err)
+	}
+
+	return results, nil
+}
+
+// lockBatch locks every account of the batch, and then every balance its legs post to, each in ID order.
+func lockBatch(ctx context.Context, tx pgx.Tx, legs []*TransferParams) error {
+	accountIDs := make([]string, 0, 2*len(legs))
+	postings := make([]Posting, 0, 4*len(legs))
+	for _, leg := range legs {
+		accountIDs = append(accountIDs, leg.From, leg.To)
+		postings = append(postings, transferPostings(leg, leg.Amount)...)
+	}
+	slices.Sort(accountIDs)
+
+	for _, accountID := range slices.Compact(accountIDs) {
+		if _, err := lockCustomerAccount(ctx, tx, accountID); err != nil {
+			return err
+		}
+	}
+
+	return LockBalances(ctx, tx, postings)
+}
+
+func (m *MemoryStore) BatchTransfer(_ context.Context, params *BatchTransferParams) ([]BatchLegResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := make([]BatchLegResult, 0, len(params.Legs))
+
+	if params.Mode == BatchModeBestEffort {
+		for _, leg := range params.Legs {
+			result, err := m.transfer(leg)
+			results = append(results, BatchLegResult{Result: result, Err: err})
+		}
+		return results, nil
+	}
+
+	rollback := m.snapshot()
+	for i, leg := range params.Legs {
+		result, err := m.transfer(leg)
+		if err == nil {
+			err = result.Sender.FailureReason.err()
+		}
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("unable to run batch '%s' : %w", params.BatchID, &BatchLegError{Index: i, Err: err})
+		}
+		results = append(results, BatchLegResult{Result: result})
+	}
+
+	return results, nil
+}
+
+// snapshot returns a function that undoes every balance, posting, transaction, quote and queued webhook event change
+// made after it was taken, standing in for a database rollback.
+func (m *MemoryStore) snapshot() func() {
+	balances := make(map[string]map[string]decimal.Decimal, len(m.accounts))
+	for accountID, acc := range m.accounts {
+		balances[accountID] = maps.Clone(acc.balances)
+	}
+	usedBy := make(map[string]string, len(m.quotes))
+	for quoteID, q := range m.quotes {
+		usedBy[quoteID] = q.usedBy
+	}
+	postings, transactions := len(m.postings), len(m.transactions)
+	webhookEvents, webhookDeliveries := maps.Clone(m.webhookEvents), maps.Clone(m.webhookDeliveries)
+
+	return func() {
+		for accountID, balance := range balances {
+			m.accounts[accountID].balances = balance
+		}
+		for quoteID, used := range usedBy {
+			m.quotes[quoteID].usedBy = used
+		}
+		m.postings = m.postings[:postings]
+		m.transactions = m.transactions[:transactions]
+		m.webhookEvents, m.webhookDeliveries = webhookEvents, webhookDeliveries
+	}
+}
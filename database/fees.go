@@ -0,0 +1,34 @@
+package database
+
+import (
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// feePostings move a fee from the account paying it to the revenue account. There are none for a zero fee.
+func feePostings(accountID string, currency string, fee decimal.Decimal) []Posting {
+	if !fee.IsPositive() {
+		return nil
+	}
+	return []Posting{
+		{AccountID: accountID, Currency: currency, Amount: fee.Neg()},
+		{AccountID: SYSTEM_REVENUE_ACCOUNT, Currency: currency, Amount: fee},
+	}
+}
+
+// feeRecord is the line a fee shows as in the history of the account paying it. It shares the ID of the
+// transaction it was charged for and is posted by the same journal entry. It is nil for a zero fee.
+func feeRecord(txnID string, accountID string, currency string, fee decimal.Decimal, entryID string) *TransactionRecord {
+	if !fee.IsPositive() {
+		return nil
+	}
+	return &TransactionRecord{
+		ID:        txnID,
+		AccountID: accountID,
+		Amount:    fee,
+		Currency:  currency,
+		TxnType:   TxnTypeFee,
+		Status:    utils.COMPLETED,
+		EntryID:   entryID,
+	}
+}
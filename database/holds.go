@@ -0,0 +1,521 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const DEFAULT_HOLD_TTL = 7 * 24 * time.Hour
+
+type HoldStatus string
+
+const (
+	HoldStatusActive   HoldStatus = "active"
+	HoldStatusCaptured HoldStatus = "captured"
+	HoldStatusVoided   HoldStatus = "voided"
+	HoldStatusExpired  HoldStatus = "expired"
+)
+
+// Hold reserves part of an account balance. It lowers the available balance until it is captured, voided or expires,
+// but only a capture moves money.
+type Hold struct {
+	ID             string
+	AccountID      string
+	Currency       string
+	Amount         decimal.Decimal
+	CapturedAmount decimal.Decimal
+	Status         HoldStatus
+	CaptureTxnID   string
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+type HoldParams struct {
+	HoldID    string
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  string
+	ExpiresAt time.Time
+}
+
+// CaptureParams captures Amount of a hold, or all of it when Amount is zero. Whatever is not captured is released.
+// A capture counts toward the debit limits of the account like a withdrawal, but is not charged a fee.
+type CaptureParams struct {
+	TxnID  string
+	HoldID string
+	Amount decimal.Decimal
+}
+
+// HoldTTL is how long a hold lasts when the request does not say, configurable through HOLD_TTL.
+func HoldTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("HOLD_TTL"))
+	if err != nil || ttl <= 0 {
+		return DEFAULT_HOLD_TTL
+	}
+	return ttl
+}
+
+// ExpireHoldsPeriodically marks lapsed holds as expired every interval until ctx is done. Lapsed holds stop counting
+// against the available balance straight away; this only brings their status up to date.
+func ExpireHoldsPeriodically(ctx context.Context, logger *slog.Logger, store AccountStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := store.ExpireHolds(ctx, now)
+			if err != nil {
+				logger.Error(fmt.Sprintf("[ExpireHoldsPeriodically] unable to expire holds : %v", err))
+				continue
+			}
+			if expired > 0 {
+				logger.Info(fmt.Sprintf("[ExpireHoldsPeriodically] expired %d holds", expired))
+			}
+		}
+	}
+}
+
+// expire reports a lapsed active hold as expired, whether or not the expiry job has caught up with it.
+func (h *Hold) expire(now time.Time) {
+	if h.Status == HoldStatusActive && !h.ExpiresAt.After(now) {
+		h.Status = HoldStatusExpired
+	}
+}
+
+// capture settles the hold and returns the amount to post, checking it against what was held.
+func (h *Hold) capture(params *CaptureParams) (decimal.Decimal, error) {
+	if h.Status != HoldStatusActive {
+		return decimal.Zero, ErrHoldNotActive
+	}
+
+	amount := params.Amount
+	if amount.IsZero() {
+		amount = h.Amount
+	}
+	if amount.GreaterThan(h.Amount) {
+		return decimal.Zero, ErrCaptureExceedsHold
+	}
+
+	h.Status = HoldStatusCaptured
+	h.CapturedAmount = amount
+	h.CaptureTxnID = params.TxnID
+	return amount, nil
+}
+
+func captureEntry(hold *Hold, txnID string, amount decimal.Decimal) *JournalEntry {
+	return &JournalEntry{
+		ID:        uuid.NewString(),
+		TxnID:     txnID,
+		Operation: string(TxnTypeCapture),
+		Postings: []Posting{
+			{AccountID: hold.AccountID, Currency: hold.Currency, Amount: amount.Neg()},
+			{AccountID: SYSTEM_CASH_ACCOUNT, Currency: hold.Currency, Amount: amount},
+		},
+	}
+}
+
+func (p *Postgres) PlaceHold(ctx context.Context, params *HoldParams) (*Hold, error) {
+	var hold *Hold
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		hold, err = p.placeHold(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to place hold '%s' : %w", params.HoldID, err)
+	}
+
+	return hold, nil
+}
+
+// placeHold reserves the amount of the hold within tx.
+func (p *Postgres) placeHold(ctx context.Context, tx pgx.Tx, params *HoldParams) (*Hold, error) {
+	state, err := LockAccount(ctx, tx, params.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err = state.CanDebit(); err != nil {
+		return nil, err
+	}
+
+	spendable, found, err := LockSpendableBalance(ctx, tx, params.AccountID, params.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find balance of account '%s' : %v", params.AccountID, err)
+	}
+	if !found || spendable.LessThan(params.Amount) {
+		return nil, ErrInsufficientFunds
+	}
+
+	hold := &Hold{
+		ID:        params.HoldID,
+		AccountID: params.AccountID,
+		Currency:  params.Currency,
+		Amount:    params.Amount,
+		Status:    HoldStatusActive,
+		ExpiresAt: params.ExpiresAt,
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		INSERT_HOLD_QUERY,
+		pgx.NamedArgs{
+			"id":         hold.ID,
+			"account_id": hold.AccountID,
+			"currency":   hold.Currency,
+			"amount":     hold.Amount,
+			"expires_at": hold.ExpiresAt,
+		},
+	).Scan(&hold.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert hold '%s' : %v", hold.ID, err)
+	}
+
+	return hold, nil
+}
+
+func (p *Postgres) CaptureHold(ctx context.Context, params *CaptureParams) (*Hold, *TransactionRecord, error) {
+	var (
+		hold *Hold
+		txn  *TransactionRecord
+	)
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		hold, txn, err = p.captureHold(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to capture hold '%s' : %w", params.HoldID, err)
+	}
+
+	return hold, txn, nil
+}
+
+// captureHold posts the captured amount and records it within tx.
+func (p *Postgres) captureHold(ctx context.Context, tx pgx.Tx, params *CaptureParams) (*Hold, *TransactionRecord, error) {
+	hold, err := queryHold(ctx, tx, LOCK_HOLD_QUERY, params.HoldID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state, err := LockAccount(ctx, tx, hold.AccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = state.CanDebit(); err != nil {
+		return nil, nil, err
+	}
+
+	amount, err := hold.capture(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := captureEntry(hold, params.TxnID, amount)
+	if err = LockBalances(ctx, tx, entry.Postings); err != nil {
+		return nil, nil, err
+	}
+	reason, err := debitLimitFailure(ctx, tx, hold.AccountID, hold.Currency, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(reason) > 0 {
+		return nil, nil, reason.err()
+	}
+
+	if err = updateHold(ctx, tx, hold); err != nil {
+		return nil, nil, err
+	}
+
+	if err = PostJournalEntry(ctx, tx, entry); err != nil {
+		return nil, nil, err
+	}
+
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: hold.AccountID,
+		Amount:    amount,
+		Currency:  hold.Currency,
+		TxnType:   TxnTypeCapture,
+		Status:    utils.COMPLETED,
+		EntryID:   entry.ID,
+	}
+	if err = InsertTransaction(ctx, tx, txn); err != nil {
+		return nil, nil, err
+	}
+	if err = p.queueTransactionEvents(ctx, tx, txn); err != nil {
+		return nil, nil, err
+	}
+
+	return hold, txn, nil
+}
+
+func (p *Postgres) VoidHold(ctx context.Context, holdID string) (*Hold, error) {
+	var hold *Hold
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		hold, err = p.voidHold(ctx, tx, holdID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to void hold '%s' : %w", holdID, err)
+	}
+
+	return hold, nil
+}
+
+// voidHold releases the hold within tx.
+func (p *Postgres) voidHold(ctx context.Context, tx pgx.Tx, holdID string) (*Hold, error) {
+	hold, err := queryHold(ctx, tx, LOCK_HOLD_QUERY, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+
+	hold.Status = HoldStatusVoided
+	if err = updateHold(ctx, tx, hold); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (p *Postgres) GetHold(ctx context.Context, holdID string) (*Hold, error) {
+	return queryHold(ctx, p.Db, GET_HOLD_QUERY, holdID)
+}
+
+func (p *Postgres) ExpireHolds(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := p.Db.Exec(
+		ctx,
+		EXPIRE_HOLDS_QUERY,
+		pgx.NamedArgs{
+			"now": now,
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("unable to expire holds : %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// rowQuerier is satisfied by both the pool and a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func queryHold(ctx context.Context, q rowQuerier, query string, holdID string) (*Hold, error) {
+	hold := new(Hold)
+
+	err := q.QueryRow(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"id": holdID,
+		},
+	).Scan(&hold.ID, &hold.AccountID, &hold.Currency, &hold.Amount, &hold.CapturedAmount, &hold.Status,
+		&hold.CaptureTxnID, &hold.ExpiresAt, &hold.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query hold '%s' : %v", holdID, err)
+	}
+
+	hold.expire(time.Now())
+	return hold, nil
+}
+
+func updateHold(ctx context.Context, tx pgx.Tx, hold *Hold) error {
+	_, err := tx.Exec(
+		ctx,
+		UPDATE_HOLD_QUERY,
+		pgx.NamedArgs{
+			"id":              hold.ID,
+			"status":          hold.Status,
+			"captured_amount": hold.CapturedAmount,
+			"capture_txn_id":  hold.CaptureTxnID,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update hold '%s' : %v", hold.ID, err)
+	}
+	return nil
+}
+
+func (m *MemoryStore) PlaceHold(_ context.Context, params *HoldParams) (*Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.customerAccount(params.AccountID)
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if err := acc.state().CanDebit(); err != nil {
+		return nil, err
+	}
+
+	spendable, found := m.spendable(params.AccountID, params.Currency)
+	if !found || spendable.LessThan(params.Amount) {
+		return nil, ErrInsufficientFunds
+	}
+
+	if _, ok := m.holds[params.HoldID]; ok {
+		return nil, fmt.Errorf("unable to insert hold '%s' : it already exists", params.HoldID)
+	}
+
+	hold := &Hold{
+		ID:        params.HoldID,
+		AccountID: params.AccountID,
+		Currency:  params.Currency,
+		Amount:    params.Amount,
+		Status:    HoldStatusActive,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.holds[hold.ID] = hold
+
+	placed := *hold
+	return &placed, nil
+}
+
+func (m *MemoryStore) CaptureHold(_ context.Context, params *CaptureParams) (*Hold, *TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, err := m.hold(params.HoldID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.recordedTransaction(params.TxnID, TxnTypeCapture) != nil {
+		return nil, nil, fmt.Errorf("unable to record capture '%s' : it already exists", params.TxnID)
+	}
+
+	if err = m.accounts[hold.AccountID].state().CanDebit(); err != nil {
+		return nil, nil, err
+	}
+
+	captured := *hold
+	amount, err := captured.capture(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reason := m.debitLimitFailure(hold.AccountID, hold.Currency, amount); len(reason) > 0 {
+		return nil, nil, reason.err()
+	}
+
+	entry := captureEntry(&captured, params.TxnID, amount)
+	if err = m.postJournalEntry(entry); err != nil {
+		return nil, nil, err
+	}
+	*hold = captured
+
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: hold.AccountID,
+		Amount:    amount,
+		Currency:  hold.Currency,
+		TxnType:   TxnTypeCapture,
+		Status:    utils.COMPLETED,
+		EntryID:   entry.ID,
+	}
+	m.insertTransaction(txn)
+	m.queueTransactionEvents(txn)
+
+	return &captured, txn, nil
+}
+
+func (m *MemoryStore) VoidHold(_ context.Context, holdID string) (*Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, err := m.hold(holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+
+	hold.Status = HoldStatusVoided
+
+	voided := *hold
+	return &voided, nil
+}
+
+func (m *MemoryStore) GetHold(_ context.Context, holdID string) (*Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, err := m.hold(holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := *hold
+	return &found, nil
+}
+
+func (m *MemoryStore) ExpireHolds(_ context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired int64
+	for _, hold := range m.holds {
+		if hold.Status == HoldStatusActive && !hold.ExpiresAt.After(now) {
+			hold.Status = HoldStatusExpired
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (m *MemoryStore) hold(holdID string) (*Hold, error) {
+	hold, ok := m.holds[holdID]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+	hold.expire(time.Now())
+	return hold, nil
+}
+
+// available is the balance left after active holds.
+func (m *MemoryStore) available(accountID string, currency string) (decimal.Decimal, bool) {
+	balance, found := m.balance(accountID, currency)
+	if !found {
+		return decimal.Zero, false
+	}
+
+	now := time.Now()
+	for _, hold := range m.holds {
+		if hold.AccountID == accountID && hold.Currency == currency &&
+			hold.Status == HoldStatusActive && hold.ExpiresAt.After(now) {
+			balance = balance.Sub(hold.Amount)
+		}
+	}
+	return balance, true
+}
+
+// spendable is the amount that may be debited: the balance left after active holds, plus the credit limit.
+func (m *MemoryStore) spendable(accountID string, currency string) (decimal.Decimal, bool) {
+	available, found := m.available(accountID, currency)
+	if !found {
+		return decimal.Zero, false
+	}
+	return available.Add(m.accounts[accountID].creditLimits[currency]), true
+}
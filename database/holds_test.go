@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// TestCaptureCountsTowardDebitLimits captures holds on an account with a daily limit. A capture that would break the
+// limit is refused and leaves its hold active, and what was captured counts toward the limit of later withdrawals.
+func TestCaptureCountsTowardDebitLimits(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := fundedAccounts(t, store, 1, decimal.NewFromInt(100))[0]
+
+			limits := &AccountLimits{AccountID: accountID, Currency: "USD"}
+			limits.DailyAmount = decimal.NewNullDecimal(decimal.NewFromInt(50))
+			if _, err := store.SetLimits(ctx, limits); err != nil {
+				t.Fatalf("SetLimits() error = %v", err)
+			}
+
+			capture := func(amount int64) (*Hold, error) {
+				hold, err := store.PlaceHold(ctx, &HoldParams{
+					HoldID:    uuid.NewString(),
+					AccountID: accountID,
+					Amount:    decimal.NewFromInt(amount),
+					Currency:  "USD",
+					ExpiresAt: time.Now().Add(time.Hour),
+				})
+				if err != nil {
+					t.Fatalf("PlaceHold() error = %v", err)
+				}
+				_, _, err = store.CaptureHold(ctx, &CaptureParams{TxnID: uuid.NewString(), HoldID: hold.ID})
+				return hold, err
+			}
+
+			if _, err := capture(40); err != nil {
+				t.Fatalf("CaptureHold() within the limit error = %v", err)
+			}
+
+			refused, err := capture(20)
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("CaptureHold() over the limit error = %v, want %v", err, ErrLimitExceeded)
+			}
+			if hold, err := store.GetHold(ctx, refused.ID); err != nil || hold.Status != HoldStatusActive {
+				t.Errorf("refused hold = %+v, %v, want it still active", hold, err)
+			}
+
+			txn, err := store.Withdraw(ctx, &WithdrawParams{
+				TxnID:     uuid.NewString(),
+				AccountID: accountID,
+				Amount:    decimal.NewFromInt(20),
+				Currency:  "USD",
+			})
+			if err != nil || txn.FailureReason != FailureDailyAmountLimit {
+				t.Errorf("Withdraw() after the capture = %+v, %v, want it refused with %s", txn, err, FailureDailyAmountLimit)
+			}
+
+			if balance := balanceOf(t, store, accountID); !balance.Equal(decimal.NewFromInt(60)) {
+				t.Errorf("balance = %s, want 60", balance)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/idempotency"
+)
+
+func (p *Postgres) GetRecord(ctx context.Context, key idempotency.RecordKey) (*idempotency.Record, error) {
+	record := &idempotency.Record{
+		RecordKey: key,
+	}
+
+	err := p.Db.QueryRow(
+		ctx,
+		GET_IDEMPOTENCY_RECORD_QUERY,
+		pgx.NamedArgs{
+			"idempotency_key": key.Key,
+			"operation":       key.Operation,
+			"caller":          key.Caller,
+		},
+	).Scan(&record.RequestHash, &record.StatusCode, &record.Body, &record.CreatedAt, &record.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, idempotency.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query idempotency record '%s' : %v", key.Key, err)
+	}
+
+	return record, nil
+}
+
+func (p *Postgres) SaveRecord(ctx context.Context, record *idempotency.Record) error {
+	_, err := p.Db.Exec(
+		ctx,
+		SAVE_IDEMPOTENCY_RECORD_QUERY,
+		pgx.NamedArgs{
+			"idempotency_key": record.Key,
+			"operation":       record.Operation,
+			"caller":          record.Caller,
+			"request_hash":    record.RequestHash,
+			"status_code":     record.StatusCode,
+			"response_body":   record.Body,
+			"expires_at":      record.ExpiresAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to save idempotency record '%s' : %v", record.Key, err)
+	}
+	return nil
+}
+
+func (p *Postgres) PurgeRecords(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.Db.Exec(
+		ctx,
+		PURGE_IDEMPOTENCY_RECORDS_QUERY,
+		pgx.NamedArgs{
+			"before": before,
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge idempotency records : %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (m *MemoryStore) GetRecord(_ context.Context, key idempotency.RecordKey) (*idempotency.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, idempotency.ErrRecordNotFound
+	}
+
+	found := *record
+	return &found, nil
+}
+
+func (m *MemoryStore) SaveRecord(_ context.Context, record *idempotency.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.records[record.RecordKey]; ok && existing.ExpiresAt.After(now) {
+		return nil
+	}
+
+	saved := *record
+	saved.Body = append([]byte(nil), record.Body...)
+	saved.CreatedAt = now
+	m.records[record.RecordKey] = &saved
+	return nil
+}
+
+func (m *MemoryStore) PurgeRecords(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for key, record := range m.records {
+		if !record.ExpiresAt.After(before) {
+			delete(m.records, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Postgres struct {
-	Db *pgx.Conn
+	Db *pgxpool.Pool
+
+	events WebhookEvents
 }
 
 var (
@@ -31,18 +36,33 @@ func ConnectDb(ctx context.Context) *Postgres {
 	)
 
 	pgOnce.Do(func() {
-		db, err := pgx.Connect(ctx, dataSource)
+		config, err := pgxpool.ParseConfig(dataSource)
 		if err != nil {
-			panic("unable to connect to database : " + err.Error())
+			panic("unable to parse database config : " + err.Error())
+		}
+
+		configurePool(config)
+
+		// Custom types are registered on every connection the pool opens, not just the first one.
+		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			t, err := conn.LoadType(ctx, "txntype")
+			if err != nil {
+				return fmt.Errorf("unable to load database table type : %v", err)
+			}
+			conn.TypeMap().RegisterType(t)
+
+			pgxdecimal.Register(conn.TypeMap())
+			return nil
 		}
 
-		t, err := db.LoadType(ctx, "txntype")
+		db, err := pgxpool.NewWithConfig(ctx, config)
 		if err != nil {
-			panic("unable to load database table type : " + err.Error())
+			panic("unable to connect to database : " + err.Error())
 		}
-		db.TypeMap().RegisterType(t)
 
-		pgxdecimal.Register(db.TypeMap())
+		if err = db.Ping(ctx); err != nil {
+			panic("unable to reach database : " + err.Error())
+		}
 
 		pgInstance = &Postgres{
 			Db: db,
@@ -51,10 +71,31 @@ func ConnectDb(ctx context.Context) *Postgres {
 	return pgInstance
 }
 
-func (p *Postgres) CloseDbConnection(ctx context.Context, logger *slog.Logger) {
-	err := p.Db.Close(ctx)
-	if err != nil {
-		logger.Error("unable to close database connection : " + err.Error())
-		os.Exit(1)
+// configurePool applies the optional POSTGRES_POOL_* settings on top of the pgxpool defaults.
+func configurePool(config *pgxpool.Config) {
+	if maxConns, err := strconv.ParseInt(os.Getenv("POSTGRES_POOL_MAX_CONNS"), 10, 32); err == nil && maxConns > 0 {
+		config.MaxConns = int32(maxConns)
 	}
+	if minConns, err := strconv.ParseInt(os.Getenv("POSTGRES_POOL_MIN_CONNS"), 10, 32); err == nil && minConns >= 0 {
+		config.MinConns = int32(minConns)
+	}
+	if idleTime, err := time.ParseDuration(os.Getenv("POSTGRES_POOL_MAX_CONN_IDLE_TIME")); err == nil && idleTime > 0 {
+		config.MaxConnIdleTime = idleTime
+	}
+	if lifetime, err := time.ParseDuration(os.Getenv("POSTGRES_POOL_MAX_CONN_LIFETIME")); err == nil && lifetime > 0 {
+		config.MaxConnLifetime = lifetime
+	}
+	if period, err := time.ParseDuration(os.Getenv("POSTGRES_POOL_HEALTH_CHECK_PERIOD")); err == nil && period > 0 {
+		config.HealthCheckPeriod = period
+	}
+}
+
+// Ping checks that a pooled connection can reach the database.
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.Db.Ping(ctx)
+}
+
+func (p *Postgres) CloseDbConnection(_ context.Context, logger *slog.Logger) {
+	p.Db.Close()
+	logger.Info("closed database connection pool")
 }
@@ -0,0 +1,454 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/interest"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// SavingsBalance is a balance of a savings account. LastAccrued is the last day it accrued interest for, zero when
+// it never has.
+type SavingsBalance struct {
+	AccountID   string
+	Currency    string
+	LastAccrued time.Time
+}
+
+// AccrualParams accrue the interest a savings balance earned on the UTC day of Day, at the rate Rates give its
+// closing balance.
+type AccrualParams struct {
+	AccountID string
+	Currency  string
+	Day       time.Time
+	Rates     *interest.Schedule
+}
+
+// InterestAccrual is the interest a balance earned on one day. It is kept unrounded until it is posted, and TxnID is
+// the transaction that paid it, empty until then. A Carried accrual is what a payment left unpaid when it rounded
+// down, dated the last day that payment covered; it has no balance or rate.
+type InterestAccrual struct {
+	AccountID  string
+	Currency   string
+	Day        time.Time
+	Balance    decimal.Decimal
+	AnnualRate decimal.Decimal
+	Amount     decimal.Decimal
+	TxnID      string
+	Carried    bool
+}
+
+// InterestPostingParams pay a balance the interest it accrued on the days before Before. The transaction ID
+// identifies the balance and the month of the payment, so that interest is paid at most once a month.
+type InterestPostingParams struct {
+	TxnID     string
+	AccountID string
+	Currency  string
+	Before    time.Time
+}
+
+func (d *DepositParams) txnType() TxnType {
+	if len(d.TxnType) == 0 {
+		return TxnTypeDeposit
+	}
+	return d.TxnType
+}
+
+// source is the system account funding a credit: interest is an expense, and anything else comes in as cash.
+func (d *DepositParams) source() string {
+	if d.txnType() == TxnTypeInterest {
+		return SYSTEM_INTEREST_ACCOUNT
+	}
+	return SYSTEM_CASH_ACCOUNT
+}
+
+// InterestPostingID is the transaction ID of the interest paid to a balance in the UTC month of t.
+func InterestPostingID(accountID string, currency string, t time.Time) string {
+	month := t.UTC().Format("2006-01")
+	return uuid.NewSHA1(uuid.MustParse(accountID), []byte("interest."+currency+"."+month)).String()
+}
+
+// newInterestAccrual prices a day of interest on the balance a savings account closed the day with.
+func newInterestAccrual(params *AccrualParams, balance decimal.Decimal) *InterestAccrual {
+	rate := params.Rates.AnnualRate(params.Currency, balance, params.Day)
+	return &InterestAccrual{
+		AccountID:  params.AccountID,
+		Currency:   params.Currency,
+		Day:        interest.Day(params.Day),
+		Balance:    balance,
+		AnnualRate: rate,
+		Amount:     interest.Daily(balance, rate),
+	}
+}
+
+// interestPayment is the accrued interest rounded down to the currency, so that no more is paid than was accrued.
+func interestPayment(accrued decimal.Decimal, currency string) decimal.Decimal {
+	scale, _ := utils.CurrencyScale(currency)
+	return accrued.RoundFloor(scale)
+}
+
+// interestRemainder is what paying amount leaves of the accrued interest, carried into the next payment.
+func interestRemainder(params *InterestPostingParams, accrued decimal.Decimal, amount decimal.Decimal) *InterestAccrual {
+	return &InterestAccrual{
+		AccountID: params.AccountID,
+		Currency:  params.Currency,
+		Day:       interest.Day(params.Before).AddDate(0, 0, -1),
+		Amount:    accrued.Sub(amount),
+		Carried:   true,
+	}
+}
+
+// AccrueInterestPeriodically accrues interest on every savings balance every interval until ctx is done, and pays
+// out what was accrued before the current UTC month. Each balance accrues every day since the last it accrued for,
+// up to the day before, so that days missed while the service was down are caught up; a balance that never accrued
+// starts with the day before. Days already accrued and months already paid are skipped.
+func AccrueInterestPeriodically(ctx context.Context, logger *slog.Logger, store AccountStore, rates *interest.Schedule, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			accrueInterest(ctx, logger, store, rates, now)
+		}
+	}
+}
+
+func accrueInterest(ctx context.Context, logger *slog.Logger, store AccountStore, rates *interest.Schedule, now time.Time) {
+	balances, err := store.ListSavingsBalances(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[AccrueInterestPeriodically] unable to find savings balances : %v", err))
+		return
+	}
+
+	today := interest.Day(now)
+	yesterday := today.AddDate(0, 0, -1)
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for _, balance := range balances {
+		day := yesterday
+		if !balance.LastAccrued.IsZero() {
+			day = interest.Day(balance.LastAccrued).AddDate(0, 0, 1)
+		}
+
+		for ; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+			_, err = store.AccrueInterest(ctx, &AccrualParams{
+				AccountID: balance.AccountID,
+				Currency:  balance.Currency,
+				Day:       day,
+				Rates:     rates,
+			})
+			if err != nil {
+				logger.Error(fmt.Sprintf("[AccrueInterestPeriodically] unable to accrue %s interest of account '%s' for %s : %v", balance.Currency, balance.AccountID, day.Format(time.DateOnly), err))
+				break
+			}
+		}
+
+		txn, err := store.PostInterest(ctx, &InterestPostingParams{
+			TxnID:     InterestPostingID(balance.AccountID, balance.Currency, month),
+			AccountID: balance.AccountID,
+			Currency:  balance.Currency,
+			Before:    month,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("[AccrueInterestPeriodically] unable to pay %s interest of account '%s' : %v", balance.Currency, balance.AccountID, err))
+			continue
+		}
+		if txn != nil {
+			logger.Info(fmt.Sprintf("[AccrueInterestPeriodically] interest '%s %s' to account '%s' is %s", txn.Amount, txn.Currency, txn.AccountID, txn.Status))
+		}
+	}
+}
+
+func (p *Postgres) ListSavingsBalances(ctx context.Context) ([]SavingsBalance, error) {
+	rows, err := p.Db.Query(ctx, GET_SAVINGS_BALANCES_QUERY)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query savings balances : %w", err)
+	}
+	defer rows.Close()
+
+	balances := make([]SavingsBalance, 0)
+	for rows.Next() {
+		var (
+			balance     SavingsBalance
+			lastAccrued *time.Time
+		)
+		if err = rows.Scan(&balance.AccountID, &balance.Currency, &lastAccrued); err != nil {
+			return nil, fmt.Errorf("unable to parse savings balance : %w", err)
+		}
+		if lastAccrued != nil {
+			balance.LastAccrued = *lastAccrued
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// AccrueInterest records the interest the balance earned on the day. Postings are never changed once made, so the
+// closing balance of a past day is read as it was left by the last posting of the day. It returns no accrual when
+// the day was already accrued.
+func (p *Postgres) AccrueInterest(ctx context.Context, params *AccrualParams) (*InterestAccrual, error) {
+	day := interest.Day(params.Day)
+
+	var balance decimal.Decimal
+	err := p.Db.QueryRow(
+		ctx,
+		BALANCE_AT_QUERY,
+		pgx.NamedArgs{
+			"account_id": params.AccountID,
+			"currency":   params.Currency,
+			"until":      day.AddDate(0, 0, 1),
+		},
+	).Scan(&balance)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find balance of account '%s' : %w", params.AccountID, err)
+	}
+
+	accrual := newInterestAccrual(params, balance)
+	tag, err := p.Db.Exec(
+		ctx,
+		INSERT_INTEREST_ACCRUAL_QUERY,
+		pgx.NamedArgs{
+			"account_id":   accrual.AccountID,
+			"currency":     accrual.Currency,
+			"accrual_date": accrual.Day,
+			"balance":      accrual.Balance,
+			"annual_rate":  accrual.AnnualRate,
+			"amount":       accrual.Amount,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert interest accrual of account '%s' : %w", params.AccountID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, nil
+	}
+
+	return accrual, nil
+}
+
+// PostInterest pays the balance the interest it accrued before params.Before, credited as a deposit would be but
+// from the interest account and recorded as interest. The interest is rounded down, and what that leaves is carried
+// into the next month's payment. It returns no transaction when the month was already paid or the interest rounds to
+// nothing, which leaves it to add up with the next month's. Interest that cannot be credited stays accrued and is paid
+// with the next month's.
+func (p *Postgres) PostInterest(ctx context.Context, params *InterestPostingParams) (*TransactionRecord, error) {
+	var txn *TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		txn, err = p.postInterest(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pay interest '%s' : %w", params.TxnID, err)
+	}
+
+	return txn, nil
+}
+
+// postInterest pays the interest and records it within tx. The unpaid accruals are locked before the payment is
+// looked for, so a concurrent payment of them has either committed and is found, or waits for this one.
+func (p *Postgres) postInterest(ctx context.Context, tx pgx.Tx, params *InterestPostingParams) (*TransactionRecord, error) {
+	args := pgx.NamedArgs{
+		"id":         params.TxnID,
+		"account_id": params.AccountID,
+		"currency":   params.Currency,
+		"before":     params.Before,
+	}
+
+	accruals, err := lockUnpostedInterest(ctx, tx, args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find interest accrued by account '%s' : %w", params.AccountID, err)
+	}
+
+	var posted bool
+	if err = tx.QueryRow(ctx, INTEREST_POSTED_QUERY, args).Scan(&posted); err != nil {
+		return nil, fmt.Errorf("unable to find interest payment '%s' : %w", params.TxnID, err)
+	}
+	if posted {
+		return nil, nil
+	}
+
+	accrued := decimal.Zero
+	days := make([]time.Time, 0, len(accruals))
+	carried := make([]bool, 0, len(accruals))
+	for _, accrual := range accruals {
+		accrued = accrued.Add(accrual.Amount)
+		days = append(days, accrual.Day)
+		carried = append(carried, accrual.Carried)
+	}
+
+	amount := interestPayment(accrued, params.Currency)
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	txn, err := p.deposit(ctx, tx, &DepositParams{
+		TxnID:     params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    amount,
+		Currency:  params.Currency,
+		TxnType:   TxnTypeInterest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if txn.Status == utils.COMPLETED {
+		args["accrual_dates"] = days
+		args["carried"] = carried
+		if _, err = tx.Exec(ctx, POST_INTEREST_ACCRUALS_QUERY, args); err != nil {
+			return nil, fmt.Errorf("unable to mark interest of account '%s' as paid : %w", params.AccountID, err)
+		}
+		if err = carryInterest(ctx, tx, interestRemainder(params, accrued, amount)); err != nil {
+			return nil, err
+		}
+	}
+
+	return txn, nil
+}
+
+// lockUnpostedInterest locks the unpaid accruals args selects within tx.
+func lockUnpostedInterest(ctx context.Context, tx pgx.Tx, args pgx.NamedArgs) ([]InterestAccrual, error) {
+	rows, err := tx.Query(ctx, LOCK_UNPOSTED_INTEREST_QUERY, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accruals := make([]InterestAccrual, 0)
+	for rows.Next() {
+		var accrual InterestAccrual
+		if err = rows.Scan(&accrual.Day, &accrual.Carried, &accrual.Amount); err != nil {
+			return nil, err
+		}
+		accruals = append(accruals, accrual)
+	}
+	return accruals, rows.Err()
+}
+
+// carryInterest records the remainder of a payment within tx, unless the payment left none.
+func carryInterest(ctx context.Context, tx pgx.Tx, remainder *InterestAccrual) error {
+	if !remainder.Amount.IsPositive() {
+		return nil
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		CARRY_INTEREST_QUERY,
+		pgx.NamedArgs{
+			"account_id":   remainder.AccountID,
+			"currency":     remainder.Currency,
+			"accrual_date": remainder.Day,
+			"amount":       remainder.Amount,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to carry interest of account '%s' : %w", remainder.AccountID, err)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListSavingsBalances(_ context.Context) ([]SavingsBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balances := make([]SavingsBalance, 0)
+	for accountID, acc := range m.accounts {
+		if acc.isSystem || acc.details.Type != AccountTypeSavings || acc.status == AccountStatusClosed {
+			continue
+		}
+		for currency := range acc.balances {
+			balance := SavingsBalance{AccountID: accountID, Currency: currency}
+			for _, accrual := range m.accruals {
+				if accrual.AccountID == accountID && accrual.Currency == currency && !accrual.Carried && accrual.Day.After(balance.LastAccrued) {
+					balance.LastAccrued = accrual.Day
+				}
+			}
+			balances = append(balances, balance)
+		}
+	}
+	return balances, nil
+}
+
+func (m *MemoryStore) AccrueInterest(_ context.Context, params *AccrualParams) (*InterestAccrual, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := interest.Day(params.Day)
+	for _, accrual := range m.accruals {
+		if accrual.AccountID == params.AccountID && accrual.Currency == params.Currency && !accrual.Carried && accrual.Day.Equal(day) {
+			return nil, nil
+		}
+	}
+
+	until := day.AddDate(0, 0, 1)
+	balance := decimal.Zero
+	for i := len(m.postings) - 1; i >= 0; i-- {
+		posting := m.postings[i]
+		if posting.accountID == params.AccountID && posting.record.Currency == params.Currency && posting.record.Timestamp.Before(until) {
+			balance = posting.record.BalanceAfter
+			break
+		}
+	}
+
+	accrual := newInterestAccrual(params, balance)
+	m.accruals = append(m.accruals, *accrual)
+	return accrual, nil
+}
+
+func (m *MemoryStore) PostInterest(_ context.Context, params *InterestPostingParams) (*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.transactions {
+		if existing.ID == params.TxnID && existing.TxnType == TxnTypeInterest {
+			return nil, nil
+		}
+	}
+
+	accrued := decimal.Zero
+	unposted := make([]int, 0)
+	for i, accrual := range m.accruals {
+		if accrual.AccountID == params.AccountID && accrual.Currency == params.Currency && len(accrual.TxnID) == 0 && accrual.Day.Before(params.Before) {
+			accrued = accrued.Add(accrual.Amount)
+			unposted = append(unposted, i)
+		}
+	}
+
+	amount := interestPayment(accrued, params.Currency)
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	txn, err := m.deposit(&DepositParams{
+		TxnID:     params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    amount,
+		Currency:  params.Currency,
+		TxnType:   TxnTypeInterest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if txn.Status == utils.COMPLETED {
+		for _, i := range unposted {
+			m.accruals[i].TxnID = params.TxnID
+		}
+		if remainder := interestRemainder(params, accrued, amount); remainder.Amount.IsPositive() {
+			m.accruals = append(m.accruals, *remainder)
+		}
+	}
+	return txn, nil
+}
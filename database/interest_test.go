@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/interest"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TestInterestRemainderIsCarried pays interest that does not round to the cent twice. Each payment must round down,
+// and what the first leaves must be paid with the second.
+func TestInterestRemainderIsCarried(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`[{"currency":"USD","effective_from":"2025-01-01","rate":"0.05"}]`), 0o600); err != nil {
+		t.Fatalf("writing rates : %v", err)
+	}
+	rates, err := interest.NewSchedule(path)
+	if err != nil {
+		t.Fatalf("NewSchedule() error = %v", err)
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			accounts, err := store.CreateAccounts(ctx, []*AccountParams{{Type: AccountTypeSavings}})
+			if err != nil {
+				t.Fatalf("CreateAccounts() error = %v", err)
+			}
+			accountID := accounts[0].ID
+			txn, err := store.Deposit(ctx, &DepositParams{TxnID: uuid.NewString(), AccountID: accountID, Amount: decimal.NewFromInt(1000), Currency: "USD"})
+			if err != nil || txn.Status != utils.COMPLETED {
+				t.Fatalf("Deposit() = %+v, %v", txn, err)
+			}
+
+			// Days after the deposit, so that each closes on the balance it left.
+			day := interest.Day(txn.Timestamp).AddDate(0, 0, 1)
+
+			// Four days on 1000 accrue 0.5479452056, paid as 0.54 rather than 0.55. Four days on 1000.54 accrue
+			// 0.5482410960, which with the 0.0079452056 carried is paid as 0.55 rather than 0.54.
+			for _, want := range []string{"0.54", "0.55"} {
+				for range 4 {
+					if _, err = store.AccrueInterest(ctx, &AccrualParams{AccountID: accountID, Currency: "USD", Day: day, Rates: rates}); err != nil {
+						t.Fatalf("AccrueInterest(%s) error = %v", day, err)
+					}
+					day = day.AddDate(0, 0, 1)
+				}
+
+				paid, err := store.PostInterest(ctx, &InterestPostingParams{TxnID: uuid.NewString(), AccountID: accountID, Currency: "USD", Before: day})
+				if err != nil || paid == nil {
+					t.Fatalf("PostInterest() = %+v, %v", paid, err)
+				}
+				if !paid.Amount.Equal(decimal.RequireFromString(want)) {
+					t.Errorf("PostInterest() paid %s, want %s", paid.Amount, want)
+				}
+			}
+
+			if balance := balanceOf(t, store, accountID); !balance.Equal(decimal.RequireFromString("1001.09")) {
+				t.Errorf("balance = %s, want 1001.09", balance)
+			}
+
+			balances, err := store.ListSavingsBalances(ctx)
+			if err != nil {
+				t.Fatalf("ListSavingsBalances() error = %v", err)
+			}
+			for _, balance := range balances {
+				if balance.AccountID == accountID && !balance.LastAccrued.Equal(day.AddDate(0, 0, -1)) {
+					t.Errorf("last accrued %s, want %s", balance.LastAccrued, day.AddDate(0, 0, -1))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// SYSTEM_CASH_ACCOUNT is the settlement account that deposits are funded from and withdrawals are paid out to.
+	SYSTEM_CASH_ACCOUNT = "00000000-0000-0000-0000-000000000001"
+	// SYSTEM_FX_ACCOUNT is the position account that sits between the two currency legs of a converted transfer.
+	SYSTEM_FX_ACCOUNT = "00000000-0000-0000-0000-000000000002"
+	// SYSTEM_REVENUE_ACCOUNT is the income account that charges to customers are credited to.
+	SYSTEM_REVENUE_ACCOUNT = "00000000-0000-0000-0000-000000000003"
+	// SYSTEM_INTEREST_ACCOUNT is the expense account that interest paid to customers is debited from.
+	SYSTEM_INTEREST_ACCOUNT = "00000000-0000-0000-0000-000000000004"
+)
+
+var ErrUnbalancedEntry = errors.New("journal entry does not balance")
+
+// Posting is one line of a journal entry. A positive amount credits the account and a negative amount debits it.
+type Posting struct {
+	AccountID string
+	Currency  string
+	Amount    decimal.Decimal
+}
+
+type JournalEntry struct {
+	ID        string
+	TxnID     string
+	Operation string
+	Postings  []Posting
+}
+
+func IsSystemAccount(accountID string) bool {
+	return accountID == SYSTEM_CASH_ACCOUNT || accountID == SYSTEM_FX_ACCOUNT || accountID == SYSTEM_REVENUE_ACCOUNT ||
+		accountID == SYSTEM_INTEREST_ACCOUNT
+}
+
+// Validate checks that the entry has at least two non-zero postings which sum to zero in every currency.
+func (e *JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w : entry '%s' has %d postings", ErrUnbalancedEntry, e.ID, len(e.Postings))
+	}
+
+	sums := make(map[string]decimal.Decimal)
+	for _, posting := range e.Postings {
+		if posting.Amount.IsZero() {
+			return fmt.Errorf("%w : entry '%s' has a zero posting for account '%s'", ErrUnbalancedEntry, e.ID, posting.AccountID)
+		}
+		sums[posting.Currency] = sums[posting.Currency].Add(posting.Amount)
+	}
+
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w : entry '%s' is off by %s %s", ErrUnbalancedEntry, e.ID, sum, currency)
+		}
+	}
+
+	return nil
+}
+
+// PostJournalEntry writes the entry and its postings, moving each balance in step with its posting.
+// Balances are updated in account order so that concurrent entries lock rows in the same sequence.
+func PostJournalEntry(ctx context.Context, tx pgx.Tx, entry *JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		INSERT_JOURNAL_ENTRY_QUERY,
+		pgx.NamedArgs{
+			"id":        entry.ID,
+			"txn_id":    entry.TxnID,
+			"operation": entry.Operation,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to insert journal entry '%s' : %w", entry.ID, err)
+	}
+
+	postings := make([]Posting, len(entry.Postings))
+	copy(postings, entry.Postings)
+	sort.SliceStable(postings, func(i, j int) bool {
+		if postings[i].AccountID != postings[j].AccountID {
+			return postings[i].AccountID < postings[j].AccountID
+		}
+		return postings[i].Currency < postings[j].Currency
+	})
+
+	for _, posting := range postings {
+		_, err = tx.Exec(
+			ctx,
+			INSERT_POSTING_QUERY,
+			pgx.NamedArgs{
+				"entry_id":   entry.ID,
+				"account_id": posting.AccountID,
+				"currency":   posting.Currency,
+				"amount":     posting.Amount,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to post '%s %s' to account '%s' for entry '%s' : %w", posting.Amount, posting.Currency, posting.AccountID, entry.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// LockSpendableBalance returns what may be debited from the balance of an account in a currency: the balance less
+// its active holds, plus its credit limit. It holds a row lock on the balance until the transaction ends.
+func LockSpendableBalance(ctx context.Context, tx pgx.Tx, accountID string, currency string) (decimal.Decimal, bool, error) {
+	var balance decimal.Decimal
+
+	err := tx.QueryRow(
+		ctx,
+		LOCK_SPENDABLE_BALANCE_QUERY,
+		pgx.NamedArgs{
+			"account_id": accountID,
+			"currency":   currency,
+		},
+	).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return decimal.Zero, false, nil
+	}
+	if err != nil {
+		return decimal.Zero, false, err
+	}
+
+	return balance, true, nil
+}
+
+// LockBalances locks the existing balances the postings touch, in account and currency order. Taking every lock a
+// transaction needs up front and in one order keeps transactions that touch the same balances from deadlocking.
+func LockBalances(ctx context.Context, tx pgx.Tx, postings []Posting) error {
+	accountIDs := make([]string, 0, len(postings))
+	currencies := make([]string, 0, len(postings))
+	for _, posting := range postings {
+		accountIDs = append(accountIDs, posting.AccountID)
+		currencies = append(currencies, posting.Currency)
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		LOCK_BALANCES_QUERY,
+		pgx.NamedArgs{
+			"account_ids": accountIDs,
+			"currencies":  currencies,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to lock balances : %w", err)
+	}
+	return nil
+}
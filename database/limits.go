@@ -0,0 +1,387 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	LIMIT_DAILY_WINDOW   = 24 * time.Hour
+	LIMIT_MONTHLY_WINDOW = 30 * 24 * time.Hour
+)
+
+const (
+	FailureSingleAmountLimit  FailureReason = "limit_single_amount"
+	FailureDailyAmountLimit   FailureReason = "limit_daily_amount"
+	FailureMonthlyAmountLimit FailureReason = "limit_monthly_amount"
+	FailureDailyCountLimit    FailureReason = "limit_daily_count"
+	FailureMonthlyCountLimit  FailureReason = "limit_monthly_count"
+	FailureMaxBalanceLimit    FailureReason = "limit_max_balance"
+)
+
+// IsLimit reports whether the transaction failed because it would have broken a limit of an account.
+func (r FailureReason) IsLimit() bool {
+	return strings.HasPrefix(string(r), "limit_")
+}
+
+// Limits caps what an account may do in one currency. Outgoing amounts and counts cover the completed withdrawals
+// and transfers out of the account over a rolling day or month; MaxBalance caps the balance any credit may leave.
+// An unset limit does not apply.
+type Limits struct {
+	MaxSingleAmount decimal.NullDecimal
+	DailyAmount     decimal.NullDecimal
+	MonthlyAmount   decimal.NullDecimal
+	DailyCount      *int
+	MonthlyCount    *int
+	MaxBalance      decimal.NullDecimal
+}
+
+// AccountLimits are the limits set for one account, or for every account of a type, in one currency.
+type AccountLimits struct {
+	AccountID   string
+	AccountType AccountType
+	Currency    string
+	Limits
+	UpdatedAt time.Time
+}
+
+// LimitScope names the accounts limits are set for: one account, or every account of a type.
+type LimitScope struct {
+	AccountID   string
+	AccountType AccountType
+}
+
+// outgoingUsage is what an account has sent in one currency over each window.
+type outgoingUsage struct {
+	daily        decimal.Decimal
+	monthly      decimal.Decimal
+	dailyCount   int
+	monthlyCount int
+}
+
+func (l *Limits) IsEmpty() bool {
+	return !l.MaxSingleAmount.Valid && !l.DailyAmount.Valid && !l.MonthlyAmount.Valid && l.DailyCount == nil &&
+		l.MonthlyCount == nil && !l.MaxBalance.Valid
+}
+
+func (l *Limits) limitsDebits() bool {
+	return l.MaxSingleAmount.Valid || l.DailyAmount.Valid || l.MonthlyAmount.Valid || l.DailyCount != nil || l.MonthlyCount != nil
+}
+
+// Or fills the limits that are not set with those of fallback, as the limits of an account fall back to those of
+// its type.
+func (l Limits) Or(fallback Limits) Limits {
+	orDecimal := func(limit, fallback decimal.NullDecimal) decimal.NullDecimal {
+		if limit.Valid {
+			return limit
+		}
+		return fallback
+	}
+	orCount := func(limit, fallback *int) *int {
+		if limit != nil {
+			return limit
+		}
+		return fallback
+	}
+
+	return Limits{
+		MaxSingleAmount: orDecimal(l.MaxSingleAmount, fallback.MaxSingleAmount),
+		DailyAmount:     orDecimal(l.DailyAmount, fallback.DailyAmount),
+		MonthlyAmount:   orDecimal(l.MonthlyAmount, fallback.MonthlyAmount),
+		DailyCount:      orCount(l.DailyCount, fallback.DailyCount),
+		MonthlyCount:    orCount(l.MonthlyCount, fallback.MonthlyCount),
+		MaxBalance:      orDecimal(l.MaxBalance, fallback.MaxBalance),
+	}
+}
+
+// checkDebit is the limit a debit of amount breaks given what the account already sent, if any.
+func (l *Limits) checkDebit(amount decimal.Decimal, usage *outgoingUsage) FailureReason {
+	exceeds := func(limit decimal.NullDecimal, total decimal.Decimal) bool {
+		return limit.Valid && total.GreaterThan(limit.Decimal)
+	}
+
+	switch {
+	case exceeds(l.MaxSingleAmount, amount):
+		return FailureSingleAmountLimit
+	case exceeds(l.DailyAmount, usage.daily.Add(amount)):
+		return FailureDailyAmountLimit
+	case exceeds(l.MonthlyAmount, usage.monthly.Add(amount)):
+		return FailureMonthlyAmountLimit
+	case l.DailyCount != nil && usage.dailyCount >= *l.DailyCount:
+		return FailureDailyCountLimit
+	case l.MonthlyCount != nil && usage.monthlyCount >= *l.MonthlyCount:
+		return FailureMonthlyCountLimit
+	}
+	return ""
+}
+
+// checkCredit is the limit a credit leaving balance breaks, if any.
+func (l *Limits) checkCredit(balance decimal.Decimal) FailureReason {
+	if l.MaxBalance.Valid && balance.GreaterThan(l.MaxBalance.Decimal) {
+		return FailureMaxBalanceLimit
+	}
+	return ""
+}
+
+func (s *LimitScope) matches(limits *AccountLimits) bool {
+	return limits.AccountID == s.AccountID && limits.AccountType == s.AccountType
+}
+
+// debitLimitFailure checks a debit of amount, including any fee charged with it, against the limits of the account
+// within tx. The caller holds the lock on the
+// balance being debited, which every debit of it takes, so what the account sent cannot change before the debit is
+// recorded.
+func debitLimitFailure(ctx context.Context, tx pgx.Tx, accountID string, currency string, amount decimal.Decimal) (FailureReason, error) {
+	limits, err := effectiveLimits(ctx, tx, accountID, currency)
+	if err != nil || !limits.limitsDebits() {
+		return "", err
+	}
+
+	usage := new(outgoingUsage)
+	err = tx.QueryRow(
+		ctx,
+		GET_OUTGOING_USAGE_QUERY,
+		pgx.NamedArgs{
+			"account_id": accountID,
+			"currency":   currency,
+		},
+	).Scan(&usage.daily, &usage.dailyCount, &usage.monthly, &usage.monthlyCount)
+	if err != nil {
+		return "", fmt.Errorf("unable to total what account '%s' sent : %w", accountID, err)
+	}
+
+	return limits.checkDebit(amount, usage), nil
+}
+
+// creditLimitFailure checks the balance a credit of amount leaves against the limits of the account within tx,
+// locking the balance so that concurrent credits are checked one after the other.
+func creditLimitFailure(ctx context.Context, tx pgx.Tx, accountID string, currency string, amount decimal.Decimal) (FailureReason, error) {
+	limits, err := effectiveLimits(ctx, tx, accountID, currency)
+	if err != nil || !limits.MaxBalance.Valid {
+		return "", err
+	}
+
+	balance := decimal.Zero
+	err = tx.QueryRow(
+		ctx,
+		LOCK_BALANCE_QUERY,
+		pgx.NamedArgs{
+			"account_id": accountID,
+			"currency":   currency,
+		},
+	).Scan(&balance)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("unable to find balance of account '%s' : %w", accountID, err)
+	}
+
+	return limits.checkCredit(balance.Add(amount)), nil
+}
+
+// transferLimitFailure checks the debit of the sender, fee included, and the credit of the receiver of a transfer
+// against their limits, the receiver being credited received in ToCurrency.
+func transferLimitFailure(ctx context.Context, tx pgx.Tx, params *TransferParams, received decimal.Decimal) (FailureReason, error) {
+	reason, err := debitLimitFailure(ctx, tx, params.From, params.Currency, params.Amount.Add(params.Fee))
+	if err != nil || len(reason) > 0 {
+		return reason, err
+	}
+	return creditLimitFailure(ctx, tx, params.To, params.ToCurrency, received)
+}
+
+// effectiveLimits are the limits of the account in currency, falling back to those of its type.
+func effectiveLimits(ctx context.Context, tx pgx.Tx, accountID string, currency string) (*Limits, error) {
+	limits := new(Limits)
+
+	err := tx.QueryRow(
+		ctx,
+		GET_EFFECTIVE_LIMITS_QUERY,
+		pgx.NamedArgs{
+			"account_id": accountID,
+			"currency":   currency,
+		},
+	).Scan(&limits.MaxSingleAmount, &limits.DailyAmount, &limits.MonthlyAmount, &limits.DailyCount, &limits.MonthlyCount,
+		&limits.MaxBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return limits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to find limits of account '%s' : %w", accountID, err)
+	}
+
+	return limits, nil
+}
+
+func (p *Postgres) GetLimits(ctx context.Context, scope *LimitScope) ([]*AccountLimits, error) {
+	rows, err := p.Db.Query(
+		ctx,
+		GET_LIMITS_QUERY,
+		pgx.NamedArgs{
+			"account_id":   scope.AccountID,
+			"account_type": scope.AccountType,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query limits : %w", err)
+	}
+	defer rows.Close()
+
+	found := make([]*AccountLimits, 0)
+	for rows.Next() {
+		limits := new(AccountLimits)
+		err = rows.Scan(&limits.AccountID, &limits.AccountType, &limits.Currency, &limits.MaxSingleAmount, &limits.DailyAmount,
+			&limits.MonthlyAmount, &limits.DailyCount, &limits.MonthlyCount, &limits.MaxBalance, &limits.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse limits : %w", err)
+		}
+		found = append(found, limits)
+	}
+
+	return found, rows.Err()
+}
+
+// SetLimits replaces the limits of an account or account type in one currency. Setting no limit removes them.
+func (p *Postgres) SetLimits(ctx context.Context, limits *AccountLimits) (*AccountLimits, error) {
+	args := pgx.NamedArgs{
+		"account_id":        limits.AccountID,
+		"account_type":      limits.AccountType,
+		"currency":          limits.Currency,
+		"max_single_amount": limits.MaxSingleAmount,
+		"daily_amount":      limits.DailyAmount,
+		"monthly_amount":    limits.MonthlyAmount,
+		"daily_count":       limits.DailyCount,
+		"monthly_count":     limits.MonthlyCount,
+		"max_balance":       limits.MaxBalance,
+	}
+
+	if limits.IsEmpty() {
+		if _, err := p.Db.Exec(ctx, DELETE_LIMITS_QUERY, args); err != nil {
+			return nil, fmt.Errorf("unable to remove limits : %w", err)
+		}
+		return limits, nil
+	}
+
+	query := UPSERT_ACCOUNT_TYPE_LIMITS_QUERY
+	if len(limits.AccountID) > 0 {
+		query = UPSERT_ACCOUNT_LIMITS_QUERY
+	}
+
+	if err := p.Db.QueryRow(ctx, query, args).Scan(&limits.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("unable to set limits : %w", err)
+	}
+	return limits, nil
+}
+
+// debitLimitFailure is checked under the store lock, like every other memory store operation. The fees of
+// withdrawals and transfers count toward what was sent, as in GET_OUTGOING_USAGE_QUERY.
+func (m *MemoryStore) debitLimitFailure(accountID string, currency string, amount decimal.Decimal) FailureReason {
+	limits := m.effectiveLimits(accountID, currency)
+	if !limits.limitsDebits() {
+		return ""
+	}
+
+	sent := make(map[string]bool)
+	for _, txn := range m.transactions {
+		if txn.AccountID == accountID && (txn.TxnType == TxnTypeWithdraw || txn.TxnType == TxnTypeSender) {
+			sent[txn.ID] = true
+		}
+	}
+
+	now := time.Now()
+	usage := new(outgoingUsage)
+	for _, txn := range m.transactions {
+		isFee := txn.TxnType == TxnTypeFee && sent[txn.ID]
+		if txn.AccountID != accountID || txn.Currency != currency || txn.Status != utils.COMPLETED ||
+			(txn.TxnType != TxnTypeWithdraw && txn.TxnType != TxnTypeSender && txn.TxnType != TxnTypeCapture && !isFee) {
+			continue
+		}
+		if txn.Timestamp.After(now.Add(-LIMIT_MONTHLY_WINDOW)) {
+			usage.monthly = usage.monthly.Add(txn.Amount)
+			if !isFee {
+				usage.monthlyCount++
+			}
+		}
+		if txn.Timestamp.After(now.Add(-LIMIT_DAILY_WINDOW)) {
+			usage.daily = usage.daily.Add(txn.Amount)
+			if !isFee {
+				usage.dailyCount++
+			}
+		}
+	}
+
+	return limits.checkDebit(amount, usage)
+}
+
+func (m *MemoryStore) creditLimitFailure(accountID string, currency string, amount decimal.Decimal) FailureReason {
+	limits := m.effectiveLimits(accountID, currency)
+	balance, _ := m.balance(accountID, currency)
+	return limits.checkCredit(balance.Add(amount))
+}
+
+func (m *MemoryStore) transferLimitFailure(params *TransferParams, received decimal.Decimal) FailureReason {
+	if reason := m.debitLimitFailure(params.From, params.Currency, params.Amount.Add(params.Fee)); len(reason) > 0 {
+		return reason
+	}
+	return m.creditLimitFailure(params.To, params.ToCurrency, received)
+}
+
+func (m *MemoryStore) effectiveLimits(accountID string, currency string) *Limits {
+	var own, byType Limits
+
+	acc := m.customerAccount(accountID)
+	for _, limits := range m.limits {
+		switch {
+		case limits.Currency != currency:
+		case limits.AccountID == accountID:
+			own = limits.Limits
+		case acc != nil && len(limits.AccountID) == 0 && limits.AccountType == acc.details.Type:
+			byType = limits.Limits
+		}
+	}
+
+	effective := own.Or(byType)
+	return &effective
+}
+
+func (m *MemoryStore) GetLimits(_ context.Context, scope *LimitScope) ([]*AccountLimits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := make([]*AccountLimits, 0)
+	for _, limits := range m.limits {
+		if scope.matches(limits) {
+			result := *limits
+			found = append(found, &result)
+		}
+	}
+
+	slices.SortFunc(found, func(a, b *AccountLimits) int {
+		return strings.Compare(a.Currency, b.Currency)
+	})
+	return found, nil
+}
+
+func (m *MemoryStore) SetLimits(_ context.Context, limits *AccountLimits) (*AccountLimits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scope := &LimitScope{AccountID: limits.AccountID, AccountType: limits.AccountType}
+	m.limits = slices.DeleteFunc(m.limits, func(existing *AccountLimits) bool {
+		return scope.matches(existing) && existing.Currency == limits.Currency
+	})
+
+	set := *limits
+	if !set.IsEmpty() {
+		set.UpdatedAt = time.Now()
+		m.limits = append(m.limits, &set)
+	}
+
+	result := set
+	return &result, nil
+}
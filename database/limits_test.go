@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TestFeesCountTowardDebitLimits withdraws and transfers with fees from an account with amount limits. Each debit is
+// checked with its fee, and the fees already charged count toward what was sent.
+func TestFeesCountTowardDebitLimits(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountIDs := fundedAccounts(t, store, 2, decimal.NewFromInt(100))
+			from, to := accountIDs[0], accountIDs[1]
+
+			limits := &AccountLimits{AccountID: from, Currency: "USD"}
+			limits.MaxSingleAmount = decimal.NewNullDecimal(decimal.NewFromInt(50))
+			limits.DailyAmount = decimal.NewNullDecimal(decimal.NewFromInt(60))
+			if _, err := store.SetLimits(ctx, limits); err != nil {
+				t.Fatalf("SetLimits() error = %v", err)
+			}
+
+			withdraw := func(amount int64) FailureReason {
+				txn, err := store.Withdraw(ctx, &WithdrawParams{
+					TxnID:     uuid.NewString(),
+					AccountID: from,
+					Amount:    decimal.NewFromInt(amount),
+					Currency:  "USD",
+					Fee:       decimal.NewFromInt(2),
+				})
+				if err != nil {
+					t.Fatalf("Withdraw(%d) error = %v", amount, err)
+				}
+				return txn.FailureReason
+			}
+
+			if reason := withdraw(49); reason != FailureSingleAmountLimit {
+				t.Errorf("Withdraw() of 49 with a fee of 2 failure = '%s', want '%s'", reason, FailureSingleAmountLimit)
+			}
+			if reason := withdraw(40); len(reason) > 0 {
+				t.Fatalf("Withdraw() of 40 with a fee of 2 failure = '%s'", reason)
+			}
+
+			// 42 was sent, so 17 with a fee of 2 would take the day to 61.
+			result, err := store.Transfer(ctx, &TransferParams{
+				TxnID:      uuid.NewString(),
+				From:       from,
+				To:         to,
+				Amount:     decimal.NewFromInt(17),
+				Currency:   "USD",
+				ToCurrency: "USD",
+				Fee:        decimal.NewFromInt(2),
+			})
+			if err != nil || result.Sender.FailureReason != FailureDailyAmountLimit {
+				t.Errorf("Transfer() = %+v, %v, want it refused with %s", result, err, FailureDailyAmountLimit)
+			}
+			if reason := withdraw(16); len(reason) > 0 {
+				t.Errorf("Withdraw() of 16 with a fee of 2 failure = '%s'", reason)
+			}
+
+			if balance := balanceOf(t, store, from); !balance.Equal(decimal.NewFromInt(40)) {
+				t.Errorf("balance = %s, want 40", balance)
+			}
+			if txn, err := store.Withdraw(ctx, &WithdrawParams{TxnID: uuid.NewString(), AccountID: from, Amount: decimal.NewFromInt(1), Currency: "USD"}); err != nil || txn.Status == utils.COMPLETED {
+				t.Errorf("Withdraw() past the daily limit = %+v, %v, want it refused", txn, err)
+			}
+		})
+	}
+}
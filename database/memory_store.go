@@ -0,0 +1,502 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/idempotency"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// MemoryStore is an in-process AccountStore for tests and local runs without Postgres. Every operation runs
+// under a single lock, which gives it the same all-or-nothing behaviour as a database transaction.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	accounts     map[string]*memoryAccount
+	postings     []memoryPosting
+	transactions []TransactionRecord
+	quotes       map[string]*memoryQuote
+	records      map[idempotency.RecordKey]*idempotency.Record
+	holds        map[string]*Hold
+	schedules    map[string]*Schedule
+	scheduleRuns []ScheduleRun
+	limits       []*AccountLimits
+	accruals     []InterestAccrual
+
+	webhooks          map[string]*Webhook
+	webhookEvents     map[string]*WebhookEvent
+	webhookDeliveries map[string]*WebhookDelivery
+	webhookAttempts   []WebhookAttempt
+
+	events WebhookEvents
+}
+
+type memoryAccount struct {
+	isSystem     bool
+	balances     map[string]decimal.Decimal
+	creditLimits map[string]decimal.Decimal
+
+	status        AccountStatus
+	statusReason  string
+	freezeCredits bool
+	details       AccountParams
+	createdAt     time.Time
+}
+
+type memoryPosting struct {
+	accountID string
+	record    PostingRecord
+}
+
+type memoryQuote struct {
+	quote  FxQuote
+	usedBy string
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		accounts:  make(map[string]*memoryAccount),
+		quotes:    make(map[string]*memoryQuote),
+		records:   make(map[idempotency.RecordKey]*idempotency.Record),
+		holds:     make(map[string]*Hold),
+		schedules: make(map[string]*Schedule),
+
+		webhooks:          make(map[string]*Webhook),
+		webhookEvents:     make(map[string]*WebhookEvent),
+		webhookDeliveries: make(map[string]*WebhookDelivery),
+	}
+
+	for _, accountID := range []string{SYSTEM_CASH_ACCOUNT, SYSTEM_FX_ACCOUNT, SYSTEM_REVENUE_ACCOUNT, SYSTEM_INTEREST_ACCOUNT} {
+		m.accounts[accountID] = &memoryAccount{
+			isSystem: true,
+			balances: make(map[string]decimal.Decimal),
+		}
+	}
+
+	return m
+}
+
+func (m *MemoryStore) CreateAccounts(_ context.Context, params []*AccountParams) ([]*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts := make([]*Account, 0, len(params))
+	for _, param := range params {
+		accountID, err := uuid.NewUUID()
+		if err != nil {
+			return accounts, err
+		}
+		if _, ok := m.accounts[accountID.String()]; ok {
+			continue
+		}
+
+		account := newAccount(accountID.String(), param)
+		account.CreatedAt = time.Now()
+		m.accounts[account.ID] = &memoryAccount{
+			balances: make(map[string]decimal.Decimal),
+			status:   account.Status,
+			details: AccountParams{
+				OwnerID:     account.OwnerID,
+				Type:        account.Type,
+				DisplayName: account.DisplayName,
+				Metadata:    maps.Clone(account.Metadata),
+			},
+			createdAt: account.CreatedAt,
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+func (m *MemoryStore) GetAccount(_ context.Context, accountID string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[accountID]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	return m.account(accountID, acc), nil
+}
+
+func (m *MemoryStore) Deposit(_ context.Context, params *DepositParams) (*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deposit(params)
+}
+
+func (m *MemoryStore) deposit(params *DepositParams) (*TransactionRecord, error) {
+	if recorded := m.recordedTransaction(params.TxnID, params.txnType()); recorded != nil {
+		return recorded, nil
+	}
+
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    params.Amount,
+		Currency:  params.Currency,
+		TxnType:   params.txnType(),
+		Status:    utils.FAILED,
+	}
+
+	acc := m.customerAccount(params.AccountID)
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if err := acc.state().CanCredit(); err != nil {
+		return nil, err
+	}
+
+	txn.FailureReason = m.creditLimitFailure(params.AccountID, params.Currency, params.Amount.Sub(params.Fee))
+
+	var fee *TransactionRecord
+	if len(txn.FailureReason) == 0 {
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: string(txn.TxnType),
+			Postings: append([]Posting{
+				{AccountID: params.source(), Currency: params.Currency, Amount: params.Amount.Neg()},
+				{AccountID: params.AccountID, Currency: params.Currency, Amount: params.Amount},
+			}, feePostings(params.AccountID, params.Currency, params.Fee)...),
+		}
+
+		if err := m.postJournalEntry(entry); err != nil {
+			return nil, err
+		}
+
+		txn.Status = utils.COMPLETED
+		txn.EntryID = entry.ID
+		fee = feeRecord(params.TxnID, params.AccountID, params.Currency, params.Fee, entry.ID)
+	}
+
+	m.insertTransaction(txn)
+	if fee != nil {
+		m.insertTransaction(fee)
+	}
+	m.queueTransactionEvents(txn)
+
+	return txn, nil
+}
+
+func (m *MemoryStore) Withdraw(_ context.Context, params *WithdrawParams) (*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if recorded := m.recordedTransaction(params.TxnID, TxnTypeWithdraw); recorded != nil {
+		return recorded, nil
+	}
+
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    params.Amount,
+		Currency:  params.Currency,
+		TxnType:   TxnTypeWithdraw,
+		Status:    utils.FAILED,
+	}
+
+	acc := m.customerAccount(params.AccountID)
+	if acc == nil {
+		return nil, ErrAccountNotFound
+	}
+	if err := acc.state().CanDebit(); err != nil {
+		return nil, err
+	}
+
+	spendable, found := m.spendable(params.AccountID, params.Currency)
+	if !found || spendable.LessThan(params.Amount.Add(params.Fee)) {
+		txn.FailureReason = FailureInsufficientFunds
+	} else {
+		txn.FailureReason = m.debitLimitFailure(params.AccountID, params.Currency, params.Amount.Add(params.Fee))
+	}
+
+	var fee *TransactionRecord
+
+	if len(txn.FailureReason) == 0 {
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: string(TxnTypeWithdraw),
+			Postings: append([]Posting{
+				{AccountID: params.AccountID, Currency: params.Currency, Amount: params.Amount.Neg()},
+				{AccountID: SYSTEM_CASH_ACCOUNT, Currency: params.Currency, Amount: params.Amount},
+			}, feePostings(params.AccountID, params.Currency, params.Fee)...),
+		}
+
+		if err := m.postJournalEntry(entry); err != nil {
+			return nil, err
+		}
+
+		txn.Status = utils.COMPLETED
+		txn.EntryID = entry.ID
+		fee = feeRecord(params.TxnID, params.AccountID, params.Currency, params.Fee, entry.ID)
+	}
+
+	m.insertTransaction(txn)
+	if fee != nil {
+		m.insertTransaction(fee)
+	}
+	m.queueTransactionEvents(txn)
+
+	return txn, nil
+}
+
+func (m *MemoryStore) Transfer(_ context.Context, params *TransferParams) (*TransferResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transfer(params)
+}
+
+func (m *MemoryStore) transfer(params *TransferParams) (*TransferResult, error) {
+	if result := recordedTransferResult(m.transactionLegs(params.TxnID)); result != nil {
+		return result, nil
+	}
+
+	// Failures are found in the order the Postgres store finds them: the quote, then the accounts, then the
+	// destination, the funds and the limits.
+	rate, err := m.transferRate(params)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := newTransferResult(params, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := m.customerAccount(params.From)
+	if sender == nil {
+		return nil, ErrAccountNotFound
+	}
+	if err = sender.state().CanDebit(); err != nil {
+		return nil, err
+	}
+
+	receiver := m.customerAccount(params.To)
+	if receiver != nil {
+		if err = receiver.state().CanCredit(); err != nil {
+			return nil, err
+		}
+	}
+
+	spendable, found := m.spendable(params.From, params.Currency)
+	switch {
+	case receiver == nil:
+		result.fail(FailureDestinationNotFound)
+	case !found || spendable.LessThan(params.Amount.Add(params.Fee)):
+		result.fail(FailureInsufficientFunds)
+	default:
+		if reason := m.transferLimitFailure(params, result.Receiver.Amount); len(reason) > 0 {
+			result.fail(reason)
+			break
+		}
+
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: transferEntryOperation,
+			Postings:  append(transferPostings(params, result.Receiver.Amount), feePostings(params.From, params.Currency, params.Fee)...),
+		}
+
+		if err = m.postJournalEntry(entry); err != nil {
+			return nil, err
+		}
+		if q, ok := m.quotes[params.QuoteID]; ok && rate != nil {
+			q.usedBy = params.TxnID
+		}
+
+		result.complete(entry.ID)
+	}
+
+	for _, txn := range result.Records() {
+		m.insertTransaction(txn)
+	}
+	m.queueTransactionEvents(result.Records()...)
+
+	return result, nil
+}
+
+func (m *MemoryStore) transferRate(params *TransferParams) (*fx.Rate, error) {
+	if params.Currency == params.ToCurrency {
+		return nil, nil
+	}
+
+	if len(params.QuoteID) == 0 {
+		if params.Rate == nil {
+			return nil, fx.ErrRateNotFound
+		}
+		return params.Rate, nil
+	}
+
+	q, ok := m.quotes[params.QuoteID]
+	if !ok || len(q.usedBy) > 0 || !q.quote.ExpiresAt.After(time.Now()) ||
+		q.quote.Rate.From != params.Currency || q.quote.Rate.To != params.ToCurrency {
+		return nil, ErrQuoteUnavailable
+	}
+
+	rate := q.quote.Rate
+	return &rate, nil
+}
+
+func (m *MemoryStore) GetBatchTransactions(_ context.Context, batchID string) ([]TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txns := make([]TransactionRecord, 0)
+	for _, txn := range m.transactions {
+		if txn.BatchID == batchID {
+			txns = append(txns, txn)
+		}
+	}
+
+	return txns, nil
+}
+
+func (m *MemoryStore) GetTransactions(_ context.Context, txnID string) ([]TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txns := m.transactionLegs(txnID)
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Timestamp.After(txns[j].Timestamp)
+	})
+
+	return txns, nil
+}
+
+func (m *MemoryStore) ListAccountPostings(_ context.Context, accountID string) ([]PostingRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	postings := make([]PostingRecord, 0)
+	for _, posting := range m.postings {
+		if posting.accountID == accountID {
+			postings = append(postings, posting.record)
+		}
+	}
+
+	return postings, nil
+}
+
+func (m *MemoryStore) CreateFxQuote(_ context.Context, quote *FxQuote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.quotes[quote.ID]; ok {
+		return fmt.Errorf("unable to store fx quote '%s' : it already exists", quote.ID)
+	}
+	m.quotes[quote.ID] = &memoryQuote{
+		quote: *quote,
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) customerAccount(accountID string) *memoryAccount {
+	acc, ok := m.accounts[accountID]
+	if !ok || acc.isSystem {
+		return nil
+	}
+	return acc
+}
+
+func (acc *memoryAccount) state() *AccountState {
+	return &AccountState{
+		Status:        acc.status,
+		FreezeCredits: acc.freezeCredits,
+	}
+}
+
+func (m *MemoryStore) balance(accountID string, currency string) (decimal.Decimal, bool) {
+	acc, ok := m.accounts[accountID]
+	if !ok {
+		return decimal.Zero, false
+	}
+	balance, ok := acc.balances[currency]
+	return balance, ok
+}
+
+// postJournalEntry mirrors PostJournalEntry: the entry must balance, and every posting moves its account balance.
+func (m *MemoryStore) postJournalEntry(entry *JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		if _, ok := m.accounts[posting.AccountID]; !ok {
+			return fmt.Errorf("unable to post to account '%s' for entry '%s' : %w", posting.AccountID, entry.ID, ErrAccountNotFound)
+		}
+	}
+
+	now := time.Now()
+	for _, posting := range entry.Postings {
+		acc := m.accounts[posting.AccountID]
+		acc.balances[posting.Currency] = acc.balances[posting.Currency].Add(posting.Amount)
+
+		m.postings = append(m.postings, memoryPosting{
+			accountID: posting.AccountID,
+			record: PostingRecord{
+				EntryID:      entry.ID,
+				TxnID:        entry.TxnID,
+				Operation:    entry.Operation,
+				Currency:     posting.Currency,
+				Amount:       posting.Amount,
+				BalanceAfter: acc.balances[posting.Currency],
+				Timestamp:    now,
+			},
+		})
+	}
+
+	return nil
+}
+
+// transactionLegs returns copies of the records of a transaction ID.
+func (m *MemoryStore) transactionLegs(txnID string) []TransactionRecord {
+	legs := make([]TransactionRecord, 0)
+	for _, txn := range m.transactions {
+		if txn.ID == txnID {
+			legs = append(legs, txn)
+		}
+	}
+	return legs
+}
+
+// recordedTransaction returns a copy of the record of the transaction ID and type, or nil when there is none. An
+// operation checks it before posting anything, so that a transaction ID moves money only once.
+func (m *MemoryStore) recordedTransaction(txnID string, txnType TxnType) *TransactionRecord {
+	for _, txn := range m.transactions {
+		if txn.ID == txnID && txn.TxnType == txnType {
+			recorded := txn
+			return &recorded
+		}
+	}
+	return nil
+}
+
+// insertTransaction keeps the first record for a transaction ID and type, like the table's primary key.
+func (m *MemoryStore) insertTransaction(txn *TransactionRecord) {
+	for _, existing := range m.transactions {
+		if existing.ID == txn.ID && existing.TxnType == txn.TxnType {
+			return
+		}
+	}
+	txn.Timestamp = time.Now()
+	m.transactions = append(m.transactions, *txn)
+}
@@ -0,0 +1,342 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// OVERDRAFT_DAYS_PER_YEAR turns the annual overdraft interest rate into the rate charged for one day.
+const OVERDRAFT_DAYS_PER_YEAR = 365
+
+// CreditLimitParams sets how far below zero the balance of an account in Currency may be debited.
+type CreditLimitParams struct {
+	AccountID   string
+	Currency    string
+	CreditLimit decimal.Decimal
+}
+
+// OverdraftTerms price a day spent overdrawn: a flat DailyFee in the currency of the balance, plus interest on the
+// overdrawn amount at AnnualRate. Zero terms charge nothing.
+type OverdraftTerms struct {
+	DailyFee   decimal.Decimal
+	AnnualRate decimal.Decimal
+}
+
+type OverdrawnBalance struct {
+	AccountID string
+	Currency  string
+}
+
+// OverdraftChargeParams charges an overdrawn balance for one day. The transaction ID identifies the balance and the
+// day, so that the balance is charged at most once for it.
+type OverdraftChargeParams struct {
+	TxnID     string
+	AccountID string
+	Currency  string
+	Terms     *OverdraftTerms
+}
+
+// RemainingCredit is how much of the credit limit is left once the available balance has gone below zero.
+func (b *Balance) RemainingCredit() decimal.Decimal {
+	if !b.Available.IsNegative() {
+		return b.CreditLimit
+	}
+	return decimal.Max(b.CreditLimit.Add(b.Available), decimal.Zero)
+}
+
+// OverdraftTermsFromEnv reads the overdraft terms from OVERDRAFT_DAILY_FEE and OVERDRAFT_INTEREST_RATE, the annual
+// rate as a fraction. A missing or invalid value charges nothing.
+func OverdraftTermsFromEnv() *OverdraftTerms {
+	rate := func(name string) decimal.Decimal {
+		value, err := decimal.NewFromString(os.Getenv(name))
+		if err != nil || value.IsNegative() {
+			return decimal.Zero
+		}
+		return value
+	}
+
+	return &OverdraftTerms{
+		DailyFee:   rate("OVERDRAFT_DAILY_FEE"),
+		AnnualRate: rate("OVERDRAFT_INTEREST_RATE"),
+	}
+}
+
+func (t *OverdraftTerms) IsEmpty() bool {
+	return t.DailyFee.IsZero() && t.AnnualRate.IsZero()
+}
+
+// charge is what a day overdrawn by balance costs, rounded to the currency. A balance that is not overdrawn costs
+// nothing.
+func (t *OverdraftTerms) charge(balance decimal.Decimal, currency string) decimal.Decimal {
+	if !balance.IsNegative() {
+		return decimal.Zero
+	}
+
+	interest := balance.Neg().Mul(t.AnnualRate).Div(decimal.NewFromInt(OVERDRAFT_DAYS_PER_YEAR))
+	scale, _ := utils.CurrencyScale(currency)
+	return t.DailyFee.Add(interest).Round(scale)
+}
+
+// OverdraftChargeID is the transaction ID of the charge for an overdrawn balance on the UTC day of t.
+func OverdraftChargeID(accountID string, currency string, t time.Time) string {
+	day := t.UTC().Format(time.DateOnly)
+	return uuid.NewSHA1(uuid.MustParse(accountID), []byte(currency+"."+day)).String()
+}
+
+// overdraftCharge is the journal entry and transaction charging amount to an overdrawn balance.
+func overdraftCharge(params *OverdraftChargeParams, amount decimal.Decimal) (*JournalEntry, *TransactionRecord) {
+	entry := &JournalEntry{
+		ID:        uuid.NewString(),
+		TxnID:     params.TxnID,
+		Operation: string(TxnTypeOverdraftCharge),
+		Postings: []Posting{
+			{AccountID: params.AccountID, Currency: params.Currency, Amount: amount.Neg()},
+			{AccountID: SYSTEM_REVENUE_ACCOUNT, Currency: params.Currency, Amount: amount},
+		},
+	}
+
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    amount,
+		Currency:  params.Currency,
+		TxnType:   TxnTypeOverdraftCharge,
+		Status:    utils.COMPLETED,
+		EntryID:   entry.ID,
+	}
+
+	return entry, txn
+}
+
+// ChargeOverdraftsPeriodically charges every overdrawn balance for the current day every interval until ctx is
+// done. A balance already charged for the day is skipped, so the interval only bounds how soon after going
+// overdrawn a balance is first charged.
+func ChargeOverdraftsPeriodically(ctx context.Context, logger *slog.Logger, store AccountStore, terms *OverdraftTerms, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			overdrawn, err := store.ListOverdrawnBalances(ctx)
+			if err != nil {
+				logger.Error(fmt.Sprintf("[ChargeOverdraftsPeriodically] unable to find overdrawn balances : %v", err))
+				continue
+			}
+
+			for _, balance := range overdrawn {
+				txn, err := store.ChargeOverdraft(ctx, &OverdraftChargeParams{
+					TxnID:     OverdraftChargeID(balance.AccountID, balance.Currency, now),
+					AccountID: balance.AccountID,
+					Currency:  balance.Currency,
+					Terms:     terms,
+				})
+				if err != nil {
+					logger.Error(fmt.Sprintf("[ChargeOverdraftsPeriodically] unable to charge %s overdraft of account '%s' : %v", balance.Currency, balance.AccountID, err))
+					continue
+				}
+				if txn != nil {
+					logger.Info(fmt.Sprintf("[ChargeOverdraftsPeriodically] charged '%s %s' to account '%s'", txn.Amount, txn.Currency, txn.AccountID))
+				}
+			}
+		}
+	}
+}
+
+// SetCreditLimit sets the credit limit of an account in a currency, opening a zero balance in it if there is none.
+// Lowering the limit below what the account already owes leaves the debt in place but refuses further debits.
+func (p *Postgres) SetCreditLimit(ctx context.Context, params *CreditLimitParams) error {
+	tx, err := p.Db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to start transaction : %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	state, err := LockAccount(ctx, tx, params.AccountID)
+	if err != nil {
+		return err
+	}
+	if state.Status == AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	query := SET_CREDIT_LIMIT_QUERY
+	if params.CreditLimit.IsZero() {
+		query = CLEAR_CREDIT_LIMIT_QUERY
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"account_id":   params.AccountID,
+			"currency":     params.Currency,
+			"credit_limit": params.CreditLimit,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to set credit limit of account '%s' : %w", params.AccountID, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit credit limit of account '%s' : %v", params.AccountID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) ListOverdrawnBalances(ctx context.Context) ([]OverdrawnBalance, error) {
+	rows, err := p.Db.Query(ctx, GET_OVERDRAWN_BALANCES_QUERY)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query overdrawn balances : %w", err)
+	}
+	defer rows.Close()
+
+	overdrawn := make([]OverdrawnBalance, 0)
+	for rows.Next() {
+		var balance OverdrawnBalance
+		if err = rows.Scan(&balance.AccountID, &balance.Currency); err != nil {
+			return nil, fmt.Errorf("unable to parse overdrawn balance : %w", err)
+		}
+		overdrawn = append(overdrawn, balance)
+	}
+
+	return overdrawn, rows.Err()
+}
+
+// ChargeOverdraft charges the balance for the day of the transaction ID if it is still overdrawn. It returns no
+// transaction when there is nothing to charge or the day was already charged. The charge is owed rather than spent,
+// so it is posted whatever the status and credit limit of the account.
+func (p *Postgres) ChargeOverdraft(ctx context.Context, params *OverdraftChargeParams) (*TransactionRecord, error) {
+	var txn *TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		txn, err = p.chargeOverdraft(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to charge overdraft '%s' : %w", params.TxnID, err)
+	}
+
+	return txn, nil
+}
+
+// chargeOverdraft posts the charge and records it within tx.
+func (p *Postgres) chargeOverdraft(ctx context.Context, tx pgx.Tx, params *OverdraftChargeParams) (*TransactionRecord, error) {
+	args := pgx.NamedArgs{
+		"id":         params.TxnID,
+		"account_id": params.AccountID,
+		"currency":   params.Currency,
+	}
+
+	var balance decimal.Decimal
+	if err := tx.QueryRow(ctx, LOCK_BALANCE_QUERY, args).Scan(&balance); err != nil {
+		return nil, fmt.Errorf("unable to find balance of account '%s' : %w", params.AccountID, err)
+	}
+
+	var charged bool
+	if err := tx.QueryRow(ctx, OVERDRAFT_CHARGED_QUERY, args).Scan(&charged); err != nil {
+		return nil, fmt.Errorf("unable to find overdraft charge '%s' : %w", params.TxnID, err)
+	}
+
+	amount := params.Terms.charge(balance, params.Currency)
+	if charged || !amount.IsPositive() {
+		return nil, nil
+	}
+
+	entry, txn := overdraftCharge(params, amount)
+	if err := PostJournalEntry(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err := InsertTransaction(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+	if err := p.queueTransactionEvents(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+func (m *MemoryStore) SetCreditLimit(_ context.Context, params *CreditLimitParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.customerAccount(params.AccountID)
+	if acc == nil {
+		return ErrAccountNotFound
+	}
+	if acc.status == AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	if params.CreditLimit.IsZero() {
+		delete(acc.creditLimits, params.Currency)
+		return nil
+	}
+
+	if _, ok := acc.balances[params.Currency]; !ok {
+		acc.balances[params.Currency] = decimal.Zero
+	}
+	if acc.creditLimits == nil {
+		acc.creditLimits = make(map[string]decimal.Decimal)
+	}
+	acc.creditLimits[params.Currency] = params.CreditLimit
+	return nil
+}
+
+func (m *MemoryStore) ListOverdrawnBalances(_ context.Context) ([]OverdrawnBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	overdrawn := make([]OverdrawnBalance, 0)
+	for accountID, acc := range m.accounts {
+		if acc.isSystem {
+			continue
+		}
+		for currency, balance := range acc.balances {
+			if balance.IsNegative() {
+				overdrawn = append(overdrawn, OverdrawnBalance{AccountID: accountID, Currency: currency})
+			}
+		}
+	}
+	return overdrawn, nil
+}
+
+func (m *MemoryStore) ChargeOverdraft(_ context.Context, params *OverdraftChargeParams) (*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.transactions {
+		if existing.ID == params.TxnID && existing.TxnType == TxnTypeOverdraftCharge {
+			return nil, nil
+		}
+	}
+
+	balance, _ := m.balance(params.AccountID, params.Currency)
+	amount := params.Terms.charge(balance, params.Currency)
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	entry, txn := overdraftCharge(params, amount)
+	if err := m.postJournalEntry(entry); err != nil {
+		return nil, err
+	}
+	m.insertTransaction(txn)
+	m.queueTransactionEvents(txn)
+
+	return txn, nil
+}
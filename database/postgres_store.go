@@ -0,0 +1,569 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const transferEntryOperation = "transfer"
+
+func (p *Postgres) CreateAccounts(ctx context.Context, params []*AccountParams) ([]*Account, error) {
+	batch := &pgx.Batch{}
+	accounts := make([]*Account, 0, len(params))
+
+	for _, param := range params {
+		accountID, err := uuid.NewUUID()
+		if err != nil {
+			return nil, err
+		}
+		account := newAccount(accountID.String(), param)
+		accounts = append(accounts, account)
+
+		metadata := account.Metadata
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		batch.Queue(INSERT_ACCOUNTS_QUERY, pgx.NamedArgs{
+			"id":           account.ID,
+			"owner_id":     account.OwnerID,
+			"account_type": account.Type,
+			"display_name": account.DisplayName,
+			"metadata":     metadata,
+		})
+	}
+
+	results := p.Db.SendBatch(ctx, batch)
+	defer func(results pgx.BatchResults) {
+		_ = results.Close()
+	}(results)
+
+	created := make([]*Account, 0, len(accounts))
+	for _, account := range accounts {
+		err := results.QueryRow().Scan(&account.CreatedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				continue
+			}
+			return created, fmt.Errorf("unable to insert row for account '%s' : %v", account.ID, err)
+		}
+		created = append(created, account)
+	}
+
+	return created, results.Close()
+}
+
+func (p *Postgres) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	results, err := p.Db.Query(
+		ctx,
+		GET_ACCOUNT_BALANCE_QUERY,
+		pgx.NamedArgs{
+			"id": accountID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query account balance : %v", err)
+	}
+	defer results.Close()
+
+	accounts, err := scanAccounts(results)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accounts) == 0 {
+		return nil, ErrAccountNotFound
+	}
+
+	return accounts[0], nil
+}
+
+func (p *Postgres) Deposit(ctx context.Context, params *DepositParams) (*TransactionRecord, error) {
+	var txn *TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		txn, err = p.deposit(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to deposit '%s' : %w", params.TxnID, err)
+	}
+
+	return txn, nil
+}
+
+// deposit credits an account and records it within tx. A deposit already recorded under the transaction ID is
+// returned as it was recorded, without posting again.
+func (p *Postgres) deposit(ctx context.Context, tx pgx.Tx, params *DepositParams) (*TransactionRecord, error) {
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    params.Amount,
+		Currency:  params.Currency,
+		TxnType:   params.txnType(),
+		Status:    utils.FAILED,
+	}
+
+	recorded, err := RecordTransaction(ctx, tx, txn)
+	if err != nil {
+		return nil, err
+	}
+	if !recorded {
+		return recordedTransaction(ctx, tx, txn)
+	}
+
+	state, err := LockAccount(ctx, tx, params.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err = state.CanCredit(); err != nil {
+		return nil, err
+	}
+
+	txn.FailureReason, err = creditLimitFailure(ctx, tx, params.AccountID, params.Currency, params.Amount.Sub(params.Fee))
+	if err != nil {
+		return nil, err
+	}
+
+	var fee *TransactionRecord
+	if len(txn.FailureReason) == 0 {
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: string(txn.TxnType),
+			Postings: append([]Posting{
+				{AccountID: params.source(), Currency: params.Currency, Amount: params.Amount.Neg()},
+				{AccountID: params.AccountID, Currency: params.Currency, Amount: params.Amount},
+			}, feePostings(params.AccountID, params.Currency, params.Fee)...),
+		}
+
+		if err = PostJournalEntry(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+
+		txn.Status = utils.COMPLETED
+		txn.EntryID = entry.ID
+		fee = feeRecord(params.TxnID, params.AccountID, params.Currency, params.Fee, entry.ID)
+	}
+
+	if err = UpdateTransaction(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+	if fee != nil {
+		if err = InsertTransaction(ctx, tx, fee); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.queueTransactionEvents(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+func (p *Postgres) Withdraw(ctx context.Context, params *WithdrawParams) (*TransactionRecord, error) {
+	var txn *TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		txn, err = p.withdraw(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to withdraw '%s' : %w", params.TxnID, err)
+	}
+
+	return txn, nil
+}
+
+// withdraw debits an account and records it within tx. A withdrawal already recorded under the transaction ID is
+// returned as it was recorded, without posting again.
+func (p *Postgres) withdraw(ctx context.Context, tx pgx.Tx, params *WithdrawParams) (*TransactionRecord, error) {
+	txn := &TransactionRecord{
+		ID:        params.TxnID,
+		AccountID: params.AccountID,
+		Amount:    params.Amount,
+		Currency:  params.Currency,
+		TxnType:   TxnTypeWithdraw,
+		Status:    utils.FAILED,
+	}
+
+	recorded, err := RecordTransaction(ctx, tx, txn)
+	if err != nil {
+		return nil, err
+	}
+	if !recorded {
+		return recordedTransaction(ctx, tx, txn)
+	}
+
+	state, err := LockAccount(ctx, tx, params.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err = state.CanDebit(); err != nil {
+		return nil, err
+	}
+
+	spendable, found, err := LockSpendableBalance(ctx, tx, params.AccountID, params.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find balance of account '%s' : %v", params.AccountID, err)
+	}
+
+	if !found || spendable.LessThan(params.Amount.Add(params.Fee)) {
+		txn.FailureReason = FailureInsufficientFunds
+	} else if txn.FailureReason, err = debitLimitFailure(ctx, tx, params.AccountID, params.Currency, params.Amount.Add(params.Fee)); err != nil {
+		return nil, err
+	}
+
+	var fee *TransactionRecord
+	if len(txn.FailureReason) == 0 {
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: string(TxnTypeWithdraw),
+			Postings: append([]Posting{
+				{AccountID: params.AccountID, Currency: params.Currency, Amount: params.Amount.Neg()},
+				{AccountID: SYSTEM_CASH_ACCOUNT, Currency: params.Currency, Amount: params.Amount},
+			}, feePostings(params.AccountID, params.Currency, params.Fee)...),
+		}
+
+		if err = PostJournalEntry(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+
+		txn.Status = utils.COMPLETED
+		txn.EntryID = entry.ID
+		fee = feeRecord(params.TxnID, params.AccountID, params.Currency, params.Fee, entry.ID)
+	}
+
+	if err = UpdateTransaction(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+	if fee != nil {
+		if err = InsertTransaction(ctx, tx, fee); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.queueTransactionEvents(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// Transfer runs serializably and is retried when it races another transaction. Both accounts, and then every
+// balance the transfer posts to, are locked in ID order, so opposing transfers queue behind each other instead of
+// deadlocking.
+func (p *Postgres) Transfer(ctx context.Context, params *TransferParams) (*TransferResult, error) {
+	var result *TransferResult
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		result, err = p.transfer(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to transfer '%s' : %w", params.TxnID, err)
+	}
+
+	return result, nil
+}
+
+// transfer moves the money of one transfer and records it within tx. A transfer already recorded under the
+// transaction ID is returned as it was recorded, without posting again. Its records stay locked until tx ends, and
+// a transfer racing to record the same ID is aborted with a serialization failure and finds them when retried.
+func (p *Postgres) transfer(ctx context.Context, tx pgx.Tx, params *TransferParams) (*TransferResult, error) {
+	legs, err := lockTransactions(ctx, tx, params.TxnID)
+	if err != nil {
+		return nil, err
+	}
+	if result := recordedTransferResult(legs); result != nil {
+		return result, nil
+	}
+
+	rate, err := p.transferRate(ctx, tx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := newTransferResult(params, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, receiver, err := lockTransferAccounts(ctx, tx, params)
+	if err != nil {
+		return nil, err
+	}
+	if err = sender.CanDebit(); err != nil {
+		return nil, err
+	}
+	if receiver != nil {
+		if err = receiver.CanCredit(); err != nil {
+			return nil, err
+		}
+	}
+
+	postings := append(transferPostings(params, result.Receiver.Amount), feePostings(params.From, params.Currency, params.Fee)...)
+	if err = LockBalances(ctx, tx, postings); err != nil {
+		return nil, err
+	}
+
+	spendable, found, err := LockSpendableBalance(ctx, tx, params.From, params.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find balance of account '%s' : %w", params.From, err)
+	}
+
+	switch {
+	case receiver == nil:
+		result.fail(FailureDestinationNotFound)
+	case !found || spendable.LessThan(params.Amount.Add(params.Fee)):
+		result.fail(FailureInsufficientFunds)
+	default:
+		reason, err := transferLimitFailure(ctx, tx, params, result.Receiver.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if len(reason) > 0 {
+			result.fail(reason)
+			break
+		}
+
+		entry := &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: transferEntryOperation,
+			Postings:  postings,
+		}
+
+		if err = PostJournalEntry(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+
+		if err = useFxQuote(ctx, tx, params); err != nil {
+			return nil, err
+		}
+
+		result.complete(entry.ID)
+	}
+
+	for _, txn := range result.Records() {
+		if err = InsertTransaction(ctx, tx, txn); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.queueTransactionEvents(ctx, tx, result.Records()...); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// lockTransferAccounts locks the sender and the receiver in ID order. The receiver state is nil when it does not
+// exist; a missing sender is an error.
+func lockTransferAccounts(ctx context.Context, tx pgx.Tx, params *TransferParams) (*AccountState, *AccountState, error) {
+	accountIDs := []string{params.From, params.To}
+	slices.Sort(accountIDs)
+
+	states := make(map[string]*AccountState, len(accountIDs))
+	for _, accountID := range accountIDs {
+		state, err := lockCustomerAccount(ctx, tx, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		states[accountID] = state
+	}
+
+	if states[params.From] == nil {
+		return nil, nil, ErrAccountNotFound
+	}
+	return states[params.From], states[params.To], nil
+}
+
+// transferRate locks the quote referenced by the transfer within its database transaction, or uses the rate
+// supplied by the caller when there is no quote. The quote is only consumed once the transfer completes, so a
+// transfer that fails leaves it to be used by another.
+func (p *Postgres) transferRate(ctx context.Context, tx pgx.Tx, params *TransferParams) (*fx.Rate, error) {
+	if params.Currency == params.ToCurrency {
+		return nil, nil
+	}
+
+	if len(params.QuoteID) == 0 {
+		if params.Rate == nil {
+			return nil, fx.ErrRateNotFound
+		}
+		return params.Rate, nil
+	}
+
+	rate := &fx.Rate{
+		From: params.Currency,
+		To:   params.ToCurrency,
+	}
+
+	err := tx.QueryRow(
+		ctx,
+		LOCK_FX_QUOTE_QUERY,
+		pgx.NamedArgs{
+			"id":            params.QuoteID,
+			"from_currency": params.Currency,
+			"to_currency":   params.ToCurrency,
+		},
+	).Scan(&rate.Rate, &rate.Spread)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrQuoteUnavailable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock fx quote '%s' : %w", params.QuoteID, err)
+	}
+
+	return rate, nil
+}
+
+// useFxQuote consumes the quote of a completed transfer, when it has one.
+func useFxQuote(ctx context.Context, tx pgx.Tx, params *TransferParams) error {
+	if params.Currency == params.ToCurrency || len(params.QuoteID) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		USE_FX_QUOTE_QUERY,
+		pgx.NamedArgs{
+			"id":      params.QuoteID,
+			"used_by": params.TxnID,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to use fx quote '%s' : %w", params.QuoteID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) GetTransactions(ctx context.Context, txnID string) ([]TransactionRecord, error) {
+	return p.queryTransactions(ctx, GET_TRANSACTIONS_QUERY, pgx.NamedArgs{
+		"id": txnID,
+	})
+}
+
+func (p *Postgres) GetBatchTransactions(ctx context.Context, batchID string) ([]TransactionRecord, error) {
+	return p.queryTransactions(ctx, GET_BATCH_TRANSACTIONS_QUERY, pgx.NamedArgs{
+		"batch_id": batchID,
+	})
+}
+
+func (p *Postgres) queryTransactions(ctx context.Context, query string, args pgx.NamedArgs) ([]TransactionRecord, error) {
+	results, err := p.Db.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query transactions : %v", err)
+	}
+	defer results.Close()
+
+	txns := make([]TransactionRecord, 0)
+
+	for results.Next() {
+		txn, err := scanTransaction(results)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse transactions : %v", err)
+		}
+		txns = append(txns, txn)
+	}
+
+	return txns, results.Err()
+}
+
+func scanTransaction(row pgx.Row) (TransactionRecord, error) {
+	var (
+		txn             TransactionRecord
+		txnType         string
+		counterCurrency pgtype.Text
+		failureReason   string
+		batchID         string
+		reference       string
+	)
+
+	err := row.Scan(
+		&txn.ID,
+		&txn.AccountID,
+		&txn.Amount,
+		&txn.Currency,
+		&txnType,
+		&txn.SenderID,
+		&txn.ReceiverID,
+		&txn.Timestamp,
+		&txn.Status,
+		&txn.CounterAmount,
+		&counterCurrency,
+		&txn.FxRate,
+		&txn.FxSpread,
+		&txn.ReversesID,
+		&txn.ReversedAmount,
+		&failureReason,
+		&batchID,
+		&reference,
+	)
+
+	txn.TxnType = TxnType(txnType)
+	txn.FailureReason = FailureReason(failureReason)
+	txn.BatchID = batchID
+	txn.Reference = reference
+	txn.CounterCurrency = counterCurrency.String
+
+	return txn, err
+}
+
+func (p *Postgres) ListAccountPostings(ctx context.Context, accountID string) ([]PostingRecord, error) {
+	results, err := p.Db.Query(
+		ctx,
+		GET_ACCOUNT_POSTINGS_QUERY,
+		pgx.NamedArgs{
+			"account_id": accountID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query account postings : %v", err)
+	}
+	defer results.Close()
+
+	postings := make([]PostingRecord, 0)
+
+	for results.Next() {
+		var posting PostingRecord
+		err = results.Scan(&posting.EntryID, &posting.TxnID, &posting.Operation, &posting.Currency, &posting.Amount, &posting.BalanceAfter, &posting.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse account postings : %v", err)
+		}
+		postings = append(postings, posting)
+	}
+
+	return postings, results.Err()
+}
+
+func (p *Postgres) CreateFxQuote(ctx context.Context, quote *FxQuote) error {
+	_, err := p.Db.Exec(
+		ctx,
+		INSERT_FX_QUOTE_QUERY,
+		pgx.NamedArgs{
+			"id":            quote.ID,
+			"from_currency": quote.Rate.From,
+			"to_currency":   quote.Rate.To,
+			"rate":          quote.Rate.Rate,
+			"spread":        quote.Rate.Spread,
+			"expires_at":    quote.ExpiresAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to store fx quote '%s' : %v", quote.ID, err)
+	}
+	return nil
+}
@@ -7,60 +7,422 @@ const (
 	TxnTypeWithdraw TxnType = "withdraw"
 	TxnTypeSender   TxnType = "sender"
 	TxnTypeReceiver TxnType = "receiver"
+	TxnTypeCapture  TxnType = "capture"
+
+	TxnTypeReversalDebit  TxnType = "reversal_debit"
+	TxnTypeReversalCredit TxnType = "reversal_credit"
+
+	TxnTypeOverdraftCharge TxnType = "overdraft_charge"
+	TxnTypeFee             TxnType = "fee"
+	TxnTypeInterest        TxnType = "interest"
 )
 
+func IsTxnType(txnType string) bool {
+	switch TxnType(txnType) {
+	case TxnTypeDeposit, TxnTypeWithdraw, TxnTypeSender, TxnTypeReceiver, TxnTypeCapture,
+		TxnTypeReversalDebit, TxnTypeReversalCredit, TxnTypeOverdraftCharge, TxnTypeFee,
+		TxnTypeInterest:
+		return true
+	}
+	return false
+}
+
 const (
-	INSERT_ACCOUNTS_QUERY     = `INSERT INTO accounts (id, balance) VALUES (@id, @balance)`
-	GET_ACCOUNT_BALANCE_QUERY = `SELECT id, balance FROM accounts WHERE id = @id`
+	INSERT_ACCOUNTS_QUERY = `
+	INSERT INTO accounts (id, owner_id, account_type, display_name, metadata)
+	VALUES (@id, NULLIF(@owner_id, ''), @account_type, NULLIF(@display_name, ''), @metadata)
+	RETURNING created_at`
 
-	DEPOSIT_QUERY = `
-	WITH accs AS (
-		UPDATE accounts SET balance = balance + $2 WHERE id = $1 AND $2 > 0.00
-		RETURNING *
-	), txns AS (
-		INSERT INTO transactions (id, account_id, amount, txntype, sender_id, receiver_id, status) 
-		VALUES (
-			$3, 
-			$1, 
-			$2, 
-			$4, 
-			CASE WHEN CAST ($4 AS txntype) = 'receiver' THEN $5 ELSE '' END, 
-			CASE WHEN CAST ($4 AS txntype) = 'receiver' THEN $1 ELSE '' END, 
-			CASE WHEN (SELECT COUNT(*) FROM accs) = 0 THEN 'failed' ELSE 'completed' END
-		)
-		ON CONFLICT DO NOTHING
-	), txns_transfer_failed AS (
-		UPDATE transactions 
-		SET (id, account_id, amount, txntype, sender_id, receiver_id, status) = 
-		($3, $5, $2, 'sender', $5, $1, 'failed')
-		WHERE $4 = 'receiver' AND (SELECT COUNT(*) FROM accs) = 0
+	ACCOUNT_COLUMNS = `a.id, a.status, COALESCE(a.status_reason, ''), a.freeze_credits, COALESCE(a.owner_id, ''), a.account_type,
+	COALESCE(a.display_name, ''), a.metadata, a.created_at, b.currency, b.balance, b.balance - COALESCE(h.held, 0), b.credit_limit`
+
+	GET_ACCOUNT_BALANCE_QUERY = `
+	SELECT ` + ACCOUNT_COLUMNS + `
+	FROM accounts a
+	LEFT JOIN balances b ON b.account_id = a.id
+	LEFT JOIN (
+		SELECT account_id, currency, SUM(amount) AS held FROM holds
+		WHERE account_id = @id AND status = 'active' AND expires_at > NOW()
+		GROUP BY account_id, currency
+	) h ON h.account_id = b.account_id AND h.currency = b.currency
+	WHERE a.id = @id ORDER BY b.currency`
+
+	// FIND_ACCOUNTS_QUERY returns the customer accounts of an owner, or those whose metadata contains every given
+	// key and value, oldest first.
+	FIND_ACCOUNTS_QUERY = `
+	WITH a AS (
+		SELECT * FROM accounts
+		WHERE NOT is_system AND (@owner_id = '' OR owner_id = @owner_id) AND metadata @> @metadata
+		ORDER BY created_at, id LIMIT @limit
 	)
-	SELECT COUNT(*) FROM accs`
+	SELECT ` + ACCOUNT_COLUMNS + `
+	FROM a
+	LEFT JOIN balances b ON b.account_id = a.id
+	LEFT JOIN (
+		SELECT account_id, currency, SUM(amount) AS held FROM holds
+		WHERE account_id IN (SELECT id FROM a) AND status = 'active' AND expires_at > NOW()
+		GROUP BY account_id, currency
+	) h ON h.account_id = b.account_id AND h.currency = b.currency
+	ORDER BY a.created_at, a.id, b.currency`
 
-	WITHDRAW_QUERY = `
-	WITH accs AS (
-		UPDATE accounts SET balance = balance - $2 WHERE id = $1 AND balance >= $2
-		RETURNING *
-	), txns AS (
-		INSERT INTO transactions (id, account_id, amount, txntype, sender_id, receiver_id, status) 
-		VALUES (
-			$3, 
-			$1, 
-			$2, 
-			$4, 
-			CASE WHEN CAST ($4 AS txntype) = 'sender' THEN $1 ELSE '' END, 
-			CASE WHEN CAST ($4 AS txntype) = 'sender' THEN $5 ELSE '' END, 
-			CASE WHEN (SELECT COUNT(*) FROM accs) = 0 THEN 'failed' ELSE 'completed' END
+	LOCK_ACCOUNT_QUERY            = `SELECT status, freeze_credits FROM accounts WHERE id = @id AND NOT is_system FOR SHARE`
+	LOCK_ACCOUNT_FOR_UPDATE_QUERY = `SELECT status, freeze_credits FROM accounts WHERE id = @id AND NOT is_system FOR UPDATE`
+	LOCK_ACCOUNT_BALANCES_QUERY   = `SELECT currency, balance FROM balances WHERE account_id = @account_id ORDER BY currency FOR UPDATE`
+	COUNT_ACTIVE_HOLDS_QUERY      = `SELECT COUNT(*) FROM holds WHERE account_id = @account_id AND status = 'active' AND expires_at > NOW()`
+
+	// UPDATE_ACCOUNT_STATUS_QUERY changes the status of an account and keeps an audit row of the change.
+	UPDATE_ACCOUNT_STATUS_QUERY = `
+	WITH acc AS (
+		UPDATE accounts SET status = @status, status_reason = @reason, freeze_credits = @freeze_credits, status_updated_at = NOW()
+		WHERE id = @id
+		RETURNING id
+	)
+	INSERT INTO account_status_changes (account_id, from_status, to_status, reason)
+	SELECT id, @from_status, @status, @reason FROM acc`
+
+	// LOCK_SPENDABLE_BALANCE_QUERY locks the balance row and returns what may be debited from it: the balance less
+	// active holds, plus the credit limit. Holds are only placed under the same row lock, so the result stays valid
+	// until the transaction ends.
+	LOCK_SPENDABLE_BALANCE_QUERY = `
+	SELECT b.balance + b.credit_limit - COALESCE((
+		SELECT SUM(h.amount) FROM holds h
+		WHERE h.account_id = b.account_id AND h.currency = b.currency AND h.status = 'active' AND h.expires_at > NOW()
+	), 0)
+	FROM balances b WHERE b.account_id = @account_id AND b.currency = @currency FOR UPDATE OF b`
+
+	// LOCK_BALANCES_QUERY locks the balances of the given account and currency pairs in a fixed order.
+	LOCK_BALANCES_QUERY = `
+	SELECT b.account_id, b.currency FROM balances b
+	JOIN UNNEST(@account_ids::varchar[], @currencies::varchar[]) AS l (account_id, currency)
+		ON l.account_id = b.account_id AND l.currency = b.currency
+	ORDER BY b.account_id, b.currency
+	FOR UPDATE OF b`
+
+	INSERT_JOURNAL_ENTRY_QUERY = `INSERT INTO journal_entries (id, txn_id, operation) VALUES (@id, @txn_id, @operation)`
+
+	// INSERT_POSTING_QUERY applies a posting to the account balance and records it together with the resulting balance.
+	INSERT_POSTING_QUERY = `
+	WITH bal AS (
+		INSERT INTO balances (account_id, currency, balance)
+		VALUES (@account_id, @currency, @amount)
+		ON CONFLICT (account_id, currency) DO UPDATE SET balance = balances.balance + EXCLUDED.balance
+		RETURNING balance
+	)
+	INSERT INTO postings (entry_id, account_id, currency, amount, balance_after)
+	SELECT @entry_id, @account_id, @currency, @amount, balance FROM bal`
+
+	GET_ACCOUNT_POSTINGS_QUERY = `
+	SELECT p.entry_id, e.txn_id, e.operation, p.currency, p.amount, p.balance_after, p.created_at
+	FROM postings p JOIN journal_entries e ON e.id = p.entry_id
+	WHERE p.account_id = @account_id
+	ORDER BY p.id`
+
+	INSERT_TRANSACTION_QUERY = `
+	INSERT INTO transactions (id, account_id, amount, currency, txntype, sender_id, receiver_id, status, entry_id,
+		counter_amount, counter_currency, fx_rate, fx_spread, quote_id, reverses_id, failure_reason, batch_id, reference)
+	VALUES (@id, @account_id, @amount, @currency, @txntype, @sender_id, @receiver_id, @status, NULLIF(@entry_id, ''),
+		@counter_amount, NULLIF(@counter_currency, ''), @fx_rate, @fx_spread, NULLIF(@quote_id, ''), NULLIF(@reverses_id, ''),
+		NULLIF(@failure_reason, ''), NULLIF(@batch_id, ''), NULLIF(@reference, ''))`
+
+	UPDATE_TRANSACTION_OUTCOME_QUERY = `
+	UPDATE transactions SET status = @status, entry_id = NULLIF(@entry_id, ''), failure_reason = NULLIF(@failure_reason, '')
+	WHERE id = @id AND txntype = @txntype`
+
+	INSERT_FX_QUOTE_QUERY = `INSERT INTO fx_quotes (id, from_currency, to_currency, rate, spread, expires_at) VALUES (@id, @from_currency, @to_currency, @rate, @spread, @expires_at)`
+
+	// LOCK_FX_QUOTE_QUERY reads an unused, unexpired quote and keeps it from other transfers until the transfer
+	// reading it ends.
+	LOCK_FX_QUOTE_QUERY = `
+	SELECT rate, spread FROM fx_quotes
+	WHERE id = @id AND from_currency = @from_currency AND to_currency = @to_currency AND used_by IS NULL AND expires_at > NOW()
+	FOR UPDATE`
+
+	// USE_FX_QUOTE_QUERY consumes a quote locked by a completed transfer, so that it backs exactly one.
+	USE_FX_QUOTE_QUERY = `UPDATE fx_quotes SET used_by = @used_by WHERE id = @id`
+
+	TRANSACTION_COLUMNS = `id, account_id, amount, currency, txntype, sender_id, receiver_id, timestamp::timestamptz, status, counter_amount, counter_currency, fx_rate, fx_spread, COALESCE(reverses_id, ''), reversed_amount, COALESCE(failure_reason, ''),
+	COALESCE(batch_id, ''), COALESCE(reference, '')`
+
+	GET_TRANSACTIONS_QUERY       = `SELECT ` + TRANSACTION_COLUMNS + ` FROM transactions WHERE id = @id ORDER BY timestamp::timestamptz DESC`
+	GET_BATCH_TRANSACTIONS_QUERY = `SELECT ` + TRANSACTION_COLUMNS + ` FROM transactions WHERE batch_id = @batch_id ORDER BY id, txntype`
+	LOCK_TRANSACTIONS_QUERY      = `SELECT ` + TRANSACTION_COLUMNS + ` FROM transactions WHERE id = @id ORDER BY txntype FOR UPDATE`
+
+	ADD_REVERSED_AMOUNT_QUERY = `UPDATE transactions SET reversed_amount = reversed_amount + @amount WHERE id = @id AND txntype = @txntype`
+
+	GET_IDEMPOTENCY_RECORD_QUERY = `
+	SELECT request_hash, status_code, response_body, created_at, expires_at FROM idempotency_records
+	WHERE idempotency_key = @idempotency_key AND operation = @operation AND caller = @caller AND expires_at > NOW()`
+
+	// SAVE_IDEMPOTENCY_RECORD_QUERY only replaces a record once it has expired.
+	SAVE_IDEMPOTENCY_RECORD_QUERY = `
+	INSERT INTO idempotency_records (idempotency_key, operation, caller, request_hash, status_code, response_body, expires_at)
+	VALUES (@idempotency_key, @operation, @caller, @request_hash, @status_code, @response_body, @expires_at)
+	ON CONFLICT (idempotency_key, operation, caller) DO UPDATE SET
+		request_hash = EXCLUDED.request_hash, status_code = EXCLUDED.status_code, response_body = EXCLUDED.response_body,
+		created_at = NOW(), expires_at = EXCLUDED.expires_at
+	WHERE idempotency_records.expires_at <= NOW()`
+
+	PURGE_IDEMPOTENCY_RECORDS_QUERY = `DELETE FROM idempotency_records WHERE expires_at <= @before`
+
+	INSERT_HOLD_QUERY = `
+	INSERT INTO holds (id, account_id, currency, amount, expires_at) VALUES (@id, @account_id, @currency, @amount, @expires_at)
+	RETURNING created_at`
+
+	GET_HOLD_QUERY  = `SELECT id, account_id, currency, amount, captured_amount, status, COALESCE(capture_txn_id, ''), expires_at, created_at FROM holds WHERE id = @id`
+	LOCK_HOLD_QUERY = GET_HOLD_QUERY + ` FOR UPDATE`
+
+	UPDATE_HOLD_QUERY = `
+	UPDATE holds SET status = @status, captured_amount = @captured_amount, capture_txn_id = NULLIF(@capture_txn_id, ''), updated_at = NOW()
+	WHERE id = @id`
+
+	EXPIRE_HOLDS_QUERY = `UPDATE holds SET status = 'expired', updated_at = NOW() WHERE status = 'active' AND expires_at <= @now`
+
+	LOCK_BALANCE_QUERY = `SELECT balance FROM balances WHERE account_id = @account_id AND currency = @currency FOR UPDATE`
+
+	// SET_CREDIT_LIMIT_QUERY sets the credit limit of a balance, opening the balance at zero if there is none yet.
+	SET_CREDIT_LIMIT_QUERY = `
+	INSERT INTO balances (account_id, currency, credit_limit)
+	VALUES (@account_id, @currency, @credit_limit)
+	ON CONFLICT (account_id, currency) DO UPDATE SET credit_limit = EXCLUDED.credit_limit`
+
+	CLEAR_CREDIT_LIMIT_QUERY = `UPDATE balances SET credit_limit = 0 WHERE account_id = @account_id AND currency = @currency`
+
+	GET_OVERDRAWN_BALANCES_QUERY = `
+	SELECT b.account_id, b.currency FROM balances b
+	JOIN accounts a ON a.id = b.account_id
+	WHERE NOT a.is_system AND b.balance < 0
+	ORDER BY b.account_id, b.currency`
+
+	OVERDRAFT_CHARGED_QUERY = `SELECT EXISTS (SELECT 1 FROM transactions WHERE id = @id AND txntype = 'overdraft_charge')`
+
+	// GET_SAVINGS_BALANCES_QUERY returns the balances of savings accounts that are not closed, with the last day each
+	// has accrued interest for.
+	GET_SAVINGS_BALANCES_QUERY = `
+	SELECT b.account_id, b.currency, MAX(ia.accrual_date)
+	FROM balances b
+	JOIN accounts a ON a.id = b.account_id
+	LEFT JOIN interest_accruals ia ON ia.account_id = b.account_id AND ia.currency = b.currency AND NOT ia.carried
+	WHERE NOT a.is_system AND a.account_type = 'savings' AND a.status <> 'closed'
+	GROUP BY b.account_id, b.currency
+	ORDER BY b.account_id, b.currency`
+
+	// BALANCE_AT_QUERY returns the balance left by the last posting to it before @until, or zero before the first.
+	BALANCE_AT_QUERY = `
+	SELECT COALESCE((
+		SELECT balance_after FROM postings
+		WHERE account_id = @account_id AND currency = @currency AND created_at < @until
+		ORDER BY id DESC
+		LIMIT 1
+	), 0)`
+
+	INSERT_INTEREST_ACCRUAL_QUERY = `
+	INSERT INTO interest_accruals (account_id, currency, accrual_date, balance, annual_rate, amount)
+	VALUES (@account_id, @currency, @accrual_date, @balance, @annual_rate, @amount)
+	ON CONFLICT (account_id, currency, accrual_date, carried) DO NOTHING`
+
+	// CARRY_INTEREST_QUERY records what a payment left of the interest it paid as an unpaid accrual.
+	CARRY_INTEREST_QUERY = `
+	INSERT INTO interest_accruals (account_id, currency, accrual_date, balance, annual_rate, amount, carried)
+	VALUES (@account_id, @currency, @accrual_date, 0, 0, @amount, TRUE)`
+
+	INTEREST_POSTED_QUERY = `SELECT EXISTS (SELECT 1 FROM transactions WHERE id = @id AND txntype = 'interest')`
+
+	// LOCK_UNPOSTED_INTEREST_QUERY locks the unpaid accruals of a balance before @before, so that concurrent payments
+	// of them wait for each other.
+	LOCK_UNPOSTED_INTEREST_QUERY = `
+	SELECT accrual_date, carried, amount FROM interest_accruals
+	WHERE account_id = @account_id AND currency = @currency AND txn_id IS NULL AND accrual_date < @before
+	ORDER BY accrual_date, carried
+	FOR UPDATE`
+
+	// POST_INTEREST_ACCRUALS_QUERY marks the accruals a payment totalled as paid by it, and no accrual of a missed day
+	// recorded since.
+	POST_INTEREST_ACCRUALS_QUERY = `
+	UPDATE interest_accruals ia SET txn_id = @id
+	FROM UNNEST(@accrual_dates::date[], @carried::boolean[]) AS p (accrual_date, carried)
+	WHERE ia.account_id = @account_id AND ia.currency = @currency AND ia.txn_id IS NULL
+		AND ia.accrual_date = p.accrual_date AND ia.carried = p.carried`
+
+	// GET_EFFECTIVE_LIMITS_QUERY returns the limits of an account in a currency, each falling back to the limit set
+	// for the type of the account.
+	GET_EFFECTIVE_LIMITS_QUERY = `
+	SELECT COALESCE(al.max_single_amount, tl.max_single_amount), COALESCE(al.daily_amount, tl.daily_amount),
+		COALESCE(al.monthly_amount, tl.monthly_amount), COALESCE(al.daily_count, tl.daily_count),
+		COALESCE(al.monthly_count, tl.monthly_count), COALESCE(al.max_balance, tl.max_balance)
+	FROM accounts a
+	LEFT JOIN account_limits al ON al.account_id = a.id AND al.currency = @currency
+	LEFT JOIN account_limits tl ON tl.account_type = a.account_type AND tl.currency = @currency
+	WHERE a.id = @account_id`
+
+	// GET_OUTGOING_USAGE_QUERY totals the completed withdrawals, hold captures and transfers out of an account in a
+	// currency over the rolling day and month, with the fees charged on the withdrawals and transfers. Fees add to the
+	// amounts but not to the counts. Timestamps are written in CCT.
+	GET_OUTGOING_USAGE_QUERY = `
+	SELECT COALESCE(SUM(amount) FILTER (WHERE timestamp > (NOW() AT TIME ZONE 'cct') - INTERVAL '1 day'), 0),
+		COUNT(*) FILTER (WHERE txntype <> 'fee' AND timestamp > (NOW() AT TIME ZONE 'cct') - INTERVAL '1 day'),
+		COALESCE(SUM(amount), 0), COUNT(*) FILTER (WHERE txntype <> 'fee')
+	FROM transactions t
+	WHERE account_id = @account_id AND currency = @currency AND status = 'completed'
+		AND (txntype IN ('withdraw', 'sender', 'capture') OR (txntype = 'fee' AND EXISTS (
+			SELECT 1 FROM transactions sent WHERE sent.id = t.id AND sent.txntype IN ('withdraw', 'sender'))))
+		AND timestamp > (NOW() AT TIME ZONE 'cct') - INTERVAL '30 days'`
+
+	LIMITS_COLUMNS = `COALESCE(account_id, ''), COALESCE(account_type, ''), currency, max_single_amount, daily_amount,
+	monthly_amount, daily_count, monthly_count, max_balance, updated_at`
+
+	GET_LIMITS_QUERY = `
+	SELECT ` + LIMITS_COLUMNS + ` FROM account_limits
+	WHERE COALESCE(account_id, '') = @account_id AND COALESCE(account_type, '') = @account_type::varchar
+	ORDER BY currency`
+
+	SET_LIMITS_COLUMNS = `
+	max_single_amount = EXCLUDED.max_single_amount, daily_amount = EXCLUDED.daily_amount,
+	monthly_amount = EXCLUDED.monthly_amount, daily_count = EXCLUDED.daily_count, monthly_count = EXCLUDED.monthly_count,
+	max_balance = EXCLUDED.max_balance, updated_at = NOW()
+	RETURNING updated_at`
+
+	UPSERT_ACCOUNT_LIMITS_QUERY = `
+	INSERT INTO account_limits (account_id, currency, max_single_amount, daily_amount, monthly_amount, daily_count, monthly_count, max_balance)
+	VALUES (@account_id, @currency, @max_single_amount, @daily_amount, @monthly_amount, @daily_count, @monthly_count, @max_balance)
+	ON CONFLICT (account_id, currency) WHERE account_id IS NOT NULL DO UPDATE SET` + SET_LIMITS_COLUMNS
+
+	UPSERT_ACCOUNT_TYPE_LIMITS_QUERY = `
+	INSERT INTO account_limits (account_type, currency, max_single_amount, daily_amount, monthly_amount, daily_count, monthly_count, max_balance)
+	VALUES (@account_type, @currency, @max_single_amount, @daily_amount, @monthly_amount, @daily_count, @monthly_count, @max_balance)
+	ON CONFLICT (account_type, currency) WHERE account_type IS NOT NULL DO UPDATE SET` + SET_LIMITS_COLUMNS
+
+	DELETE_LIMITS_QUERY = `
+	DELETE FROM account_limits
+	WHERE COALESCE(account_id, '') = @account_id AND COALESCE(account_type, '') = @account_type::varchar AND currency = @currency`
+
+	INSERT_SCHEDULE_QUERY = `
+	INSERT INTO transfer_schedules (id, from_account_id, to_account_id, amount, currency, reference, every_seconds, cron,
+		start_at, end_at, status, next_run_at, occurrence, attempt)
+	VALUES (@id, @from, @to, @amount, @currency, NULLIF(@reference, ''), NULLIF(@every_seconds, 0), NULLIF(@cron, ''),
+		@start_at, @end_at, @status, @next_run_at, @occurrence, @attempt)
+	RETURNING created_at, updated_at`
+
+	SCHEDULE_COLUMNS = `id, from_account_id, to_account_id, amount, currency, COALESCE(reference, ''), COALESCE(every_seconds, 0),
+	COALESCE(cron, ''), start_at, end_at, status, next_run_at, occurrence, attempt, locked_until, last_run_at,
+	COALESCE(last_status, ''), COALESCE(last_error, ''), created_at, updated_at`
+
+	GET_SCHEDULE_QUERY  = `SELECT ` + SCHEDULE_COLUMNS + ` FROM transfer_schedules WHERE id = @id`
+	LOCK_SCHEDULE_QUERY = GET_SCHEDULE_QUERY + ` FOR UPDATE`
+
+	LIST_SCHEDULES_QUERY = `
+	SELECT ` + SCHEDULE_COLUMNS + ` FROM transfer_schedules
+	WHERE (from_account_id = @account_id OR to_account_id = @account_id) AND (@status::varchar = '' OR status = @status)
+	ORDER BY created_at DESC, id LIMIT @limit`
+
+	UPDATE_SCHEDULE_QUERY = `
+	UPDATE transfer_schedules SET status = @status, next_run_at = @next_run_at, occurrence = @occurrence, attempt = @attempt,
+		locked_until = @locked_until, last_run_at = @last_run_at, last_status = NULLIF(@last_status, ''),
+		last_error = NULLIF(@last_error, ''), updated_at = NOW()
+	WHERE id = @id
+	RETURNING updated_at`
+
+	// CLAIM_DUE_SCHEDULES_QUERY leases the due schedules that no other scheduler holds a lease on.
+	CLAIM_DUE_SCHEDULES_QUERY = `
+	UPDATE transfer_schedules SET locked_until = @locked_until
+	WHERE id IN (
+		SELECT id FROM transfer_schedules
+		WHERE status = 'active' AND next_run_at <= @now AND (locked_until IS NULL OR locked_until <= @now)
+		ORDER BY next_run_at LIMIT @limit
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + SCHEDULE_COLUMNS
+
+	INSERT_SCHEDULE_RUN_QUERY = `
+	INSERT INTO transfer_schedule_runs (schedule_id, occurrence, attempt, txn_id, scheduled_at, status, error, ran_at)
+	VALUES (@schedule_id, @occurrence, @attempt, @txn_id, @scheduled_at, @status, NULLIF(@error, ''), @ran_at)
+	ON CONFLICT DO NOTHING`
+
+	GET_SCHEDULE_RUNS_QUERY = `
+	SELECT schedule_id, occurrence, attempt, txn_id, scheduled_at, status, COALESCE(error, ''), ran_at
+	FROM transfer_schedule_runs WHERE schedule_id = @schedule_id
+	ORDER BY occurrence, attempt`
+
+	INSERT_WEBHOOK_QUERY = `
+	INSERT INTO webhooks (id, url, event_types, secret, status)
+	VALUES (@id, @url, @event_types, @secret, @status)
+	RETURNING created_at, updated_at`
+
+	WEBHOOK_COLUMNS = `id, url, event_types, secret, status, created_at, updated_at`
+
+	GET_WEBHOOK_QUERY   = `SELECT ` + WEBHOOK_COLUMNS + ` FROM webhooks WHERE id = @id`
+	LIST_WEBHOOKS_QUERY = `SELECT ` + WEBHOOK_COLUMNS + ` FROM webhooks ORDER BY created_at DESC, id`
+
+	UPDATE_WEBHOOK_STATUS_QUERY = `
+	UPDATE webhooks SET status = @status, updated_at = NOW()
+	WHERE id = @id
+	RETURNING ` + WEBHOOK_COLUMNS
+
+	GET_SUBSCRIBED_WEBHOOKS_QUERY = `
+	SELECT id FROM webhooks WHERE status = 'active' AND @event_type::varchar = ANY (event_types)
+	ORDER BY id`
+
+	INSERT_WEBHOOK_EVENT_QUERY = `
+	INSERT INTO webhook_events (id, type, payload)
+	VALUES (@id, @type, @payload::jsonb)
+	RETURNING created_at`
+
+	INSERT_WEBHOOK_DELIVERY_QUERY = `
+	INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, redelivery_of)
+	VALUES (@id, @webhook_id, @event_id, @event_type, @status, @attempts, @next_attempt_at, NULLIF(@redelivery_of, ''))
+	RETURNING created_at, updated_at`
+
+	WEBHOOK_DELIVERY_COLUMNS = `d.id, d.webhook_id, d.event_id, d.event_type, d.status, d.attempts, d.next_attempt_at,
+	d.last_attempt_at, COALESCE(d.last_status, 0), COALESCE(d.last_error, ''), COALESCE(d.redelivery_of, ''), d.locked_until,
+	d.created_at, d.updated_at`
+
+	GET_WEBHOOK_DELIVERY_BY_WEBHOOK_QUERY = `
+	SELECT ` + WEBHOOK_DELIVERY_COLUMNS + ` FROM webhook_deliveries d WHERE d.id = @id AND d.webhook_id = @webhook_id`
+
+	GET_WEBHOOK_DELIVERY_QUERY = `
+	SELECT ` + WEBHOOK_DELIVERY_COLUMNS + `, e.payload::text
+	FROM webhook_deliveries d JOIN webhook_events e ON e.id = d.event_id
+	WHERE d.id = @id AND d.webhook_id = @webhook_id`
+
+	LOCK_WEBHOOK_DELIVERY_QUERY = `
+	SELECT ` + WEBHOOK_DELIVERY_COLUMNS + ` FROM webhook_deliveries d WHERE d.id = @id FOR UPDATE`
+
+	LIST_WEBHOOK_DELIVERIES_QUERY = `
+	SELECT ` + WEBHOOK_DELIVERY_COLUMNS + ` FROM webhook_deliveries d
+	WHERE d.webhook_id = @webhook_id AND (@status::varchar = '' OR d.status = @status)
+	ORDER BY d.created_at DESC, d.id LIMIT @limit`
+
+	UPDATE_WEBHOOK_DELIVERY_QUERY = `
+	UPDATE webhook_deliveries SET status = @status, attempts = @attempts, next_attempt_at = @next_attempt_at,
+		last_attempt_at = @last_attempt_at, last_status = NULLIF(@last_status, 0), last_error = NULLIF(@last_error, ''),
+		locked_until = @locked_until, updated_at = NOW()
+	WHERE id = @id
+	RETURNING updated_at`
+
+	// CLAIM_DUE_WEBHOOK_DELIVERIES_QUERY leases the due deliveries to active webhooks that no other dispatcher holds a
+	// lease on, and returns them with the URL, secret and payload to send them with.
+	CLAIM_DUE_WEBHOOK_DELIVERIES_QUERY = `
+	WITH claimed AS (
+		UPDATE webhook_deliveries SET locked_until = @locked_until
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending' AND w.status = 'active' AND d.next_attempt_at <= @now
+				AND (d.locked_until IS NULL OR d.locked_until <= @now)
+			ORDER BY d.next_attempt_at LIMIT @limit
+			FOR UPDATE OF d SKIP LOCKED
 		)
-		ON CONFLICT DO NOTHING
-	), txns_transfer_failed AS (
-		INSERT INTO transactions (id, account_id, amount, txntype, sender_id, receiver_id, status)
-		SELECT $3, $5, $2, 'receiver', $1, $5, 'failed'
-		WHERE $4 = 'sender' AND (SELECT COUNT(*) FROM accs) = 0
+		RETURNING *
 	)
-	SELECT COUNT(*) FROM accs 
-	`
+	SELECT ` + WEBHOOK_DELIVERY_COLUMNS + `, w.url, w.secret, e.payload::text
+	FROM claimed d JOIN webhooks w ON w.id = d.webhook_id JOIN webhook_events e ON e.id = d.event_id
+	ORDER BY d.next_attempt_at`
+
+	INSERT_WEBHOOK_ATTEMPT_QUERY = `
+	INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, attempted_at, duration_ms)
+	VALUES (@delivery_id, @attempt, NULLIF(@status_code, 0), NULLIF(@error, ''), @attempted_at, @duration_ms)
+	ON CONFLICT DO NOTHING`
 
-	GET_ACCOUNT_TRANSACTIONS_QUERY = `SELECT id, account_id, amount, txntype, sender_id, receiver_id, timestamp::timestamptz, status FROM transactions WHERE account_id = @account_id`
-	GET_TRANSACTIONS_QUERY         = `SELECT id, account_id, amount, txntype, sender_id, receiver_id, timestamp::timestamptz, status FROM transactions WHERE id = @id ORDER BY timestamp::timestamptz DESC`
+	GET_WEBHOOK_ATTEMPTS_QUERY = `
+	SELECT delivery_id, attempt, COALESCE(status_code, 0), COALESCE(error, ''), attempted_at, duration_ms
+	FROM webhook_delivery_attempts WHERE delivery_id = @delivery_id
+	ORDER BY attempt`
 )
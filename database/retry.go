@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	DEFAULT_TRANSFER_RETRY_ATTEMPTS = 5
+	DEFAULT_TRANSFER_RETRY_BACKOFF  = 10 * time.Millisecond
+)
+
+// ledgerTxOptions is the isolation level of every operation that moves money or changes what an account may spend:
+// deposits, withdrawals, transfers, reversals, holds, overdraft charges, interest payments and account closures.
+// They run serializably, so each commits only if it could have run alone, and one that raced another is aborted
+// with a serialization failure and retried by inTx.
+var ledgerTxOptions = pgx.TxOptions{
+	IsoLevel: pgx.Serializable,
+}
+
+// TransferRetryAttempts is how many times a transaction moving money is tried before a serialization failure or
+// deadlock is returned, configurable through TRANSFER_RETRY_ATTEMPTS.
+func TransferRetryAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("TRANSFER_RETRY_ATTEMPTS"))
+	if err != nil || attempts < 1 {
+		return DEFAULT_TRANSFER_RETRY_ATTEMPTS
+	}
+	return attempts
+}
+
+// TransferRetryBackoff is the wait before the first retry of a transaction moving money, doubled for every retry
+// after it, configurable through TRANSFER_RETRY_BACKOFF.
+func TransferRetryBackoff() time.Duration {
+	backoff, err := time.ParseDuration(os.Getenv("TRANSFER_RETRY_BACKOFF"))
+	if err != nil || backoff <= 0 {
+		return DEFAULT_TRANSFER_RETRY_BACKOFF
+	}
+	return backoff
+}
+
+// isRetryable reports whether err aborted a transaction only because it raced another one.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected
+}
+
+// inTx runs fn in a database transaction and commits it. Nothing fn did is kept unless the commit succeeds. A
+// transaction aborted by a serialization failure or a deadlock is run again from the start, as retryTx describes.
+func (p *Postgres) inTx(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	return retryTx(ctx, TransferRetryAttempts(), TransferRetryBackoff(), func() error {
+		return p.runTx(ctx, opts, fn)
+	})
+}
+
+// retryTx calls run until it succeeds, fails for any reason but racing another transaction, or has been called
+// attempts times. Each retry waits for retryWait, so that the transactions that collided do not collide again.
+func retryTx(ctx context.Context, attempts int, backoff time.Duration, run func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = run()
+		if err == nil || !isRetryable(err) || attempt >= attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w : gave up retrying after %d attempts : %w", ctx.Err(), attempt, err)
+		case <-time.After(retryWait(backoff, attempt)):
+		}
+	}
+}
+
+// retryWait is the wait after a failed attempt: the backoff doubled for every attempt before it, and jittered by up
+// to one more backoff.
+func retryWait(backoff time.Duration, attempt int) time.Duration {
+	return backoff<<(attempt-1) + rand.N(backoff)
+}
+
+func (p *Postgres) runTx(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := p.Db.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction : %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: pgerrcode.SerializationFailure}, want: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: pgerrcode.DeadlockDetected}, want: true},
+		{name: "wrapped serialization failure", err: fmt.Errorf("unable to commit transaction : %w", &pgconn.PgError{Code: pgerrcode.SerializationFailure}), want: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: pgerrcode.UniqueViolation}, want: false},
+		{name: "lock not available", err: &pgconn.PgError{Code: pgerrcode.LockNotAvailable}, want: false},
+		{name: "not a database error", err: ErrInsufficientFunds, want: false},
+		{name: "no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	backoff := 10 * time.Millisecond
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		base := backoff << (attempt - 1)
+		for range 100 {
+			wait := retryWait(backoff, attempt)
+			if wait < base || wait >= base+backoff {
+				t.Fatalf("retryWait(%s, %d) = %s, want within [%s, %s)", backoff, attempt, wait, base, base+backoff)
+			}
+		}
+	}
+}
+
+func TestRetryTx(t *testing.T) {
+	serializationFailure := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+
+	tests := []struct {
+		name      string
+		failures  []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "succeeds at once", wantCalls: 1},
+		{name: "succeeds after retries", failures: []error{serializationFailure, serializationFailure}, wantCalls: 3},
+		{name: "does not retry other errors", failures: []error{ErrAccountNotFound}, wantCalls: 1, wantErr: ErrAccountNotFound},
+		{name: "gives up after the last attempt", failures: []error{serializationFailure, serializationFailure, serializationFailure, serializationFailure, serializationFailure}, wantCalls: 4, wantErr: serializationFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryTx(context.Background(), 4, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retryTx() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("retryTx() ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryTxBacksOff(t *testing.T) {
+	backoff := 5 * time.Millisecond
+
+	var attempts []time.Time
+	start := time.Now()
+	err := retryTx(context.Background(), 4, backoff, func() error {
+		attempts = append(attempts, time.Now())
+		return &pgconn.PgError{Code: pgerrcode.DeadlockDetected}
+	})
+	if !isRetryable(err) {
+		t.Fatalf("retryTx() error = %v, want the deadlock of the last attempt", err)
+	}
+	if len(attempts) != 4 {
+		t.Fatalf("retryTx() ran %d times, want 4", len(attempts))
+	}
+
+	// Every retry waits at least the backoff doubled for each attempt before it.
+	for i := 1; i < len(attempts); i++ {
+		want := backoff << (i - 1)
+		if waited := attempts[i].Sub(attempts[i-1]); waited < want {
+			t.Errorf("retry %d waited %s, want at least %s", i, waited, want)
+		}
+	}
+	if elapsed, want := time.Since(start), 7*backoff; elapsed < want {
+		t.Errorf("retryTx() took %s, want at least %s", elapsed, want)
+	}
+}
+
+func TestRetryTxStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := retryTx(ctx, 10, time.Hour, func() error {
+		calls++
+		cancel()
+		return &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("retryTx() error = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("retryTx() ran %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,350 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const reversalEntryOperation = "reversal"
+
+// ReversalParams reverses Amount of the original transaction, or whatever is left of it when Amount is zero.
+// For transfers the amount is in the sender's currency.
+type ReversalParams struct {
+	TxnID      string
+	OriginalID string
+	Amount     decimal.Decimal
+}
+
+// reversal is the compensating movement for a transaction: the entry that posts it, the records it adds to the
+// history, and how much each original leg has had reversed.
+type reversal struct {
+	entry    *JournalEntry
+	records  []*TransactionRecord
+	reversed map[TxnType]decimal.Decimal
+
+	// debit is the posting taking money back from a customer, which must be covered by what the account may spend.
+	debit Posting
+}
+
+// PrimaryLeg is the leg a reversal amount is measured against: the sender of a transfer, or the only leg otherwise.
+// The line of a fee charged with the transaction is not a leg, so reversing a transaction does not refund its fee.
+func PrimaryLeg(legs []TransactionRecord) *TransactionRecord {
+	var only *TransactionRecord
+	count := 0
+	for i := range legs {
+		switch legs[i].TxnType {
+		case TxnTypeSender:
+			return &legs[i]
+		case TxnTypeFee:
+			continue
+		}
+		only = &legs[i]
+		count++
+	}
+	if count == 1 {
+		return only
+	}
+	return nil
+}
+
+func planReversal(legs []TransactionRecord, params *ReversalParams) (*reversal, error) {
+	if len(legs) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+
+	primary := PrimaryLeg(legs)
+	if primary == nil || primary.Status != utils.COMPLETED {
+		return nil, ErrNotReversible
+	}
+
+	remaining := primary.Amount.Sub(primary.ReversedAmount)
+	if !remaining.IsPositive() {
+		return nil, ErrAlreadyReversed
+	}
+
+	amount := params.Amount
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if amount.GreaterThan(remaining) {
+		return nil, ErrReversalExceedsOriginal
+	}
+
+	r := &reversal{
+		entry: &JournalEntry{
+			ID:        uuid.NewString(),
+			TxnID:     params.TxnID,
+			Operation: reversalEntryOperation,
+		},
+		reversed: map[TxnType]decimal.Decimal{
+			primary.TxnType: amount,
+		},
+	}
+
+	record := &TransactionRecord{
+		ID:         params.TxnID,
+		AccountID:  primary.AccountID,
+		Amount:     amount,
+		Currency:   primary.Currency,
+		Status:     utils.COMPLETED,
+		EntryID:    r.entry.ID,
+		ReversesID: primary.ID,
+	}
+
+	switch primary.TxnType {
+	case TxnTypeDeposit:
+		record.TxnType = TxnTypeReversalDebit
+		r.debit = Posting{AccountID: primary.AccountID, Currency: primary.Currency, Amount: amount.Neg()}
+		r.entry.Postings = []Posting{
+			r.debit,
+			{AccountID: SYSTEM_CASH_ACCOUNT, Currency: primary.Currency, Amount: amount},
+		}
+		r.records = []*TransactionRecord{record}
+
+	case TxnTypeWithdraw, TxnTypeCapture:
+		record.TxnType = TxnTypeReversalCredit
+		r.entry.Postings = []Posting{
+			{AccountID: SYSTEM_CASH_ACCOUNT, Currency: primary.Currency, Amount: amount.Neg()},
+			{AccountID: primary.AccountID, Currency: primary.Currency, Amount: amount},
+		}
+		r.records = []*TransactionRecord{record}
+
+	case TxnTypeSender:
+		if err := r.planTransferReversal(legs, primary, record, amount, remaining); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrNotReversible
+	}
+
+	return r, nil
+}
+
+// planTransferReversal sends money back from the receiver. A partial reversal of a converted transfer takes back
+// the same share of the received amount, at the rate the transfer was made at.
+func (r *reversal) planTransferReversal(legs []TransactionRecord, sender *TransactionRecord, record *TransactionRecord,
+	amount decimal.Decimal, remaining decimal.Decimal) error {
+	var receiver *TransactionRecord
+	for i := range legs {
+		if legs[i].TxnType == TxnTypeReceiver {
+			receiver = &legs[i]
+		}
+	}
+	if receiver == nil {
+		return ErrNotReversible
+	}
+
+	toAmount := receiver.Amount.Sub(receiver.ReversedAmount)
+	if amount.LessThan(remaining) {
+		scale, _ := utils.CurrencyScale(receiver.Currency)
+		toAmount = receiver.Amount.Mul(amount).Div(sender.Amount).RoundDown(scale)
+	}
+	if !toAmount.IsPositive() {
+		return fmt.Errorf("%w : reversing '%s %s' of transaction '%s'", utils.ErrAmountNotPositive, amount, sender.Currency, sender.ID)
+	}
+	r.reversed[TxnTypeReceiver] = toAmount
+
+	params := &TransferParams{
+		TxnID:      record.ID,
+		From:       receiver.AccountID,
+		To:         sender.AccountID,
+		Amount:     toAmount,
+		Currency:   receiver.Currency,
+		ToCurrency: sender.Currency,
+	}
+	r.entry.Postings = transferPostings(params, amount)
+	r.debit = r.entry.Postings[0]
+
+	debit := &TransactionRecord{
+		ID:         record.ID,
+		AccountID:  receiver.AccountID,
+		Amount:     toAmount,
+		Currency:   receiver.Currency,
+		TxnType:    TxnTypeReversalDebit,
+		SenderID:   receiver.AccountID,
+		ReceiverID: sender.AccountID,
+		Status:     utils.COMPLETED,
+		EntryID:    record.EntryID,
+		ReversesID: sender.ID,
+		FxRate:     receiver.FxRate,
+		FxSpread:   receiver.FxSpread,
+	}
+
+	record.TxnType = TxnTypeReversalCredit
+	record.SenderID = receiver.AccountID
+	record.ReceiverID = sender.AccountID
+	record.FxRate = sender.FxRate
+	record.FxSpread = sender.FxSpread
+
+	if receiver.Currency != sender.Currency {
+		debit.CounterAmount = decimal.NewNullDecimal(amount)
+		debit.CounterCurrency = sender.Currency
+		record.CounterAmount = decimal.NewNullDecimal(toAmount)
+		record.CounterCurrency = receiver.Currency
+	}
+
+	r.records = []*TransactionRecord{debit, record}
+	return nil
+}
+
+func (p *Postgres) Reverse(ctx context.Context, params *ReversalParams) ([]*TransactionRecord, error) {
+	var records []*TransactionRecord
+
+	err := p.inTx(ctx, ledgerTxOptions, func(tx pgx.Tx) error {
+		var err error
+		records, err = p.reverse(ctx, tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to reverse '%s' : %w", params.OriginalID, err)
+	}
+
+	return records, nil
+}
+
+// reverse posts the reversal and records it within tx.
+func (p *Postgres) reverse(ctx context.Context, tx pgx.Tx, params *ReversalParams) ([]*TransactionRecord, error) {
+	legs, err := lockTransactions(ctx, tx, params.OriginalID)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := planReversal(legs, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkPostings(ctx, tx, r.entry.Postings); err != nil {
+		return nil, err
+	}
+
+	if r.debit.Amount.IsNegative() {
+		spendable, found, err := LockSpendableBalance(ctx, tx, r.debit.AccountID, r.debit.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find balance of account '%s' : %v", r.debit.AccountID, err)
+		}
+		if !found || spendable.LessThan(r.debit.Amount.Neg()) {
+			return nil, ErrInsufficientFunds
+		}
+	}
+
+	if err = PostJournalEntry(ctx, tx, r.entry); err != nil {
+		return nil, err
+	}
+
+	for _, txn := range r.records {
+		if err = InsertTransaction(ctx, tx, txn); err != nil {
+			return nil, err
+		}
+	}
+
+	for txnType, amount := range r.reversed {
+		_, err = tx.Exec(
+			ctx,
+			ADD_REVERSED_AMOUNT_QUERY,
+			pgx.NamedArgs{
+				"id":      params.OriginalID,
+				"txntype": txnType,
+				"amount":  amount,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to update reversed amount of transaction '%s' : %v", params.OriginalID, err)
+		}
+	}
+
+	if err = p.queueTransactionEvents(ctx, tx, r.records...); err != nil {
+		return nil, err
+	}
+
+	return r.records, nil
+}
+
+// lockTransactions reads every leg of a transaction, holding row locks on them until the transaction ends so that
+// concurrent reversals see each other's reversed amounts.
+func lockTransactions(ctx context.Context, tx pgx.Tx, txnID string) ([]TransactionRecord, error) {
+	results, err := tx.Query(
+		ctx,
+		LOCK_TRANSACTIONS_QUERY,
+		pgx.NamedArgs{
+			"id": txnID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query transaction '%s' : %v", txnID, err)
+	}
+	defer results.Close()
+
+	legs := make([]TransactionRecord, 0)
+	for results.Next() {
+		txn, err := scanTransaction(results)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse transaction '%s' : %v", txnID, err)
+		}
+		legs = append(legs, txn)
+	}
+
+	return legs, results.Err()
+}
+
+func (m *MemoryStore) Reverse(_ context.Context, params *ReversalParams) ([]*TransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	legs := make([]TransactionRecord, 0)
+	for _, txn := range m.transactions {
+		if txn.ID == params.OriginalID {
+			legs = append(legs, txn)
+		}
+	}
+
+	r, err := planReversal(legs, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, txn := range r.records {
+		if m.recordedTransaction(txn.ID, txn.TxnType) != nil {
+			return nil, fmt.Errorf("unable to record reversal '%s' : it already exists", params.TxnID)
+		}
+	}
+
+	for _, posting := range r.entry.Postings {
+		if acc := m.customerAccount(posting.AccountID); acc != nil {
+			if err = acc.state().checkPosting(posting); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r.debit.Amount.IsNegative() {
+		spendable, found := m.spendable(r.debit.AccountID, r.debit.Currency)
+		if !found || spendable.LessThan(r.debit.Amount.Neg()) {
+			return nil, ErrInsufficientFunds
+		}
+	}
+
+	if err = m.postJournalEntry(r.entry); err != nil {
+		return nil, err
+	}
+
+	for _, txn := range r.records {
+		m.insertTransaction(txn)
+	}
+
+	for i := range m.transactions {
+		txn := &m.transactions[i]
+		if amount, ok := r.reversed[txn.TxnType]; ok && txn.ID == params.OriginalID {
+			txn.ReversedAmount = txn.ReversedAmount.Add(amount)
+		}
+	}
+	m.queueTransactionEvents(r.records...)
+
+	return r.records, nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+func reverse(store AccountStore, originalID string, amount string) ([]*TransactionRecord, error) {
+	params := &ReversalParams{TxnID: uuid.NewString(), OriginalID: originalID}
+	if len(amount) > 0 {
+		params.Amount = decimal.RequireFromString(amount)
+	}
+	return store.Reverse(context.Background(), params)
+}
+
+func balanceIn(t *testing.T, store AccountStore, accountID string, currency string) decimal.Decimal {
+	t.Helper()
+
+	account, err := store.GetAccount(context.Background(), accountID)
+	if err != nil {
+		t.Fatalf("GetAccount(%s) error = %v", accountID, err)
+	}
+	for _, balance := range account.Balances {
+		if balance.Currency == currency {
+			return balance.Balance
+		}
+	}
+	return decimal.Zero
+}
+
+func TestReverseWithdrawal(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := fundedAccounts(t, store, 1, decimal.NewFromInt(100))[0]
+
+			withdrawal, err := store.Withdraw(ctx, &WithdrawParams{TxnID: uuid.NewString(), AccountID: accountID, Amount: decimal.NewFromInt(40), Currency: "USD"})
+			if err != nil || withdrawal.Status != utils.COMPLETED {
+				t.Fatalf("Withdraw() = %+v, %v", withdrawal, err)
+			}
+
+			records, err := reverse(store, withdrawal.ID, "")
+			if err != nil {
+				t.Fatalf("Reverse() error = %v", err)
+			}
+			if len(records) != 1 || records[0].TxnType != TxnTypeReversalCredit || !records[0].Amount.Equal(decimal.NewFromInt(40)) || records[0].ReversesID != withdrawal.ID {
+				t.Errorf("Reverse() = %+v, want a reversal credit of 40 for '%s'", records, withdrawal.ID)
+			}
+			if balance := balanceOf(t, store, accountID); !balance.Equal(decimal.NewFromInt(100)) {
+				t.Errorf("balance = %s, want 100", balance)
+			}
+
+			if _, err = reverse(store, withdrawal.ID, ""); !errors.Is(err, ErrAlreadyReversed) {
+				t.Errorf("Reverse() again error = %v, want %v", err, ErrAlreadyReversed)
+			}
+		})
+	}
+}
+
+// TestPartialReversals reverses a deposit in parts. Each part must be taken from what is left, and none may take
+// more than that.
+func TestPartialReversals(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accounts, err := store.CreateAccounts(ctx, []*AccountParams{{}})
+			if err != nil {
+				t.Fatalf("CreateAccounts() error = %v", err)
+			}
+			accountID := accounts[0].ID
+			deposit, err := store.Deposit(ctx, &DepositParams{TxnID: uuid.NewString(), AccountID: accountID, Amount: decimal.NewFromInt(100), Currency: "USD"})
+			if err != nil || deposit.Status != utils.COMPLETED {
+				t.Fatalf("Deposit() = %+v, %v", deposit, err)
+			}
+
+			steps := []struct {
+				amount  string
+				wantErr error
+				balance int64
+			}{
+				{amount: "30", balance: 70},
+				{amount: "80", wantErr: ErrReversalExceedsOriginal, balance: 70},
+				{amount: "70", balance: 0},
+				{amount: "1", wantErr: ErrAlreadyReversed, balance: 0},
+			}
+			for _, step := range steps {
+				_, err = reverse(store, deposit.ID, step.amount)
+				if !errors.Is(err, step.wantErr) {
+					t.Errorf("Reverse(%s) error = %v, want %v", step.amount, err, step.wantErr)
+				}
+				if balance := balanceOf(t, store, accountID); !balance.Equal(decimal.NewFromInt(step.balance)) {
+					t.Errorf("balance after reversing %s = %s, want %d", step.amount, balance, step.balance)
+				}
+			}
+		})
+	}
+}
+
+// TestReverseConvertedTransfer reverses part of a transfer from USD to EUR. The receiver must give back the same
+// share of what it received, rounded down to the cent.
+func TestReverseConvertedTransfer(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountIDs := fundedAccounts(t, store, 2, decimal.NewFromInt(100))
+			from, to := accountIDs[0], accountIDs[1]
+
+			quote := &FxQuote{
+				ID:        uuid.NewString(),
+				Rate:      fx.Rate{From: "USD", To: "EUR", Rate: decimal.RequireFromString("0.9"), Spread: decimal.Zero},
+				ExpiresAt: time.Now().Add(time.Minute),
+			}
+			if err := store.CreateFxQuote(ctx, quote); err != nil {
+				t.Fatalf("CreateFxQuote() error = %v", err)
+			}
+			result, err := store.Transfer(ctx, &TransferParams{
+				TxnID:      uuid.NewString(),
+				From:       from,
+				To:         to,
+				Amount:     decimal.NewFromInt(10),
+				Currency:   "USD",
+				ToCurrency: "EUR",
+				QuoteID:    quote.ID,
+			})
+			if err != nil || result.Sender.Status != utils.COMPLETED {
+				t.Fatalf("Transfer() = %+v, %v", result, err)
+			}
+
+			// 3.33 of the 10 USD sent is 2.997 of the 9 EUR received.
+			records, err := reverse(store, result.Sender.ID, "3.33")
+			if err != nil {
+				t.Fatalf("Reverse() error = %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("Reverse() = %+v, want both legs of a transfer", records)
+			}
+			for _, record := range records {
+				want := map[TxnType]string{TxnTypeReversalDebit: "2.99", TxnTypeReversalCredit: "3.33"}[record.TxnType]
+				if !record.Amount.Equal(decimal.RequireFromString(want)) {
+					t.Errorf("%s of the reversal = %s %s, want %s", record.TxnType, record.Amount, record.Currency, want)
+				}
+			}
+			if balance := balanceIn(t, store, to, "EUR"); !balance.Equal(decimal.RequireFromString("6.01")) {
+				t.Errorf("EUR balance of receiver = %s, want 6.01", balance)
+			}
+			if balance := balanceOf(t, store, from); !balance.Equal(decimal.RequireFromString("93.33")) {
+				t.Errorf("balance of sender = %s, want 93.33", balance)
+			}
+		})
+	}
+}
+
+// TestReverseTransferReceiverCannotCover reverses a transfer whose receiver has spent what it received.
+func TestReverseTransferReceiverCannotCover(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountIDs := fundedAccounts(t, store, 2, decimal.NewFromInt(100))
+			from, to := accountIDs[0], accountIDs[1]
+
+			result, err := store.Transfer(ctx, &TransferParams{TxnID: uuid.NewString(), From: from, To: to, Amount: decimal.NewFromInt(40), Currency: "USD", ToCurrency: "USD"})
+			if err != nil || result.Sender.Status != utils.COMPLETED {
+				t.Fatalf("Transfer() = %+v, %v", result, err)
+			}
+			withdrawal, err := store.Withdraw(ctx, &WithdrawParams{TxnID: uuid.NewString(), AccountID: to, Amount: decimal.NewFromInt(120), Currency: "USD"})
+			if err != nil || withdrawal.Status != utils.COMPLETED {
+				t.Fatalf("Withdraw() = %+v, %v", withdrawal, err)
+			}
+
+			if _, err = reverse(store, result.Sender.ID, ""); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("Reverse() error = %v, want %v", err, ErrInsufficientFunds)
+			}
+			if balance := balanceOf(t, store, from); !balance.Equal(decimal.NewFromInt(60)) {
+				t.Errorf("balance of sender = %s, want 60", balance)
+			}
+			if balance := balanceOf(t, store, to); !balance.Equal(decimal.NewFromInt(20)) {
+				t.Errorf("balance of receiver = %s, want 20", balance)
+			}
+		})
+	}
+}
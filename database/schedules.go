@@ -0,0 +1,581 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DEFAULT_SCHEDULE_RETRY_ATTEMPTS = 3
+	DEFAULT_SCHEDULE_RETRY_BACKOFF  = 5 * time.Minute
+
+	DEFAULT_LIST_SCHEDULES_LIMIT = 50
+	MAX_LIST_SCHEDULES_LIMIT     = 200
+
+	// SCHEDULE_LEASE is how long a claimed schedule is kept from other schedulers. A scheduler that stops before
+	// recording its run leaves the schedule to be claimed again once the lease runs out.
+	SCHEDULE_LEASE = 5 * time.Minute
+)
+
+var (
+	ErrScheduleNotFound      = errors.New("schedule not found")
+	ErrInvalidScheduleChange = errors.New("schedule status cannot be changed this way")
+)
+
+type ScheduleStatus string
+
+const (
+	ScheduleStatusActive    ScheduleStatus = "active"
+	ScheduleStatusPaused    ScheduleStatus = "paused"
+	ScheduleStatusCancelled ScheduleStatus = "cancelled"
+	ScheduleStatusCompleted ScheduleStatus = "completed"
+)
+
+func IsScheduleStatus(status string) bool {
+	switch ScheduleStatus(status) {
+	case ScheduleStatusActive, ScheduleStatusPaused, ScheduleStatusCancelled, ScheduleStatusCompleted:
+		return true
+	}
+	return false
+}
+
+// Schedule is a standing order to transfer Amount from one account to another. It runs once at StartAt, every
+// Every from StartAt, or whenever Cron matches from StartAt, until EndAt. Occurrence and Attempt name the run due at
+// NextRunAt; the transaction ID of a run is derived from both, so a run that is repeated reuses its transaction
+// while a retry makes a new one.
+type Schedule struct {
+	ID        string
+	From      string
+	To        string
+	Amount    decimal.Decimal
+	Currency  string
+	Reference string
+	Every     time.Duration
+	Cron      string
+	StartAt   time.Time
+	EndAt     time.Time
+	Status    ScheduleStatus
+
+	NextRunAt  time.Time
+	Occurrence int
+	Attempt    int
+
+	LastRunAt  time.Time
+	LastStatus string
+	LastError  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	lockedUntil time.Time
+}
+
+// ScheduleRun records one attempt at one occurrence of a schedule.
+type ScheduleRun struct {
+	ScheduleID  string
+	Occurrence  int
+	Attempt     int
+	TxnID       string
+	ScheduledAt time.Time
+	Status      string
+	Error       string
+	RanAt       time.Time
+}
+
+// ScheduleFilter lists the schedules that pay from or to AccountID, optionally only those with Status.
+type ScheduleFilter struct {
+	AccountID string
+	Status    ScheduleStatus
+	Limit     int
+}
+
+// ScheduleRetryAttempts is how many times an occurrence of a schedule is tried before it is given up and the
+// schedule moves on to the next one, configurable through SCHEDULE_RETRY_ATTEMPTS.
+func ScheduleRetryAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("SCHEDULE_RETRY_ATTEMPTS"))
+	if err != nil || attempts < 1 {
+		return DEFAULT_SCHEDULE_RETRY_ATTEMPTS
+	}
+	return attempts
+}
+
+// ScheduleRetryBackoff is the wait before the first retry of a failed occurrence, doubled for every retry after it,
+// configurable through SCHEDULE_RETRY_BACKOFF.
+func ScheduleRetryBackoff() time.Duration {
+	backoff, err := time.ParseDuration(os.Getenv("SCHEDULE_RETRY_BACKOFF"))
+	if err != nil || backoff <= 0 {
+		return DEFAULT_SCHEDULE_RETRY_BACKOFF
+	}
+	return backoff
+}
+
+// IsOnce reports whether the schedule runs a single time.
+func (s *Schedule) IsOnce() bool {
+	return s.Every == 0 && len(s.Cron) == 0
+}
+
+// FirstRun is the first occurrence of the schedule, or the zero time when it has none before EndAt.
+func (s *Schedule) FirstRun() time.Time {
+	return s.nextAfter(s.StartAt.Add(-time.Nanosecond))
+}
+
+// nextAfter is the first occurrence of the schedule after t, or the zero time when there is none before EndAt.
+func (s *Schedule) nextAfter(t time.Time) time.Time {
+	var next time.Time
+
+	switch {
+	case s.Every > 0:
+		next = s.StartAt
+		if !t.Before(next) {
+			next = s.StartAt.Add((t.Sub(s.StartAt)/s.Every + 1) * s.Every)
+		}
+	case len(s.Cron) > 0:
+		cron, err := utils.ParseCron(s.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		next = cron.Next(t)
+	case t.Before(s.StartAt):
+		next = s.StartAt
+	}
+
+	if !s.EndAt.IsZero() && next.After(s.EndAt) {
+		return time.Time{}
+	}
+	return next
+}
+
+// moveOn schedules the occurrence after the one due, skipping those that passed while it was retried or the
+// service was down, and completes the schedule when there is none.
+func (s *Schedule) moveOn(now time.Time) {
+	s.Occurrence++
+	s.Attempt = 1
+
+	after := s.NextRunAt
+	if now.After(after) {
+		after = now
+	}
+	s.NextRunAt = s.nextAfter(after)
+
+	if s.NextRunAt.IsZero() && s.Status != ScheduleStatusCancelled {
+		s.Status = ScheduleStatusCompleted
+	}
+}
+
+// recordRun moves the schedule past a run: on to the next occurrence once the run completed or the retries are
+// spent, or else to a retry of the same occurrence after a backoff that doubles with every attempt.
+func (s *Schedule) recordRun(run *ScheduleRun) {
+	s.LastRunAt = run.RanAt
+	s.LastStatus = run.Status
+	s.LastError = run.Error
+	s.lockedUntil = time.Time{}
+
+	if run.Status == utils.COMPLETED || s.Attempt >= ScheduleRetryAttempts() {
+		s.moveOn(run.RanAt)
+		return
+	}
+
+	s.NextRunAt = run.RanAt.Add(ScheduleRetryBackoff() << (s.Attempt - 1))
+	s.Attempt++
+}
+
+// changeStatus pauses, resumes or cancels the schedule. A resumed schedule skips the occurrences that passed while
+// it was paused, except for a one-off schedule, which runs straight away.
+func (s *Schedule) changeStatus(status ScheduleStatus, now time.Time) error {
+	switch {
+	case status == ScheduleStatusPaused && s.Status == ScheduleStatusActive:
+	case status == ScheduleStatusActive && s.Status == ScheduleStatusPaused:
+		if !s.IsOnce() && s.NextRunAt.Before(now) {
+			s.NextRunAt = s.nextAfter(now)
+		}
+		if s.NextRunAt.IsZero() {
+			status = ScheduleStatusCompleted
+		}
+	case status == ScheduleStatusCancelled && (s.Status == ScheduleStatusActive || s.Status == ScheduleStatusPaused):
+	default:
+		return ErrInvalidScheduleChange
+	}
+
+	s.Status = status
+	return nil
+}
+
+func (s *Schedule) matches(filter *ScheduleFilter) bool {
+	if s.From != filter.AccountID && s.To != filter.AccountID {
+		return false
+	}
+	return len(filter.Status) == 0 || s.Status == filter.Status
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func scheduleArgs(s *Schedule) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"id":            s.ID,
+		"from":          s.From,
+		"to":            s.To,
+		"amount":        s.Amount,
+		"currency":      s.Currency,
+		"reference":     s.Reference,
+		"every_seconds": int64(s.Every / time.Second),
+		"cron":          s.Cron,
+		"start_at":      s.StartAt,
+		"end_at":        nullTime(s.EndAt),
+		"status":        s.Status,
+		"next_run_at":   nullTime(s.NextRunAt),
+		"occurrence":    s.Occurrence,
+		"attempt":       s.Attempt,
+		"locked_until":  nullTime(s.lockedUntil),
+		"last_run_at":   nullTime(s.LastRunAt),
+		"last_status":   s.LastStatus,
+		"last_error":    s.LastError,
+	}
+}
+
+func scanSchedule(row pgx.Row) (*Schedule, error) {
+	var (
+		s                                        = new(Schedule)
+		everySeconds                             int64
+		endAt, nextRunAt, lockedUntil, lastRunAt *time.Time
+	)
+
+	err := row.Scan(&s.ID, &s.From, &s.To, &s.Amount, &s.Currency, &s.Reference, &everySeconds, &s.Cron, &s.StartAt,
+		&endAt, &s.Status, &nextRunAt, &s.Occurrence, &s.Attempt, &lockedUntil, &lastRunAt, &s.LastStatus, &s.LastError,
+		&s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Every = time.Duration(everySeconds) * time.Second
+	for _, t := range []struct {
+		dst *time.Time
+		src *time.Time
+	}{{&s.EndAt, endAt}, {&s.NextRunAt, nextRunAt}, {&s.lockedUntil, lockedUntil}, {&s.LastRunAt, lastRunAt}} {
+		if t.src != nil {
+			*t.dst = *t.src
+		}
+	}
+	return s, nil
+}
+
+func querySchedule(ctx context.Context, q rowQuerier, query string, scheduleID string) (*Schedule, error) {
+	s, err := scanSchedule(q.QueryRow(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"id": scheduleID,
+		},
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query schedule '%s' : %w", scheduleID, err)
+	}
+	return s, nil
+}
+
+func (p *Postgres) querySchedules(ctx context.Context, query string, args pgx.NamedArgs) ([]*Schedule, error) {
+	rows, err := p.Db.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query schedules : %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make([]*Schedule, 0)
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse schedules : %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+func updateSchedule(ctx context.Context, tx pgx.Tx, s *Schedule) error {
+	err := tx.QueryRow(ctx, UPDATE_SCHEDULE_QUERY, scheduleArgs(s)).Scan(&s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to update schedule '%s' : %w", s.ID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) CreateSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error) {
+	err := p.Db.QueryRow(ctx, INSERT_SCHEDULE_QUERY, scheduleArgs(schedule)).Scan(&schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert schedule '%s' : %w", schedule.ID, err)
+	}
+	return schedule, nil
+}
+
+func (p *Postgres) GetSchedule(ctx context.Context, scheduleID string) (*Schedule, error) {
+	return querySchedule(ctx, p.Db, GET_SCHEDULE_QUERY, scheduleID)
+}
+
+func (p *Postgres) ListSchedules(ctx context.Context, filter *ScheduleFilter) ([]*Schedule, error) {
+	return p.querySchedules(ctx, LIST_SCHEDULES_QUERY, pgx.NamedArgs{
+		"account_id": filter.AccountID,
+		"status":     filter.Status,
+		"limit":      filter.Limit,
+	})
+}
+
+func (p *Postgres) ChangeScheduleStatus(ctx context.Context, scheduleID string, status ScheduleStatus) (*Schedule, error) {
+	var schedule *Schedule
+
+	err := p.inTx(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		schedule, err = querySchedule(ctx, tx, LOCK_SCHEDULE_QUERY, scheduleID)
+		if err != nil {
+			return err
+		}
+		if err = schedule.changeStatus(status, time.Now()); err != nil {
+			return err
+		}
+		return updateSchedule(ctx, tx, schedule)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// ClaimDueSchedules leases up to limit active schedules whose next run is due, skipping those claimed by another
+// scheduler.
+func (p *Postgres) ClaimDueSchedules(ctx context.Context, now time.Time, limit int) ([]*Schedule, error) {
+	return p.querySchedules(ctx, CLAIM_DUE_SCHEDULES_QUERY, pgx.NamedArgs{
+		"now":          now,
+		"locked_until": now.Add(SCHEDULE_LEASE),
+		"limit":        limit,
+	})
+}
+
+// RecordScheduleRun records a run and moves its schedule on. A run of an occurrence and attempt that is no longer
+// due, because another scheduler recorded it first, leaves the schedule as it is.
+func (p *Postgres) RecordScheduleRun(ctx context.Context, run *ScheduleRun) (*Schedule, error) {
+	var schedule *Schedule
+
+	err := p.inTx(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		schedule, err = querySchedule(ctx, tx, LOCK_SCHEDULE_QUERY, run.ScheduleID)
+		if err != nil {
+			return err
+		}
+		if schedule.Occurrence != run.Occurrence || schedule.Attempt != run.Attempt {
+			return nil
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			INSERT_SCHEDULE_RUN_QUERY,
+			pgx.NamedArgs{
+				"schedule_id":  run.ScheduleID,
+				"occurrence":   run.Occurrence,
+				"attempt":      run.Attempt,
+				"txn_id":       run.TxnID,
+				"scheduled_at": run.ScheduledAt,
+				"status":       run.Status,
+				"error":        run.Error,
+				"ran_at":       run.RanAt,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to insert run of schedule '%s' : %w", run.ScheduleID, err)
+		}
+
+		schedule.recordRun(run)
+		return updateSchedule(ctx, tx, schedule)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (p *Postgres) ListScheduleRuns(ctx context.Context, scheduleID string) ([]ScheduleRun, error) {
+	if _, err := p.GetSchedule(ctx, scheduleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Db.Query(
+		ctx,
+		GET_SCHEDULE_RUNS_QUERY,
+		pgx.NamedArgs{
+			"schedule_id": scheduleID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query runs of schedule '%s' : %w", scheduleID, err)
+	}
+	defer rows.Close()
+
+	runs := make([]ScheduleRun, 0)
+	for rows.Next() {
+		var run ScheduleRun
+		err = rows.Scan(&run.ScheduleID, &run.Occurrence, &run.Attempt, &run.TxnID, &run.ScheduledAt, &run.Status, &run.Error, &run.RanAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse runs of schedule '%s' : %w", scheduleID, err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (m *MemoryStore) CreateSchedule(_ context.Context, schedule *Schedule) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.schedules[schedule.ID]; ok {
+		return nil, fmt.Errorf("unable to insert schedule '%s' : it already exists", schedule.ID)
+	}
+
+	created := *schedule
+	created.CreatedAt = time.Now()
+	created.UpdatedAt = created.CreatedAt
+	m.schedules[created.ID] = &created
+
+	result := created
+	return &result, nil
+}
+
+func (m *MemoryStore) GetSchedule(_ context.Context, scheduleID string) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleID]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+
+	result := *schedule
+	return &result, nil
+}
+
+func (m *MemoryStore) ListSchedules(_ context.Context, filter *ScheduleFilter) ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules := make([]*Schedule, 0)
+	for _, schedule := range m.schedules {
+		if schedule.matches(filter) {
+			result := *schedule
+			schedules = append(schedules, &result)
+		}
+	}
+
+	slices.SortFunc(schedules, func(a, b *Schedule) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(schedules) > filter.Limit {
+		schedules = schedules[:filter.Limit]
+	}
+
+	return schedules, nil
+}
+
+func (m *MemoryStore) ChangeScheduleStatus(_ context.Context, scheduleID string, status ScheduleStatus) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleID]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+
+	changed := *schedule
+	if err := changed.changeStatus(status, time.Now()); err != nil {
+		return nil, err
+	}
+	changed.UpdatedAt = time.Now()
+	*schedule = changed
+
+	return &changed, nil
+}
+
+func (m *MemoryStore) ClaimDueSchedules(_ context.Context, now time.Time, limit int) ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]*Schedule, 0)
+	for _, schedule := range m.schedules {
+		if schedule.Status == ScheduleStatusActive && !schedule.NextRunAt.After(now) && !schedule.lockedUntil.After(now) {
+			due = append(due, schedule)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b *Schedule) int {
+		return a.NextRunAt.Compare(b.NextRunAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Schedule, 0, len(due))
+	for _, schedule := range due {
+		schedule.lockedUntil = now.Add(SCHEDULE_LEASE)
+		result := *schedule
+		claimed = append(claimed, &result)
+	}
+
+	return claimed, nil
+}
+
+func (m *MemoryStore) RecordScheduleRun(_ context.Context, run *ScheduleRun) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[run.ScheduleID]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+
+	if schedule.Occurrence == run.Occurrence && schedule.Attempt == run.Attempt {
+		m.scheduleRuns = append(m.scheduleRuns, *run)
+		schedule.recordRun(run)
+		schedule.UpdatedAt = time.Now()
+	}
+
+	result := *schedule
+	return &result, nil
+}
+
+func (m *MemoryStore) ListScheduleRuns(_ context.Context, scheduleID string) ([]ScheduleRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.schedules[scheduleID]; !ok {
+		return nil, ErrScheduleNotFound
+	}
+
+	runs := make([]ScheduleRun, 0)
+	for _, run := range m.scheduleRuns {
+		if run.ScheduleID == scheduleID {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
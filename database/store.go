@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrQuoteUnavailable    = errors.New("fx quote is unknown, expired or already used")
+	ErrInsufficientFunds   = errors.New("insufficient available balance")
+	ErrDestinationNotFound = errors.New("destination account not found")
+	ErrLimitExceeded       = errors.New("transaction exceeds a limit of the account")
+	ErrHoldNotFound        = errors.New("hold not found")
+	ErrHoldNotActive       = errors.New("hold has already been captured, voided or has expired")
+	ErrCaptureExceedsHold  = errors.New("capture amount exceeds the held amount")
+
+	ErrTransactionNotFound     = errors.New("transaction not found")
+	ErrNotReversible           = errors.New("only completed deposits, withdrawals, transfers and captures can be reversed")
+	ErrAlreadyReversed         = errors.New("transaction has already been fully reversed")
+	ErrReversalExceedsOriginal = errors.New("reversal amount exceeds what is left of the original transaction")
+)
+
+// AccountStore is everything the handlers need to persist. Implementations must keep every journal entry
+// balanced, never debit a customer balance beyond what its active holds and credit limit leave spendable, refuse to
+// move money through frozen or closed accounts, and record an operation only once per transaction ID.
+type AccountStore interface {
+	CreateAccounts(ctx context.Context, accounts []*AccountParams) ([]*Account, error)
+	GetAccount(ctx context.Context, accountID string) (*Account, error)
+	FindAccounts(ctx context.Context, filter *AccountFilter) ([]*Account, error)
+
+	Deposit(ctx context.Context, params *DepositParams) (*TransactionRecord, error)
+	Withdraw(ctx context.Context, params *WithdrawParams) (*TransactionRecord, error)
+	Transfer(ctx context.Context, params *TransferParams) (*TransferResult, error)
+	BatchTransfer(ctx context.Context, params *BatchTransferParams) ([]BatchLegResult, error)
+
+	Reverse(ctx context.Context, params *ReversalParams) ([]*TransactionRecord, error)
+
+	GetTransactions(ctx context.Context, txnID string) ([]TransactionRecord, error)
+	GetBatchTransactions(ctx context.Context, batchID string) ([]TransactionRecord, error)
+	ListAccountTransactions(ctx context.Context, query *TransactionQuery) (*TransactionPage, error)
+	ListAccountPostings(ctx context.Context, accountID string) ([]PostingRecord, error)
+
+	CreateFxQuote(ctx context.Context, quote *FxQuote) error
+
+	PlaceHold(ctx context.Context, params *HoldParams) (*Hold, error)
+	CaptureHold(ctx context.Context, params *CaptureParams) (*Hold, *TransactionRecord, error)
+	VoidHold(ctx context.Context, holdID string) (*Hold, error)
+	GetHold(ctx context.Context, holdID string) (*Hold, error)
+	ExpireHolds(ctx context.Context, now time.Time) (int64, error)
+
+	ChangeAccountStatus(ctx context.Context, params *StatusChangeParams) ([]*TransactionRecord, error)
+
+	GetLimits(ctx context.Context, scope *LimitScope) ([]*AccountLimits, error)
+	SetLimits(ctx context.Context, limits *AccountLimits) (*AccountLimits, error)
+
+	SetCreditLimit(ctx context.Context, params *CreditLimitParams) error
+	ListOverdrawnBalances(ctx context.Context) ([]OverdrawnBalance, error)
+	ChargeOverdraft(ctx context.Context, params *OverdraftChargeParams) (*TransactionRecord, error)
+
+	ListSavingsBalances(ctx context.Context) ([]SavingsBalance, error)
+	AccrueInterest(ctx context.Context, params *AccrualParams) (*InterestAccrual, error)
+	PostInterest(ctx context.Context, params *InterestPostingParams) (*TransactionRecord, error)
+
+	CreateSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID string) (*Schedule, error)
+	ListSchedules(ctx context.Context, filter *ScheduleFilter) ([]*Schedule, error)
+	ChangeScheduleStatus(ctx context.Context, scheduleID string, status ScheduleStatus) (*Schedule, error)
+	ClaimDueSchedules(ctx context.Context, now time.Time, limit int) ([]*Schedule, error)
+	RecordScheduleRun(ctx context.Context, run *ScheduleRun) (*Schedule, error)
+	ListScheduleRuns(ctx context.Context, scheduleID string) ([]ScheduleRun, error)
+
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	GetWebhook(ctx context.Context, webhookID string) (*Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*Webhook, error)
+	ChangeWebhookStatus(ctx context.Context, webhookID string, status WebhookStatus) (*Webhook, error)
+	PublishWebhookEvents(events WebhookEvents)
+	ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, attempt *WebhookAttempt) (*WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, filter *WebhookDeliveryFilter) ([]*WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (*WebhookDelivery, []WebhookAttempt, error)
+	RedeliverWebhook(ctx context.Context, webhookID string, deliveryID string, redeliveryID string) (*WebhookDelivery, error)
+
+	Ping(ctx context.Context) error
+}
+
+type Account struct {
+	ID            string
+	Status        AccountStatus
+	StatusReason  string
+	FreezeCredits bool
+	OwnerID       string
+	Type          AccountType
+	DisplayName   string
+	Metadata      map[string]string
+	CreatedAt     time.Time
+	Balances      []Balance
+}
+
+// Balance is the ledger balance of an account in one currency, and what is available of it after active holds.
+// An account with a credit limit may be debited until its available balance reaches the negative of the limit.
+type Balance struct {
+	Currency    string
+	Balance     decimal.Decimal
+	Available   decimal.Decimal
+	CreditLimit decimal.Decimal
+}
+
+type PostingRecord struct {
+	EntryID      string
+	TxnID        string
+	Operation    string
+	Currency     string
+	Amount       decimal.Decimal
+	BalanceAfter decimal.Decimal
+	Timestamp    time.Time
+}
+
+type FxQuote struct {
+	ID        string
+	Rate      fx.Rate
+	ExpiresAt time.Time
+}
+
+// DepositParams credits Amount less Fee, which goes to the revenue account. TxnType is what the credit is recorded
+// as, a deposit when it is not set.
+type DepositParams struct {
+	TxnID     string
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  string
+	Fee       decimal.Decimal
+	TxnType   TxnType
+}
+
+// WithdrawParams debits Amount plus Fee, which goes to the revenue account.
+type WithdrawParams struct {
+	TxnID     string
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  string
+	Fee       decimal.Decimal
+}
+
+// TransferParams describes a transfer. When the currencies differ, the rate locked by QuoteID is used,
+// falling back to Rate when no quote is referenced. The sender also pays Fee, in the source currency.
+type TransferParams struct {
+	TxnID      string
+	From       string
+	To         string
+	Amount     decimal.Decimal
+	Currency   string
+	ToCurrency string
+	QuoteID    string
+	Rate       *fx.Rate
+	BatchID    string
+	Reference  string
+	Fee        decimal.Decimal
+}
+
+// TransferResult holds the records of a transfer. Fee is nil when the transfer is free, and only completed when the
+// transfer is.
+type TransferResult struct {
+	Sender   *TransactionRecord
+	Receiver *TransactionRecord
+	Fee      *TransactionRecord
+	Rate     *fx.Rate
+}
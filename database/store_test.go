@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// testStores are the stores every store test runs against. The Postgres store is only included when
+// POSTGRES_HOST points at a migrated database, which it must in CI: the memory store takes one lock for everything,
+// so only Postgres can show a deadlock or a serialization failure.
+func testStores(t *testing.T) map[string]AccountStore {
+	t.Helper()
+
+	stores := map[string]AccountStore{
+		"memory": NewMemoryStore(),
+	}
+	switch {
+	case len(os.Getenv("POSTGRES_HOST")) > 0:
+		stores["postgres"] = ConnectDb(context.Background())
+	case len(os.Getenv("CI")) > 0:
+		t.Fatalf("POSTGRES_HOST is not set, so the store tests cannot run against Postgres in CI")
+	}
+	return stores
+}
+
+// fundedAccounts creates count accounts holding amount of USD each.
+func fundedAccounts(t *testing.T, store AccountStore, count int, amount decimal.Decimal) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	params := make([]*AccountParams, count)
+	for i := range params {
+		params[i] = &AccountParams{}
+	}
+	accounts, err := store.CreateAccounts(ctx, params)
+	if err != nil || len(accounts) != count {
+		t.Fatalf("CreateAccounts() = %d accounts, %v", len(accounts), err)
+	}
+
+	accountIDs := make([]string, 0, count)
+	for _, account := range accounts {
+		txn, err := store.Deposit(ctx, &DepositParams{
+			TxnID:     uuid.NewString(),
+			AccountID: account.ID,
+			Amount:    amount,
+			Currency:  "USD",
+		})
+		if err != nil || txn.Status != utils.COMPLETED {
+			t.Fatalf("Deposit() = %+v, %v", txn, err)
+		}
+		accountIDs = append(accountIDs, account.ID)
+	}
+	return accountIDs
+}
+
+func balanceOf(t *testing.T, store AccountStore, accountID string) decimal.Decimal {
+	t.Helper()
+
+	account, err := store.GetAccount(context.Background(), accountID)
+	if err != nil {
+		t.Fatalf("GetAccount(%s) error = %v", accountID, err)
+	}
+	for _, balance := range account.Balances {
+		if balance.Currency == "USD" {
+			return balance.Balance
+		}
+	}
+	return decimal.Zero
+}
+
+// TestRetriedTransactionIDMovesMoneyOnce sends each operation several times at once under one transaction ID. Only
+// one of them may move the money, and every one of them must report the same record.
+func TestRetriedTransactionIDMovesMoneyOnce(t *testing.T) {
+	const retries = 10
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TRANSFER_RETRY_ATTEMPTS", "50")
+			ctx := context.Background()
+
+			initial := decimal.NewFromInt(100)
+			accountIDs := fundedAccounts(t, store, 2, initial)
+			a, b := accountIDs[0], accountIDs[1]
+			amount := decimal.NewFromInt(10)
+
+			operations := []struct {
+				name string
+				run  func(txnID string) (string, error)
+			}{
+				{
+					name: "deposit",
+					run: func(txnID string) (string, error) {
+						txn, err := store.Deposit(ctx, &DepositParams{TxnID: txnID, AccountID: a, Amount: amount, Currency: "USD"})
+						if err != nil {
+							return "", err
+						}
+						return txn.EntryID, nil
+					},
+				},
+				{
+					name: "withdraw",
+					run: func(txnID string) (string, error) {
+						txn, err := store.Withdraw(ctx, &WithdrawParams{TxnID: txnID, AccountID: a, Amount: amount, Currency: "USD"})
+						if err != nil {
+							return "", err
+						}
+						return txn.EntryID, nil
+					},
+				},
+				{
+					name: "transfer",
+					run: func(txnID string) (string, error) {
+						result, err := store.Transfer(ctx, &TransferParams{TxnID: txnID, From: a, To: b, Amount: amount, Currency: "USD", ToCurrency: "USD"})
+						if err != nil {
+							return "", err
+						}
+						return result.Sender.EntryID, nil
+					},
+				},
+			}
+
+			for _, op := range operations {
+				txnID := uuid.NewString()
+				entryIDs := make(chan string, retries)
+
+				var wg sync.WaitGroup
+				for range retries {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						entryID, err := op.run(txnID)
+						if err != nil {
+							t.Errorf("%s '%s' error = %v", op.name, txnID, err)
+						}
+						entryIDs <- entryID
+					}()
+				}
+				wg.Wait()
+				close(entryIDs)
+
+				first := <-entryIDs
+				for entryID := range entryIDs {
+					if entryID != first {
+						t.Errorf("%s '%s' reported entries '%s' and '%s'", op.name, txnID, first, entryID)
+					}
+				}
+
+				legs, err := store.GetTransactions(ctx, txnID)
+				if err != nil || len(legs) == 0 {
+					t.Fatalf("GetTransactions(%s) = %d records, %v", txnID, len(legs), err)
+				}
+				for _, leg := range legs {
+					if leg.Status != utils.COMPLETED {
+						t.Errorf("%s '%s' record %s is %s, want %s", op.name, txnID, leg.TxnType, leg.Status, utils.COMPLETED)
+					}
+				}
+			}
+
+			// The deposit and the withdrawal cancel out, so only the transfer is left on the balances.
+			if balance, want := balanceOf(t, store, a), initial.Sub(amount); !balance.Equal(want) {
+				t.Errorf("balance of a = %s, want %s", balance, want)
+			}
+			if balance, want := balanceOf(t, store, b), initial.Add(amount); !balance.Equal(want) {
+				t.Errorf("balance of b = %s, want %s", balance, want)
+			}
+
+			postings, err := store.ListAccountPostings(ctx, a)
+			if err != nil {
+				t.Fatalf("ListAccountPostings() error = %v", err)
+			}
+			if want := 4; len(postings) != want {
+				t.Errorf("account a has %d postings, want %d", len(postings), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DEFAULT_TRANSACTIONS_PAGE_SIZE = 50
+	MAX_TRANSACTIONS_PAGE_SIZE     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid transactions cursor")
+
+// TransactionQuery selects a page of the transaction history of an account. Zero values leave a filter out;
+// From is inclusive and To exclusive. After continues from the last record of the previous page, in the same
+// order.
+type TransactionQuery struct {
+	AccountID    string
+	From         time.Time
+	To           time.Time
+	TxnTypes     []TxnType
+	Statuses     []string
+	Counterparty string
+	Currency     string
+	MinAmount    decimal.NullDecimal
+	MaxAmount    decimal.NullDecimal
+
+	Descending   bool
+	Limit        int
+	After        *TransactionCursor
+	IncludeTotal bool
+}
+
+// TransactionCursor is the position of a record in the history, ordered by timestamp and then by primary key.
+type TransactionCursor struct {
+	Timestamp  time.Time `json:"t"`
+	ID         string    `json:"id"`
+	TxnType    TxnType   `json:"type"`
+	Descending bool      `json:"desc"`
+}
+
+// TransactionPage is one page of history. Next is set when more records follow, and Total, the number of records
+// matching the filters on every page, only when it was asked for.
+type TransactionPage struct {
+	Transactions []TransactionRecord
+	Next         *TransactionCursor
+	Total        *int64
+}
+
+// Encode renders the cursor as an opaque token for clients to send back.
+func (c *TransactionCursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func DecodeTransactionCursor(token string) (*TransactionCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidCursor, err)
+	}
+
+	cursor := new(TransactionCursor)
+	if err = json.Unmarshal(decoded, cursor); err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidCursor, err)
+	}
+	if len(cursor.ID) == 0 || len(cursor.TxnType) == 0 || cursor.Timestamp.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func cursorOf(txn *TransactionRecord, descending bool) *TransactionCursor {
+	return &TransactionCursor{
+		Timestamp:  txn.Timestamp,
+		ID:         txn.ID,
+		TxnType:    txn.TxnType,
+		Descending: descending,
+	}
+}
+
+// filters renders the conditions of the query shared by the page and its total. The cursor is left out so the
+// total covers every page.
+func (q *TransactionQuery) filters() ([]string, pgx.NamedArgs) {
+	conditions := []string{`account_id = @account_id`}
+	args := pgx.NamedArgs{
+		"account_id": q.AccountID,
+	}
+
+	if !q.From.IsZero() {
+		conditions = append(conditions, `timestamp >= @from::timestamptz::timestamp`)
+		args["from"] = q.From
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, `timestamp < @to::timestamptz::timestamp`)
+		args["to"] = q.To
+	}
+	if len(q.TxnTypes) > 0 {
+		txnTypes := make([]string, 0, len(q.TxnTypes))
+		for _, txnType := range q.TxnTypes {
+			txnTypes = append(txnTypes, string(txnType))
+		}
+		conditions = append(conditions, `txntype::text = ANY(@txntypes)`)
+		args["txntypes"] = txnTypes
+	}
+	if len(q.Statuses) > 0 {
+		conditions = append(conditions, `status = ANY(@statuses)`)
+		args["statuses"] = q.Statuses
+	}
+	if len(q.Counterparty) > 0 {
+		conditions = append(conditions, `(sender_id = @counterparty OR receiver_id = @counterparty)`)
+		args["counterparty"] = q.Counterparty
+	}
+	if len(q.Currency) > 0 {
+		conditions = append(conditions, `currency = @currency`)
+		args["currency"] = q.Currency
+	}
+	if q.MinAmount.Valid {
+		conditions = append(conditions, `amount >= @min_amount`)
+		args["min_amount"] = q.MinAmount.Decimal
+	}
+	if q.MaxAmount.Valid {
+		conditions = append(conditions, `amount <= @max_amount`)
+		args["max_amount"] = q.MaxAmount.Decimal
+	}
+
+	return conditions, args
+}
+
+// pageQuery renders the page query, which walks the (account_id, timestamp, id, txntype) index from the cursor
+// and reads one record past the page to tell whether another follows.
+func (q *TransactionQuery) pageQuery() (string, pgx.NamedArgs) {
+	conditions, args := q.filters()
+
+	order, after := `ASC`, `>`
+	if q.Descending {
+		order, after = `DESC`, `<`
+	}
+
+	if q.After != nil {
+		conditions = append(conditions, `(timestamp, id, txntype) `+after+` (@cursor_timestamp::timestamptz::timestamp, @cursor_id, @cursor_txntype::txntype)`)
+		args["cursor_timestamp"] = q.After.Timestamp
+		args["cursor_id"] = q.After.ID
+		args["cursor_txntype"] = string(q.After.TxnType)
+	}
+	args["limit"] = q.Limit + 1
+
+	query := `SELECT ` + TRANSACTION_COLUMNS + ` FROM transactions WHERE ` + strings.Join(conditions, ` AND `) +
+		` ORDER BY timestamp ` + order + `, id ` + order + `, txntype ` + order + ` LIMIT @limit`
+	return query, args
+}
+
+func (q *TransactionQuery) countQuery() (string, pgx.NamedArgs) {
+	conditions, args := q.filters()
+	return `SELECT COUNT(*) FROM transactions WHERE ` + strings.Join(conditions, ` AND `), args
+}
+
+// page trims the records read past the limit and points Next at the last record kept.
+func (q *TransactionQuery) page(txns []TransactionRecord) *TransactionPage {
+	page := &TransactionPage{
+		Transactions: txns,
+	}
+	if len(txns) > q.Limit {
+		page.Transactions = txns[:q.Limit]
+		page.Next = cursorOf(&page.Transactions[q.Limit-1], q.Descending)
+	}
+	return page
+}
+
+func (p *Postgres) ListAccountTransactions(ctx context.Context, query *TransactionQuery) (*TransactionPage, error) {
+	sql, args := query.pageQuery()
+	txns, err := p.queryTransactions(ctx, sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	page := query.page(txns)
+
+	if query.IncludeTotal {
+		sql, args = query.countQuery()
+
+		var total int64
+		if err = p.Db.QueryRow(ctx, sql, args).Scan(&total); err != nil {
+			return nil, fmt.Errorf("unable to count transactions of account '%s' : %v", query.AccountID, err)
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func (q *TransactionQuery) matches(txn *TransactionRecord) bool {
+	switch {
+	case txn.AccountID != q.AccountID:
+		return false
+	case !q.From.IsZero() && txn.Timestamp.Before(q.From):
+		return false
+	case !q.To.IsZero() && !txn.Timestamp.Before(q.To):
+		return false
+	case len(q.TxnTypes) > 0 && !slices.Contains(q.TxnTypes, txn.TxnType):
+		return false
+	case len(q.Statuses) > 0 && !slices.Contains(q.Statuses, txn.Status):
+		return false
+	case len(q.Counterparty) > 0 && txn.SenderID != q.Counterparty && txn.ReceiverID != q.Counterparty:
+		return false
+	case len(q.Currency) > 0 && txn.Currency != q.Currency:
+		return false
+	case q.MinAmount.Valid && txn.Amount.LessThan(q.MinAmount.Decimal):
+		return false
+	case q.MaxAmount.Valid && txn.Amount.GreaterThan(q.MaxAmount.Decimal):
+		return false
+	}
+	return true
+}
+
+// compareTransactions orders records like the page query: by timestamp, then by primary key.
+func compareTransactions(a *TransactionRecord, b *TransactionCursor) int {
+	if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.ID, b.ID); c != 0 {
+		return c
+	}
+	return strings.Compare(string(a.TxnType), string(b.TxnType))
+}
+
+func (m *MemoryStore) ListAccountTransactions(_ context.Context, query *TransactionQuery) (*TransactionPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matched := make([]TransactionRecord, 0)
+	for i := range m.transactions {
+		if query.matches(&m.transactions[i]) {
+			matched = append(matched, m.transactions[i])
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compareTransactions(&matched[i], cursorOf(&matched[j], false))
+		if query.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	txns := make([]TransactionRecord, 0, query.Limit+1)
+	for i := range matched {
+		if query.After != nil {
+			c := compareTransactions(&matched[i], query.After)
+			if (query.Descending && c >= 0) || (!query.Descending && c <= 0) {
+				continue
+			}
+		}
+		txns = append(txns, matched[i])
+		if len(txns) > query.Limit {
+			break
+		}
+	}
+
+	page := query.page(txns)
+	if query.IncludeTotal {
+		total := int64(len(matched))
+		page.Total = &total
+	}
+
+	return page, nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+)
+
+// FailureReason tells why a transaction was recorded as failed.
+type FailureReason string
+
+const (
+	FailureInsufficientFunds   FailureReason = "insufficient_funds"
+	FailureDestinationNotFound FailureReason = "destination_not_found"
+)
+
+// TransactionRecord is the per-account view of an operation shown in transaction history.
+// Completed records point at the journal entry that moved the money, and failed ones carry a FailureReason. A
+// reversal points at the transaction it reverses through ReversesID, and that transaction keeps a running
+// ReversedAmount. The legs of a batch transfer share a BatchID.
+type TransactionRecord struct {
+	ID         string
+	AccountID  string
+	Amount     decimal.Decimal
+	Currency   string
+	TxnType    TxnType
+	SenderID   string
+	ReceiverID string
+	Status     string
+	EntryID    string
+	Timestamp  time.Time
+
+	FailureReason FailureReason
+	BatchID       string
+	Reference     string
+
+	CounterAmount   decimal.NullDecimal
+	CounterCurrency string
+	FxRate          decimal.NullDecimal
+	FxSpread        decimal.NullDecimal
+	QuoteID         string
+
+	ReversesID     string
+	ReversedAmount decimal.Decimal
+}
+
+func InsertTransaction(ctx context.Context, tx pgx.Tx, txn *TransactionRecord) error {
+	_, err := tx.Exec(
+		ctx,
+		INSERT_TRANSACTION_QUERY,
+		pgx.NamedArgs{
+			"id":          txn.ID,
+			"account_id":  txn.AccountID,
+			"amount":      txn.Amount,
+			"currency":    txn.Currency,
+			"txntype":     txn.TxnType,
+			"sender_id":   txn.SenderID,
+			"receiver_id": txn.ReceiverID,
+			"status":      txn.Status,
+			"entry_id":    txn.EntryID,
+
+			"counter_amount":   txn.CounterAmount,
+			"counter_currency": txn.CounterCurrency,
+			"fx_rate":          txn.FxRate,
+			"fx_spread":        txn.FxSpread,
+			"quote_id":         txn.QuoteID,
+			"reverses_id":      txn.ReversesID,
+			"failure_reason":   txn.FailureReason,
+			"batch_id":         txn.BatchID,
+			"reference":        txn.Reference,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to record %s transaction '%s' for account '%s' : %w", txn.TxnType, txn.ID, txn.AccountID, err)
+	}
+	return nil
+}
+
+// RecordTransaction inserts the record of an operation before any of its money moves, so that the primary key on the
+// transaction ID and type lets a single operation through per ID. It returns false, with tx still usable, when the
+// operation has already been recorded; the caller must then return the existing record instead of posting again.
+func RecordTransaction(ctx context.Context, tx pgx.Tx, txn *TransactionRecord) (bool, error) {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to record %s transaction '%s' : %w", txn.TxnType, txn.ID, err)
+	}
+
+	if err = InsertTransaction(ctx, savepoint, txn); err != nil {
+		_ = savepoint.Rollback(ctx)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err = savepoint.Commit(ctx); err != nil {
+		return false, fmt.Errorf("unable to record %s transaction '%s' : %w", txn.TxnType, txn.ID, err)
+	}
+	return true, nil
+}
+
+// UpdateTransaction stores the outcome of an operation recorded with RecordTransaction.
+func UpdateTransaction(ctx context.Context, tx pgx.Tx, txn *TransactionRecord) error {
+	_, err := tx.Exec(
+		ctx,
+		UPDATE_TRANSACTION_OUTCOME_QUERY,
+		pgx.NamedArgs{
+			"id":             txn.ID,
+			"txntype":        txn.TxnType,
+			"status":         txn.Status,
+			"entry_id":       txn.EntryID,
+			"failure_reason": txn.FailureReason,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update %s transaction '%s' : %w", txn.TxnType, txn.ID, err)
+	}
+	return nil
+}
+
+// recordedTransaction returns the existing record of the same ID and type as txn, locking it until tx ends.
+func recordedTransaction(ctx context.Context, tx pgx.Tx, txn *TransactionRecord) (*TransactionRecord, error) {
+	legs, err := lockTransactions(ctx, tx, txn.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range legs {
+		if legs[i].TxnType == txn.TxnType {
+			return &legs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w : %s transaction '%s'", ErrTransactionNotFound, txn.TxnType, txn.ID)
+}
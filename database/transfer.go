@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// newTransferResult builds the failed sender and receiver records of a transfer, converting the amount when a
+// rate applies. The sender record is stated in the source currency and the receiver record in the target
+// currency, each carrying the other side as its counter amount.
+func newTransferResult(params *TransferParams, rate *fx.Rate) (*TransferResult, error) {
+	toAmount := params.Amount
+	if rate != nil {
+		toAmount = rate.Convert(params.Amount)
+		if !toAmount.IsPositive() {
+			return nil, fmt.Errorf("%w : converting '%s %s' to %s", utils.ErrAmountNotPositive, params.Amount, params.Currency, params.ToCurrency)
+		}
+	}
+
+	sender := &TransactionRecord{
+		ID:         params.TxnID,
+		AccountID:  params.From,
+		Amount:     params.Amount,
+		Currency:   params.Currency,
+		TxnType:    TxnTypeSender,
+		SenderID:   params.From,
+		ReceiverID: params.To,
+		Status:     utils.FAILED,
+		BatchID:    params.BatchID,
+		Reference:  params.Reference,
+	}
+	receiver := &TransactionRecord{
+		ID:         params.TxnID,
+		AccountID:  params.To,
+		Amount:     toAmount,
+		Currency:   params.ToCurrency,
+		TxnType:    TxnTypeReceiver,
+		SenderID:   params.From,
+		ReceiverID: params.To,
+		Status:     utils.FAILED,
+		BatchID:    params.BatchID,
+		Reference:  params.Reference,
+	}
+
+	if rate != nil {
+		for _, txn := range []*TransactionRecord{sender, receiver} {
+			txn.FxRate = decimal.NewNullDecimal(rate.Rate)
+			txn.FxSpread = decimal.NewNullDecimal(rate.Spread)
+			txn.QuoteID = params.QuoteID
+		}
+		sender.CounterAmount, sender.CounterCurrency = decimal.NewNullDecimal(toAmount), params.ToCurrency
+		receiver.CounterAmount, receiver.CounterCurrency = decimal.NewNullDecimal(params.Amount), params.Currency
+	}
+
+	fee := feeRecord(params.TxnID, params.From, params.Currency, params.Fee, "")
+	if fee != nil {
+		fee.Status = utils.FAILED
+	}
+
+	return &TransferResult{
+		Sender:   sender,
+		Receiver: receiver,
+		Fee:      fee,
+		Rate:     rate,
+	}, nil
+}
+
+// recordedTransferResult rebuilds the result of a transfer from its recorded legs, or returns nil when no transfer
+// is recorded among them. A receiver that does not exist has no record, so it is rebuilt from the sender.
+func recordedTransferResult(legs []TransactionRecord) *TransferResult {
+	result := new(TransferResult)
+	for i := range legs {
+		switch legs[i].TxnType {
+		case TxnTypeSender:
+			result.Sender = &legs[i]
+		case TxnTypeReceiver:
+			result.Receiver = &legs[i]
+		case TxnTypeFee:
+			result.Fee = &legs[i]
+		}
+	}
+	if result.Sender == nil {
+		return nil
+	}
+
+	sender := result.Sender
+	if result.Receiver == nil {
+		result.Receiver = &TransactionRecord{
+			ID:            sender.ID,
+			AccountID:     sender.ReceiverID,
+			Amount:        sender.Amount,
+			Currency:      sender.Currency,
+			TxnType:       TxnTypeReceiver,
+			SenderID:      sender.SenderID,
+			ReceiverID:    sender.ReceiverID,
+			Status:        sender.Status,
+			FailureReason: sender.FailureReason,
+			BatchID:       sender.BatchID,
+			Reference:     sender.Reference,
+		}
+		if sender.CounterAmount.Valid {
+			result.Receiver.Amount, result.Receiver.Currency = sender.CounterAmount.Decimal, sender.CounterCurrency
+		}
+	}
+
+	if sender.FxRate.Valid {
+		result.Rate = &fx.Rate{
+			From:   sender.Currency,
+			To:     result.Receiver.Currency,
+			Rate:   sender.FxRate.Decimal,
+			Spread: sender.FxSpread.Decimal,
+		}
+	}
+
+	return result
+}
+
+func (r *TransferResult) complete(entryID string) {
+	r.Sender.Status, r.Receiver.Status = utils.COMPLETED, utils.COMPLETED
+	r.Sender.EntryID, r.Receiver.EntryID = entryID, entryID
+	if r.Fee != nil {
+		r.Fee.Status, r.Fee.EntryID = utils.COMPLETED, entryID
+	}
+}
+
+func (r *TransferResult) fail(reason FailureReason) {
+	r.Sender.FailureReason, r.Receiver.FailureReason = reason, reason
+}
+
+// Records are the transaction records kept for the transfer. No record is kept for a receiver that does not exist,
+// and a fee is only recorded once charged.
+func (r *TransferResult) Records() []*TransactionRecord {
+	if r.Sender.FailureReason == FailureDestinationNotFound {
+		return []*TransactionRecord{r.Sender}
+	}
+	if r.Fee != nil && r.Fee.Status == utils.COMPLETED {
+		return []*TransactionRecord{r.Sender, r.Receiver, r.Fee}
+	}
+	return []*TransactionRecord{r.Sender, r.Receiver}
+}
+
+// transferPostings moves the amount between the two accounts. A converted transfer goes through the fx
+// account so that each currency balances on its own.
+func transferPostings(params *TransferParams, toAmount decimal.Decimal) []Posting {
+	if params.Currency == params.ToCurrency {
+		return []Posting{
+			{AccountID: params.From, Currency: params.Currency, Amount: params.Amount.Neg()},
+			{AccountID: params.To, Currency: params.ToCurrency, Amount: toAmount},
+		}
+	}
+	return []Posting{
+		{AccountID: params.From, Currency: params.Currency, Amount: params.Amount.Neg()},
+		{AccountID: SYSTEM_FX_ACCOUNT, Currency: params.Currency, Amount: params.Amount},
+		{AccountID: SYSTEM_FX_ACCOUNT, Currency: params.ToCurrency, Amount: toAmount.Neg()},
+		{AccountID: params.To, Currency: params.ToCurrency, Amount: toAmount},
+	}
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	stressTransfers = 50
+	stressTimeout   = 30 * time.Second
+)
+
+// TestOpposingTransfers runs transfers in both directions between two accounts at once. They must all complete
+// without deadlocking, and the money must only move between the two accounts.
+func TestOpposingTransfers(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TRANSFER_RETRY_ATTEMPTS", "50")
+
+			initial := decimal.NewFromInt(1000)
+			accountIDs := fundedAccounts(t, store, 2, initial)
+			a, b := accountIDs[0], accountIDs[1]
+
+			ctx, cancel := context.WithTimeout(context.Background(), stressTimeout)
+			defer cancel()
+
+			amountAB, amountBA := decimal.NewFromInt(3), decimal.NewFromInt(2)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 2*stressTransfers)
+			transfer := func(from string, to string, amount decimal.Decimal) {
+				defer wg.Done()
+				result, err := store.Transfer(ctx, &TransferParams{
+					TxnID:      uuid.NewString(),
+					From:       from,
+					To:         to,
+					Amount:     amount,
+					Currency:   "USD",
+					ToCurrency: "USD",
+				})
+				if err == nil && result.Sender.Status != utils.COMPLETED {
+					err = result.Sender.FailureReason.err()
+				}
+				errs <- err
+			}
+
+			for range stressTransfers {
+				wg.Add(2)
+				go transfer(a, b, amountAB)
+				go transfer(b, a, amountBA)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				t.Fatalf("transfers did not finish within %s", stressTimeout)
+			}
+
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("Transfer() error = %v", err)
+				}
+			}
+
+			net := amountAB.Sub(amountBA).Mul(decimal.NewFromInt(stressTransfers))
+			balanceA, balanceB := balanceOf(t, store, a), balanceOf(t, store, b)
+			if want := initial.Sub(net); !balanceA.Equal(want) {
+				t.Errorf("balance of a = %s, want %s", balanceA, want)
+			}
+			if want := initial.Add(net); !balanceB.Equal(want) {
+				t.Errorf("balance of b = %s, want %s", balanceB, want)
+			}
+			if total, want := balanceA.Add(balanceB), initial.Mul(decimal.NewFromInt(2)); !total.Equal(want) {
+				t.Errorf("total balance = %s, want %s", total, want)
+			}
+		})
+	}
+}
+
+// TestFailedTransferLeavesQuoteUnused refuses a transfer that references a quote. The quote must stay usable until a
+// transfer completes with it, and only that one.
+func TestFailedTransferLeavesQuoteUnused(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountIDs := fundedAccounts(t, store, 2, decimal.NewFromInt(100))
+
+			quote := &FxQuote{
+				ID:        uuid.NewString(),
+				Rate:      fx.Rate{From: "USD", To: "EUR", Rate: decimal.RequireFromString("0.9"), Spread: decimal.Zero},
+				ExpiresAt: time.Now().Add(time.Minute),
+			}
+			if err := store.CreateFxQuote(ctx, quote); err != nil {
+				t.Fatalf("CreateFxQuote() error = %v", err)
+			}
+
+			transfer := func(to string, amount int64) (*TransferResult, error) {
+				return store.Transfer(ctx, &TransferParams{
+					TxnID:      uuid.NewString(),
+					From:       accountIDs[0],
+					To:         to,
+					Amount:     decimal.NewFromInt(amount),
+					Currency:   "USD",
+					ToCurrency: "EUR",
+					QuoteID:    quote.ID,
+				})
+			}
+
+			for reason, to := range map[FailureReason]string{
+				FailureInsufficientFunds:   accountIDs[1],
+				FailureDestinationNotFound: uuid.NewString(),
+			} {
+				amount := int64(10)
+				if reason == FailureInsufficientFunds {
+					amount = 1000
+				}
+				result, err := transfer(to, amount)
+				if err != nil || result.Sender.FailureReason != reason {
+					t.Fatalf("Transfer() = %+v, %v, want it to fail with %s", result, err, reason)
+				}
+			}
+
+			result, err := transfer(accountIDs[1], 10)
+			if err != nil || result.Sender.Status != utils.COMPLETED {
+				t.Fatalf("Transfer() after the failures = %+v, %v, want it completed with the quote", result, err)
+			}
+			if !result.Receiver.Amount.Equal(decimal.NewFromInt(9)) {
+				t.Errorf("receiver got %s, want 9 at the quoted rate", result.Receiver.Amount)
+			}
+
+			if _, err = transfer(accountIDs[1], 10); !errors.Is(err, ErrQuoteUnavailable) {
+				t.Errorf("Transfer() with a used quote error = %v, want %v", err, ErrQuoteUnavailable)
+			}
+		})
+	}
+}
+
+// TestTransferFailureOrder makes transfers that fail for more than one reason. Every store must report the first of
+// them in the same order: the quote, the sender, the destination, the funds and then the limits.
+func TestTransferFailureOrder(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountIDs := fundedAccounts(t, store, 2, decimal.NewFromInt(100))
+			from, to := accountIDs[0], accountIDs[1]
+
+			limits := &AccountLimits{AccountID: from, Currency: "USD"}
+			limits.MaxSingleAmount = decimal.NewNullDecimal(decimal.NewFromInt(50))
+			if _, err := store.SetLimits(ctx, limits); err != nil {
+				t.Fatalf("SetLimits() error = %v", err)
+			}
+
+			tests := []struct {
+				name       string
+				params     TransferParams
+				wantErr    error
+				wantReason FailureReason
+			}{
+				{
+					name:    "unknown quote from an unknown sender",
+					params:  TransferParams{From: uuid.NewString(), To: to, Amount: decimal.NewFromInt(10), Currency: "USD", ToCurrency: "EUR", QuoteID: uuid.NewString()},
+					wantErr: ErrQuoteUnavailable,
+				},
+				{
+					name:       "unknown destination without the funds",
+					params:     TransferParams{From: from, To: uuid.NewString(), Amount: decimal.NewFromInt(1000), Currency: "USD", ToCurrency: "USD"},
+					wantReason: FailureDestinationNotFound,
+				},
+				{
+					name:       "over the limit without the funds",
+					params:     TransferParams{From: from, To: to, Amount: decimal.NewFromInt(1000), Currency: "USD", ToCurrency: "USD"},
+					wantReason: FailureInsufficientFunds,
+				},
+			}
+
+			for _, tt := range tests {
+				tt.params.TxnID = uuid.NewString()
+				result, err := store.Transfer(ctx, &tt.params)
+				switch {
+				case tt.wantErr != nil:
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("%s: Transfer() error = %v, want %v", tt.name, err, tt.wantErr)
+					}
+				case err != nil || result.Sender.FailureReason != tt.wantReason:
+					t.Errorf("%s: Transfer() = %+v, %v, want it to fail with %s", tt.name, result, err, tt.wantReason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,856 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DEFAULT_WEBHOOK_RETRY_ATTEMPTS = 8
+	DEFAULT_WEBHOOK_RETRY_BACKOFF  = 30 * time.Second
+
+	DEFAULT_LIST_WEBHOOK_DELIVERIES_LIMIT = 50
+	MAX_LIST_WEBHOOK_DELIVERIES_LIMIT     = 200
+
+	// WEBHOOK_DELIVERY_LEASE is how long a claimed delivery is kept from other dispatchers. A dispatcher claims no
+	// more than it can send within half of it, so that a delivery is only sent again once its dispatcher has stopped.
+	WEBHOOK_DELIVERY_LEASE = 2 * time.Minute
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrWebhookDisabled         = errors.New("webhook is disabled")
+)
+
+type WebhookStatus string
+
+const (
+	WebhookStatusActive   WebhookStatus = "active"
+	WebhookStatusDisabled WebhookStatus = "disabled"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending    WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered  WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryDeadLetter WebhookDeliveryStatus = "dead_letter"
+)
+
+func IsWebhookDeliveryStatus(status string) bool {
+	switch WebhookDeliveryStatus(status) {
+	case WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryDeadLetter:
+		return true
+	}
+	return false
+}
+
+// Webhook is a subscription of URL to the events of EventTypes. Deliveries are signed with Secret.
+type Webhook struct {
+	ID         string
+	URL        string
+	EventTypes []string
+	Secret     string
+	Status     WebhookStatus
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Subscribes reports whether the webhook is to be sent events of the type.
+func (w *Webhook) Subscribes(eventType string) bool {
+	return w.Status == WebhookStatusActive && slices.Contains(w.EventTypes, eventType)
+}
+
+// WebhookEvent is an event as it is sent to every webhook subscribed to its type.
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// WebhookEvents builds the webhook events a store queues as it records what they report. They are queued in the
+// database transaction of the records, so an event is queued if and only if what it reports is committed. A nil
+// event is not queued.
+type WebhookEvents interface {
+	// TransactionEvent is the event reporting a transaction record.
+	TransactionEvent(txn *TransactionRecord) *WebhookEvent
+	// AccountStatusEvent is the event reporting an account moving to a status.
+	AccountStatusEvent(params *StatusChangeParams) *WebhookEvent
+}
+
+// WebhookDelivery is the sending of one event to one webhook. It is tried until the webhook accepts it, or is dead
+// lettered once the retries are spent; Attempts counts the tries made so far. A manual redelivery is a new delivery
+// of the same event that names the one it repeats in RedeliveryOf.
+//
+// URL and Secret are only set on the deliveries claimed for sending, and Payload on those claimed or looked up one by
+// one.
+type WebhookDelivery struct {
+	ID            string
+	WebhookID     string
+	EventID       string
+	EventType     string
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastAttemptAt time.Time
+	LastStatus    int
+	LastError     string
+	RedeliveryOf  string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	URL     string
+	Secret  string
+	Payload []byte
+
+	lockedUntil time.Time
+}
+
+// WebhookAttempt records one try at a delivery and how the webhook answered it. StatusCode is zero when there was
+// no answer.
+type WebhookAttempt struct {
+	DeliveryID  string
+	Attempt     int
+	StatusCode  int
+	Error       string
+	AttemptedAt time.Time
+	Duration    time.Duration
+}
+
+// Succeeded reports whether the webhook accepted the delivery.
+func (a *WebhookAttempt) Succeeded() bool {
+	return len(a.Error) == 0
+}
+
+// WebhookDeliveryFilter lists the deliveries to WebhookID, optionally only those with Status.
+type WebhookDeliveryFilter struct {
+	WebhookID string
+	Status    WebhookDeliveryStatus
+	Limit     int
+}
+
+// WebhookRetryAttempts is how many times a delivery is tried before it is dead lettered, configurable through
+// WEBHOOK_RETRY_ATTEMPTS.
+func WebhookRetryAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_RETRY_ATTEMPTS"))
+	if err != nil || attempts < 1 {
+		return DEFAULT_WEBHOOK_RETRY_ATTEMPTS
+	}
+	return attempts
+}
+
+// WebhookRetryBackoff is the wait before the first retry of a failed delivery, doubled for every retry after it,
+// configurable through WEBHOOK_RETRY_BACKOFF.
+func WebhookRetryBackoff() time.Duration {
+	backoff, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_BACKOFF"))
+	if err != nil || backoff <= 0 {
+		return DEFAULT_WEBHOOK_RETRY_BACKOFF
+	}
+	return backoff
+}
+
+// recordAttempt moves the delivery past an attempt: to delivered once the webhook accepted it, to the dead letters
+// once the retries are spent, or else to a retry after a backoff that doubles with every attempt.
+func (d *WebhookDelivery) recordAttempt(attempt *WebhookAttempt) {
+	d.Attempts = attempt.Attempt
+	d.LastAttemptAt = attempt.AttemptedAt
+	d.LastStatus = attempt.StatusCode
+	d.LastError = attempt.Error
+	d.lockedUntil = time.Time{}
+
+	switch {
+	case attempt.Succeeded():
+		d.Status = WebhookDeliveryDelivered
+	case d.Attempts >= WebhookRetryAttempts():
+		d.Status = WebhookDeliveryDeadLetter
+	default:
+		d.NextAttemptAt = attempt.AttemptedAt.Add(WebhookRetryBackoff() << (d.Attempts - 1))
+	}
+}
+
+// isDue reports whether the attempt is the next one the delivery waits for. An attempt recorded by another
+// dispatcher first, or at a delivery that has since been settled, is not.
+func (d *WebhookDelivery) isDue(attempt *WebhookAttempt) bool {
+	return d.Status == WebhookDeliveryPending && attempt.Attempt == d.Attempts+1
+}
+
+// newWebhookDelivery is a delivery of the event to the webhook due straight away.
+func newWebhookDelivery(deliveryID string, webhookID string, event *WebhookEvent, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:            deliveryID,
+		WebhookID:     webhookID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: now,
+	}
+}
+
+func webhookDeliveryArgs(d *WebhookDelivery) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"id":              d.ID,
+		"webhook_id":      d.WebhookID,
+		"event_id":        d.EventID,
+		"event_type":      d.EventType,
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt_at": d.NextAttemptAt,
+		"last_attempt_at": nullTime(d.LastAttemptAt),
+		"last_status":     d.LastStatus,
+		"last_error":      d.LastError,
+		"redelivery_of":   d.RedeliveryOf,
+		"locked_until":    nullTime(d.lockedUntil),
+	}
+}
+
+func scanWebhook(row pgx.Row) (*Webhook, error) {
+	w := new(Webhook)
+	err := row.Scan(&w.ID, &w.URL, &w.EventTypes, &w.Secret, &w.Status, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func scanWebhookDelivery(row pgx.Row, extra ...any) (*WebhookDelivery, error) {
+	var (
+		d                          = new(WebhookDelivery)
+		lastAttemptAt, lockedUntil *time.Time
+	)
+
+	dest := []any{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt, &lastAttemptAt,
+		&d.LastStatus, &d.LastError, &d.RedeliveryOf, &lockedUntil, &d.CreatedAt, &d.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if lastAttemptAt != nil {
+		d.LastAttemptAt = *lastAttemptAt
+	}
+	if lockedUntil != nil {
+		d.lockedUntil = *lockedUntil
+	}
+	return d, nil
+}
+
+func queryWebhook(ctx context.Context, q rowQuerier, query string, webhookID string) (*Webhook, error) {
+	w, err := scanWebhook(q.QueryRow(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"id": webhookID,
+		},
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query webhook '%s' : %w", webhookID, err)
+	}
+	return w, nil
+}
+
+// queryWebhookDelivery finds a delivery to the webhook. A delivery to another webhook is not found.
+func queryWebhookDelivery(ctx context.Context, q rowQuerier, query string, webhookID string, deliveryID string) (*WebhookDelivery, error) {
+	d, err := scanWebhookDelivery(q.QueryRow(
+		ctx,
+		query,
+		pgx.NamedArgs{
+			"id":         deliveryID,
+			"webhook_id": webhookID,
+		},
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query webhook delivery '%s' : %w", deliveryID, err)
+	}
+	return d, nil
+}
+
+func insertWebhookDelivery(ctx context.Context, tx pgx.Tx, d *WebhookDelivery) error {
+	err := tx.QueryRow(ctx, INSERT_WEBHOOK_DELIVERY_QUERY, webhookDeliveryArgs(d)).Scan(&d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to insert webhook delivery '%s' : %w", d.ID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	err := p.Db.QueryRow(
+		ctx,
+		INSERT_WEBHOOK_QUERY,
+		pgx.NamedArgs{
+			"id":          webhook.ID,
+			"url":         webhook.URL,
+			"event_types": webhook.EventTypes,
+			"secret":      webhook.Secret,
+			"status":      webhook.Status,
+		},
+	).Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert webhook '%s' : %w", webhook.ID, err)
+	}
+	return webhook, nil
+}
+
+func (p *Postgres) GetWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	return queryWebhook(ctx, p.Db, GET_WEBHOOK_QUERY, webhookID)
+}
+
+func (p *Postgres) ListWebhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := p.Db.Query(ctx, LIST_WEBHOOKS_QUERY)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query webhooks : %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]*Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse webhooks : %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// ChangeWebhookStatus disables or enables the webhook. The deliveries of a disabled webhook wait, and are sent
+// once it is enabled again.
+func (p *Postgres) ChangeWebhookStatus(ctx context.Context, webhookID string, status WebhookStatus) (*Webhook, error) {
+	w, err := scanWebhook(p.Db.QueryRow(
+		ctx,
+		UPDATE_WEBHOOK_STATUS_QUERY,
+		pgx.NamedArgs{
+			"id":     webhookID,
+			"status": status,
+		},
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update webhook '%s' : %w", webhookID, err)
+	}
+	return w, nil
+}
+
+// PublishWebhookEvents has the store queue the events built by events from now on. Until it is called, no events
+// are queued.
+func (p *Postgres) PublishWebhookEvents(events WebhookEvents) {
+	p.events = events
+}
+
+// queueTransactionEvents queues the event of every record within tx.
+func (p *Postgres) queueTransactionEvents(ctx context.Context, tx pgx.Tx, txns ...*TransactionRecord) error {
+	if p.events == nil {
+		return nil
+	}
+
+	for _, txn := range txns {
+		if err := enqueueWebhookEvent(ctx, tx, p.events.TransactionEvent(txn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueAccountStatusEvent queues the event of the status change within tx.
+func (p *Postgres) queueAccountStatusEvent(ctx context.Context, tx pgx.Tx, params *StatusChangeParams) error {
+	if p.events == nil {
+		return nil
+	}
+	return enqueueWebhookEvent(ctx, tx, p.events.AccountStatusEvent(params))
+}
+
+// enqueueWebhookEvent stores the event with a delivery to every active webhook subscribed to its type. An event no
+// webhook subscribes to is not stored.
+func enqueueWebhookEvent(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	if event == nil {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, GET_SUBSCRIBED_WEBHOOKS_QUERY, pgx.NamedArgs{"event_type": event.Type})
+	if err != nil {
+		return fmt.Errorf("unable to query webhooks subscribed to '%s' : %w", event.Type, err)
+	}
+	webhookIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("unable to parse webhooks subscribed to '%s' : %w", event.Type, err)
+	}
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		INSERT_WEBHOOK_EVENT_QUERY,
+		pgx.NamedArgs{
+			"id":      event.ID,
+			"type":    event.Type,
+			"payload": string(event.Payload),
+		},
+	).Scan(&event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to insert webhook event '%s' : %w", event.ID, err)
+	}
+
+	for _, webhookID := range webhookIDs {
+		if err = insertWebhookDelivery(ctx, tx, newWebhookDelivery(uuid.NewString(), webhookID, event, event.CreatedAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimDueWebhookDeliveries leases up to limit pending deliveries to active webhooks whose next attempt is due,
+// skipping those claimed by another dispatcher, together with what is needed to send them.
+func (p *Postgres) ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	rows, err := p.Db.Query(
+		ctx,
+		CLAIM_DUE_WEBHOOK_DELIVERIES_QUERY,
+		pgx.NamedArgs{
+			"now":          now,
+			"locked_until": now.Add(WEBHOOK_DELIVERY_LEASE),
+			"limit":        limit,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to claim webhook deliveries : %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		var url, secret, payload string
+		d, err := scanWebhookDelivery(rows, &url, &secret, &payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse webhook deliveries : %w", err)
+		}
+		d.URL, d.Secret, d.Payload = url, secret, []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt records an attempt and moves its delivery on. An attempt that is no longer due, because
+// another dispatcher recorded it first, leaves the delivery as it is.
+func (p *Postgres) RecordWebhookAttempt(ctx context.Context, attempt *WebhookAttempt) (*WebhookDelivery, error) {
+	var delivery *WebhookDelivery
+
+	err := p.inTx(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		delivery, err = queryWebhookDelivery(ctx, tx, LOCK_WEBHOOK_DELIVERY_QUERY, "", attempt.DeliveryID)
+		if err != nil {
+			return err
+		}
+		if !delivery.isDue(attempt) {
+			return nil
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			INSERT_WEBHOOK_ATTEMPT_QUERY,
+			pgx.NamedArgs{
+				"delivery_id":  attempt.DeliveryID,
+				"attempt":      attempt.Attempt,
+				"status_code":  attempt.StatusCode,
+				"error":        attempt.Error,
+				"attempted_at": attempt.AttemptedAt,
+				"duration_ms":  attempt.Duration.Milliseconds(),
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to insert attempt at webhook delivery '%s' : %w", attempt.DeliveryID, err)
+		}
+
+		delivery.recordAttempt(attempt)
+		err = tx.QueryRow(ctx, UPDATE_WEBHOOK_DELIVERY_QUERY, webhookDeliveryArgs(delivery)).Scan(&delivery.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("unable to update webhook delivery '%s' : %w", delivery.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (p *Postgres) ListWebhookDeliveries(ctx context.Context, filter *WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	if _, err := p.GetWebhook(ctx, filter.WebhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Db.Query(
+		ctx,
+		LIST_WEBHOOK_DELIVERIES_QUERY,
+		pgx.NamedArgs{
+			"webhook_id": filter.WebhookID,
+			"status":     filter.Status,
+			"limit":      filter.Limit,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query deliveries of webhook '%s' : %w", filter.WebhookID, err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse deliveries of webhook '%s' : %w", filter.WebhookID, err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery finds a delivery to the webhook, with its payload and every attempt made at it.
+func (p *Postgres) GetWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (*WebhookDelivery, []WebhookAttempt, error) {
+	var payload string
+	delivery, err := scanWebhookDelivery(p.Db.QueryRow(
+		ctx,
+		GET_WEBHOOK_DELIVERY_QUERY,
+		pgx.NamedArgs{
+			"id":         deliveryID,
+			"webhook_id": webhookID,
+		},
+	), &payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to query webhook delivery '%s' : %w", deliveryID, err)
+	}
+	delivery.Payload = []byte(payload)
+
+	rows, err := p.Db.Query(
+		ctx,
+		GET_WEBHOOK_ATTEMPTS_QUERY,
+		pgx.NamedArgs{
+			"delivery_id": deliveryID,
+		},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to query attempts at webhook delivery '%s' : %w", deliveryID, err)
+	}
+	defer rows.Close()
+
+	attempts := make([]WebhookAttempt, 0)
+	for rows.Next() {
+		var (
+			attempt    WebhookAttempt
+			durationMs int64
+		)
+		err = rows.Scan(&attempt.DeliveryID, &attempt.Attempt, &attempt.StatusCode, &attempt.Error, &attempt.AttemptedAt, &durationMs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse attempts at webhook delivery '%s' : %w", deliveryID, err)
+		}
+		attempt.Duration = time.Duration(durationMs) * time.Millisecond
+		attempts = append(attempts, attempt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return delivery, attempts, nil
+}
+
+// RedeliverWebhook sends the event of a delivery to its webhook again, as a new delivery due straight away, whatever
+// became of the first one.
+func (p *Postgres) RedeliverWebhook(ctx context.Context, webhookID string, deliveryID string, redeliveryID string) (*WebhookDelivery, error) {
+	var redelivery *WebhookDelivery
+
+	err := p.inTx(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		webhook, err := queryWebhook(ctx, tx, GET_WEBHOOK_QUERY, webhookID)
+		if err != nil {
+			return err
+		}
+		if webhook.Status != WebhookStatusActive {
+			return ErrWebhookDisabled
+		}
+
+		delivery, err := queryWebhookDelivery(ctx, tx, GET_WEBHOOK_DELIVERY_BY_WEBHOOK_QUERY, webhookID, deliveryID)
+		if err != nil {
+			return err
+		}
+
+		redelivery = newWebhookDelivery(redeliveryID, webhookID, &WebhookEvent{ID: delivery.EventID, Type: delivery.EventType}, time.Now())
+		redelivery.RedeliveryOf = delivery.ID
+		return insertWebhookDelivery(ctx, tx, redelivery)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return redelivery, nil
+}
+
+func (m *MemoryStore) CreateWebhook(_ context.Context, webhook *Webhook) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[webhook.ID]; ok {
+		return nil, fmt.Errorf("unable to insert webhook '%s' : it already exists", webhook.ID)
+	}
+
+	created := *webhook
+	created.EventTypes = slices.Clone(webhook.EventTypes)
+	created.CreatedAt = time.Now()
+	created.UpdatedAt = created.CreatedAt
+	m.webhooks[created.ID] = &created
+
+	result := created
+	return &result, nil
+}
+
+func (m *MemoryStore) GetWebhook(_ context.Context, webhookID string) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[webhookID]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	result := *webhook
+	return &result, nil
+}
+
+func (m *MemoryStore) ListWebhooks(_ context.Context) ([]*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := make([]*Webhook, 0, len(m.webhooks))
+	for _, webhook := range m.webhooks {
+		result := *webhook
+		webhooks = append(webhooks, &result)
+	}
+
+	slices.SortFunc(webhooks, func(a, b *Webhook) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return webhooks, nil
+}
+
+func (m *MemoryStore) ChangeWebhookStatus(_ context.Context, webhookID string, status WebhookStatus) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[webhookID]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	if webhook.Status != status {
+		webhook.Status = status
+		webhook.UpdatedAt = time.Now()
+	}
+
+	result := *webhook
+	return &result, nil
+}
+
+func (m *MemoryStore) PublishWebhookEvents(events WebhookEvents) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = events
+}
+
+func (m *MemoryStore) queueTransactionEvents(txns ...*TransactionRecord) {
+	if m.events == nil {
+		return
+	}
+
+	for _, txn := range txns {
+		m.enqueueWebhookEvent(m.events.TransactionEvent(txn))
+	}
+}
+
+func (m *MemoryStore) queueAccountStatusEvent(params *StatusChangeParams) {
+	if m.events == nil {
+		return
+	}
+	m.enqueueWebhookEvent(m.events.AccountStatusEvent(params))
+}
+
+func (m *MemoryStore) enqueueWebhookEvent(event *WebhookEvent) {
+	if event == nil {
+		return
+	}
+
+	now := time.Now()
+	deliveries := 0
+	for _, webhook := range m.webhooks {
+		if !webhook.Subscribes(event.Type) {
+			continue
+		}
+
+		delivery := newWebhookDelivery(uuid.NewString(), webhook.ID, event, now)
+		delivery.CreatedAt, delivery.UpdatedAt = now, now
+		m.webhookDeliveries[delivery.ID] = delivery
+		deliveries++
+	}
+
+	if deliveries > 0 {
+		stored := *event
+		stored.CreatedAt = now
+		m.webhookEvents[stored.ID] = &stored
+	}
+}
+
+func (m *MemoryStore) ClaimDueWebhookDeliveries(_ context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]*WebhookDelivery, 0)
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.Status == WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) && !delivery.lockedUntil.After(now) &&
+			m.webhooks[delivery.WebhookID].Status == WebhookStatusActive {
+			due = append(due, delivery)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b *WebhookDelivery) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*WebhookDelivery, 0, len(due))
+	for _, delivery := range due {
+		delivery.lockedUntil = now.Add(WEBHOOK_DELIVERY_LEASE)
+
+		result := *delivery
+		webhook := m.webhooks[delivery.WebhookID]
+		result.URL, result.Secret = webhook.URL, webhook.Secret
+		result.Payload = m.webhookEvents[delivery.EventID].Payload
+		claimed = append(claimed, &result)
+	}
+
+	return claimed, nil
+}
+
+func (m *MemoryStore) RecordWebhookAttempt(_ context.Context, attempt *WebhookAttempt) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.webhookDeliveries[attempt.DeliveryID]
+	if !ok {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	if delivery.isDue(attempt) {
+		m.webhookAttempts = append(m.webhookAttempts, *attempt)
+		delivery.recordAttempt(attempt)
+		delivery.UpdatedAt = time.Now()
+	}
+
+	result := *delivery
+	return &result, nil
+}
+
+func (m *MemoryStore) ListWebhookDeliveries(_ context.Context, filter *WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[filter.WebhookID]; !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.WebhookID == filter.WebhookID && (len(filter.Status) == 0 || delivery.Status == filter.Status) {
+			result := *delivery
+			deliveries = append(deliveries, &result)
+		}
+	}
+
+	slices.SortFunc(deliveries, func(a, b *WebhookDelivery) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+
+	return deliveries, nil
+}
+
+func (m *MemoryStore) GetWebhookDelivery(_ context.Context, webhookID string, deliveryID string) (*WebhookDelivery, []WebhookAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.webhookDeliveries[deliveryID]
+	if !ok || delivery.WebhookID != webhookID {
+		return nil, nil, ErrWebhookDeliveryNotFound
+	}
+
+	attempts := make([]WebhookAttempt, 0)
+	for _, attempt := range m.webhookAttempts {
+		if attempt.DeliveryID == deliveryID {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	result := *delivery
+	result.Payload = m.webhookEvents[delivery.EventID].Payload
+	return &result, attempts, nil
+}
+
+func (m *MemoryStore) RedeliverWebhook(_ context.Context, webhookID string, deliveryID string, redeliveryID string) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[webhookID]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	if webhook.Status != WebhookStatusActive {
+		return nil, ErrWebhookDisabled
+	}
+
+	delivery, ok := m.webhookDeliveries[deliveryID]
+	if !ok || delivery.WebhookID != webhookID {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if _, ok = m.webhookDeliveries[redeliveryID]; ok {
+		return nil, fmt.Errorf("unable to insert webhook delivery '%s' : it already exists", redeliveryID)
+	}
+
+	now := time.Now()
+	redelivery := newWebhookDelivery(redeliveryID, webhookID, m.webhookEvents[delivery.EventID], now)
+	redelivery.RedeliveryOf = delivery.ID
+	redelivery.CreatedAt, redelivery.UpdatedAt = now, now
+	m.webhookDeliveries[redelivery.ID] = redelivery
+
+	result := *redelivery
+	return &result, nil
+}
@@ -0,0 +1,185 @@
+package fees
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+type Operation string
+
+const (
+	OperationDeposit  Operation = "deposit"
+	OperationWithdraw Operation = "withdraw"
+	OperationTransfer Operation = "transfer"
+)
+
+func IsOperation(operation string) bool {
+	switch Operation(operation) {
+	case OperationDeposit, OperationWithdraw, OperationTransfer:
+		return true
+	}
+	return false
+}
+
+// Tier prices amounts up to UpTo, or every amount above the tier before it when UpTo is not set.
+type Tier struct {
+	UpTo decimal.NullDecimal `json:"up_to"`
+	Flat decimal.Decimal     `json:"flat"`
+	Rate decimal.Decimal     `json:"rate"`
+}
+
+// Rule prices an operation for an account type in a currency; an empty account type or currency matches any. The
+// fee is Flat plus Rate, a fraction, of the amount, both taken from the tier the amount falls in when there are
+// Tiers, and is then kept between Min and Max. Flat amounts are in the currency of the operation.
+type Rule struct {
+	Operation   Operation           `json:"operation"`
+	AccountType string              `json:"account_type"`
+	Currency    string              `json:"currency"`
+	Flat        decimal.Decimal     `json:"flat"`
+	Rate        decimal.Decimal     `json:"rate"`
+	Tiers       []Tier              `json:"tiers"`
+	Min         decimal.NullDecimal `json:"min"`
+	Max         decimal.NullDecimal `json:"max"`
+}
+
+// Schedule holds the fee rules. The most specific rule matching an operation applies: one for the account type
+// over one for any type, then one for the currency over one for any currency.
+type Schedule struct {
+	rules []Rule
+}
+
+// NewSchedule loads fee rules from a JSON file holding a list of rules. An empty path yields a schedule that charges
+// nothing.
+func NewSchedule(path string) (*Schedule, error) {
+	schedule := &Schedule{
+		rules: make([]Rule, 0),
+	}
+
+	if len(path) == 0 {
+		return schedule, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fee schedule file '%s' : %v", path, err)
+	}
+
+	var rules []Rule
+	if err = json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse fee schedule file '%s' : %v", path, err)
+	}
+
+	for _, rule := range rules {
+		rule.AccountType = strings.ToLower(rule.AccountType)
+		rule.Currency = strings.ToUpper(rule.Currency)
+		if err = rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid fee rule for %s by '%s' accounts in '%s' : %v", rule.Operation, rule.AccountType, rule.Currency, err)
+		}
+		schedule.rules = append(schedule.rules, rule)
+	}
+
+	return schedule, nil
+}
+
+func (s *Schedule) IsEmpty() bool {
+	return len(s.rules) == 0
+}
+
+// Fee is what the operation of amount costs an account of the type, rounded to the currency. It is zero when no rule
+// matches.
+func (s *Schedule) Fee(operation Operation, accountType string, currency string, amount decimal.Decimal) decimal.Decimal {
+	var (
+		match *Rule
+		best  = -1
+	)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.Operation != operation || !matches(rule.AccountType, accountType) || !matches(rule.Currency, currency) {
+			continue
+		}
+
+		specificity := 0
+		if len(rule.AccountType) > 0 {
+			specificity += 2
+		}
+		if len(rule.Currency) > 0 {
+			specificity++
+		}
+		if specificity > best {
+			match, best = rule, specificity
+		}
+	}
+
+	if match == nil {
+		return decimal.Zero
+	}
+	return match.fee(currency, amount)
+}
+
+func (r *Rule) fee(currency string, amount decimal.Decimal) decimal.Decimal {
+	flat, rate := r.Flat, r.Rate
+	if len(r.Tiers) > 0 {
+		tier := r.Tiers[len(r.Tiers)-1]
+		for _, candidate := range r.Tiers {
+			if candidate.UpTo.Valid && amount.LessThanOrEqual(candidate.UpTo.Decimal) {
+				tier = candidate
+				break
+			}
+		}
+		flat, rate = tier.Flat, tier.Rate
+	}
+
+	fee := flat.Add(amount.Mul(rate))
+	if r.Min.Valid {
+		fee = decimal.Max(fee, r.Min.Decimal)
+	}
+	if r.Max.Valid {
+		fee = decimal.Min(fee, r.Max.Decimal)
+	}
+
+	scale, _ := utils.CurrencyScale(currency)
+	return fee.Round(scale)
+}
+
+func (r *Rule) validate() error {
+	if !IsOperation(string(r.Operation)) {
+		return fmt.Errorf("operation must be one of deposit, withdraw or transfer")
+	}
+	if len(r.Currency) > 0 {
+		if _, err := utils.ParseCurrency(r.Currency); err != nil {
+			return err
+		}
+	}
+	if r.Flat.IsNegative() || r.Rate.IsNegative() {
+		return fmt.Errorf("flat and rate must not be negative")
+	}
+	if (r.Min.Valid && r.Min.Decimal.IsNegative()) || (r.Max.Valid && r.Max.Decimal.IsNegative()) {
+		return fmt.Errorf("min and max must not be negative")
+	}
+	if r.Min.Valid && r.Max.Valid && r.Min.Decimal.GreaterThan(r.Max.Decimal) {
+		return fmt.Errorf("min must not exceed max")
+	}
+
+	for i, tier := range r.Tiers {
+		if tier.Flat.IsNegative() || tier.Rate.IsNegative() {
+			return fmt.Errorf("tier %d : flat and rate must not be negative", i)
+		}
+		if !tier.UpTo.Valid && i < len(r.Tiers)-1 {
+			return fmt.Errorf("tier %d : only the last tier may leave up_to unset", i)
+		}
+		if i > 0 && tier.UpTo.Valid && !tier.UpTo.Decimal.GreaterThan(r.Tiers[i-1].UpTo.Decimal) {
+			return fmt.Errorf("tier %d : up_to must be above that of the tier before", i)
+		}
+	}
+
+	return nil
+}
+
+func matches(ruleValue string, value string) bool {
+	return len(ruleValue) == 0 || ruleValue == value
+}
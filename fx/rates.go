@@ -0,0 +1,46 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const DEFAULT_QUOTE_TTL = 30 * time.Second
+
+var ErrRateNotFound = errors.New("fx rate not found")
+
+type Rate struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Rate   decimal.Decimal `json:"rate"`
+	Spread decimal.Decimal `json:"spread"`
+}
+
+// RateProvider supplies the mid-market rate and spread used to convert between two currencies.
+type RateProvider interface {
+	GetRate(ctx context.Context, from string, to string) (*Rate, error)
+}
+
+// Convert applies the rate net of spread and rounds the result down to the scale of the target currency.
+func (r *Rate) Convert(amount decimal.Decimal) decimal.Decimal {
+	scale, _ := utils.CurrencyScale(r.To)
+	return amount.Mul(r.EffectiveRate()).RoundDown(scale)
+}
+
+func (r *Rate) EffectiveRate() decimal.Decimal {
+	return r.Rate.Mul(decimal.NewFromInt(1).Sub(r.Spread))
+}
+
+// QuoteTTL is how long a locked quote can be referenced by a transfer, configurable through FX_QUOTE_TTL.
+func QuoteTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("FX_QUOTE_TTL"))
+	if err != nil || ttl <= 0 {
+		return DEFAULT_QUOTE_TTL
+	}
+	return ttl
+}
@@ -0,0 +1,73 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+type StaticRateProvider struct {
+	rates map[string]Rate
+}
+
+// NewStaticRateProvider loads rates from a JSON file holding a list of {from, to, rate, spread} entries.
+// The inverse of each rate is derived when it is not listed explicitly. An empty path yields no rates.
+func NewStaticRateProvider(path string) (*StaticRateProvider, error) {
+	provider := &StaticRateProvider{
+		rates: make(map[string]Rate),
+	}
+
+	if len(path) == 0 {
+		return provider, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fx rates file '%s' : %v", path, err)
+	}
+
+	var rates []Rate
+	if err = json.Unmarshal(content, &rates); err != nil {
+		return nil, fmt.Errorf("unable to parse fx rates file '%s' : %v", path, err)
+	}
+
+	for _, rate := range rates {
+		rate.From = strings.ToUpper(rate.From)
+		rate.To = strings.ToUpper(rate.To)
+		if !rate.Rate.IsPositive() || rate.Spread.IsNegative() || rate.Spread.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			return nil, fmt.Errorf("invalid fx rate from '%s' to '%s'", rate.From, rate.To)
+		}
+		provider.rates[rateKey(rate.From, rate.To)] = rate
+	}
+
+	for _, rate := range rates {
+		inverseKey := rateKey(strings.ToUpper(rate.To), strings.ToUpper(rate.From))
+		if _, ok := provider.rates[inverseKey]; ok {
+			continue
+		}
+		provider.rates[inverseKey] = Rate{
+			From:   strings.ToUpper(rate.To),
+			To:     strings.ToUpper(rate.From),
+			Rate:   decimal.NewFromInt(1).DivRound(rate.Rate, 18),
+			Spread: rate.Spread,
+		}
+	}
+
+	return provider, nil
+}
+
+func (s *StaticRateProvider) GetRate(_ context.Context, from string, to string) (*Rate, error) {
+	rate, ok := s.rates[rateKey(from, to)]
+	if !ok {
+		return nil, fmt.Errorf("%w : '%s' to '%s'", ErrRateNotFound, from, to)
+	}
+	return &rate, nil
+}
+
+func rateKey(from string, to string) string {
+	return fmt.Sprintf("%s_%s", from, to)
+}
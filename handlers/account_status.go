@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const (
+	freezeAccountOp   = "FreezeAccount"
+	unfreezeAccountOp = "UnfreezeAccount"
+	closeAccountOp    = "CloseAccount"
+)
+
+func (a *accountsHandler) FreezeAccount(ctx *fiber.Ctx) error {
+	return a.changeAccountStatus(ctx, freezeAccountOp, database.AccountStatusFrozen)
+}
+
+func (a *accountsHandler) UnfreezeAccount(ctx *fiber.Ctx) error {
+	return a.changeAccountStatus(ctx, unfreezeAccountOp, database.AccountStatusActive)
+}
+
+func (a *accountsHandler) CloseAccount(ctx *fiber.Ctx) error {
+	return a.changeAccountStatus(ctx, closeAccountOp, database.AccountStatusClosed)
+}
+
+func (a *accountsHandler) changeAccountStatus(ctx *fiber.Ctx, op string, status database.AccountStatus) error {
+	req, err := a.validateAccountStatusRequest(ctx, op, status)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	accounts, txns, err := a.handleChangeAccountStatus(ctx.UserContext(), op, status, req)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"accounts":     accounts,
+			"transactions": txns,
+		},
+	)
+}
+
+func (a *accountsHandler) handleChangeAccountStatus(ctx context.Context, op string, status database.AccountStatus,
+	req *models.AccountStatusRequest) ([]models.AccountResponse, []models.AccountTransactionsResponse, error) {
+	sweeps, err := a.store.ChangeAccountStatus(ctx, &database.StatusChangeParams{
+		AccountID:     req.AccountID,
+		Status:        status,
+		Reason:        req.Reason,
+		FreezeCredits: req.FreezeCredits,
+		SweepTo:       req.SweepTo,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to change status of account '%s' to '%s' : %v", op, req.AccountID, status, err))
+		return nil, nil, err
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] account '%s' is now '%s' : %s", op, req.AccountID, status, req.Reason))
+
+	txns := make([]models.AccountTransactionsResponse, 0, len(sweeps))
+	for _, txn := range sweeps {
+		txns = append(txns, toTransactionResponse(txn))
+	}
+
+	accounts, err := a.handleGetAccountBalance(ctx, &models.GetAccountBalanceRequest{
+		Id: req.AccountID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accounts, txns, nil
+}
+
+func (a *accountsHandler) validateAccountStatusRequest(ctx *fiber.Ctx, op string, status database.AccountStatus) (*models.AccountStatusRequest, error) {
+	req := new(models.AccountStatusRequest)
+
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", op, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	req.AccountID = ctx.Params("id")
+	if err := uuid.Validate(req.AccountID); err != nil || database.IsSystemAccount(req.AccountID) {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid account ID '%s'", op, req.AccountID))
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input reason cannot be empty", op))
+		return nil, utils.Invalid("reason", "is required")
+	}
+
+	if req.FreezeCredits && status != database.AccountStatusFrozen {
+		a.logger.Error(fmt.Sprintf("[%s] request input freeze_credits only applies to freezing", op))
+		return nil, utils.Invalid("freeze_credits", "only applies when freezing an account")
+	}
+
+	if len(req.SweepTo) > 0 {
+		err := uuid.Validate(req.SweepTo)
+		if err != nil || database.IsSystemAccount(req.SweepTo) || req.SweepTo == req.AccountID || status != database.AccountStatusClosed {
+			a.logger.Error(fmt.Sprintf("[%s] request input sweep_to '%s' is not valid", op, req.SweepTo))
+			return nil, utils.Invalid("sweep_to", "must be the UUID of another customer account, and only applies when closing")
+		}
+	}
+
+	return req, nil
+}
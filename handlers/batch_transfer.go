@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const batchTransferOp = "BatchTransfer"
+
+const (
+	MAX_BATCH_TRANSFER_LEGS = 500
+	MAX_REFERENCE_LENGTH    = 140
+)
+
+func (a *accountsHandler) BatchTransfer(ctx *fiber.Ctx) error {
+	req, err := a.validateBatchTransferRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateTransferHeader(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	batch, err := a.handleBatchTransfer(ctx.UserContext(), req, reqHeader.IdempotencyKey)
+	if err != nil {
+		return utils.NewError(ctx, batchError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"batch": batch,
+		},
+	)
+}
+
+// handleBatchTransfer runs the legs of the batch that have not been recorded yet. Legs recorded by an earlier
+// attempt with the same Idempotency-Key are reported as recorded rather than run again.
+func (a *accountsHandler) handleBatchTransfer(ctx context.Context, req *models.BatchTransfer, batchID string) (*models.BatchTransferResponse, error) {
+	recorded, err := a.store.GetBatchTransactions(ctx, batchID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Error finding existing transactions of batch '%s' : %+v", batchTransferOp, batchID, err))
+		return nil, err
+	}
+
+	senders := make(map[string]database.TransactionRecord, len(recorded))
+	for _, txn := range recorded {
+		if txn.TxnType == database.TxnTypeSender {
+			senders[txn.ID] = txn
+		}
+	}
+
+	resp := &models.BatchTransferResponse{
+		BatchID:   batchID,
+		Mode:      req.Mode,
+		Transfers: make([]models.BatchTransferLegResponse, 0, len(req.Legs)),
+	}
+
+	params := &database.BatchTransferParams{
+		BatchID: batchID,
+		Mode:    database.BatchMode(req.Mode),
+	}
+	pending := make([]int, 0, len(req.Legs))
+
+	for i, leg := range req.Legs {
+		legResp := models.BatchTransferLegResponse{
+			Index:         i,
+			TransactionID: batchLegID(batchID, i),
+			From:          leg.From,
+			To:            leg.To,
+			Amount:        utils.FormatAmount(leg.Amount, leg.Currency),
+			Currency:      leg.Currency,
+			Reference:     leg.Reference,
+			Status:        utils.FAILED,
+		}
+
+		if txn, ok := senders[legResp.TransactionID]; ok {
+			setBatchLegOutcome(&legResp, txn.Status, failureError(txn.FailureReason, txn.ID))
+		} else {
+			// A sender that does not exist fails its leg in the store like any other, so it is priced as free here.
+			fee, err := a.fee(ctx, fees.OperationTransfer, leg.From, leg.Currency, leg.Amount)
+			if err != nil && !errors.Is(err, database.ErrAccountNotFound) {
+				a.logger.Error(fmt.Sprintf("[%s] Error pricing leg '%s' of batch '%s' : %+v", batchTransferOp, legResp.TransactionID, batchID, err))
+				return nil, err
+			}
+
+			pending = append(pending, i)
+			params.Legs = append(params.Legs, &database.TransferParams{
+				TxnID:      legResp.TransactionID,
+				From:       leg.From,
+				To:         leg.To,
+				Amount:     leg.Amount,
+				Currency:   leg.Currency,
+				ToCurrency: leg.Currency,
+				BatchID:    batchID,
+				Reference:  leg.Reference,
+				Fee:        fee,
+			})
+		}
+
+		resp.Transfers = append(resp.Transfers, legResp)
+	}
+
+	if len(params.Legs) > 0 {
+		results, err := a.store.BatchTransfer(ctx, params)
+		if err != nil {
+			var legErr *database.BatchLegError
+			if errors.As(err, &legErr) {
+				legErr.Index = pending[legErr.Index]
+			}
+			a.logger.Error(fmt.Sprintf("[%s] Error running batch '%s' : %+v", batchTransferOp, batchID, err))
+			return nil, err
+		}
+
+		for i, result := range results {
+			legResp := &resp.Transfers[pending[i]]
+			if result.Err != nil {
+				a.logger.Error(fmt.Sprintf("[%s] Leg '%s' of batch '%s' was not recorded : %+v", batchTransferOp, legResp.TransactionID, batchID, result.Err))
+				setBatchLegOutcome(legResp, utils.FAILED, storeError(result.Err))
+				continue
+			}
+			setBatchLegOutcome(legResp, result.Result.Sender.Status, failureError(result.Result.Sender.FailureReason, legResp.TransactionID))
+		}
+	}
+
+	resp.Status = batchStatus(resp.Transfers)
+	a.logger.Info(fmt.Sprintf("[%s] batch '%s' of %d transfers is %s", batchTransferOp, batchID, len(resp.Transfers), resp.Status))
+
+	return resp, nil
+}
+
+// batchLegID derives the transaction ID of a leg from the batch ID, so that retrying a batch gives every leg the
+// same ID again.
+func batchLegID(batchID string, index int) string {
+	return uuid.NewSHA1(uuid.MustParse(batchID), []byte(strconv.Itoa(index))).String()
+}
+
+func setBatchLegOutcome(legResp *models.BatchTransferLegResponse, status string, err error) {
+	legResp.Status = status
+
+	var apiErr *utils.APIError
+	if errors.As(err, &apiErr) {
+		legResp.ErrorCode = int(apiErr.Code)
+		legResp.Error = apiErr.Name()
+	}
+}
+
+func batchStatus(legs []models.BatchTransferLegResponse) string {
+	completed := 0
+	for _, leg := range legs {
+		if leg.Status == utils.COMPLETED {
+			completed++
+		}
+	}
+
+	switch completed {
+	case len(legs):
+		return utils.COMPLETED
+	case 0:
+		return utils.FAILED
+	default:
+		return utils.PARTIAL
+	}
+}
+
+// batchError reports the leg that failed an atomic batch as the field at fault.
+func batchError(err error) *utils.APIError {
+	apiErr := storeError(err)
+
+	var legErr *database.BatchLegError
+	if !errors.As(err, &legErr) || apiErr.Code == utils.ERR_INTERNAL {
+		return apiErr
+	}
+
+	return utils.NewAPIError(apiErr.Code, utils.FieldError{
+		Field:   fmt.Sprintf("transfers[%d]", legErr.Index),
+		Message: apiErr.Message(),
+	})
+}
+
+func (a *accountsHandler) validateBatchTransferRequest(ctx *fiber.Ctx) (*models.BatchTransfer, error) {
+	req := new(models.BatchTransferRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", batchTransferOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	if len(req.Mode) == 0 {
+		req.Mode = string(database.BatchModeAtomic)
+	}
+	if !database.IsBatchMode(req.Mode) {
+		a.logger.Error(fmt.Sprintf("[%s] request input mode '%s' is invalid", batchTransferOp, req.Mode))
+		return nil, utils.Invalid("mode", "must be atomic or best_effort")
+	}
+
+	if len(req.Transfers) == 0 || len(req.Transfers) > MAX_BATCH_TRANSFER_LEGS {
+		a.logger.Error(fmt.Sprintf("[%s] request has %d transfers, not between 1 and %d", batchTransferOp, len(req.Transfers), MAX_BATCH_TRANSFER_LEGS))
+		return nil, utils.Invalid("transfers", fmt.Sprintf("must hold between 1 and %d transfers", MAX_BATCH_TRANSFER_LEGS))
+	}
+
+	batch := &models.BatchTransfer{
+		Mode: req.Mode,
+		Legs: make([]models.BatchTransferLeg, 0, len(req.Transfers)),
+	}
+
+	for i, leg := range req.Transfers {
+		field := fmt.Sprintf("transfers[%d].", i)
+
+		if err := uuid.Validate(leg.From); err != nil || database.IsSystemAccount(leg.From) {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d FROM account ID '%s' is invalid", batchTransferOp, i, leg.From))
+			return nil, utils.Invalid(field+"from", "must be the UUID of a customer account")
+		}
+
+		if err := uuid.Validate(leg.To); err != nil || database.IsSystemAccount(leg.To) || leg.To == leg.From {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d TO account ID '%s' is invalid", batchTransferOp, i, leg.To))
+			return nil, utils.Invalid(field+"to", "must be the UUID of another customer account")
+		}
+
+		currency, err := utils.ParseCurrency(leg.Currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d currency '%s' is invalid : %v", batchTransferOp, i, leg.Currency, err))
+			return nil, utils.Invalid(field+"currency", "is not a supported ISO 4217 currency")
+		}
+
+		if len(leg.Amount) == 0 {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d amount is not specified", batchTransferOp, i))
+			return nil, utils.Invalid(field+"amount", "is required")
+		}
+
+		amount, err := utils.ParseAmount(leg.Amount, currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d amount '%s' is invalid : %v", batchTransferOp, i, leg.Amount, err))
+			return nil, invalidAmount(field+"amount", err)
+		}
+
+		if len(leg.Reference) > MAX_REFERENCE_LENGTH {
+			a.logger.Error(fmt.Sprintf("[%s] request leg %d reference is longer than %d characters", batchTransferOp, i, MAX_REFERENCE_LENGTH))
+			return nil, utils.Invalid(field+"reference", fmt.Sprintf("must be at most %d characters", MAX_REFERENCE_LENGTH))
+		}
+
+		batch.Legs = append(batch.Legs, models.BatchTransferLeg{
+			From:      leg.From,
+			To:        leg.To,
+			Amount:    amount,
+			Currency:  currency,
+			Reference: leg.Reference,
+		})
+	}
+
+	return batch, nil
+}
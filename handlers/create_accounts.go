@@ -2,16 +2,10 @@ package handlers
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gomodule/redigo/redis"
-	"github.com/google/uuid"
-	"github.com/jackc/pgerrcode"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/robinloh/wallet-backend/database"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
@@ -19,70 +13,29 @@ import (
 
 const createAccountsOp = "CreateAccounts"
 
+const (
+	MAX_OWNER_ID_LENGTH       = 64
+	MAX_DISPLAY_NAME_LENGTH   = 128
+	MAX_METADATA_KEYS         = 32
+	MAX_METADATA_KEY_LENGTH   = 64
+	MAX_METADATA_VALUE_LENGTH = 512
+)
+
 func (a *accountsHandler) CreateAccounts(ctx *fiber.Ctx) error {
 	req, err := a.validateCreateAccountsRequest(ctx)
-	if err != nil || req == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
-	}
-
-	reqHeader, err := a.validateCreateAccountsHeader(ctx)
-	if err != nil || reqHeader == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
-	}
-
-	redisKey := fmt.Sprintf("%s_%s", reqHeader.IdempotencyKey, createAccountsOp)
-
-	redisConn := a.redis.RedisPool.Get()
-	defer func(redisConn redis.Conn) {
-		err := redisConn.Close()
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] Error closing redis connection for redisKey '%s'. error: %s", createAccountsOp, redisKey, err.Error()))
-		}
-	}(redisConn)
-
-	ok, err := a.redis.Acquire(redisConn, redisKey)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] error acquiring lock for idempotency key '%s' : %v", createAccountsOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	}
-
-	shouldRelease := true
-
-	defer func() {
-		err := a.redis.Release(redisConn, redisKey, shouldRelease)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] error releasing lock for idempotency key '%s' : %v", createAccountsOp, redisKey, err))
-		}
-	}()
-
-	if !ok {
-		shouldRelease = false
-		results, err := a.redis.HandleMultipleRequests(ctx.UserContext(), redisKey, 5*time.Second)
-		if err != nil || results == nil {
-			a.logger.Error(fmt.Sprintf("[%s] error handling multiple requests '%s' : %v", createAccountsOp, redisKey, err))
-			return utils.NewError(ctx, fiber.StatusInternalServerError)
-		}
-		a.logger.Info(fmt.Sprintf("[%s] multiple requests detected for '%s' : Results : %+v", createAccountsOp, redisKey, results))
-		return utils.NewSuccess(ctx, results)
+		return utils.NewError(ctx, err)
 	}
 
 	results, err := a.handleCreateAccounts(ctx.UserContext(), req)
 	if err != nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
 	successResp := fiber.Map{
 		"accounts": results,
 	}
 
-	err = a.redis.Publish(redisConn, redisKey, successResp)
-	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Unable to publish results for idempotency key '%s' : %v", createAccountsOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	} else {
-		a.logger.Debug(fmt.Sprintf("[%s] Successfully published results '%+v' for idempotency key '%s'", createAccountsOp, results, redisKey))
-	}
-
 	return utils.NewSuccess(ctx, successResp)
 }
 
@@ -91,74 +44,115 @@ func (a *accountsHandler) validateCreateAccountsRequest(ctx *fiber.Ctx) (*models
 
 	if err := ctx.BodyParser(accReq); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", createAccountsOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	if len((*accReq).Accounts) > 0 {
+		if (*accReq).Count != 0 && (*accReq).Count != len((*accReq).Accounts) {
+			a.logger.Error(fmt.Sprintf("[%s] request input count '%d' does not match the %d accounts given", createAccountsOp, (*accReq).Count, len((*accReq).Accounts)))
+			return nil, utils.Invalid("count", "does not match the number of accounts given")
+		}
+		if !isEmptyAccountDetails(&(*accReq).AccountDetails) {
+			a.logger.Error(fmt.Sprintf("[%s] account details must be given either per account or for all of them", createAccountsOp))
+			return nil, utils.Invalid("accounts", "cannot be combined with account details for all accounts")
+		}
+		(*accReq).Count = len((*accReq).Accounts)
 	}
 
 	if (*accReq).Count < 1 {
 		a.logger.Error(fmt.Sprintf("[%s] request input count '%d' cannot be less than 1", createAccountsOp, (*accReq).Count))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("count", "must be at least 1")
+	}
+
+	if err := a.validateAccountDetails(&(*accReq).AccountDetails, ""); err != nil {
+		return nil, err
+	}
+	for i := range (*accReq).Accounts {
+		if err := a.validateAccountDetails(&(*accReq).Accounts[i], fmt.Sprintf("accounts[%d].", i)); err != nil {
+			return nil, err
+		}
 	}
 
 	return accReq, nil
 }
 
-func (a *accountsHandler) validateCreateAccountsHeader(ctx *fiber.Ctx) (*models.AccountRequestHeader, error) {
-	accReqHeader := new(models.AccountRequestHeader)
+// validateAccountDetails checks the details of one account. Fields at fault are reported under prefix, which locates
+// the account in the request.
+func (a *accountsHandler) validateAccountDetails(details *models.AccountDetails, prefix string) error {
+	details.OwnerID = strings.TrimSpace(details.OwnerID)
+	if len(details.OwnerID) > MAX_OWNER_ID_LENGTH {
+		a.logger.Error(fmt.Sprintf("[%s] request input owner_id is longer than %d characters", createAccountsOp, MAX_OWNER_ID_LENGTH))
+		return utils.Invalid(prefix+"owner_id", fmt.Sprintf("must be at most %d characters", MAX_OWNER_ID_LENGTH))
+	}
 
-	if err := ctx.ReqHeaderParser(accReqHeader); err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", createAccountsOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	if len(details.AccountType) > 0 && !database.IsAccountType(details.AccountType) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account_type '%s' is invalid", createAccountsOp, details.AccountType))
+		return utils.Invalid(prefix+"account_type", "must be one of checking, savings or business")
 	}
 
-	if len(accReqHeader.IdempotencyKey) == 0 {
-		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not supplied", createAccountsOp, accReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	details.DisplayName = strings.TrimSpace(details.DisplayName)
+	if len(details.DisplayName) > MAX_DISPLAY_NAME_LENGTH {
+		a.logger.Error(fmt.Sprintf("[%s] request input display_name is longer than %d characters", createAccountsOp, MAX_DISPLAY_NAME_LENGTH))
+		return utils.Invalid(prefix+"display_name", fmt.Sprintf("must be at most %d characters", MAX_DISPLAY_NAME_LENGTH))
 	}
 
-	err := uuid.Validate(accReqHeader.IdempotencyKey)
-	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", createAccountsOp, accReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	if err := validateMetadata(details.Metadata, prefix+"metadata"); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input metadata is invalid : %v", createAccountsOp, err))
+		return err
 	}
 
-	return accReqHeader, nil
+	return nil
 }
 
-func (a *accountsHandler) handleCreateAccounts(ctx context.Context, accReq *models.AccountRequest) ([]pgx.NamedArgs, error) {
-	batch := &pgx.Batch{}
-	argsList := make([]pgx.NamedArgs, 0, accReq.Count)
-
-	for i := 0; i < accReq.Count; i++ {
-		accountID, _ := uuid.NewUUID()
-		args := pgx.NamedArgs{
-			"id":      accountID.String(),
-			"balance": 0.00,
+// validateMetadata bounds the metadata of an account, which is stored and searched as given.
+func validateMetadata(metadata map[string]string, field string) *utils.APIError {
+	if len(metadata) > MAX_METADATA_KEYS {
+		return utils.Invalid(field, fmt.Sprintf("must have at most %d keys", MAX_METADATA_KEYS))
+	}
+	for key, value := range metadata {
+		if len(key) == 0 || len(key) > MAX_METADATA_KEY_LENGTH {
+			return utils.Invalid(field, fmt.Sprintf("key '%s' must be 1 to %d characters", key, MAX_METADATA_KEY_LENGTH))
+		}
+		if len(value) > MAX_METADATA_VALUE_LENGTH {
+			return utils.Invalid(field+"."+key, fmt.Sprintf("must be at most %d characters", MAX_METADATA_VALUE_LENGTH))
 		}
-		argsList = append(argsList, args)
-		batch.Queue(database.INSERT_ACCOUNTS_QUERY, args)
 	}
+	return nil
+}
 
-	results := a.postgresDB.Db.SendBatch(ctx, batch)
-	defer func(results pgx.BatchResults) {
-		err := results.Close()
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[handleCreateAccounts] error closing batch: %v", err))
-		}
-	}(results)
+func isEmptyAccountDetails(details *models.AccountDetails) bool {
+	return len(details.OwnerID) == 0 && len(details.AccountType) == 0 && len(details.DisplayName) == 0 && len(details.Metadata) == 0
+}
 
+func (a *accountsHandler) handleCreateAccounts(ctx context.Context, accReq *models.AccountRequest) ([]models.AccountResponse, error) {
+	params := make([]*database.AccountParams, 0, accReq.Count)
 	for i := 0; i < accReq.Count; i++ {
-		_, err := results.Exec()
-		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-				a.logger.Error(fmt.Sprintf("[handleCreateAccounts] account '%s' already exists : %v", argsList[i]["accountid"], err))
-				continue
-			}
-			return argsList, fmt.Errorf("unable to insert row for account '%s' : %v", argsList[i]["accountid"], err)
+		details := &accReq.AccountDetails
+		if len(accReq.Accounts) > 0 {
+			details = &accReq.Accounts[i]
 		}
+		params = append(params, &database.AccountParams{
+			OwnerID:     details.OwnerID,
+			Type:        database.AccountType(details.AccountType),
+			DisplayName: details.DisplayName,
+			Metadata:    details.Metadata,
+		})
+	}
+
+	created, err := a.store.CreateAccounts(ctx, params)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[handleCreateAccounts] unable to create accounts : %v", err))
+		return nil, err
+	}
+
+	accounts := make([]models.AccountResponse, 0, len(created))
+	accountIDs := make([]string, 0, len(created))
+	for _, account := range created {
+		accounts = append(accounts, toAccountResponse(account))
+		accountIDs = append(accountIDs, account.ID)
 	}
 
-	a.logger.Info(fmt.Sprintf("[handleCreateAccounts] successfully created . %+v", argsList))
+	a.logger.Info(fmt.Sprintf("[handleCreateAccounts] successfully created . %+v", accountIDs))
 
-	return argsList, results.Close()
+	return accounts, nil
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const setCreditLimitOp = "SetCreditLimit"
+
+func (a *accountsHandler) SetCreditLimit(ctx *fiber.Ctx) error {
+	params, err := a.validateCreditLimitRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	accounts, err := a.handleSetCreditLimit(ctx.UserContext(), params)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"accounts": accounts,
+		},
+	)
+}
+
+func (a *accountsHandler) handleSetCreditLimit(ctx context.Context, params *database.CreditLimitParams) ([]models.AccountResponse, error) {
+	if err := a.store.SetCreditLimit(ctx, params); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to set %s credit limit of account '%s' : %v", setCreditLimitOp, params.Currency, params.AccountID, err))
+		return nil, err
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] %s credit limit of account '%s' is now '%s'", setCreditLimitOp, params.Currency, params.AccountID, params.CreditLimit))
+
+	return a.handleGetAccountBalance(ctx, &models.GetAccountBalanceRequest{
+		Id: params.AccountID,
+	})
+}
+
+func (a *accountsHandler) validateCreditLimitRequest(ctx *fiber.Ctx) (*database.CreditLimitParams, error) {
+	req := new(models.CreditLimitRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", setCreditLimitOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+	req.AccountID = ctx.Params("id")
+
+	if err := uuid.Validate(req.AccountID); err != nil || database.IsSystemAccount(req.AccountID) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", setCreditLimitOp, req.AccountID))
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
+	}
+
+	currency, err := utils.ParseCurrency(req.Currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", setCreditLimitOp, req.Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+
+	if len(req.CreditLimit) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input credit limit is not specified", setCreditLimitOp))
+		return nil, utils.Invalid("credit_limit", "is required")
+	}
+
+	// A zero limit withdraws the credit line, so it is the one amount accepted that is not positive.
+	limit := decimal.Zero
+	parsed, err := decimal.NewFromString(strings.TrimSpace(req.CreditLimit))
+	switch {
+	case err == nil && parsed.IsNegative():
+		a.logger.Error(fmt.Sprintf("[%s] request input credit limit '%s' is negative", setCreditLimitOp, req.CreditLimit))
+		return nil, utils.Invalid("credit_limit", "must not be negative")
+	case err != nil || !parsed.IsZero():
+		limit, err = utils.ParseAmount(req.CreditLimit, currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input credit limit '%s' is invalid : %v", setCreditLimitOp, req.CreditLimit, err))
+			return nil, invalidAmount("credit_limit", err)
+		}
+	}
+
+	return &database.CreditLimitParams{
+		AccountID:   req.AccountID,
+		Currency:    currency,
+		CreditLimit: limit,
+	}, nil
+}
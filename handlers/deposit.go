@@ -3,13 +3,11 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
 	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
 )
@@ -18,68 +16,24 @@ const depositOp = "Deposit"
 
 func (a *accountsHandler) Deposit(ctx *fiber.Ctx) error {
 	req, err := a.validateDepositRequest(ctx)
-	if err != nil || req == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
+	if err != nil {
+		return utils.NewError(ctx, err)
 	}
 
 	reqHeader, err := a.validateDepositHeader(ctx)
-	if err != nil || reqHeader == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
-	}
-
-	redisKey := fmt.Sprintf("%s_%s", reqHeader.IdempotencyKey, depositOp)
-
-	redisConn := a.redis.RedisPool.Get()
-	defer func(redisConn redis.Conn) {
-		err := redisConn.Close()
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] Error closing redis connection for redisKey '%s'. error: %s", depositOp, redisKey, err.Error()))
-		}
-	}(redisConn)
-
-	ok, err := a.redis.Acquire(redisConn, redisKey)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] error acquiring lock for idempotency key '%s' : %v", depositOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	}
-
-	shouldRelease := true
-
-	defer func() {
-		err := a.redis.Release(redisConn, redisKey, shouldRelease)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] error releasing lock for idempotency key '%s' : %v", depositOp, redisKey, err))
-		}
-	}()
-
-	if !ok {
-		shouldRelease = false
-		results, err := a.redis.HandleMultipleRequests(ctx.UserContext(), redisKey, 5*time.Second)
-		if err != nil || results == nil {
-			a.logger.Error(fmt.Sprintf("[%s] error handling multiple requests '%s' : %v", depositOp, redisKey, err))
-			return utils.NewError(ctx, fiber.StatusInternalServerError)
-		}
-		a.logger.Info(fmt.Sprintf("[%s] multiple requests detected for '%s' : Results : %+v", depositOp, redisKey, results))
-		return utils.NewSuccess(ctx, results)
+		return utils.NewError(ctx, err)
 	}
 
 	results, err := a.handleDeposit(ctx.UserContext(), req, reqHeader)
 	if err != nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
 	successResp := fiber.Map{
 		"accounts": results,
 	}
 
-	err = a.redis.Publish(redisConn, redisKey, successResp)
-	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Unable to publish results for idempotency key '%s' : %v", depositOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	} else {
-		a.logger.Debug(fmt.Sprintf("[%s] Successfully published results '%+v' for idempotency key '%s'", depositOp, results, redisKey))
-	}
-
 	return utils.NewSuccess(ctx, successResp)
 }
 
@@ -89,7 +43,8 @@ func (a *accountsHandler) handleDeposit(ctx context.Context, req *models.Deposit
 		a.logger.Error(fmt.Sprintf("[%s] Error finding existing transaction '%s' : %+v", depositOp, reqHeader.IdempotencyKey, err))
 		return &models.DepositResponse{
 			AccountID:     req.ID,
-			Amount:        req.Amount,
+			Amount:        utils.FormatAmount(req.Amount, req.Currency),
+			Currency:      req.Currency,
 			Status:        utils.FAILED,
 			TransactionID: reqHeader.IdempotencyKey,
 		}, err
@@ -97,52 +52,55 @@ func (a *accountsHandler) handleDeposit(ctx context.Context, req *models.Deposit
 
 	if len(res) > 0 {
 		a.logger.Info(fmt.Sprintf("[%s] There was existing transaction '%s' : %+v", depositOp, reqHeader.IdempotencyKey, res))
+		res, fee := splitFee(res)
 		return &models.DepositResponse{
 			AccountID:     res[0].AccountID,
 			Amount:        res[0].Amount,
+			Currency:      res[0].Currency,
 			Status:        res[0].Status,
 			TransactionID: res[0].TransactionID,
-		}, err
+			Fee:           fee,
+		}, failureError(database.FailureReason(res[0].FailureReason), res[0].TransactionID)
 	}
 
-	var done int64
+	resp := &models.DepositResponse{
+		AccountID:     req.ID,
+		Amount:        utils.FormatAmount(req.Amount, req.Currency),
+		Currency:      req.Currency,
+		Status:        utils.FAILED,
+		TransactionID: reqHeader.IdempotencyKey,
+	}
 
-	err = a.postgresDB.Db.QueryRow(
-		ctx,
-		database.DEPOSIT_QUERY,
-		req.ID,
-		req.Amount,
-		reqHeader.IdempotencyKey,
-		database.TxnTypeDeposit,
-		"",
-	).Scan(&done)
+	fee, err := a.fee(ctx, fees.OperationDeposit, req.ID, req.Currency, req.Amount)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Error pricing deposit into account '%s' : %+v", depositOp, req.ID, err))
+		return resp, err
+	}
+	if fee.GreaterThanOrEqual(req.Amount) {
+		a.logger.Error(fmt.Sprintf("[%s] Depositing '%s' into account '%s' does not cover its fee '%s'", depositOp, req.Amount, req.ID, fee))
+		return resp, utils.Invalid("amount", fmt.Sprintf("must be greater than the fee of %s", utils.FormatAmount(fee, req.Currency)))
+	}
 
+	txn, err := a.store.Deposit(ctx, &database.DepositParams{
+		TxnID:     reqHeader.IdempotencyKey,
+		AccountID: req.ID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Fee:       fee,
+	})
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Error depositing from account '%s' : %+v", depositOp, req.ID, err))
-		return &models.DepositResponse{
-			AccountID:     req.ID,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+		a.logger.Error(fmt.Sprintf("[%s] Error depositing into account '%s' : %+v", depositOp, req.ID, err))
+		return resp, err
 	}
 
-	if done == 0 {
-		a.logger.Error(fmt.Sprintf("[%s] Depositing '%f' was not done from account '%s'", depositOp, req.Amount, req.ID))
-		return &models.DepositResponse{
-			AccountID:     req.ID,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+	if txn.Status != utils.COMPLETED {
+		a.logger.Error(fmt.Sprintf("[%s] Depositing '%s' was not done into account '%s'", depositOp, req.Amount, req.ID))
+	} else if fee.IsPositive() {
+		resp.Fee = utils.FormatAmount(fee, req.Currency)
 	}
 
-	return &models.DepositResponse{
-		AccountID:     req.ID,
-		Amount:        req.Amount,
-		Status:        utils.COMPLETED,
-		TransactionID: reqHeader.IdempotencyKey,
-	}, nil
+	resp.Status = txn.Status
+	return resp, failureError(txn.FailureReason, resp.TransactionID)
 }
 
 func (a *accountsHandler) validateDepositRequest(ctx *fiber.Ctx) (*models.Deposit, error) {
@@ -150,34 +108,36 @@ func (a *accountsHandler) validateDepositRequest(ctx *fiber.Ctx) (*models.Deposi
 
 	if err := ctx.BodyParser(req); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", depositOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	err := uuid.Validate((*req).ID)
-	if err != nil {
+	if err != nil || database.IsSystemAccount((*req).ID) {
 		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", depositOp, (*req).ID))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
 	}
 
 	if len((*req).Amount) == 0 {
 		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not specified", depositOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("amount", "is required")
 	}
 
-	amount, err := strconv.ParseFloat((*req).Amount, 64)
+	currency, err := utils.ParseCurrency((*req).Currency)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid", depositOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", depositOp, (*req).Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
 	}
 
-	if amount <= 0 {
-		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not greater than zero", depositOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	amount, err := utils.ParseAmount((*req).Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", depositOp, (*req).Amount, err))
+		return nil, invalidAmount("amount", err)
 	}
 
 	return &models.Deposit{
-		ID:     (*req).ID,
-		Amount: amount,
+		ID:       (*req).ID,
+		Amount:   amount,
+		Currency: currency,
 	}, nil
 }
 
@@ -186,18 +146,18 @@ func (a *accountsHandler) validateDepositHeader(ctx *fiber.Ctx) (*models.Deposit
 
 	if err := ctx.ReqHeaderParser(depositReqHeader); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", depositOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	if len(depositReqHeader.IdempotencyKey) == 0 {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not supplied", depositOp, depositReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MISSING_IDEMPOTENCY_KEY)
 	}
 
 	err := uuid.Validate(depositReqHeader.IdempotencyKey)
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", depositOp, depositReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
 	}
 
 	return depositReqHeader, nil
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+// storeErrors maps the errors of the store and the rate provider to the catalog entry reported for them.
+var storeErrors = []struct {
+	err  error
+	code utils.ErrorCode
+}{
+	{database.ErrAccountNotFound, utils.ERR_ACCOUNT_NOT_FOUND},
+	{database.ErrAccountFrozen, utils.ERR_ACCOUNT_FROZEN},
+	{database.ErrAccountClosed, utils.ERR_ACCOUNT_CLOSED},
+	{database.ErrAccountNotEmpty, utils.ERR_ACCOUNT_NOT_EMPTY},
+	{database.ErrInvalidStatusChange, utils.ERR_INVALID_STATUS_CHANGE},
+	{database.ErrInsufficientFunds, utils.ERR_INSUFFICIENT_FUNDS},
+	{database.ErrDestinationNotFound, utils.ERR_DESTINATION_NOT_FOUND},
+	{database.ErrLimitExceeded, utils.ERR_LIMIT_EXCEEDED},
+	{database.ErrHoldNotFound, utils.ERR_HOLD_NOT_FOUND},
+	{database.ErrHoldNotActive, utils.ERR_HOLD_NOT_ACTIVE},
+	{database.ErrCaptureExceedsHold, utils.ERR_CAPTURE_EXCEEDS_HOLD},
+	{database.ErrTransactionNotFound, utils.ERR_TRANSACTION_NOT_FOUND},
+	{database.ErrNotReversible, utils.ERR_NOT_REVERSIBLE},
+	{database.ErrAlreadyReversed, utils.ERR_ALREADY_REVERSED},
+	{database.ErrReversalExceedsOriginal, utils.ERR_REVERSAL_EXCEEDS_ORIGINAL},
+	{database.ErrQuoteUnavailable, utils.ERR_FX_QUOTE_UNAVAILABLE},
+	{database.ErrScheduleNotFound, utils.ERR_SCHEDULE_NOT_FOUND},
+	{database.ErrInvalidScheduleChange, utils.ERR_INVALID_SCHEDULE_CHANGE},
+	{database.ErrWebhookNotFound, utils.ERR_WEBHOOK_NOT_FOUND},
+	{database.ErrWebhookDeliveryNotFound, utils.ERR_WEBHOOK_DELIVERY_NOT_FOUND},
+	{database.ErrWebhookDisabled, utils.ERR_WEBHOOK_DISABLED},
+	{fx.ErrRateNotFound, utils.ERR_FX_RATE_UNAVAILABLE},
+	{utils.ErrAmountNotPositive, utils.ERR_AMOUNT_TOO_SMALL},
+}
+
+// failureErrors maps the reasons a transaction is recorded as failed to the catalog entry reported for them.
+var failureErrors = map[database.FailureReason]utils.ErrorCode{
+	database.FailureInsufficientFunds:   utils.ERR_INSUFFICIENT_FUNDS,
+	database.FailureDestinationNotFound: utils.ERR_DESTINATION_NOT_FOUND,
+	database.FailureSingleAmountLimit:   utils.ERR_LIMIT_EXCEEDED,
+	database.FailureDailyAmountLimit:    utils.ERR_LIMIT_EXCEEDED,
+	database.FailureMonthlyAmountLimit:  utils.ERR_LIMIT_EXCEEDED,
+	database.FailureDailyCountLimit:     utils.ERR_LIMIT_EXCEEDED,
+	database.FailureMonthlyCountLimit:   utils.ERR_LIMIT_EXCEEDED,
+	database.FailureMaxBalanceLimit:     utils.ERR_LIMIT_EXCEEDED,
+}
+
+// limitMessages say which limit a transaction refused for a limit would have broken.
+var limitMessages = map[database.FailureReason]string{
+	database.FailureSingleAmountLimit:  "exceeds the largest amount allowed in one transaction",
+	database.FailureDailyAmountLimit:   "exceeds what is left of the daily outgoing limit",
+	database.FailureMonthlyAmountLimit: "exceeds what is left of the monthly outgoing limit",
+	database.FailureDailyCountLimit:    "exceeds the number of outgoing transactions allowed per day",
+	database.FailureMonthlyCountLimit:  "exceeds the number of outgoing transactions allowed per month",
+	database.FailureMaxBalanceLimit:    "would take the balance above its limit",
+}
+
+// storeError is the catalog entry for an error returned while handling a request. Validation failures pass
+// through, and errors the catalog has no entry for are internal.
+func storeError(err error) *utils.APIError {
+	var apiErr *utils.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, mapping := range storeErrors {
+		if errors.Is(err, mapping.err) {
+			return utils.NewAPIError(mapping.code)
+		}
+	}
+
+	return utils.NewAPIError(utils.ERR_INTERNAL)
+}
+
+// failureError is the error reported for transaction txnID recorded as failed, or nil when the transaction did not
+// fail for a known reason. It names the transaction and why it failed, which the error replaces the response of.
+func failureError(reason database.FailureReason, txnID string) error {
+	code, ok := failureErrors[reason]
+	if !ok {
+		return nil
+	}
+
+	apiErr := utils.NewAPIError(code)
+	if message, ok := limitMessages[reason]; ok {
+		apiErr.Details = []utils.FieldError{{Field: "amount", Message: message}}
+	}
+	apiErr.Extensions = map[string]any{
+		"transaction_id": txnID,
+		"status":         utils.FAILED,
+		"failure_reason": reason,
+	}
+	return apiErr
+}
+
+// invalidAmount describes why an amount field failed to parse.
+func invalidAmount(field string, err error) *utils.APIError {
+	switch {
+	case errors.Is(err, utils.ErrAmountScale):
+		return utils.Invalid(field, "has more decimal places than the currency allows")
+	case errors.Is(err, utils.ErrAmountNotPositive):
+		return utils.Invalid(field, "must be greater than zero")
+	case errors.Is(err, utils.ErrAmountOutOfRange):
+		return utils.Invalid(field, "is too large")
+	default:
+		return utils.Invalid(field, "must be a decimal number")
+	}
+}
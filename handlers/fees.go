@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const getFeeQuoteOp = "GetFeeQuote"
+
+func (a *accountsHandler) GetFeeQuote(ctx *fiber.Ctx) error {
+	req, amount, err := a.validateFeeQuoteRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	quote, err := a.handleGetFeeQuote(ctx.UserContext(), req, amount)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"quote": quote,
+		},
+	)
+}
+
+func (a *accountsHandler) handleGetFeeQuote(ctx context.Context, req *models.FeeQuoteRequest, amount decimal.Decimal) (*models.FeeQuoteResponse, error) {
+	operation := fees.Operation(req.Operation)
+
+	fee, err := a.fee(ctx, operation, req.AccountID, req.Currency, amount)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to price %s of '%s %s' by account '%s' : %v", getFeeQuoteOp, operation, amount, req.Currency, req.AccountID, err))
+		return nil, err
+	}
+
+	total := amount.Add(fee)
+	if operation == fees.OperationDeposit {
+		total = amount.Sub(fee)
+	}
+
+	return &models.FeeQuoteResponse{
+		Operation: req.Operation,
+		AccountID: req.AccountID,
+		Amount:    utils.FormatAmount(amount, req.Currency),
+		Currency:  req.Currency,
+		Fee:       utils.FormatAmount(fee, req.Currency),
+		Total:     utils.FormatAmount(total, req.Currency),
+	}, nil
+}
+
+// fee is what the fee schedule charges the account for the operation. The account is only looked up when the
+// schedule has rules, so a missing account is not reported while nothing is charged.
+func (a *accountsHandler) fee(ctx context.Context, operation fees.Operation, accountID string, currency string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if a.fees.IsEmpty() {
+		return decimal.Zero, nil
+	}
+
+	account, err := a.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return a.fees.Fee(operation, string(account.Type), currency, amount), nil
+}
+
+// splitFee separates the line of the fee charged with a recorded transaction from the records of the transaction
+// itself. The fee is empty when the transaction was free.
+func splitFee(res []models.AccountTransactionsResponse) ([]models.AccountTransactionsResponse, string) {
+	legs := make([]models.AccountTransactionsResponse, 0, len(res))
+	fee := ""
+	for _, txn := range res {
+		if txn.TxnType == string(database.TxnTypeFee) {
+			fee = txn.Amount
+			continue
+		}
+		legs = append(legs, txn)
+	}
+	return legs, fee
+}
+
+func (a *accountsHandler) validateFeeQuoteRequest(ctx *fiber.Ctx) (*models.FeeQuoteRequest, decimal.Decimal, error) {
+	req := new(models.FeeQuoteRequest)
+	if err := ctx.QueryParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request query : %v", getFeeQuoteOp, err))
+		return nil, decimal.Zero, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	if !fees.IsOperation(req.Operation) {
+		a.logger.Error(fmt.Sprintf("[%s] request input operation '%s' is invalid", getFeeQuoteOp, req.Operation))
+		return nil, decimal.Zero, utils.Invalid("operation", "must be one of deposit, withdraw or transfer")
+	}
+
+	if err := uuid.Validate(req.AccountID); err != nil || database.IsSystemAccount(req.AccountID) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", getFeeQuoteOp, req.AccountID))
+		return nil, decimal.Zero, utils.Invalid("account_id", "must be the UUID of a customer account")
+	}
+
+	if len(req.Amount) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount is not specified", getFeeQuoteOp))
+		return nil, decimal.Zero, utils.Invalid("amount", "is required")
+	}
+
+	currency, err := utils.ParseCurrency(req.Currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", getFeeQuoteOp, req.Currency, err))
+		return nil, decimal.Zero, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+	req.Currency = currency
+
+	amount, err := utils.ParseAmount(req.Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", getFeeQuoteOp, req.Amount, err))
+		return nil, decimal.Zero, invalidAmount("amount", err)
+	}
+
+	return req, amount, nil
+}
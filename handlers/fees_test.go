@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const testFeeRules = `[
+	{"operation":"withdraw","flat":"0.50","rate":"0.01"},
+	{"operation":"deposit","currency":"EUR","flat":"1"}
+]`
+
+// TestWithdrawFee withdraws under a fee schedule. The fee is debited on top of the amount, reported in the response
+// and listed in the history as a line of its own sharing the transaction ID.
+func TestWithdrawFee(t *testing.T) {
+	app := newTestAppCharging(t, database.NewMemoryStore(), testFeeRules)
+	accountID := app.createAccounts(1)[0]
+	app.deposit(accountID, "200")
+
+	txnID := uuid.NewString()
+	status, body := app.post("v1/withdraw", txnID, depositBody(accountID, "100"))
+	if status != http.StatusOK {
+		t.Fatalf("withdraw = %d %v", status, body)
+	}
+	if withdrawal := body["accounts"].(map[string]any); withdrawal["amount"] != "100.00" || withdrawal["fee"] != "1.50" {
+		t.Errorf("withdrawal = %v, want 100.00 with a fee of 1.50", withdrawal)
+	}
+	if balance := app.balance(accountID); balance != "98.50" {
+		t.Errorf("balance = %s, want 98.50", balance)
+	}
+
+	status, body = app.get("v1/accounts/transactions/" + accountID)
+	if status != http.StatusOK {
+		t.Fatalf("getting transactions = %d %v", status, body)
+	}
+	lines := make(map[string]string)
+	for _, txn := range body["transactions"].([]any) {
+		txn := txn.(map[string]any)
+		if txn["transaction_id"] == txnID {
+			lines[txn["txntype"].(string)] = txn["amount"].(string)
+		}
+	}
+	if len(lines) != 2 || lines["withdraw"] != "100.00" || lines[string(database.TxnTypeFee)] != "1.50" {
+		t.Errorf("history of '%s' = %v, want a withdrawal of 100.00 and a fee of 1.50", txnID, lines)
+	}
+
+	// A withdrawal the fee would take past the balance is refused, fee and all.
+	status, body = app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "98"))
+	wantError(t, status, body, http.StatusUnprocessableEntity, utils.ERR_INSUFFICIENT_FUNDS)
+	if balance := app.balance(accountID); balance != "98.50" {
+		t.Errorf("balance after the refused withdrawal = %s, want 98.50", balance)
+	}
+}
+
+func TestFeeQuote(t *testing.T) {
+	app := newTestAppCharging(t, database.NewMemoryStore(), testFeeRules)
+	accountID := app.createAccounts(1)[0]
+
+	quote := func(operation string, amount string, currency string) (int, map[string]any) {
+		return app.get(fmt.Sprintf("v1/fees/quote?operation=%s&account_id=%s&amount=%s&currency=%s", operation, accountID, amount, currency))
+	}
+
+	tests := []struct {
+		name      string
+		operation string
+		amount    string
+		currency  string
+		fee       string
+		total     string
+	}{
+		{name: "withdrawal debits the fee on top", operation: "withdraw", amount: "100", currency: "USD", fee: "1.50", total: "101.50"},
+		{name: "deposit credits less the fee", operation: "deposit", amount: "100", currency: "EUR", fee: "1.00", total: "99.00"},
+		{name: "operation without a rule", operation: "transfer", amount: "100", currency: "USD", fee: "0.00", total: "100.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := quote(tt.operation, tt.amount, tt.currency)
+			if status != http.StatusOK {
+				t.Fatalf("quote = %d %v", status, body)
+			}
+			if got := body["quote"].(map[string]any); got["fee"] != tt.fee || got["total"] != tt.total {
+				t.Errorf("quote = %v, want a fee of %s and a total of %s", got, tt.fee, tt.total)
+			}
+		})
+	}
+
+	status, body := quote("refund", "100", "USD")
+	wantError(t, status, body, http.StatusBadRequest, utils.ERR_VALIDATION_FAILED)
+}
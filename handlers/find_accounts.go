@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const (
+	findAccountsOp = "FindAccounts"
+
+	// METADATA_QUERY_PREFIX marks query parameters that filter on metadata, as in ?metadata.region=eu.
+	METADATA_QUERY_PREFIX = "metadata."
+)
+
+func (a *accountsHandler) FindAccounts(ctx *fiber.Ctx) error {
+	req, err := a.validateFindAccountsRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	accounts, err := a.handleFindAccounts(ctx.UserContext(), req)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"accounts": accounts,
+		},
+	)
+}
+
+func (a *accountsHandler) handleFindAccounts(ctx context.Context, req *models.FindAccountsRequest) ([]models.AccountResponse, error) {
+	found, err := a.store.FindAccounts(ctx, &database.AccountFilter{
+		OwnerID:  req.OwnerID,
+		Metadata: req.Metadata,
+		Limit:    req.Limit,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find accounts : %+v", findAccountsOp, err))
+		return nil, err
+	}
+
+	accounts := make([]models.AccountResponse, 0, len(found))
+	for _, account := range found {
+		accounts = append(accounts, toAccountResponse(account))
+	}
+
+	return accounts, nil
+}
+
+// validateFindAccountsRequest requires an owner or at least one metadata filter, so that the endpoint never lists
+// every account.
+func (a *accountsHandler) validateFindAccountsRequest(ctx *fiber.Ctx) (*models.FindAccountsRequest, error) {
+	req := &models.FindAccountsRequest{
+		OwnerID:  strings.TrimSpace(ctx.Query("owner_id")),
+		Metadata: make(map[string]string),
+		Limit:    database.DEFAULT_FIND_ACCOUNTS_LIMIT,
+	}
+
+	for key, value := range ctx.Queries() {
+		if metadataKey, ok := strings.CutPrefix(key, METADATA_QUERY_PREFIX); ok {
+			req.Metadata[metadataKey] = value
+		}
+	}
+
+	if len(req.OwnerID) == 0 && len(req.Metadata) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request needs an owner_id or a metadata filter", findAccountsOp))
+		return nil, utils.Invalid("owner_id", "is required unless a metadata filter is given")
+	}
+
+	if len(req.OwnerID) > MAX_OWNER_ID_LENGTH {
+		a.logger.Error(fmt.Sprintf("[%s] request input owner_id is longer than %d characters", findAccountsOp, MAX_OWNER_ID_LENGTH))
+		return nil, utils.Invalid("owner_id", fmt.Sprintf("must be at most %d characters", MAX_OWNER_ID_LENGTH))
+	}
+
+	if err := validateMetadata(req.Metadata, "metadata"); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input metadata is invalid : %v", findAccountsOp, err))
+		return nil, err
+	}
+
+	if limit := ctx.Query("limit"); len(limit) > 0 {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > database.MAX_FIND_ACCOUNTS_LIMIT {
+			a.logger.Error(fmt.Sprintf("[%s] request input limit '%s' must be between 1 and %d", findAccountsOp, limit, database.MAX_FIND_ACCOUNTS_LIMIT))
+			return nil, utils.Invalid("limit", fmt.Sprintf("must be between 1 and %d", database.MAX_FIND_ACCOUNTS_LIMIT))
+		}
+		req.Limit = parsed
+	}
+
+	return req, nil
+}
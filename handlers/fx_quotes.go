@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const createFxQuoteOp = "CreateFxQuote"
+
+func (a *accountsHandler) CreateFxQuote(ctx *fiber.Ctx) error {
+	req, amount, err := a.validateCreateFxQuoteRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	quote, err := a.handleCreateFxQuote(ctx.UserContext(), req, amount)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"quote": quote,
+		},
+	)
+}
+
+func (a *accountsHandler) handleCreateFxQuote(ctx context.Context, req *models.FxQuoteRequest, amount decimal.Decimal) (*models.FxQuoteResponse, error) {
+	rate, err := a.fxRates.GetRate(ctx, req.FromCurrency, req.ToCurrency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to get rate from '%s' to '%s' : %v", createFxQuoteOp, req.FromCurrency, req.ToCurrency, err))
+		return nil, err
+	}
+
+	quoteID, err := utils.GenerateTxnID()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(fx.QuoteTTL())
+
+	err = a.store.CreateFxQuote(ctx, &database.FxQuote{
+		ID:        quoteID,
+		Rate:      *rate,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to store quote '%s' : %v", createFxQuoteOp, quoteID, err))
+		return nil, err
+	}
+
+	resp := &models.FxQuoteResponse{
+		QuoteID:       quoteID,
+		FromCurrency:  rate.From,
+		ToCurrency:    rate.To,
+		Rate:          rate.Rate.String(),
+		Spread:        rate.Spread.String(),
+		EffectiveRate: rate.EffectiveRate().String(),
+		ExpiresAt:     utils.ConvertTimezone(expiresAt),
+	}
+
+	if amount.IsPositive() {
+		resp.Amount = utils.FormatAmount(amount, rate.From)
+		resp.ToAmount = utils.FormatAmount(rate.Convert(amount), rate.To)
+	}
+
+	return resp, nil
+}
+
+func (a *accountsHandler) validateCreateFxQuoteRequest(ctx *fiber.Ctx) (*models.FxQuoteRequest, decimal.Decimal, error) {
+	req := new(models.FxQuoteRequest)
+
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", createFxQuoteOp, err))
+		return nil, decimal.Zero, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	from, err := utils.ParseCurrency((*req).FromCurrency)
+	if err != nil || len((*req).FromCurrency) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input from_currency '%s' is invalid", createFxQuoteOp, (*req).FromCurrency))
+		return nil, decimal.Zero, utils.Invalid("from_currency", "is not a supported ISO 4217 currency")
+	}
+
+	to, err := utils.ParseCurrency((*req).ToCurrency)
+	if err != nil || len((*req).ToCurrency) == 0 || to == from {
+		a.logger.Error(fmt.Sprintf("[%s] request input to_currency '%s' is invalid", createFxQuoteOp, (*req).ToCurrency))
+		return nil, decimal.Zero, utils.Invalid("to_currency", "must be a supported ISO 4217 currency other than from_currency")
+	}
+
+	req.FromCurrency = from
+	req.ToCurrency = to
+
+	if len((*req).Amount) == 0 {
+		return req, decimal.Zero, nil
+	}
+
+	amount, err := utils.ParseAmount((*req).Amount, from)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", createFxQuoteOp, (*req).Amount, err))
+		return nil, decimal.Zero, invalidAmount("amount", err)
+	}
+
+	return req, amount, nil
+}
@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/robinloh/wallet-backend/database"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
@@ -15,17 +14,17 @@ import (
 
 func (a *accountsHandler) GetAccountBalance(ctx *fiber.Ctx) error {
 	req, err := a.validateGetAccountBalanceRequest(ctx)
-	if err != nil || req == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
+	if err != nil {
+		return utils.NewError(ctx, err)
 	}
 
 	accounts, err := a.handleGetAccountBalance(ctx.UserContext(), req)
 	if err != nil || accounts == nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
 	if len(accounts) == 0 {
-		return utils.NewError(ctx, fiber.StatusNotFound)
+		return utils.NewAPIError(utils.ERR_ACCOUNT_NOT_FOUND)
 	}
 
 	return utils.NewSuccess(
@@ -37,41 +36,55 @@ func (a *accountsHandler) GetAccountBalance(ctx *fiber.Ctx) error {
 }
 
 func (a *accountsHandler) handleGetAccountBalance(ctx context.Context, req *models.GetAccountBalanceRequest) ([]models.AccountResponse, error) {
-	results, err := a.postgresDB.Db.Query(
-		ctx,
-		database.GET_ACCOUNT_BALANCE_QUERY,
-		pgx.NamedArgs{
-			"id": req.Id,
-		},
-	)
+	resp := make([]models.AccountResponse, 0)
+
+	account, err := a.store.GetAccount(ctx, req.Id)
+	if errors.Is(err, database.ErrAccountNotFound) {
+		return resp, nil
+	}
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[handleGetAccountBalance] unable to query account balance: %+v", err))
 		return nil, fmt.Errorf("unable to query account balance : %v", err.Error())
 	}
-	defer results.Close()
 
-	resp := make([]models.AccountResponse, 0)
+	resp = append(resp, toAccountResponse(account))
+
+	return resp, nil
+}
 
-	for results.Next() {
-		account := models.AccountResponse{}
-		var bal pgtype.Float8
-		err = results.Scan(&account.ID, &bal)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[handleGetAccountBalance] unable to parse account balance: %+v", err))
-			return nil, fmt.Errorf("unable to parse account balance : %v", err.Error())
+func toAccountResponse(account *database.Account) models.AccountResponse {
+	balances := make([]models.BalanceResponse, 0, len(account.Balances))
+	for _, balance := range account.Balances {
+		resp := models.BalanceResponse{
+			Currency:  balance.Currency,
+			Available: utils.FormatAmount(balance.Available, balance.Currency),
+			Ledger:    utils.FormatAmount(balance.Balance, balance.Currency),
+		}
+		if balance.CreditLimit.IsPositive() {
+			resp.CreditLimit = utils.FormatAmount(balance.CreditLimit, balance.Currency)
+			resp.RemainingCredit = utils.FormatAmount(balance.RemainingCredit(), balance.Currency)
 		}
-		account.Balance = fmt.Sprintf("%.2f", bal.Float64)
-		resp = append(resp, account)
+		balances = append(balances, resp)
 	}
 
-	return resp, err
+	return models.AccountResponse{
+		ID:            account.ID,
+		Status:        string(account.Status),
+		StatusReason:  account.StatusReason,
+		FreezeCredits: account.FreezeCredits,
+		OwnerID:       account.OwnerID,
+		AccountType:   string(account.Type),
+		DisplayName:   account.DisplayName,
+		Metadata:      account.Metadata,
+		Balances:      balances,
+	}
 }
 
 func (a *accountsHandler) validateGetAccountBalanceRequest(ctx *fiber.Ctx) (*models.GetAccountBalanceRequest, error) {
 	id := ctx.Params("id")
 	if err := uuid.Validate(id); err != nil {
 		a.logger.Error(fmt.Sprintf("[GetAccountBalance] Invalid account ID '%s'", id))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
 	}
 	return &models.GetAccountBalanceRequest{
 		Id: id,
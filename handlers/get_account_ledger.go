@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+// GetAccountLedger lists the journal postings of an account in order, each with the balance it left behind.
+func (a *accountsHandler) GetAccountLedger(ctx *fiber.Ctx) error {
+	req, err := a.validateGetAccountLedgerRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	postings, err := a.handleGetAccountLedger(ctx.UserContext(), req)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"postings": postings,
+		},
+	)
+}
+
+func (a *accountsHandler) handleGetAccountLedger(ctx context.Context, req *models.AccountLedgerRequest) ([]models.LedgerPostingResponse, error) {
+	postings, err := a.store.ListAccountPostings(ctx, req.AccountID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[handleGetAccountLedger] unable to query account postings: %+v", err))
+		return nil, fmt.Errorf("unable to query account postings : %v", err.Error())
+	}
+
+	resp := make([]models.LedgerPostingResponse, 0, len(postings))
+	for _, posting := range postings {
+		resp = append(resp, models.LedgerPostingResponse{
+			EntryID:       posting.EntryID,
+			TransactionID: posting.TxnID,
+			Operation:     posting.Operation,
+			Currency:      posting.Currency,
+			Amount:        utils.FormatAmount(posting.Amount, posting.Currency),
+			BalanceAfter:  utils.FormatAmount(posting.BalanceAfter, posting.Currency),
+			Timestamp:     utils.ConvertTimezone(posting.Timestamp),
+		})
+	}
+
+	return resp, nil
+}
+
+func (a *accountsHandler) validateGetAccountLedgerRequest(ctx *fiber.Ctx) (*models.AccountLedgerRequest, error) {
+	accountId := ctx.Params("account_id")
+	if err := uuid.Validate(accountId); err != nil {
+		a.logger.Error(fmt.Sprintf("[GetAccountLedger] Invalid account ID '%s'", accountId))
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
+	}
+	return &models.AccountLedgerRequest{
+		AccountID: accountId,
+	}, nil
+}
@@ -3,105 +3,240 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	"github.com/robinloh/wallet-backend/database"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
 )
 
+const getAccountTransactionsOp = "GetAccountTransactions"
+
 func (a *accountsHandler) GetAccountTransactions(ctx *fiber.Ctx) error {
-	req, err := a.validateGetAccountTransactionsRequest(ctx)
-	if err != nil || req == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
+	query, err := a.validateGetAccountTransactionsRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
 	}
 
-	transactions, err := a.handleGetAccountTransactions(ctx.UserContext(), req)
+	page, err := a.handleGetAccountTransactions(ctx.UserContext(), query)
 	if err != nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
-	return utils.NewSuccess(
-		ctx,
-		fiber.Map{
-			"transactions": transactions,
-		},
-	)
-}
+	resp := fiber.Map{
+		"transactions": toTransactionResponses(page.Transactions),
+	}
+	if page.Next != nil {
+		resp["next_cursor"] = page.Next.Encode()
+	}
+	if page.Total != nil {
+		resp["total"] = *page.Total
+	}
 
-func (a *accountsHandler) handleGetAccountTransactions(ctx context.Context, req *models.AccountTransactionsRequest) ([]models.AccountTransactionsResponse, error) {
-	results, err := a.postgresDB.Db.Query(
-		ctx,
-		database.GET_ACCOUNT_TRANSACTIONS_QUERY,
-		pgx.NamedArgs{
-			"account_id": req.AccountID,
-		},
-	)
+	return utils.NewSuccess(ctx, resp)
+}
 
+func (a *accountsHandler) handleGetAccountTransactions(ctx context.Context, query *database.TransactionQuery) (*database.TransactionPage, error) {
+	page, err := a.store.ListAccountTransactions(ctx, query)
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[handleGetAccountTransactions] unable to query account transactions: %+v", err))
 		return nil, fmt.Errorf("unable to query account transactions : %v", err.Error())
 	}
 
-	defer results.Close()
+	return page, nil
+}
+
+func (a *accountsHandler) handleGetTransactions(ctx context.Context, txnID string) ([]models.AccountTransactionsResponse, error) {
+	txns, err := a.store.GetTransactions(ctx, txnID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[handleGetTransactions] unable to query transactions: %+v", err))
+		return nil, fmt.Errorf("unable to query transactions : %v", err.Error())
+	}
 
-	resp := make([]models.AccountTransactionsResponse, 0)
+	return toTransactionResponses(txns), nil
+}
 
-	for results.Next() {
-		account := models.AccountTransactionsResponse{}
-		err = results.Scan(&account.TransactionID, &account.AccountID, &account.Amount, &account.TxnType, &account.SenderID, &account.ReceiverID, &account.Timestamp, &account.Status)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[handleGetAccountTransactions] unable to parse account transactions: %+v", err))
-			return nil, fmt.Errorf("unable to parse account transactions : %v", err.Error())
-		}
-		account.Timestamp = utils.ConvertTimezone(account.Timestamp)
-		resp = append(resp, account)
+func toTransactionResponses(txns []database.TransactionRecord) []models.AccountTransactionsResponse {
+	resp := make([]models.AccountTransactionsResponse, 0, len(txns))
+	for _, txn := range txns {
+		resp = append(resp, toTransactionResponse(&txn))
 	}
+	return resp
+}
 
-	return resp, err
+func toTransactionResponse(txn *database.TransactionRecord) models.AccountTransactionsResponse {
+	resp := models.AccountTransactionsResponse{
+		TransactionID: txn.ID,
+		AccountID:     txn.AccountID,
+		Amount:        utils.FormatAmount(txn.Amount, txn.Currency),
+		Currency:      txn.Currency,
+		TxnType:       string(txn.TxnType),
+		SenderID:      txn.SenderID,
+		ReceiverID:    txn.ReceiverID,
+		Timestamp:     utils.ConvertTimezone(txn.Timestamp),
+		Status:        txn.Status,
+		FailureReason: string(txn.FailureReason),
+	}
+
+	if txn.CounterAmount.Valid && len(txn.CounterCurrency) > 0 {
+		resp.CounterAmount = utils.FormatAmount(txn.CounterAmount.Decimal, txn.CounterCurrency)
+		resp.CounterCurrency = txn.CounterCurrency
+	}
+	if txn.FxRate.Valid {
+		resp.FxRate = txn.FxRate.Decimal.String()
+	}
+	if txn.FxSpread.Valid {
+		resp.FxSpread = txn.FxSpread.Decimal.String()
+	}
+	if len(txn.ReversesID) > 0 {
+		resp.ReversesTransactionID = txn.ReversesID
+	}
+	if txn.ReversedAmount.IsPositive() {
+		resp.ReversedAmount = utils.FormatAmount(txn.ReversedAmount, txn.Currency)
+	}
+	resp.BatchID = txn.BatchID
+	resp.Reference = txn.Reference
+
+	return resp
 }
 
-func (a *accountsHandler) handleGetTransactions(ctx context.Context, txnID string) ([]models.AccountTransactionsResponse, error) {
-	results, err := a.postgresDB.Db.Query(
-		ctx,
-		database.GET_TRANSACTIONS_QUERY,
-		pgx.NamedArgs{
-			"id": txnID,
-		},
-	)
+func (a *accountsHandler) validateGetAccountTransactionsRequest(ctx *fiber.Ctx) (*database.TransactionQuery, error) {
+	req := new(models.AccountTransactionsRequest)
+	if err := ctx.QueryParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request query : %v", getAccountTransactionsOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	req.AccountID = ctx.Params("account_id")
+	if err := uuid.Validate(req.AccountID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid account ID '%s'", getAccountTransactionsOp, req.AccountID))
+		return nil, utils.Invalid("account_id", "must be the UUID of a customer account")
+	}
 
+	query, err := toTransactionQuery(req)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[handleGetTransactions] unable to query transactions: %+v", err))
-		return nil, fmt.Errorf("unable to query transactions : %v", err.Error())
+		a.logger.Error(fmt.Sprintf("[%s] request query is invalid : %v", getAccountTransactionsOp, err))
+		return nil, err
 	}
 
-	defer results.Close()
+	return query, nil
+}
 
-	resp := make([]models.AccountTransactionsResponse, 0)
+// toTransactionQuery parses the filters of a history request. List filters take repeated parameters or
+// comma-separated values.
+func toTransactionQuery(req *models.AccountTransactionsRequest) (*database.TransactionQuery, error) {
+	query := &database.TransactionQuery{
+		AccountID:    req.AccountID,
+		Limit:        database.DEFAULT_TRANSACTIONS_PAGE_SIZE,
+		IncludeTotal: req.IncludeTotal,
+	}
 
-	for results.Next() {
-		account := models.AccountTransactionsResponse{}
-		err = results.Scan(&account.TransactionID, &account.AccountID, &account.Amount, &account.TxnType, &account.SenderID, &account.ReceiverID, &account.Timestamp, &account.Status)
+	switch strings.ToLower(req.Order) {
+	case "", "desc":
+		query.Descending = true
+	case "asc":
+	default:
+		return nil, utils.Invalid("order", "must be asc or desc")
+	}
+
+	if req.Limit != 0 {
+		if req.Limit < 1 || req.Limit > database.MAX_TRANSACTIONS_PAGE_SIZE {
+			return nil, utils.Invalid("limit", fmt.Sprintf("must be between 1 and %d", database.MAX_TRANSACTIONS_PAGE_SIZE))
+		}
+		query.Limit = req.Limit
+	}
+
+	if len(req.Cursor) > 0 {
+		cursor, err := database.DecodeTransactionCursor(req.Cursor)
 		if err != nil {
-			a.logger.Error(fmt.Sprintf("[handleGetAccountTransactions] unable to parse account transactions: %+v", err))
-			return nil, fmt.Errorf("unable to parse account transactions : %v", err.Error())
+			return nil, utils.Invalid("cursor", "is not a cursor returned by this endpoint")
+		}
+		if cursor.Descending != query.Descending {
+			return nil, utils.Invalid("cursor", "was issued for the other order")
+		}
+		query.After = cursor
+	}
+
+	var err error
+	if len(req.From) > 0 {
+		if query.From, err = time.Parse(time.RFC3339, req.From); err != nil {
+			return nil, utils.Invalid("from", "must be an RFC 3339 time")
+		}
+	}
+	if len(req.To) > 0 {
+		if query.To, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return nil, utils.Invalid("to", "must be an RFC 3339 time")
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, utils.Invalid("from", "must be before to")
+	}
+
+	for _, txnType := range splitValues(req.TxnTypes) {
+		if !database.IsTxnType(txnType) {
+			return nil, utils.Invalid("txntype", fmt.Sprintf("'%s' is not a transaction type", txnType))
+		}
+		query.TxnTypes = append(query.TxnTypes, database.TxnType(txnType))
+	}
+
+	for _, status := range splitValues(req.Statuses) {
+		if status != utils.COMPLETED && status != utils.FAILED {
+			return nil, utils.Invalid("status", fmt.Sprintf("'%s' must be COMPLETED or FAILED", status))
 		}
-		account.Timestamp = utils.ConvertTimezone(account.Timestamp)
-		resp = append(resp, account)
+		query.Statuses = append(query.Statuses, status)
 	}
 
-	return resp, err
+	if len(req.Counterparty) > 0 {
+		if err = uuid.Validate(req.Counterparty); err != nil {
+			return nil, utils.Invalid("counterparty", "must be an account UUID")
+		}
+		query.Counterparty = req.Counterparty
+	}
+
+	if len(req.Currency) > 0 {
+		if query.Currency, err = utils.ParseCurrency(req.Currency); err != nil {
+			return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+		}
+	}
+
+	if query.MinAmount, err = parseAmountFilter(req.MinAmount); err != nil {
+		return nil, utils.Invalid("min_amount", "must be a non-negative decimal number")
+	}
+	if query.MaxAmount, err = parseAmountFilter(req.MaxAmount); err != nil {
+		return nil, utils.Invalid("max_amount", "must be a non-negative decimal number")
+	}
+	if query.MinAmount.Valid && query.MaxAmount.Valid && query.MinAmount.Decimal.GreaterThan(query.MaxAmount.Decimal) {
+		return nil, utils.Invalid("min_amount", "must not be greater than max_amount")
+	}
+
+	return query, nil
+}
+
+func splitValues(values []string) []string {
+	split := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.ToLower(strings.TrimSpace(part)); len(part) > 0 {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
 }
 
-func (a *accountsHandler) validateGetAccountTransactionsRequest(ctx *fiber.Ctx) (*models.AccountTransactionsRequest, error) {
-	accountId := ctx.Params("account_id")
-	if err := uuid.Validate(accountId); err != nil {
-		a.logger.Error(fmt.Sprintf("[GetAccountBalance] Invalid account ID '%s'", accountId))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+func parseAmountFilter(amount string) (decimal.NullDecimal, error) {
+	if len(amount) == 0 {
+		return decimal.NullDecimal{}, nil
+	}
+
+	d, err := decimal.NewFromString(strings.TrimSpace(amount))
+	if err != nil || d.IsNegative() {
+		return decimal.NullDecimal{}, fmt.Errorf("%w : '%s'", utils.ErrInvalidAmount, amount)
 	}
-	return &models.AccountTransactionsRequest{
-		AccountID: accountId,
-	}, nil
+
+	return decimal.NewNullDecimal(d), nil
 }
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/idempotency"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+// testApp is the Fiber app of the service on a store, routed as main routes it and behind the in-memory idempotency
+// store.
+type testApp struct {
+	t       *testing.T
+	app     *fiber.App
+	store   database.AccountStore
+	handler *accountsHandler
+}
+
+// newTestApp routes the app on a fresh memory store.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	return newTestAppOn(t, database.NewMemoryStore())
+}
+
+func newTestAppOn(t *testing.T, store database.AccountStore) *testApp {
+	t.Helper()
+	return newTestAppCharging(t, store, "")
+}
+
+// newTestAppCharging routes the app on a store with a fee schedule of the rules given as JSON, or with none when
+// rules is empty.
+func newTestAppCharging(t *testing.T, store database.AccountStore, rules string) *testApp {
+	t.Helper()
+
+	fxRates, err := fx.NewStaticRateProvider("")
+	if err != nil {
+		t.Fatalf("NewStaticRateProvider() error = %v", err)
+	}
+	path := ""
+	if len(rules) > 0 {
+		path = filepath.Join(t.TempDir(), "fees.json")
+		if err = os.WriteFile(path, []byte(rules), 0o600); err != nil {
+			t.Fatalf("writing fee schedule : %v", err)
+		}
+	}
+	feeSchedule, err := fees.NewSchedule(path)
+	if err != nil {
+		t.Fatalf("NewSchedule() error = %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := Initialize(logger, store, fxRates, feeSchedule).(*accountsHandler)
+
+	app := fiber.New(fiber.Config{
+		Immutable:    true,
+		ErrorHandler: utils.ErrorHandler,
+	})
+	idempotent := idempotency.NewMiddleware(logger, idempotency.NewMemoryStore(), store.(idempotency.RecordStore)).Handler()
+
+	app.Post("v1/accounts", idempotent, handler.CreateAccounts)
+	app.Get("v1/accounts/:id", handler.GetAccountBalance)
+	app.Post("v1/deposit", idempotent, handler.Deposit)
+	app.Post("v1/withdraw", idempotent, handler.Withdraw)
+	app.Post("v1/transfer", idempotent, handler.Transfer)
+	app.Post("v1/transfers/batch", idempotent, handler.BatchTransfer)
+	app.Get("v1/accounts/transactions/:account_id", handler.GetAccountTransactions)
+	app.Get("v1/accounts/ledger/:account_id", handler.GetAccountLedger)
+	app.Get("v1/fees/quote", handler.GetFeeQuote)
+	app.Post("v1/schedules", idempotent, handler.CreateSchedule)
+	app.Get("v1/schedules/:id", handler.GetSchedule)
+	app.Post("v1/webhooks", idempotent, handler.CreateWebhook)
+	app.Post("v1/webhooks/:id/deliveries/:delivery_id/redeliver", idempotent, handler.RedeliverWebhook)
+	app.Put("v1/admin/accounts/:id/credit-limit", handler.SetCreditLimit)
+
+	return &testApp{
+		t:       t,
+		app:     app,
+		store:   store,
+		handler: handler,
+	}
+}
+
+// do sends a request with the Idempotency-Key, when there is one, and returns the status and the decoded body.
+func (a *testApp) do(method string, path string, idempotencyKey string, body string) (int, map[string]any) {
+	a.t.Helper()
+
+	req := httptest.NewRequest(method, "/"+path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if len(idempotencyKey) > 0 {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		a.t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	decoded := make(map[string]any)
+	if err = json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		a.t.Fatalf("%s %s returned an undecodable body : %v", method, path, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func (a *testApp) post(path string, idempotencyKey string, body string) (int, map[string]any) {
+	a.t.Helper()
+	return a.do(http.MethodPost, path, idempotencyKey, body)
+}
+
+func (a *testApp) get(path string) (int, map[string]any) {
+	a.t.Helper()
+	return a.do(http.MethodGet, path, "", "")
+}
+
+func (a *testApp) put(path string, body string) (int, map[string]any) {
+	a.t.Helper()
+	return a.do(http.MethodPut, path, "", body)
+}
+
+// createAccounts creates count checking accounts and returns their IDs.
+func (a *testApp) createAccounts(count int) []string {
+	a.t.Helper()
+
+	status, body := a.post("v1/accounts", uuid.NewString(), fmt.Sprintf(`{"count":%d}`, count))
+	if status != http.StatusOK {
+		a.t.Fatalf("creating accounts = %d %v", status, body)
+	}
+
+	accountIDs := make([]string, 0, count)
+	for _, account := range body["accounts"].([]any) {
+		accountIDs = append(accountIDs, account.(map[string]any)["id"].(string))
+	}
+	return accountIDs
+}
+
+// deposit deposits amount of USD into the account and fails the test unless it completes.
+func (a *testApp) deposit(accountID string, amount string) {
+	a.t.Helper()
+
+	status, body := a.post("v1/deposit", uuid.NewString(), fmt.Sprintf(`{"id":"%s","amount":"%s","currency":"USD"}`, accountID, amount))
+	if status != http.StatusOK {
+		a.t.Fatalf("depositing %s into '%s' = %d %v", amount, accountID, status, body)
+	}
+}
+
+// balance returns the USD ledger balance of the account as the balance endpoint formats it.
+func (a *testApp) balance(accountID string) string {
+	a.t.Helper()
+
+	status, body := a.get("v1/accounts/" + accountID)
+	if status != http.StatusOK {
+		a.t.Fatalf("getting account '%s' = %d %v", accountID, status, body)
+	}
+	account := body["accounts"].([]any)[0].(map[string]any)
+	for _, balance := range account["balances"].([]any) {
+		if balance.(map[string]any)["currency"] == "USD" {
+			return balance.(map[string]any)["ledger"].(string)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+func (a *accountsHandler) HealthCheck(ctx *fiber.Ctx) error {
+	pingCtx, cancel := context.WithTimeout(ctx.UserContext(), healthCheckTimeout)
+	defer cancel()
+
+	if err := a.store.Ping(pingCtx); err != nil {
+		a.logger.Error(fmt.Sprintf("[HealthCheck] database is unreachable : %v", err))
+		return utils.NewAPIError(utils.ERR_SERVICE_UNAVAILABLE)
+	}
+
+	resp := fiber.Map{}
+
+	if postgres, ok := a.store.(*database.Postgres); ok {
+		stat := postgres.Db.Stat()
+		resp["database"] = fiber.Map{
+			"total_conns":    stat.TotalConns(),
+			"idle_conns":     stat.IdleConns(),
+			"acquired_conns": stat.AcquiredConns(),
+			"max_conns":      stat.MaxConns(),
+		}
+	}
+
+	return utils.NewSuccess(ctx, resp)
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const (
+	placeHoldOp   = "PlaceHold"
+	captureHoldOp = "CaptureHold"
+	voidHoldOp    = "VoidHold"
+	getHoldOp     = "GetHold"
+)
+
+func (a *accountsHandler) PlaceHold(ctx *fiber.Ctx) error {
+	req, err := a.validatePlaceHoldRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validatePlaceHoldHeader(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	hold, err := a.store.PlaceHold(ctx.UserContext(), &database.HoldParams{
+		HoldID:    reqHeader.IdempotencyKey,
+		AccountID: req.AccountID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to place hold on account '%s' : %v", placeHoldOp, req.AccountID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"hold": toHoldResponse(hold),
+		},
+	)
+}
+
+func (a *accountsHandler) CaptureHold(ctx *fiber.Ctx) error {
+	holdID, err := a.validateHoldID(ctx, captureHoldOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	req, err := a.validateCaptureHoldRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateCaptureHoldHeader(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	hold, txn, err := a.handleCaptureHold(ctx.UserContext(), holdID, req, reqHeader)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	resp := toHoldResponse(hold)
+	resp.TransactionID = txn.ID
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"hold": resp,
+		},
+	)
+}
+
+func (a *accountsHandler) handleCaptureHold(ctx context.Context, holdID string, req *models.CaptureHoldRequest, reqHeader *models.CaptureHoldRequestHeader) (*database.Hold, *database.TransactionRecord, error) {
+	params := &database.CaptureParams{
+		TxnID:  reqHeader.IdempotencyKey,
+		HoldID: holdID,
+	}
+
+	if len(req.Amount) > 0 {
+		hold, err := a.store.GetHold(ctx, holdID)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] unable to find hold '%s' : %v", captureHoldOp, holdID, err))
+			return nil, nil, err
+		}
+
+		params.Amount, err = utils.ParseAmount(req.Amount, hold.Currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", captureHoldOp, req.Amount, err))
+			return nil, nil, invalidAmount("amount", err)
+		}
+	}
+
+	hold, txn, err := a.store.CaptureHold(ctx, params)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to capture hold '%s' : %v", captureHoldOp, holdID, err))
+		return nil, nil, err
+	}
+
+	return hold, txn, nil
+}
+
+func (a *accountsHandler) VoidHold(ctx *fiber.Ctx) error {
+	holdID, err := a.validateHoldID(ctx, voidHoldOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	hold, err := a.store.VoidHold(ctx.UserContext(), holdID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to void hold '%s' : %v", voidHoldOp, holdID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"hold": toHoldResponse(hold),
+		},
+	)
+}
+
+func (a *accountsHandler) GetHold(ctx *fiber.Ctx) error {
+	holdID, err := a.validateHoldID(ctx, getHoldOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	hold, err := a.store.GetHold(ctx.UserContext(), holdID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find hold '%s' : %v", getHoldOp, holdID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	resp := toHoldResponse(hold)
+	resp.TransactionID = hold.CaptureTxnID
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"hold": resp,
+		},
+	)
+}
+
+func toHoldResponse(hold *database.Hold) *models.HoldResponse {
+	resp := &models.HoldResponse{
+		HoldID:    hold.ID,
+		AccountID: hold.AccountID,
+		Amount:    utils.FormatAmount(hold.Amount, hold.Currency),
+		Currency:  hold.Currency,
+		Status:    string(hold.Status),
+		ExpiresAt: utils.ConvertTimezone(hold.ExpiresAt),
+		CreatedAt: utils.ConvertTimezone(hold.CreatedAt),
+	}
+
+	if hold.Status == database.HoldStatusCaptured {
+		resp.CapturedAmount = utils.FormatAmount(hold.CapturedAmount, hold.Currency)
+	}
+
+	return resp
+}
+
+func (a *accountsHandler) validatePlaceHoldRequest(ctx *fiber.Ctx) (*models.Hold, error) {
+	req := new(models.HoldRequest)
+
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", placeHoldOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate((*req).AccountID)
+	if err != nil || database.IsSystemAccount((*req).AccountID) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", placeHoldOp, (*req).AccountID))
+		return nil, utils.Invalid("account_id", "must be the UUID of a customer account")
+	}
+
+	if len((*req).Amount) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not specified", placeHoldOp, (*req).Amount))
+		return nil, utils.Invalid("amount", "is required")
+	}
+
+	currency, err := utils.ParseCurrency((*req).Currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", placeHoldOp, (*req).Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+
+	amount, err := utils.ParseAmount((*req).Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", placeHoldOp, (*req).Amount, err))
+		return nil, invalidAmount("amount", err)
+	}
+
+	ttl := database.HoldTTL()
+	if len((*req).ExpiresIn) > 0 {
+		ttl, err = time.ParseDuration((*req).ExpiresIn)
+		if err != nil || ttl <= 0 {
+			a.logger.Error(fmt.Sprintf("[%s] request input expires_in '%s' is invalid", placeHoldOp, (*req).ExpiresIn))
+			return nil, utils.Invalid("expires_in", "must be a positive duration such as 15m or 24h")
+		}
+	}
+
+	return &models.Hold{
+		AccountID: (*req).AccountID,
+		Amount:    amount,
+		Currency:  currency,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+func (a *accountsHandler) validatePlaceHoldHeader(ctx *fiber.Ctx) (*models.HoldRequestHeader, error) {
+	holdReqHeader := new(models.HoldRequestHeader)
+
+	if err := ctx.ReqHeaderParser(holdReqHeader); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", placeHoldOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate(holdReqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", placeHoldOp, holdReqHeader.IdempotencyKey))
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
+	}
+
+	return holdReqHeader, nil
+}
+
+// validateCaptureHoldRequest accepts an empty body, which captures the whole hold.
+func (a *accountsHandler) validateCaptureHoldRequest(ctx *fiber.Ctx) (*models.CaptureHoldRequest, error) {
+	req := new(models.CaptureHoldRequest)
+	if len(ctx.Body()) == 0 {
+		return req, nil
+	}
+
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", captureHoldOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	return req, nil
+}
+
+func (a *accountsHandler) validateCaptureHoldHeader(ctx *fiber.Ctx) (*models.CaptureHoldRequestHeader, error) {
+	captureReqHeader := new(models.CaptureHoldRequestHeader)
+
+	if err := ctx.ReqHeaderParser(captureReqHeader); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", captureHoldOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate(captureReqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", captureHoldOp, captureReqHeader.IdempotencyKey))
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
+	}
+
+	return captureReqHeader, nil
+}
+
+func (a *accountsHandler) validateHoldID(ctx *fiber.Ctx, op string) (string, error) {
+	holdID := ctx.Params("id")
+	if err := uuid.Validate(holdID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid hold ID '%s'", op, holdID))
+		return "", utils.Invalid("id", "must be a hold UUID")
+	}
+	return holdID, nil
+}
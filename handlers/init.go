@@ -1,36 +1,86 @@
 package handlers
 
 import (
+	"context"
 	"log/slog"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/robinloh/wallet-backend/database"
-	"github.com/robinloh/wallet-backend/redis"
+	"github.com/robinloh/wallet-backend/fees"
+	"github.com/robinloh/wallet-backend/fx"
+	"github.com/robinloh/wallet-backend/webhooks"
 )
 
 type APIs interface {
 	CreateAccounts(*fiber.Ctx) error
 	GetAccountBalance(*fiber.Ctx) error
+	FindAccounts(*fiber.Ctx) error
+	FreezeAccount(*fiber.Ctx) error
+	UnfreezeAccount(*fiber.Ctx) error
+	CloseAccount(*fiber.Ctx) error
 
 	Deposit(*fiber.Ctx) error
 	Withdraw(*fiber.Ctx) error
 
 	Transfer(*fiber.Ctx) error
+	BatchTransfer(*fiber.Ctx) error
+	ReverseTransaction(*fiber.Ctx) error
 
 	GetAccountTransactions(*fiber.Ctx) error
+	GetAccountLedger(*fiber.Ctx) error
+
+	CreateFxQuote(*fiber.Ctx) error
+	GetFeeQuote(*fiber.Ctx) error
+
+	PlaceHold(*fiber.Ctx) error
+	CaptureHold(*fiber.Ctx) error
+	VoidHold(*fiber.Ctx) error
+	GetHold(*fiber.Ctx) error
+
+	CreateSchedule(*fiber.Ctx) error
+	ListSchedules(*fiber.Ctx) error
+	GetSchedule(*fiber.Ctx) error
+	GetScheduleRuns(*fiber.Ctx) error
+	PauseSchedule(*fiber.Ctx) error
+	ResumeSchedule(*fiber.Ctx) error
+	CancelSchedule(*fiber.Ctx) error
+
+	GetLimits(*fiber.Ctx) error
+	SetLimits(*fiber.Ctx) error
+	SetCreditLimit(*fiber.Ctx) error
+
+	CreateWebhook(*fiber.Ctx) error
+	ListWebhooks(*fiber.Ctx) error
+	GetWebhook(*fiber.Ctx) error
+	DisableWebhook(*fiber.Ctx) error
+	EnableWebhook(*fiber.Ctx) error
+	ListWebhookDeliveries(*fiber.Ctx) error
+	GetWebhookDelivery(*fiber.Ctx) error
+	RedeliverWebhook(*fiber.Ctx) error
+
+	HealthCheck(*fiber.Ctx) error
+
+	RunSchedulesPeriodically(ctx context.Context, interval time.Duration)
+	RunWebhookDeliveriesPeriodically(ctx context.Context, interval time.Duration)
 }
 
 type accountsHandler struct {
-	logger     *slog.Logger
-	postgresDB *database.Postgres
-	redis      *redis.Redis
+	logger   *slog.Logger
+	store    database.AccountStore
+	fxRates  fx.RateProvider
+	fees     *fees.Schedule
+	webhooks *webhooks.Client
 }
 
-func Initialize(logger *slog.Logger, postgresDB *database.Postgres, cache *redis.Redis) APIs {
+func Initialize(logger *slog.Logger, store database.AccountStore, fxRates fx.RateProvider, feeSchedule *fees.Schedule) APIs {
 	accountsHandler := &accountsHandler{
-		logger:     logger,
-		postgresDB: postgresDB,
-		redis:      cache,
+		logger:   logger,
+		store:    store,
+		fxRates:  fxRates,
+		fees:     feeSchedule,
+		webhooks: webhooks.NewClient(),
 	}
+	store.PublishWebhookEvents(accountsHandler)
 	return accountsHandler
 }
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	getLimitsOp = "GetLimits"
+	setLimitsOp = "SetLimits"
+)
+
+func (a *accountsHandler) GetLimits(ctx *fiber.Ctx) error {
+	req, err := a.validateGetLimitsRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	found, err := a.handleGetLimits(ctx.UserContext(), req)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	limits := make([]*models.LimitsResponse, 0, len(found))
+	for _, set := range found {
+		limits = append(limits, toLimitsResponse(set))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"limits": limits,
+		},
+	)
+}
+
+func (a *accountsHandler) handleGetLimits(ctx context.Context, req *models.GetLimitsRequest) ([]*database.AccountLimits, error) {
+	if len(req.AccountID) > 0 {
+		if _, err := a.store.GetAccount(ctx, req.AccountID); err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] unable to find account '%s' : %v", getLimitsOp, req.AccountID, err))
+			return nil, err
+		}
+	}
+
+	found, err := a.store.GetLimits(ctx, &database.LimitScope{
+		AccountID:   req.AccountID,
+		AccountType: database.AccountType(req.AccountType),
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find limits of account '%s' or type '%s' : %v", getLimitsOp, req.AccountID, req.AccountType, err))
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func (a *accountsHandler) SetLimits(ctx *fiber.Ctx) error {
+	req, err := a.validateSetLimitsRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	set, err := a.handleSetLimits(ctx.UserContext(), req)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"limits": toLimitsResponse(set),
+		},
+	)
+}
+
+func (a *accountsHandler) handleSetLimits(ctx context.Context, req *models.SetLimits) (*database.AccountLimits, error) {
+	if len(req.AccountID) > 0 {
+		if _, err := a.store.GetAccount(ctx, req.AccountID); err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] unable to find account '%s' : %v", setLimitsOp, req.AccountID, err))
+			return nil, err
+		}
+	}
+
+	set, err := a.store.SetLimits(ctx, &database.AccountLimits{
+		AccountID:   req.AccountID,
+		AccountType: database.AccountType(req.AccountType),
+		Currency:    req.Currency,
+		Limits: database.Limits{
+			MaxSingleAmount: req.MaxSingleAmount,
+			DailyAmount:     req.DailyAmount,
+			MonthlyAmount:   req.MonthlyAmount,
+			DailyCount:      req.DailyCount,
+			MonthlyCount:    req.MonthlyCount,
+			MaxBalance:      req.MaxBalance,
+		},
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to set %s limits of account '%s' or type '%s' : %v", setLimitsOp, req.Currency, req.AccountID, req.AccountType, err))
+		return nil, err
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] %s limits of account '%s' or type '%s' set to %+v", setLimitsOp, req.Currency, req.AccountID, req.AccountType, set.Limits))
+
+	return set, nil
+}
+
+func toLimitsResponse(set *database.AccountLimits) *models.LimitsResponse {
+	optionalAmount := func(amount decimal.NullDecimal) *string {
+		if !amount.Valid {
+			return nil
+		}
+		formatted := utils.FormatAmount(amount.Decimal, set.Currency)
+		return &formatted
+	}
+
+	resp := &models.LimitsResponse{
+		AccountID:       set.AccountID,
+		AccountType:     string(set.AccountType),
+		Currency:        set.Currency,
+		MaxSingleAmount: optionalAmount(set.MaxSingleAmount),
+		DailyAmount:     optionalAmount(set.DailyAmount),
+		MonthlyAmount:   optionalAmount(set.MonthlyAmount),
+		DailyCount:      set.DailyCount,
+		MonthlyCount:    set.MonthlyCount,
+		MaxBalance:      optionalAmount(set.MaxBalance),
+	}
+	if !set.UpdatedAt.IsZero() {
+		updatedAt := utils.ConvertTimezone(set.UpdatedAt)
+		resp.UpdatedAt = &updatedAt
+	}
+	return resp
+}
+
+func (a *accountsHandler) validateGetLimitsRequest(ctx *fiber.Ctx) (*models.GetLimitsRequest, error) {
+	req := &models.GetLimitsRequest{
+		AccountID:   ctx.Query("account_id"),
+		AccountType: ctx.Query("account_type"),
+	}
+
+	if err := a.validateLimitScope(getLimitsOp, req.AccountID, req.AccountType); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (a *accountsHandler) validateSetLimitsRequest(ctx *fiber.Ctx) (*models.SetLimits, error) {
+	req := new(models.SetLimitsRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", setLimitsOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	if err := a.validateLimitScope(setLimitsOp, req.AccountID, req.AccountType); err != nil {
+		return nil, err
+	}
+
+	currency, err := utils.ParseCurrency(req.Currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", setLimitsOp, req.Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+
+	limits := &models.SetLimits{
+		AccountID:    req.AccountID,
+		AccountType:  req.AccountType,
+		Currency:     currency,
+		DailyCount:   req.DailyCount,
+		MonthlyCount: req.MonthlyCount,
+	}
+
+	amounts := []struct {
+		field  string
+		amount string
+		limit  *decimal.NullDecimal
+	}{
+		{"max_single_amount", req.MaxSingleAmount, &limits.MaxSingleAmount},
+		{"daily_amount", req.DailyAmount, &limits.DailyAmount},
+		{"monthly_amount", req.MonthlyAmount, &limits.MonthlyAmount},
+		{"max_balance", req.MaxBalance, &limits.MaxBalance},
+	}
+	for _, limit := range amounts {
+		if len(limit.amount) == 0 {
+			continue
+		}
+		amount, err := utils.ParseAmount(limit.amount, currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input %s '%s' is invalid : %v", setLimitsOp, limit.field, limit.amount, err))
+			return nil, invalidAmount(limit.field, err)
+		}
+		*limit.limit = decimal.NewNullDecimal(amount)
+	}
+
+	counts := []struct {
+		field string
+		count *int
+	}{
+		{"daily_count", req.DailyCount},
+		{"monthly_count", req.MonthlyCount},
+	}
+	for _, limit := range counts {
+		if limit.count != nil && *limit.count < 1 {
+			a.logger.Error(fmt.Sprintf("[%s] request input %s '%d' is invalid", setLimitsOp, limit.field, *limit.count))
+			return nil, utils.Invalid(limit.field, "must be at least 1")
+		}
+	}
+
+	return limits, nil
+}
+
+// validateLimitScope checks that limits are for exactly one of an account or an account type.
+func (a *accountsHandler) validateLimitScope(op string, accountID string, accountType string) error {
+	switch {
+	case len(accountID) > 0 && len(accountType) > 0:
+		a.logger.Error(fmt.Sprintf("[%s] request input names both account '%s' and type '%s'", op, accountID, accountType))
+		return utils.Invalid("account_type", "cannot be given with account_id")
+	case len(accountID) > 0:
+		if err := uuid.Validate(accountID); err != nil || database.IsSystemAccount(accountID) {
+			a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", op, accountID))
+			return utils.Invalid("account_id", "must be the UUID of a customer account")
+		}
+	case len(accountType) > 0:
+		if !database.IsAccountType(accountType) {
+			a.logger.Error(fmt.Sprintf("[%s] request input account type '%s' is invalid", op, accountType))
+			return utils.Invalid("account_type", "must be one of checking, savings or business")
+		}
+	default:
+		a.logger.Error(fmt.Sprintf("[%s] request input names neither an account nor a type", op))
+		return utils.Invalid("account_id", "or account_type is required")
+	}
+	return nil
+}
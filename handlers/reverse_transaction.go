@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const reverseTransactionOp = "ReverseTransaction"
+
+func (a *accountsHandler) ReverseTransaction(ctx *fiber.Ctx) error {
+	req, err := a.validateReverseTransactionRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateReverseTransactionHeader(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	txns, err := a.handleReverseTransaction(ctx.UserContext(), req, reqHeader)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"transactions": txns,
+		},
+	)
+}
+
+func (a *accountsHandler) handleReverseTransaction(ctx context.Context, req *models.ReverseTransactionRequest, reqHeader *models.ReverseTransactionRequestHeader) ([]models.AccountTransactionsResponse, error) {
+	params := &database.ReversalParams{
+		TxnID:      reqHeader.IdempotencyKey,
+		OriginalID: req.TransactionID,
+	}
+
+	if len(req.Amount) > 0 {
+		legs, err := a.store.GetTransactions(ctx, req.TransactionID)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] Error finding transaction '%s' : %+v", reverseTransactionOp, req.TransactionID, err))
+			return nil, err
+		}
+
+		primary := database.PrimaryLeg(legs)
+		if primary == nil {
+			a.logger.Error(fmt.Sprintf("[%s] transaction '%s' was not found", reverseTransactionOp, req.TransactionID))
+			return nil, database.ErrTransactionNotFound
+		}
+
+		params.Amount, err = utils.ParseAmount(req.Amount, primary.Currency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", reverseTransactionOp, req.Amount, err))
+			return nil, invalidAmount("amount", err)
+		}
+	}
+
+	txns, err := a.store.Reverse(ctx, params)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Error reversing transaction '%s' : %+v", reverseTransactionOp, req.TransactionID, err))
+		return nil, err
+	}
+
+	resp := make([]models.AccountTransactionsResponse, 0, len(txns))
+	for _, txn := range txns {
+		resp = append(resp, toTransactionResponse(txn))
+	}
+
+	return resp, nil
+}
+
+// validateReverseTransactionRequest accepts an empty body, which reverses whatever is left of the transaction.
+func (a *accountsHandler) validateReverseTransactionRequest(ctx *fiber.Ctx) (*models.ReverseTransactionRequest, error) {
+	req := new(models.ReverseTransactionRequest)
+
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(req); err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", reverseTransactionOp, err))
+			return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+		}
+	}
+
+	req.TransactionID = ctx.Params("id")
+	if err := uuid.Validate(req.TransactionID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid transaction ID '%s'", reverseTransactionOp, req.TransactionID))
+		return nil, utils.Invalid("id", "must be a transaction UUID")
+	}
+
+	return req, nil
+}
+
+func (a *accountsHandler) validateReverseTransactionHeader(ctx *fiber.Ctx) (*models.ReverseTransactionRequestHeader, error) {
+	reverseReqHeader := new(models.ReverseTransactionRequestHeader)
+
+	if err := ctx.ReqHeaderParser(reverseReqHeader); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", reverseTransactionOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate(reverseReqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", reverseTransactionOp, reverseReqHeader.IdempotencyKey))
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
+	}
+
+	return reverseReqHeader, nil
+}
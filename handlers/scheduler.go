@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const runSchedulesOp = "RunSchedules"
+
+// SCHEDULE_CLAIM_LIMIT is how many due schedules are run on each tick; the rest wait for the next one.
+const SCHEDULE_CLAIM_LIMIT = 100
+
+// RunSchedulesPeriodically runs the due transfer schedules every interval until ctx is done.
+func (a *accountsHandler) RunSchedulesPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.runDueSchedules(ctx, now)
+		}
+	}
+}
+
+func (a *accountsHandler) runDueSchedules(ctx context.Context, now time.Time) {
+	schedules, err := a.store.ClaimDueSchedules(ctx, now, SCHEDULE_CLAIM_LIMIT)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to claim due schedules : %v", runSchedulesOp, err))
+		return
+	}
+
+	for _, schedule := range schedules {
+		a.runSchedule(ctx, schedule)
+	}
+}
+
+// runSchedule makes the transfer due on a schedule as handleTransfer would for a request, under a transaction ID
+// derived from the attempt at the occurrence. A run repeated because the scheduler stopped before recording it uses
+// the ID of the attempt it repeats and finds its transfer instead of moving the money again, while a retry of a
+// failed attempt makes a new transfer unless an earlier attempt turns out to have completed one.
+func (a *accountsHandler) runSchedule(ctx context.Context, schedule *database.Schedule) {
+	run := &database.ScheduleRun{
+		ScheduleID:  schedule.ID,
+		Occurrence:  schedule.Occurrence,
+		Attempt:     schedule.Attempt,
+		TxnID:       scheduleRunID(schedule.ID, schedule.Occurrence, schedule.Attempt),
+		ScheduledAt: schedule.NextRunAt,
+		Status:      utils.COMPLETED,
+	}
+
+	txnID, err := a.completedScheduleRun(ctx, schedule)
+	if len(txnID) > 0 {
+		a.logger.Info(fmt.Sprintf("[%s] occurrence %d of schedule '%s' was already paid by '%s'", runSchedulesOp, run.Occurrence, schedule.ID, txnID))
+		run.TxnID = txnID
+	} else if err == nil {
+		_, err = a.handleTransfer(
+			ctx,
+			&models.Transfer{
+				From:       schedule.From,
+				To:         schedule.To,
+				Amount:     schedule.Amount,
+				Currency:   schedule.Currency,
+				ToCurrency: schedule.Currency,
+				Reference:  schedule.Reference,
+			},
+			&models.TransferRequestHeader{
+				IdempotencyKey: run.TxnID,
+			},
+		)
+	}
+	run.RanAt = time.Now()
+	if err != nil {
+		run.Status = utils.FAILED
+		run.Error = storeError(err).Name()
+	}
+
+	updated, err := a.store.RecordScheduleRun(ctx, run)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to record run %d.%d of schedule '%s' : %v", runSchedulesOp, run.Occurrence, run.Attempt, schedule.ID, err))
+		return
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] run %d.%d of schedule '%s' is %s, schedule is now '%s'", runSchedulesOp, run.Occurrence, run.Attempt, schedule.ID, run.Status, updated.Status))
+	if updated.Status == database.ScheduleStatusActive {
+		a.logger.Info(fmt.Sprintf("[%s] schedule '%s' next runs at '%s'", runSchedulesOp, schedule.ID, updated.NextRunAt.Format(time.RFC3339)))
+	}
+}
+
+// completedScheduleRun is the transaction ID of an earlier attempt at the due occurrence that completed its
+// transfer, or empty when none did. The schedule is claimed, so no other attempt at the occurrence runs meanwhile.
+func (a *accountsHandler) completedScheduleRun(ctx context.Context, schedule *database.Schedule) (string, error) {
+	for attempt := 1; attempt < schedule.Attempt; attempt++ {
+		txnID := scheduleRunID(schedule.ID, schedule.Occurrence, attempt)
+
+		res, err := a.handleGetTransactions(ctx, txnID)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] Error finding run %d.%d of schedule '%s' : %+v", runSchedulesOp, schedule.Occurrence, attempt, schedule.ID, err))
+			return "", err
+		}
+		for _, txn := range res {
+			if txn.TxnType == string(database.TxnTypeSender) && txn.Status == utils.COMPLETED {
+				return txnID, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// scheduleRunID derives the transaction ID of an attempt at an occurrence of a schedule. The first attempt keeps the
+// ID derived from the occurrence alone, which every attempt used before retries got their own.
+func scheduleRunID(scheduleID string, occurrence int, attempt int) string {
+	name := strconv.Itoa(occurrence)
+	if attempt > 1 {
+		name += "." + strconv.Itoa(attempt)
+	}
+	return uuid.NewSHA1(uuid.MustParse(scheduleID), []byte(name)).String()
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+// stoppingStore is a memory store on which the scheduler stops after making the transfer of the next runs, before
+// they are recorded, as it would if the service were restarted at that moment.
+type stoppingStore struct {
+	*database.MemoryStore
+
+	mu       sync.Mutex
+	stopRuns int
+}
+
+func (s *stoppingStore) RecordScheduleRun(ctx context.Context, run *database.ScheduleRun) (*database.Schedule, error) {
+	s.mu.Lock()
+	stop := s.stopRuns > 0
+	if stop {
+		s.stopRuns--
+	}
+	s.mu.Unlock()
+
+	if stop {
+		return nil, errors.New("scheduler stopped")
+	}
+	return s.MemoryStore.RecordScheduleRun(ctx, run)
+}
+
+// createSchedule creates a schedule paying amount of USD every day and returns it.
+func (a *testApp) createSchedule(from string, to string, amount string) *database.Schedule {
+	a.t.Helper()
+
+	status, body := a.post("v1/schedules", uuid.NewString(), fmt.Sprintf(`{"from":"%s","to":"%s","amount":"%s","currency":"USD","every":"24h"}`, from, to, amount))
+	if status != http.StatusOK {
+		a.t.Fatalf("creating schedule = %d %v", status, body)
+	}
+
+	schedule, err := a.store.GetSchedule(context.Background(), body["schedule"].(map[string]any)["schedule_id"].(string))
+	if err != nil {
+		a.t.Fatalf("GetSchedule() error = %v", err)
+	}
+	return schedule
+}
+
+// TestScheduleRestart stops the scheduler between the transfer of an occurrence and its record. Once the lease runs
+// out the occurrence is claimed and run again, and must report the transfer already made instead of paying twice.
+func TestScheduleRestart(t *testing.T) {
+	store := &stoppingStore{MemoryStore: database.NewMemoryStore(), stopRuns: 1}
+	app := newTestAppOn(t, store)
+	ctx := context.Background()
+
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "100")
+
+	schedule := app.createSchedule(from, to, "10")
+	due := schedule.NextRunAt
+
+	app.handler.runDueSchedules(ctx, due)
+	if balance := app.balance(from); balance != "90.00" {
+		t.Fatalf("balance of sender after the first run = %s, want 90.00", balance)
+	}
+
+	// The schedule stays claimed by the stopped scheduler until its lease runs out.
+	app.handler.runDueSchedules(ctx, due.Add(database.SCHEDULE_LEASE-time.Second))
+	if runs, _ := store.ListScheduleRuns(ctx, schedule.ID); len(runs) != 0 {
+		t.Fatalf("schedule ran again while claimed : %v", runs)
+	}
+
+	app.handler.runDueSchedules(ctx, due.Add(database.SCHEDULE_LEASE))
+	if balance := app.balance(from); balance != "90.00" {
+		t.Errorf("balance of sender after the restart = %s, want 90.00", balance)
+	}
+	if balance := app.balance(to); balance != "10.00" {
+		t.Errorf("balance of receiver after the restart = %s, want 10.00", balance)
+	}
+
+	runs, err := store.ListScheduleRuns(ctx, schedule.ID)
+	if err != nil {
+		t.Fatalf("ListScheduleRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].Occurrence != 1 || runs[0].Status != utils.COMPLETED {
+		t.Fatalf("runs = %v, want occurrence 1 completed once", runs)
+	}
+
+	txns, err := store.GetTransactions(ctx, runs[0].TxnID)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if len(txns) != 2 {
+		t.Errorf("occurrence recorded %d transactions, want the two legs of one transfer : %v", len(txns), txns)
+	}
+
+	// The next occurrence is a new transfer.
+	updated, err := store.GetSchedule(ctx, schedule.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule() error = %v", err)
+	}
+	if updated.Occurrence != 2 {
+		t.Fatalf("schedule is at occurrence %d, want 2", updated.Occurrence)
+	}
+
+	app.handler.runDueSchedules(ctx, updated.NextRunAt)
+	if balance := app.balance(from); balance != "80.00" {
+		t.Errorf("balance of sender after the second occurrence = %s, want 80.00", balance)
+	}
+}
+
+// TestScheduleRetry fails an occurrence for lack of funds and retries it once the sender is funded. The retry must
+// pay the occurrence, and pay it once even when the scheduler stops before recording it.
+func TestScheduleRetry(t *testing.T) {
+	store := &stoppingStore{MemoryStore: database.NewMemoryStore()}
+	app := newTestAppOn(t, store)
+	ctx := context.Background()
+
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "5")
+
+	schedule := app.createSchedule(from, to, "10")
+	app.handler.runDueSchedules(ctx, schedule.NextRunAt)
+
+	failed, err := store.GetSchedule(ctx, schedule.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule() error = %v", err)
+	}
+	if failed.Occurrence != 1 || failed.Attempt != 2 || failed.LastStatus != utils.FAILED {
+		t.Fatalf("schedule after the unfunded run = %+v, want a retry of occurrence 1", failed)
+	}
+
+	app.deposit(from, "95")
+	store.mu.Lock()
+	store.stopRuns = 1
+	store.mu.Unlock()
+
+	app.handler.runDueSchedules(ctx, failed.NextRunAt)
+	app.handler.runDueSchedules(ctx, failed.NextRunAt.Add(database.SCHEDULE_LEASE))
+	if balance := app.balance(from); balance != "90.00" {
+		t.Errorf("balance of sender after the retry = %s, want 90.00", balance)
+	}
+	if balance := app.balance(to); balance != "10.00" {
+		t.Errorf("balance of receiver after the retry = %s, want 10.00", balance)
+	}
+
+	runs, err := store.ListScheduleRuns(ctx, schedule.ID)
+	if err != nil {
+		t.Fatalf("ListScheduleRuns() error = %v", err)
+	}
+	completed := 0
+	for _, run := range runs {
+		if run.Occurrence != 1 {
+			t.Errorf("run %+v is not of occurrence 1", run)
+		}
+		if run.Status == utils.COMPLETED {
+			completed++
+		}
+	}
+	if len(runs) != 2 || completed != 1 {
+		t.Fatalf("runs = %+v, want a failed run and a completed retry", runs)
+	}
+
+	updated, err := store.GetSchedule(ctx, schedule.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule() error = %v", err)
+	}
+	if updated.Occurrence != 2 || updated.Attempt != 1 {
+		t.Errorf("schedule is at run %d.%d, want 2.1", updated.Occurrence, updated.Attempt)
+	}
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const (
+	createScheduleOp  = "CreateSchedule"
+	listSchedulesOp   = "ListSchedules"
+	getScheduleOp     = "GetSchedule"
+	getScheduleRunsOp = "GetScheduleRuns"
+	pauseScheduleOp   = "PauseSchedule"
+	resumeScheduleOp  = "ResumeSchedule"
+	cancelScheduleOp  = "CancelSchedule"
+)
+
+// MIN_SCHEDULE_INTERVAL is the shortest interval a schedule may recur at.
+const MIN_SCHEDULE_INTERVAL = time.Minute
+
+func (a *accountsHandler) CreateSchedule(ctx *fiber.Ctx) error {
+	req, err := a.validateCreateScheduleRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateCreateScheduleHeader(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	schedule, err := a.handleCreateSchedule(ctx.UserContext(), req, reqHeader)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"schedule": toScheduleResponse(schedule),
+		},
+	)
+}
+
+// handleCreateSchedule checks that both accounts exist and are open before the schedule is stored, so that a mistyped
+// account is refused now rather than on every run. A frozen account is accepted, since it may be unfrozen by then.
+func (a *accountsHandler) handleCreateSchedule(ctx context.Context, req *models.Schedule, reqHeader *models.ScheduleRequestHeader) (*database.Schedule, error) {
+	from, err := a.store.GetAccount(ctx, req.From)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find account '%s' : %v", createScheduleOp, req.From, err))
+		return nil, err
+	}
+
+	to, err := a.store.GetAccount(ctx, req.To)
+	if errors.Is(err, database.ErrAccountNotFound) {
+		err = database.ErrDestinationNotFound
+	}
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find account '%s' : %v", createScheduleOp, req.To, err))
+		return nil, err
+	}
+	if from.Status == database.AccountStatusClosed || to.Status == database.AccountStatusClosed {
+		a.logger.Error(fmt.Sprintf("[%s] account '%s' or '%s' is closed", createScheduleOp, req.From, req.To))
+		return nil, database.ErrAccountClosed
+	}
+
+	schedule := &database.Schedule{
+		ID:         reqHeader.IdempotencyKey,
+		From:       req.From,
+		To:         req.To,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		Reference:  req.Reference,
+		Every:      req.Every,
+		Cron:       req.Cron,
+		StartAt:    req.StartAt,
+		EndAt:      req.EndAt,
+		Status:     database.ScheduleStatusActive,
+		Occurrence: 1,
+		Attempt:    1,
+	}
+
+	schedule.NextRunAt = schedule.FirstRun()
+	if schedule.NextRunAt.IsZero() {
+		a.logger.Error(fmt.Sprintf("[%s] schedule has no run before its end '%s'", createScheduleOp, req.EndAt))
+		return nil, utils.Invalid("end_at", "leaves no run of the schedule")
+	}
+
+	created, err := a.store.CreateSchedule(ctx, schedule)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to create schedule '%s' : %v", createScheduleOp, schedule.ID, err))
+		return nil, err
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] schedule '%s' from account '%s' to '%s' first runs at '%s'", createScheduleOp, created.ID, created.From, created.To, created.NextRunAt))
+
+	return created, nil
+}
+
+func (a *accountsHandler) ListSchedules(ctx *fiber.Ctx) error {
+	req, err := a.validateListSchedulesRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	found, err := a.store.ListSchedules(ctx.UserContext(), &database.ScheduleFilter{
+		AccountID: req.AccountID,
+		Status:    database.ScheduleStatus(req.Status),
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to list schedules of account '%s' : %v", listSchedulesOp, req.AccountID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	schedules := make([]*models.ScheduleResponse, 0, len(found))
+	for _, schedule := range found {
+		schedules = append(schedules, toScheduleResponse(schedule))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"schedules": schedules,
+		},
+	)
+}
+
+func (a *accountsHandler) GetSchedule(ctx *fiber.Ctx) error {
+	scheduleID, err := a.validateScheduleID(ctx, getScheduleOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	schedule, err := a.store.GetSchedule(ctx.UserContext(), scheduleID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find schedule '%s' : %v", getScheduleOp, scheduleID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"schedule": toScheduleResponse(schedule),
+		},
+	)
+}
+
+func (a *accountsHandler) GetScheduleRuns(ctx *fiber.Ctx) error {
+	scheduleID, err := a.validateScheduleID(ctx, getScheduleRunsOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	found, err := a.store.ListScheduleRuns(ctx.UserContext(), scheduleID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find runs of schedule '%s' : %v", getScheduleRunsOp, scheduleID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	runs := make([]models.ScheduleRunResponse, 0, len(found))
+	for _, run := range found {
+		runs = append(runs, models.ScheduleRunResponse{
+			Occurrence:    run.Occurrence,
+			Attempt:       run.Attempt,
+			TransactionID: run.TxnID,
+			ScheduledAt:   utils.ConvertTimezone(run.ScheduledAt),
+			Status:        run.Status,
+			Error:         run.Error,
+			RanAt:         utils.ConvertTimezone(run.RanAt),
+		})
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"runs": runs,
+		},
+	)
+}
+
+func (a *accountsHandler) PauseSchedule(ctx *fiber.Ctx) error {
+	return a.changeScheduleStatus(ctx, pauseScheduleOp, database.ScheduleStatusPaused)
+}
+
+func (a *accountsHandler) ResumeSchedule(ctx *fiber.Ctx) error {
+	return a.changeScheduleStatus(ctx, resumeScheduleOp, database.ScheduleStatusActive)
+}
+
+func (a *accountsHandler) CancelSchedule(ctx *fiber.Ctx) error {
+	return a.changeScheduleStatus(ctx, cancelScheduleOp, database.ScheduleStatusCancelled)
+}
+
+func (a *accountsHandler) changeScheduleStatus(ctx *fiber.Ctx, op string, status database.ScheduleStatus) error {
+	scheduleID, err := a.validateScheduleID(ctx, op)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	schedule, err := a.store.ChangeScheduleStatus(ctx.UserContext(), scheduleID, status)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to change status of schedule '%s' to '%s' : %v", op, scheduleID, status, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] schedule '%s' is now '%s'", op, scheduleID, schedule.Status))
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"schedule": toScheduleResponse(schedule),
+		},
+	)
+}
+
+func toScheduleResponse(schedule *database.Schedule) *models.ScheduleResponse {
+	resp := &models.ScheduleResponse{
+		ScheduleID: schedule.ID,
+		From:       schedule.From,
+		To:         schedule.To,
+		Amount:     utils.FormatAmount(schedule.Amount, schedule.Currency),
+		Currency:   schedule.Currency,
+		Reference:  schedule.Reference,
+		Cron:       schedule.Cron,
+		StartAt:    utils.ConvertTimezone(schedule.StartAt),
+		EndAt:      optionalTime(schedule.EndAt),
+		Status:     string(schedule.Status),
+		LastRunAt:  optionalTime(schedule.LastRunAt),
+		LastStatus: schedule.LastStatus,
+		LastError:  schedule.LastError,
+		CreatedAt:  utils.ConvertTimezone(schedule.CreatedAt),
+	}
+
+	if schedule.Every > 0 {
+		resp.Every = schedule.Every.String()
+	}
+	if schedule.Status == database.ScheduleStatusActive || schedule.Status == database.ScheduleStatusPaused {
+		resp.NextRunAt = optionalTime(schedule.NextRunAt)
+	}
+
+	return resp
+}
+
+// optionalTime leaves out a time that was never set.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	converted := utils.ConvertTimezone(t)
+	return &converted
+}
+
+func (a *accountsHandler) validateCreateScheduleRequest(ctx *fiber.Ctx) (*models.Schedule, error) {
+	req := new(models.ScheduleRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", createScheduleOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	if err := uuid.Validate(req.From); err != nil || database.IsSystemAccount(req.From) {
+		a.logger.Error(fmt.Sprintf("[%s] request FROM account ID '%s' is invalid", createScheduleOp, req.From))
+		return nil, utils.Invalid("from", "must be the UUID of a customer account")
+	}
+
+	if err := uuid.Validate(req.To); err != nil || database.IsSystemAccount(req.To) || req.To == req.From {
+		a.logger.Error(fmt.Sprintf("[%s] request TO account ID '%s' is invalid", createScheduleOp, req.To))
+		return nil, utils.Invalid("to", "must be the UUID of another customer account")
+	}
+
+	if len(req.Amount) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount is not specified", createScheduleOp))
+		return nil, utils.Invalid("amount", "is required")
+	}
+
+	currency, err := utils.ParseCurrency(req.Currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", createScheduleOp, req.Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+
+	amount, err := utils.ParseAmount(req.Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", createScheduleOp, req.Amount, err))
+		return nil, invalidAmount("amount", err)
+	}
+
+	if len(req.Reference) > MAX_REFERENCE_LENGTH {
+		a.logger.Error(fmt.Sprintf("[%s] request input reference is longer than %d characters", createScheduleOp, MAX_REFERENCE_LENGTH))
+		return nil, utils.Invalid("reference", fmt.Sprintf("must be at most %d characters", MAX_REFERENCE_LENGTH))
+	}
+
+	schedule := &models.Schedule{
+		From:      req.From,
+		To:        req.To,
+		Amount:    amount,
+		Currency:  currency,
+		Reference: req.Reference,
+		Cron:      req.Cron,
+	}
+	now := time.Now()
+
+	if len(req.Every) > 0 && len(req.Cron) > 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request gives both every '%s' and cron '%s'", createScheduleOp, req.Every, req.Cron))
+		return nil, utils.Invalid("cron", "cannot be combined with every")
+	}
+
+	if len(req.Every) > 0 {
+		schedule.Every, err = time.ParseDuration(req.Every)
+		if err != nil || schedule.Every < MIN_SCHEDULE_INTERVAL || schedule.Every%time.Second != 0 {
+			a.logger.Error(fmt.Sprintf("[%s] request input every '%s' is invalid", createScheduleOp, req.Every))
+			return nil, utils.Invalid("every", fmt.Sprintf("must be a duration of whole seconds, at least %s, such as 24h", MIN_SCHEDULE_INTERVAL))
+		}
+	}
+
+	if len(req.Cron) > 0 {
+		cron, err := utils.ParseCron(req.Cron)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input cron '%s' is invalid : %v", createScheduleOp, req.Cron, err))
+			return nil, utils.Invalid("cron", "must be a five-field cron expression that matches some time")
+		}
+		schedule.Cron = cron.String()
+	}
+
+	switch {
+	case len(req.RunAt) > 0:
+		schedule.StartAt, err = time.Parse(time.RFC3339, req.RunAt)
+		if err != nil || !schedule.StartAt.After(now) {
+			a.logger.Error(fmt.Sprintf("[%s] request input run_at '%s' is invalid", createScheduleOp, req.RunAt))
+			return nil, utils.Invalid("run_at", "must be an RFC 3339 time in the future")
+		}
+	case schedule.Every > 0:
+		schedule.StartAt = now.Add(schedule.Every)
+	case len(schedule.Cron) > 0:
+		schedule.StartAt = now
+	default:
+		a.logger.Error(fmt.Sprintf("[%s] request gives none of run_at, every or cron", createScheduleOp))
+		return nil, utils.Invalid("run_at", "is required unless every or cron is given")
+	}
+
+	if len(req.EndAt) > 0 {
+		schedule.EndAt, err = time.Parse(time.RFC3339, req.EndAt)
+		if err != nil || !schedule.EndAt.After(schedule.StartAt) {
+			a.logger.Error(fmt.Sprintf("[%s] request input end_at '%s' is invalid", createScheduleOp, req.EndAt))
+			return nil, utils.Invalid("end_at", "must be an RFC 3339 time after the first run")
+		}
+	}
+
+	return schedule, nil
+}
+
+func (a *accountsHandler) validateCreateScheduleHeader(ctx *fiber.Ctx) (*models.ScheduleRequestHeader, error) {
+	scheduleReqHeader := new(models.ScheduleRequestHeader)
+
+	if err := ctx.ReqHeaderParser(scheduleReqHeader); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", createScheduleOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate(scheduleReqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", createScheduleOp, scheduleReqHeader.IdempotencyKey))
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
+	}
+
+	return scheduleReqHeader, nil
+}
+
+func (a *accountsHandler) validateListSchedulesRequest(ctx *fiber.Ctx) (*models.ListSchedulesRequest, error) {
+	req := &models.ListSchedulesRequest{
+		AccountID: ctx.Query("account_id"),
+		Status:    ctx.Query("status"),
+		Limit:     database.DEFAULT_LIST_SCHEDULES_LIMIT,
+	}
+
+	if err := uuid.Validate(req.AccountID); err != nil || database.IsSystemAccount(req.AccountID) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", listSchedulesOp, req.AccountID))
+		return nil, utils.Invalid("account_id", "must be the UUID of a customer account")
+	}
+
+	if len(req.Status) > 0 && !database.IsScheduleStatus(req.Status) {
+		a.logger.Error(fmt.Sprintf("[%s] request input status '%s' is invalid", listSchedulesOp, req.Status))
+		return nil, utils.Invalid("status", "must be one of active, paused, cancelled or completed")
+	}
+
+	if limit := ctx.Query("limit"); len(limit) > 0 {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > database.MAX_LIST_SCHEDULES_LIMIT {
+			a.logger.Error(fmt.Sprintf("[%s] request input limit '%s' must be between 1 and %d", listSchedulesOp, limit, database.MAX_LIST_SCHEDULES_LIMIT))
+			return nil, utils.Invalid("limit", fmt.Sprintf("must be between 1 and %d", database.MAX_LIST_SCHEDULES_LIMIT))
+		}
+		req.Limit = parsed
+	}
+
+	return req, nil
+}
+
+func (a *accountsHandler) validateScheduleID(ctx *fiber.Ctx, op string) (string, error) {
+	scheduleID := ctx.Params("id")
+	if err := uuid.Validate(scheduleID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid schedule ID '%s'", op, scheduleID))
+		return "", utils.Invalid("id", "must be a schedule UUID")
+	}
+	return scheduleID, nil
+}
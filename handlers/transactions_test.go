@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+func depositBody(accountID string, amount string) string {
+	return fmt.Sprintf(`{"id":"%s","amount":"%s","currency":"USD"}`, accountID, amount)
+}
+
+func transferBody(from string, to string, amount string) string {
+	return fmt.Sprintf(`{"from":"%s","to":"%s","amount":"%s","currency":"USD"}`, from, to, amount)
+}
+
+// wantError checks that a request was answered with the status and error code.
+func wantError(t *testing.T, status int, body map[string]any, wantStatus int, wantCode utils.ErrorCode) {
+	t.Helper()
+
+	if status != wantStatus {
+		t.Errorf("status = %d, want %d : %v", status, wantStatus, body)
+	}
+	if code, _ := body["code"].(float64); utils.ErrorCode(code) != wantCode {
+		t.Errorf("code = %v, want %d : %v", body["code"], wantCode, body)
+	}
+}
+
+func TestCreateAccounts(t *testing.T) {
+	app := newTestApp(t)
+
+	accountIDs := app.createAccounts(2)
+	if len(accountIDs) != 2 || accountIDs[0] == accountIDs[1] {
+		t.Fatalf("created accounts %v, want two distinct accounts", accountIDs)
+	}
+	for _, accountID := range accountIDs {
+		if balance := app.balance(accountID); len(balance) > 0 {
+			t.Errorf("new account '%s' has a USD balance of %s", accountID, balance)
+		}
+	}
+
+	status, body := app.post("v1/accounts", uuid.NewString(), `{"count":0}`)
+	wantError(t, status, body, http.StatusBadRequest, utils.ERR_VALIDATION_FAILED)
+}
+
+func TestDeposit(t *testing.T) {
+	app := newTestApp(t)
+	accountID := app.createAccounts(1)[0]
+
+	status, body := app.post("v1/deposit", uuid.NewString(), depositBody(accountID, "100.50"))
+	if status != http.StatusOK {
+		t.Fatalf("deposit = %d %v", status, body)
+	}
+	deposit := body["accounts"].(map[string]any)
+	if deposit["status"] != utils.COMPLETED || deposit["amount"] != "100.50" {
+		t.Errorf("deposit = %v, want 100.50 completed", deposit)
+	}
+	if balance := app.balance(accountID); balance != "100.50" {
+		t.Errorf("balance = %s, want 100.50", balance)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		wantStatus int
+		wantCode   utils.ErrorCode
+	}{
+		{name: "unknown account", key: uuid.NewString(), body: depositBody(uuid.NewString(), "10"), wantStatus: http.StatusNotFound, wantCode: utils.ERR_ACCOUNT_NOT_FOUND},
+		{name: "negative amount", key: uuid.NewString(), body: depositBody(accountID, "-10"), wantStatus: http.StatusBadRequest, wantCode: utils.ERR_VALIDATION_FAILED},
+		{name: "too many decimals", key: uuid.NewString(), body: depositBody(accountID, "10.001"), wantStatus: http.StatusBadRequest, wantCode: utils.ERR_VALIDATION_FAILED},
+		{name: "missing idempotency key", body: depositBody(accountID, "10"), wantStatus: http.StatusBadRequest, wantCode: utils.ERR_MISSING_IDEMPOTENCY_KEY},
+		{name: "invalid idempotency key", key: "not-a-uuid", body: depositBody(accountID, "10"), wantStatus: http.StatusBadRequest, wantCode: utils.ERR_INVALID_IDEMPOTENCY_KEY},
+		{name: "malformed body", key: uuid.NewString(), body: `{"id":`, wantStatus: http.StatusBadRequest, wantCode: utils.ERR_MALFORMED_REQUEST},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := app.post("v1/deposit", tt.key, tt.body)
+			wantError(t, status, body, tt.wantStatus, tt.wantCode)
+		})
+	}
+
+	if balance := app.balance(accountID); balance != "100.50" {
+		t.Errorf("balance after refused deposits = %s, want 100.50", balance)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	app := newTestApp(t)
+	accountID := app.createAccounts(1)[0]
+	app.deposit(accountID, "50")
+
+	status, body := app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "20"))
+	if status != http.StatusOK {
+		t.Fatalf("withdraw = %d %v", status, body)
+	}
+	if withdrawal := body["accounts"].(map[string]any); withdrawal["status"] != utils.COMPLETED {
+		t.Errorf("withdrawal = %v, want completed", withdrawal)
+	}
+
+	status, body = app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "30.01"))
+	wantError(t, status, body, http.StatusUnprocessableEntity, utils.ERR_INSUFFICIENT_FUNDS)
+
+	status, body = app.post("v1/withdraw", uuid.NewString(), depositBody(uuid.NewString(), "1"))
+	wantError(t, status, body, http.StatusNotFound, utils.ERR_ACCOUNT_NOT_FOUND)
+
+	if balance := app.balance(accountID); balance != "30.00" {
+		t.Errorf("balance = %s, want 30.00", balance)
+	}
+}
+
+// TestWithdrawIntoOverdraft withdraws from an account with a credit limit. It may go below zero by up to the limit
+// and no further.
+func TestWithdrawIntoOverdraft(t *testing.T) {
+	app := newTestApp(t)
+	accountID := app.createAccounts(1)[0]
+	app.deposit(accountID, "50")
+
+	status, body := app.put("v1/admin/accounts/"+accountID+"/credit-limit", `{"currency":"USD","credit_limit":"100"}`)
+	if status != http.StatusOK {
+		t.Fatalf("setting credit limit = %d %v", status, body)
+	}
+
+	status, body = app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "120"))
+	if status != http.StatusOK {
+		t.Fatalf("withdraw into the overdraft = %d %v", status, body)
+	}
+	if withdrawal := body["accounts"].(map[string]any); withdrawal["status"] != utils.COMPLETED {
+		t.Errorf("withdrawal = %v, want completed", withdrawal)
+	}
+
+	status, body = app.get("v1/accounts/" + accountID)
+	if status != http.StatusOK {
+		t.Fatalf("getting account = %d %v", status, body)
+	}
+	balance := body["accounts"].([]any)[0].(map[string]any)["balances"].([]any)[0].(map[string]any)
+	if balance["ledger"] != "-70.00" || balance["credit_limit"] != "100.00" || balance["remaining_credit"] != "30.00" {
+		t.Errorf("balance = %v, want -70.00 with 30.00 of a 100.00 credit limit remaining", balance)
+	}
+
+	status, body = app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "30.01"))
+	wantError(t, status, body, http.StatusUnprocessableEntity, utils.ERR_INSUFFICIENT_FUNDS)
+
+	if _, body = app.post("v1/withdraw", uuid.NewString(), depositBody(accountID, "30")); body["accounts"].(map[string]any)["status"] != utils.COMPLETED {
+		t.Errorf("withdrawal of the remaining credit = %v, want completed", body)
+	}
+	if balance := app.balance(accountID); balance != "-100.00" {
+		t.Errorf("balance = %s, want -100.00", balance)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	app := newTestApp(t)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "100")
+
+	status, body := app.post("v1/transfer", uuid.NewString(), transferBody(from, to, "40"))
+	if status != http.StatusOK {
+		t.Fatalf("transfer = %d %v", status, body)
+	}
+	if transfer := body["accounts"].(map[string]any); transfer["status"] != utils.COMPLETED {
+		t.Errorf("transfer = %v, want completed", transfer)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   utils.ErrorCode
+	}{
+		{name: "insufficient funds", body: transferBody(from, to, "60.01"), wantStatus: http.StatusUnprocessableEntity, wantCode: utils.ERR_INSUFFICIENT_FUNDS},
+		{name: "unknown destination", body: transferBody(from, uuid.NewString(), "1"), wantStatus: http.StatusNotFound, wantCode: utils.ERR_DESTINATION_NOT_FOUND},
+		{name: "unknown source", body: transferBody(uuid.NewString(), to, "1"), wantStatus: http.StatusNotFound, wantCode: utils.ERR_ACCOUNT_NOT_FOUND},
+		{name: "same account", body: transferBody(from, from, "1"), wantStatus: http.StatusBadRequest, wantCode: utils.ERR_VALIDATION_FAILED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := app.post("v1/transfer", uuid.NewString(), tt.body)
+			wantError(t, status, body, tt.wantStatus, tt.wantCode)
+		})
+	}
+
+	status, body = app.post("v1/transfer", uuid.NewString(), fmt.Sprintf(`{"from":"%s","to":"%s","amount":"1","currency":"USD","to_currency":"XYZ"}`, from, to))
+	wantError(t, status, body, http.StatusBadRequest, utils.ERR_VALIDATION_FAILED)
+	if details, _ := body["details"].([]any); len(details) != 1 || details[0].(map[string]any)["field"] != "to_currency" {
+		t.Errorf("details = %v, want to_currency at fault", body["details"])
+	}
+
+	if balance := app.balance(from); balance != "60.00" {
+		t.Errorf("balance of sender = %s, want 60.00", balance)
+	}
+	if balance := app.balance(to); balance != "40.00" {
+		t.Errorf("balance of receiver = %s, want 40.00", balance)
+	}
+}
+
+// TestFailureNamesTransaction refuses a withdrawal and a transfer that were recorded as failed. The error must name
+// the transaction, its status and why it failed, in either error format.
+func TestFailureNamesTransaction(t *testing.T) {
+	app := newTestApp(t)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "10")
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		accept string
+	}{
+		{name: "withdraw", path: "v1/withdraw", body: depositBody(from, "20")},
+		{name: "transfer", path: "v1/transfer", body: transferBody(from, to, "20")},
+		{name: "problem details", path: "v1/transfer", body: transferBody(from, to, "20"), accept: utils.MIME_PROBLEM_JSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := uuid.NewString()
+
+			req := httptest.NewRequest(http.MethodPost, "/"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(fiber.HeaderAccept, tt.accept)
+			req.Header.Set("Idempotency-Key", key)
+			resp, err := app.app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("%s error = %v", tt.name, err)
+			}
+			defer resp.Body.Close()
+
+			body := make(map[string]any)
+			if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("%s returned an undecodable body : %v", tt.name, err)
+			}
+			wantError(t, resp.StatusCode, body, http.StatusUnprocessableEntity, utils.ERR_INSUFFICIENT_FUNDS)
+			if body["transaction_id"] != key || body["failure_reason"] != string(database.FailureInsufficientFunds) {
+				t.Errorf("%s = %v, want transaction '%s' failed for %s", tt.name, body, key, database.FailureInsufficientFunds)
+			}
+			// A problem document keeps its status for the HTTP status.
+			if len(tt.accept) == 0 && body["status"] != utils.FAILED {
+				t.Errorf("%s status = %v, want %s", tt.name, body["status"], utils.FAILED)
+			}
+
+			_, history := app.get("v1/accounts/transactions/" + from)
+			txns, _ := history["transactions"].([]any)
+			found := false
+			for _, txn := range txns {
+				if txn := txn.(map[string]any); txn["transaction_id"] == key && txn["status"] == utils.FAILED {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("history of account '%s' has no failed transaction '%s' : %v", from, key, history)
+			}
+		})
+	}
+}
+
+// TestIdempotentReplay sends every request twice under one Idempotency-Key. The second must be answered as the first
+// was, without moving the money again.
+func TestIdempotentReplay(t *testing.T) {
+	app := newTestApp(t)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "deposit", path: "v1/deposit", body: depositBody(from, "100"), wantStatus: http.StatusOK},
+		{name: "withdraw", path: "v1/withdraw", body: depositBody(from, "10"), wantStatus: http.StatusOK},
+		{name: "transfer", path: "v1/transfer", body: transferBody(from, to, "25"), wantStatus: http.StatusOK},
+		{name: "failed withdraw", path: "v1/withdraw", body: depositBody(from, "1000"), wantStatus: http.StatusUnprocessableEntity},
+		{name: "failed transfer", path: "v1/transfer", body: transferBody(from, to, "1000"), wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := uuid.NewString()
+
+			firstStatus, first := app.post(tt.path, key, tt.body)
+			if firstStatus != tt.wantStatus {
+				t.Fatalf("first %s = %d %v, want %d", tt.name, firstStatus, first, tt.wantStatus)
+			}
+
+			replayStatus, replay := app.post(tt.path, key, tt.body)
+			if replayStatus != firstStatus {
+				t.Errorf("replayed %s = %d, want %d", tt.name, replayStatus, firstStatus)
+			}
+			if fmt.Sprint(replay) != fmt.Sprint(first) {
+				t.Errorf("replayed %s = %v, want %v", tt.name, replay, first)
+			}
+		})
+	}
+
+	if balance := app.balance(from); balance != "65.00" {
+		t.Errorf("balance of sender = %s, want 65.00", balance)
+	}
+	if balance := app.balance(to); balance != "25.00" {
+		t.Errorf("balance of receiver = %s, want 25.00", balance)
+	}
+
+	status, body := app.get("v1/accounts/transactions/" + from)
+	if status != http.StatusOK {
+		t.Fatalf("transactions = %d %v", status, body)
+	}
+	if txns, _ := body["transactions"].([]any); len(txns) != 5 {
+		t.Errorf("account has %d transactions, want 5 : %v", len(txns), body)
+	}
+}
+
+// TestIdempotencyKeyReused sends a second, different request under the Idempotency-Key of the first. It must be
+// refused without running, and the first must still be replayed.
+func TestIdempotencyKeyReused(t *testing.T) {
+	app := newTestApp(t)
+	accountID := app.createAccounts(1)[0]
+	key := uuid.NewString()
+
+	status, first := app.post("v1/deposit", key, depositBody(accountID, "100"))
+	if status != http.StatusOK {
+		t.Fatalf("deposit = %d %v", status, first)
+	}
+
+	status, body := app.post("v1/deposit", key, depositBody(accountID, "200"))
+	wantError(t, status, body, http.StatusUnprocessableEntity, utils.ERR_IDEMPOTENCY_KEY_REUSED)
+
+	status, replay := app.post("v1/deposit", key, depositBody(accountID, "100"))
+	if status != http.StatusOK || fmt.Sprint(replay) != fmt.Sprint(first) {
+		t.Errorf("replayed deposit = %d %v, want %v", status, replay, first)
+	}
+
+	if balance := app.balance(accountID); balance != "100.00" {
+		t.Errorf("balance = %s, want 100.00", balance)
+	}
+}
+
+// failingStore is a memory store whose next deposits fail as a lost database would.
+type failingStore struct {
+	*database.MemoryStore
+
+	failDeposits int
+}
+
+func (s *failingStore) Deposit(ctx context.Context, params *database.DepositParams) (*database.TransactionRecord, error) {
+	if s.failDeposits > 0 {
+		s.failDeposits--
+		return nil, errors.New("database is unreachable")
+	}
+	return s.MemoryStore.Deposit(ctx, params)
+}
+
+// TestServerErrorIsNotRecorded retries a request that failed with a server error under the same Idempotency-Key. The
+// error must not have been recorded, so the retry runs and its outcome is the one replayed afterwards.
+func TestServerErrorIsNotRecorded(t *testing.T) {
+	store := &failingStore{MemoryStore: database.NewMemoryStore()}
+	app := newTestAppOn(t, store)
+	accountID := app.createAccounts(1)[0]
+	key := uuid.NewString()
+
+	store.failDeposits = 1
+	status, body := app.post("v1/deposit", key, depositBody(accountID, "100"))
+	wantError(t, status, body, http.StatusInternalServerError, utils.ERR_INTERNAL)
+
+	status, retry := app.post("v1/deposit", key, depositBody(accountID, "100"))
+	if status != http.StatusOK {
+		t.Fatalf("retried deposit = %d %v, want it run again", status, retry)
+	}
+
+	status, replay := app.post("v1/deposit", key, depositBody(accountID, "100"))
+	if status != http.StatusOK || fmt.Sprint(replay) != fmt.Sprint(retry) {
+		t.Errorf("replayed deposit = %d %v, want %v", status, replay, retry)
+	}
+
+	if balance := app.balance(accountID); balance != "100.00" {
+		t.Errorf("balance = %s, want 100.00", balance)
+	}
+}
+
+func batchBody(mode string, legs ...string) string {
+	return fmt.Sprintf(`{"mode":"%s","transfers":[%s]}`, mode, strings.Join(legs, ","))
+}
+
+// TestAtomicBatchRollsBack sends an atomic batch whose second leg cannot be paid. The batch must fail on that leg
+// and leave no posting behind, not even of the leg before it.
+func TestAtomicBatchRollsBack(t *testing.T) {
+	app := newTestApp(t)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "100")
+
+	status, body := app.post("v1/transfers/batch", uuid.NewString(), batchBody("atomic", transferBody(from, to, "10"), transferBody(from, to, "1000")))
+	wantError(t, status, body, http.StatusUnprocessableEntity, utils.ERR_INSUFFICIENT_FUNDS)
+	if details, _ := body["details"].([]any); len(details) != 1 || details[0].(map[string]any)["field"] != "transfers[1]" {
+		t.Errorf("details = %v, want transfers[1] at fault", body["details"])
+	}
+
+	for accountID, want := range map[string]int{from: 1, to: 0} {
+		_, ledger := app.get("v1/accounts/ledger/" + accountID)
+		if postings, _ := ledger["postings"].([]any); len(postings) != want {
+			t.Errorf("account '%s' has %d postings, want %d : %v", accountID, len(postings), want, ledger)
+		}
+	}
+	if balance := app.balance(from); balance != "100.00" {
+		t.Errorf("balance of sender = %s, want 100.00", balance)
+	}
+}
+
+// TestBestEffortBatch sends a best-effort batch of a leg that can be paid and two that cannot. Each leg must be
+// reported on its own, and the transaction of each must be linked to the batch.
+func TestBestEffortBatch(t *testing.T) {
+	app := newTestApp(t)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+	app.deposit(from, "100")
+	batchID := uuid.NewString()
+
+	status, body := app.post("v1/transfers/batch", batchID, batchBody("best_effort",
+		transferBody(from, to, "10"), transferBody(from, to, "1000"), transferBody(from, uuid.NewString(), "5")))
+	if status != http.StatusOK {
+		t.Fatalf("batch = %d %v", status, body)
+	}
+
+	batch := body["batch"].(map[string]any)
+	if batch["batch_id"] != batchID || batch["status"] != utils.PARTIAL {
+		t.Errorf("batch = %v, want batch '%s' partial", batch, batchID)
+	}
+
+	want := []struct {
+		status string
+		error  string
+	}{
+		{status: utils.COMPLETED},
+		{status: utils.FAILED, error: "insufficient_funds"},
+		{status: utils.FAILED, error: "destination_not_found"},
+	}
+	legs, _ := batch["transfers"].([]any)
+	if len(legs) != len(want) {
+		t.Fatalf("batch has %d legs, want %d : %v", len(legs), len(want), batch)
+	}
+	legIDs := make(map[string]bool, len(legs))
+	for i, leg := range legs {
+		leg := leg.(map[string]any)
+		if legError, _ := leg["error"].(string); leg["status"] != want[i].status || legError != want[i].error {
+			t.Errorf("leg %d = %v, want %s %s", i, leg, want[i].status, want[i].error)
+		}
+		legIDs[leg["transaction_id"].(string)] = true
+	}
+
+	_, history := app.get("v1/accounts/transactions/" + from)
+	txns, _ := history["transactions"].([]any)
+	linked := 0
+	for _, txn := range txns {
+		txn := txn.(map[string]any)
+		if txn["batch_id"] == batchID {
+			linked++
+			if !legIDs[txn["transaction_id"].(string)] {
+				t.Errorf("transaction %v of the batch is not one of its legs", txn)
+			}
+		}
+	}
+	if linked != len(want) {
+		t.Errorf("%d transactions of the sender are linked to the batch, want %d : %v", linked, len(want), history)
+	}
+
+	if balance := app.balance(from); balance != "90.00" {
+		t.Errorf("balance of sender = %s, want 90.00", balance)
+	}
+}
@@ -3,14 +3,11 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
 )
@@ -19,54 +16,18 @@ const transferOp = "Transfer"
 
 func (a *accountsHandler) Transfer(ctx *fiber.Ctx) error {
 	req, err := a.validateTransferRequest(ctx)
-	if err != nil || req == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
+	if err != nil {
+		return utils.NewError(ctx, err)
 	}
 
 	reqHeader, err := a.validateTransferHeader(ctx)
-	if err != nil || reqHeader == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
-	}
-
-	redisKey := fmt.Sprintf("%s_%s", reqHeader.IdempotencyKey, transferOp)
-
-	redisConn := a.redis.RedisPool.Get()
-	defer func(redisConn redis.Conn) {
-		err := redisConn.Close()
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] Error closing redis connection for redisKey '%s'. error: %s", transferOp, redisKey, err.Error()))
-		}
-	}(redisConn)
-
-	ok, err := a.redis.Acquire(redisConn, redisKey)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] error acquiring lock for idempotency key '%s' : %v", transferOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	}
-
-	shouldRelease := true
-
-	defer func() {
-		err := a.redis.Release(redisConn, redisKey, shouldRelease)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] error releasing lock for idempotency key '%s' : %v", transferOp, redisKey, err))
-		}
-	}()
-
-	if !ok {
-		shouldRelease = false
-		results, err := a.redis.HandleMultipleRequests(ctx.UserContext(), redisKey, 5*time.Second)
-		if err != nil || results == nil {
-			a.logger.Error(fmt.Sprintf("[%s] error handling multiple requests '%s' : %v", transferOp, redisKey, err))
-			return utils.NewError(ctx, fiber.StatusInternalServerError)
-		}
-		a.logger.Info(fmt.Sprintf("[%s] multiple requests detected for '%s' : Results : %+v", transferOp, redisKey, results))
-		return utils.NewSuccess(ctx, results)
+		return utils.NewError(ctx, err)
 	}
 
 	results, err := a.handleTransfer(ctx.UserContext(), req, reqHeader)
 	if err != nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
 	return utils.NewSuccess(
@@ -78,184 +39,199 @@ func (a *accountsHandler) Transfer(ctx *fiber.Ctx) error {
 }
 
 func (a *accountsHandler) handleTransfer(ctx context.Context, req *models.Transfer, reqHeader *models.TransferRequestHeader) (*models.TransferResponse, error) {
+	failedResp := &models.TransferResponse{
+		From:          req.From,
+		To:            req.To,
+		Amount:        utils.FormatAmount(req.Amount, req.Currency),
+		Currency:      req.Currency,
+		Status:        utils.FAILED,
+		TransactionID: reqHeader.IdempotencyKey,
+	}
+
 	res, err := a.handleGetTransactions(ctx, reqHeader.IdempotencyKey)
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] Error finding existing transaction '%s' : %+v", transferOp, reqHeader.IdempotencyKey, err))
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+		return failedResp, err
 	}
 
 	if len(res) > 0 {
 		a.logger.Info(fmt.Sprintf("[%s] There was existing transaction '%s' : %+v", transferOp, reqHeader.IdempotencyKey, res))
-		return &models.TransferResponse{
-			From:          res[0].SenderID,
-			To:            res[0].ReceiverID,
-			Amount:        res[0].Amount,
-			Status:        res[0].Status,
-			TransactionID: res[0].TransactionID,
-		}, err
+		return existingTransferResponse(res), existingTransferFailure(res)
 	}
 
-	tx, err := a.postgresDB.Db.BeginTx(ctx, pgx.TxOptions{})
+	fee, err := a.fee(ctx, fees.OperationTransfer, req.From, req.Currency, req.Amount)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Error starting transaction : %+v", transferOp, err.Error()))
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+		a.logger.Error(fmt.Sprintf("[%s] Error pricing transfer from account '%s' : %+v", transferOp, req.From, err))
+		return failedResp, err
 	}
 
-	var withdrawalDone int64
-
-	withdrawalErr := tx.QueryRow(
-		ctx,
-		database.WITHDRAW_QUERY,
-		req.From,
-		req.Amount,
-		reqHeader.IdempotencyKey,
-		database.TxnTypeSender,
-		req.To,
-	).Scan(&withdrawalDone)
-
-	if withdrawalErr != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Error withdrawing from account '%s' : %+v", transferOp, req.From, err))
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+	params := &database.TransferParams{
+		TxnID:      reqHeader.IdempotencyKey,
+		From:       req.From,
+		To:         req.To,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		ToCurrency: req.ToCurrency,
+		QuoteID:    req.QuoteID,
+		Reference:  req.Reference,
+		Fee:        fee,
 	}
 
-	if withdrawalDone == 0 {
-		a.logger.Error(fmt.Sprintf("[%s] Withdrawing '%f' was not done from account '%s'", transferOp, req.Amount, req.From))
-
-		err = tx.Commit(ctx)
+	if req.Currency != req.ToCurrency && len(req.QuoteID) == 0 {
+		params.Rate, err = a.fxRates.GetRate(ctx, req.Currency, req.ToCurrency)
 		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] Error committing database transaction '%s' : %+v", transferOp, reqHeader.IdempotencyKey, err))
-			_ = tx.Rollback(ctx)
-			return &models.TransferResponse{
-				From:          req.From,
-				To:            req.To,
-				Amount:        req.Amount,
-				Status:        utils.FAILED,
-				TransactionID: reqHeader.IdempotencyKey,
-			}, err
+			a.logger.Error(fmt.Sprintf("[%s] Error getting rate from '%s' to '%s' : %+v", transferOp, req.Currency, req.ToCurrency, err))
+			return failedResp, err
 		}
-
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
 	}
 
-	var depositDone int64
-
-	depositErr := tx.QueryRow(
-		ctx,
-		database.DEPOSIT_QUERY,
-		req.To,
-		req.Amount,
-		reqHeader.IdempotencyKey,
-		database.TxnTypeReceiver,
-		req.From,
-	).Scan(&depositDone)
-
-	err = tx.Commit(ctx)
+	result, err := a.store.Transfer(ctx, params)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Error committing database transaction '%s' : %+v", transferOp, reqHeader.IdempotencyKey, err))
-		_ = tx.Rollback(ctx)
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
-	}
-
-	if depositErr != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Error depositing into account '%s' : %+v", transferOp, req.To, err))
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+		a.logger.Error(fmt.Sprintf("[%s] Error transferring from account '%s' to '%s' : %+v", transferOp, req.From, req.To, err))
+		return failedResp, err
 	}
 
-	if depositDone == 0 {
-		a.logger.Error(fmt.Sprintf("[%s] Depositing '%f' was not done into account '%s'", transferOp, req.Amount, req.To))
-		return &models.TransferResponse{
-			From:          req.From,
-			To:            req.To,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+	if result.Sender.Status != utils.COMPLETED {
+		a.logger.Error(fmt.Sprintf("[%s] Transferring '%s' was not done from account '%s' to '%s'", transferOp, req.Amount, req.From, req.To))
 	}
 
-	return &models.TransferResponse{
+	resp := &models.TransferResponse{
 		From:          req.From,
 		To:            req.To,
-		Amount:        req.Amount,
-		Status:        utils.COMPLETED,
+		Amount:        utils.FormatAmount(req.Amount, req.Currency),
+		Currency:      req.Currency,
+		Status:        result.Sender.Status,
 		TransactionID: reqHeader.IdempotencyKey,
-	}, nil
+	}
+	if result.Fee != nil && result.Fee.Status == utils.COMPLETED {
+		resp.Fee = utils.FormatAmount(result.Fee.Amount, req.Currency)
+	}
+
+	if result.Rate != nil {
+		resp.ToAmount = utils.FormatAmount(result.Receiver.Amount, req.ToCurrency)
+		resp.ToCurrency = req.ToCurrency
+		resp.FxRate = result.Rate.Rate.String()
+		resp.FxSpread = result.Rate.Spread.String()
+		resp.QuoteID = req.QuoteID
+	}
+
+	return resp, failureError(result.Sender.FailureReason, resp.TransactionID)
+}
+
+func existingTransferResponse(res []models.AccountTransactionsResponse) *models.TransferResponse {
+	res, fee := splitFee(res)
+	resp := &models.TransferResponse{
+		From:          res[0].SenderID,
+		To:            res[0].ReceiverID,
+		Amount:        res[0].Amount,
+		Currency:      res[0].Currency,
+		Status:        res[0].Status,
+		TransactionID: res[0].TransactionID,
+		FxRate:        res[0].FxRate,
+		FxSpread:      res[0].FxSpread,
+		Fee:           fee,
+	}
+
+	for _, txn := range res {
+		if txn.TxnType != string(database.TxnTypeSender) {
+			continue
+		}
+		resp.Amount = txn.Amount
+		resp.Currency = txn.Currency
+		resp.ToAmount = txn.CounterAmount
+		resp.ToCurrency = txn.CounterCurrency
+	}
+
+	return resp
+}
+
+// existingTransferFailure is the error reported again for a transfer that was recorded as failed. The reason is
+// kept on the sender record, which is the only one left when the receiver does not exist.
+func existingTransferFailure(res []models.AccountTransactionsResponse) error {
+	for _, txn := range res {
+		if txn.TxnType == string(database.TxnTypeSender) {
+			return failureError(database.FailureReason(txn.FailureReason), txn.TransactionID)
+		}
+	}
+	return nil
 }
 
 func (a *accountsHandler) validateTransferRequest(ctx *fiber.Ctx) (*models.Transfer, error) {
 	req := new(models.TransferRequest)
 	if err := ctx.BodyParser(req); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", transferOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	err := uuid.Validate((*req).From)
-	if err != nil {
+	if err != nil || database.IsSystemAccount((*req).From) {
 		a.logger.Error(fmt.Sprintf("[%s] request FROM account ID '%s' is invalid", transferOp, (*req).From))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("from", "must be the UUID of a customer account")
 	}
 
 	err = uuid.Validate((*req).To)
-	if err != nil {
+	if err != nil || database.IsSystemAccount((*req).To) {
 		a.logger.Error(fmt.Sprintf("[%s] request TO account ID '%s' is invalid", transferOp, (*req).To))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("to", "must be the UUID of a customer account")
 	}
 
 	if len((*req).Amount) == 0 {
 		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not specified", transferOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.Invalid("amount", "is required")
 	}
 
-	amount, err := strconv.ParseFloat((*req).Amount, 64)
+	currency, err := utils.ParseCurrency((*req).Currency)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid", transferOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", transferOp, (*req).Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
+	}
+
+	amount, err := utils.ParseAmount((*req).Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", transferOp, (*req).Amount, err))
+		return nil, invalidAmount("amount", err)
+	}
+
+	toCurrency := currency
+	if len((*req).ToCurrency) > 0 {
+		toCurrency, err = utils.ParseCurrency((*req).ToCurrency)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request input to_currency '%s' is invalid : %v", transferOp, (*req).ToCurrency, err))
+			return nil, utils.Invalid("to_currency", "is not a supported ISO 4217 currency")
+		}
+	}
+
+	if len((*req).QuoteID) > 0 {
+		if err = uuid.Validate((*req).QuoteID); err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] request quote ID '%s' is invalid", transferOp, (*req).QuoteID))
+			return nil, utils.Invalid("quote_id", "must be a UUID")
+		}
+		(*req).Convert = true
+	}
+
+	if (*req).From == (*req).To && currency == toCurrency {
+		a.logger.Error(fmt.Sprintf("[%s] request FROM and TO account ID '%s' are the same", transferOp, (*req).From))
+		return nil, utils.Invalid("to", "must be the UUID of a customer account")
+	}
+
+	if len((*req).QuoteID) > 0 && currency == toCurrency {
+		a.logger.Error(fmt.Sprintf("[%s] request quote ID '%s' was given for a transfer without conversion", transferOp, (*req).QuoteID))
+		return nil, utils.Invalid("quote_id", "only applies to transfers with conversion")
 	}
 
-	if amount <= 0 {
-		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not greater than zero", transferOp, (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	if currency != toCurrency && !(*req).Convert {
+		a.logger.Error(fmt.Sprintf("[%s] request currencies '%s' and '%s' differ but conversion was not requested", transferOp, currency, toCurrency))
+		return nil, utils.Invalid("to_currency", "differs from currency but convert is not set")
 	}
 
 	return &models.Transfer{
-		From:   req.From,
-		To:     req.To,
-		Amount: amount,
+		From:       req.From,
+		To:         req.To,
+		Amount:     amount,
+		Currency:   currency,
+		ToCurrency: toCurrency,
+		Convert:    (*req).Convert,
+		QuoteID:    (*req).QuoteID,
 	}, nil
 
 }
@@ -265,18 +241,18 @@ func (a *accountsHandler) validateTransferHeader(ctx *fiber.Ctx) (*models.Transf
 
 	if err := ctx.ReqHeaderParser(depositReqHeader); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", transferOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	if len(depositReqHeader.IdempotencyKey) == 0 {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not supplied", transferOp, depositReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MISSING_IDEMPOTENCY_KEY)
 	}
 
 	err := uuid.Validate(depositReqHeader.IdempotencyKey)
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", transferOp, depositReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
 	}
 
 	return depositReqHeader, nil
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/robinloh/wallet-backend/webhooks"
+)
+
+const (
+	publishWebhookEventOp = "PublishWebhookEvent"
+	deliverWebhooksOp     = "DeliverWebhooks"
+)
+
+const (
+	// WEBHOOK_CLAIM_LIMIT is the most due deliveries sent on each tick; the rest wait for the next one.
+	WEBHOOK_CLAIM_LIMIT = 100
+
+	// WEBHOOK_SENDERS is how many claimed deliveries are sent at once.
+	WEBHOOK_SENDERS = 10
+)
+
+// accountEvents are the webhook events published when an account moves to a status.
+var accountEvents = map[database.AccountStatus]string{
+	database.AccountStatusFrozen: webhooks.EventAccountFrozen,
+	database.AccountStatusActive: webhooks.EventAccountUnfrozen,
+	database.AccountStatusClosed: webhooks.EventAccountClosed,
+}
+
+// RunWebhookDeliveriesPeriodically sends the due webhook deliveries every interval until ctx is done.
+func (a *accountsHandler) RunWebhookDeliveriesPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.sendDueWebhookDeliveries(ctx, now)
+		}
+	}
+}
+
+// sendDueWebhookDeliveries claims the due deliveries and sends them across WEBHOOK_SENDERS senders, returning once
+// every one is recorded.
+func (a *accountsHandler) sendDueWebhookDeliveries(ctx context.Context, now time.Time) {
+	deliveries, err := a.store.ClaimDueWebhookDeliveries(ctx, now, webhookClaimLimit(webhooks.Timeout()))
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to claim due webhook deliveries : %v", deliverWebhooksOp, err))
+		return
+	}
+
+	claimed := make(chan *database.WebhookDelivery)
+	var wg sync.WaitGroup
+	for range min(WEBHOOK_SENDERS, len(deliveries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range claimed {
+				a.sendWebhookDelivery(ctx, delivery)
+			}
+		}()
+	}
+
+	for _, delivery := range deliveries {
+		claimed <- delivery
+	}
+	close(claimed)
+	wg.Wait()
+}
+
+// webhookClaimLimit is how many deliveries are claimed at once: no more than the senders get through in half of
+// WEBHOOK_DELIVERY_LEASE when every webhook takes the whole timeout to answer. A claim is then sent and recorded
+// before its lease runs out, and is not claimed and sent again by another dispatcher meanwhile.
+func webhookClaimLimit(timeout time.Duration) int {
+	perSender := max(1, int(database.WEBHOOK_DELIVERY_LEASE/2/timeout))
+	return min(WEBHOOK_CLAIM_LIMIT, WEBHOOK_SENDERS*perSender)
+}
+
+// sendWebhookDelivery makes the next attempt at a delivery and records how the webhook answered it.
+func (a *accountsHandler) sendWebhookDelivery(ctx context.Context, delivery *database.WebhookDelivery) {
+	attempt := &database.WebhookAttempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts + 1,
+		AttemptedAt: time.Now(),
+	}
+
+	statusCode, err := a.webhooks.Send(
+		ctx,
+		&webhooks.Delivery{
+			ID:        delivery.ID,
+			EventType: delivery.EventType,
+			URL:       delivery.URL,
+			Secret:    delivery.Secret,
+			Payload:   delivery.Payload,
+		},
+		attempt.AttemptedAt,
+	)
+	attempt.StatusCode = statusCode
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	updated, err := a.store.RecordWebhookAttempt(ctx, attempt)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to record attempt %d at delivery '%s' : %v", deliverWebhooksOp, attempt.Attempt, delivery.ID, err))
+		return
+	}
+
+	switch updated.Status {
+	case database.WebhookDeliveryPending:
+		a.logger.Error(fmt.Sprintf("[%s] attempt %d at delivery '%s' of '%s' to webhook '%s' failed, retrying at '%s' : %s", deliverWebhooksOp,
+			attempt.Attempt, delivery.ID, delivery.EventType, delivery.WebhookID, updated.NextAttemptAt.Format(time.RFC3339), attempt.Error))
+	case database.WebhookDeliveryDeadLetter:
+		a.logger.Error(fmt.Sprintf("[%s] delivery '%s' of '%s' to webhook '%s' is dead lettered after %d attempts : %s", deliverWebhooksOp,
+			delivery.ID, delivery.EventType, delivery.WebhookID, attempt.Attempt, attempt.Error))
+	default:
+		a.logger.Info(fmt.Sprintf("[%s] delivery '%s' of '%s' to webhook '%s' is %s", deliverWebhooksOp, delivery.ID, delivery.EventType, delivery.WebhookID, updated.Status))
+	}
+}
+
+// TransactionEvent is the transaction.completed or transaction.failed event of a record, carrying it as the
+// transaction history of its account would.
+func (a *accountsHandler) TransactionEvent(txn *database.TransactionRecord) *database.WebhookEvent {
+	eventType := webhooks.EventTransactionFailed
+	if txn.Status == utils.COMPLETED {
+		eventType = webhooks.EventTransactionCompleted
+	}
+	return a.webhookEvent(eventType, toTransactionResponse(txn))
+}
+
+// AccountStatusEvent is the event of an account moving to a status, or nil when the status has none.
+func (a *accountsHandler) AccountStatusEvent(params *database.StatusChangeParams) *database.WebhookEvent {
+	eventType, ok := accountEvents[params.Status]
+	if !ok {
+		return nil
+	}
+
+	return a.webhookEvent(eventType, &models.WebhookAccountEvent{
+		AccountID:     params.AccountID,
+		Status:        string(params.Status),
+		Reason:        params.Reason,
+		FreezeCredits: params.FreezeCredits,
+	})
+}
+
+// webhookEvent builds an event for the store to queue with what it reports. An event that cannot be encoded is
+// logged and dropped rather than failing what it reports.
+func (a *accountsHandler) webhookEvent(eventType string, data any) *database.WebhookEvent {
+	event := &database.WebhookEvent{
+		ID:   uuid.NewString(),
+		Type: eventType,
+	}
+
+	payload, err := json.Marshal(&models.WebhookEventPayload{
+		EventID:   event.ID,
+		EventType: eventType,
+		CreatedAt: utils.ConvertTimezone(time.Now()),
+		Data:      data,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to encode '%s' event : %v", publishWebhookEventOp, eventType, err))
+		return nil
+	}
+	event.Payload = payload
+
+	return event
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/webhooks"
+	"github.com/shopspring/decimal"
+)
+
+const testWebhookSecret = "whsec_dispatcher_test"
+
+// receivedDelivery is a delivery as the subscriber received it.
+type receivedDelivery struct {
+	id       string
+	event    string
+	verified bool
+	payload  string
+}
+
+// subscriber is a webhook receiver that answers every delivery with status and keeps what it received.
+type subscriber struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	received []receivedDelivery
+}
+
+func newSubscriber(t *testing.T) *subscriber {
+	t.Helper()
+
+	s := &subscriber{status: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.received = append(s.received, receivedDelivery{
+			id:    r.Header.Get(webhooks.HEADER_ID),
+			event: r.Header.Get(webhooks.HEADER_EVENT),
+			verified: webhooks.Verify(testWebhookSecret, r.Header.Get(webhooks.HEADER_TIMESTAMP), r.Header.Get(webhooks.HEADER_SIGNATURE),
+				body, time.Now(), webhooks.DEFAULT_TOLERANCE),
+			payload: string(body),
+		})
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *subscriber) answer(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *subscriber) deliveries() []receivedDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedDelivery(nil), s.received...)
+}
+
+// newWebhookTestApp routes the app on a fresh memory store with webhooks allowed to reach the subscribers, which
+// listen on loopback.
+func newWebhookTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_HOSTS", "true")
+	return newTestApp(t)
+}
+
+// createWebhook subscribes url to the event types and returns the webhook ID.
+func (a *testApp) createWebhook(url string, eventTypes ...string) string {
+	a.t.Helper()
+
+	status, body := a.post("v1/webhooks", uuid.NewString(), fmt.Sprintf(`{"url":"%s","event_types":["%s"],"secret":"%s"}`, url, strings.Join(eventTypes, `","`), testWebhookSecret))
+	if status != http.StatusOK {
+		a.t.Fatalf("creating webhook = %d %v", status, body)
+	}
+	return body["webhook"].(map[string]any)["webhook_id"].(string)
+}
+
+// webhookDeliveries returns the deliveries to the webhook, newest first.
+func (a *testApp) webhookDeliveries(webhookID string) []*database.WebhookDelivery {
+	a.t.Helper()
+
+	deliveries, err := a.store.ListWebhookDeliveries(context.Background(), &database.WebhookDeliveryFilter{
+		WebhookID: webhookID,
+		Limit:     database.MAX_LIST_WEBHOOK_DELIVERIES_LIMIT,
+	})
+	if err != nil {
+		a.t.Fatalf("ListWebhookDeliveries() error = %v", err)
+	}
+	return deliveries
+}
+
+// TestWebhookDeliveryRetries fails every attempt at a delivery. It must be retried after a backoff that doubles with
+// every attempt and dead lettered after the last, and a redelivery must then be sent as a new delivery.
+func TestWebhookDeliveryRetries(t *testing.T) {
+	backoff := time.Minute
+	t.Setenv("WEBHOOK_RETRY_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_RETRY_BACKOFF", backoff.String())
+
+	ctx := context.Background()
+	app := newWebhookTestApp(t)
+	sub := newSubscriber(t)
+	sub.answer(http.StatusInternalServerError)
+
+	webhookID := app.createWebhook(sub.URL, webhooks.EventTransactionCompleted)
+	app.deposit(app.createAccounts(1)[0], "10")
+
+	deliveries := app.webhookDeliveries(webhookID)
+	if len(deliveries) != 1 {
+		t.Fatalf("deposit queued %d deliveries, want 1", len(deliveries))
+	}
+	deliveryID := deliveries[0].ID
+
+	// Each attempt is made once the one before it has waited out its backoff.
+	for attempt := 1; attempt <= 3; attempt++ {
+		due := app.webhookDeliveries(webhookID)[0].NextAttemptAt
+		app.handler.sendDueWebhookDeliveries(ctx, due.Add(-time.Second))
+		if received := len(sub.deliveries()); received != attempt-1 {
+			t.Fatalf("attempt %d was sent before it was due", attempt)
+		}
+
+		app.handler.sendDueWebhookDeliveries(ctx, due)
+		if received := len(sub.deliveries()); received != attempt {
+			t.Fatalf("subscriber received %d attempts, want %d", received, attempt)
+		}
+
+		delivery := app.webhookDeliveries(webhookID)[0]
+		if delivery.Attempts != attempt || delivery.LastStatus != http.StatusInternalServerError {
+			t.Fatalf("delivery after attempt %d = %+v", attempt, delivery)
+		}
+		if attempt < 3 {
+			if wait, want := delivery.NextAttemptAt.Sub(delivery.LastAttemptAt), backoff<<(attempt-1); wait != want {
+				t.Errorf("retry after attempt %d waits %s, want %s", attempt, wait, want)
+			}
+			if delivery.Status != database.WebhookDeliveryPending {
+				t.Errorf("delivery after attempt %d is %s, want %s", attempt, delivery.Status, database.WebhookDeliveryPending)
+			}
+		} else if delivery.Status != database.WebhookDeliveryDeadLetter {
+			t.Errorf("delivery after the last attempt is %s, want %s", delivery.Status, database.WebhookDeliveryDeadLetter)
+		}
+	}
+
+	// A dead letter is not tried again.
+	app.handler.sendDueWebhookDeliveries(ctx, time.Now().Add(24*time.Hour))
+	if received := len(sub.deliveries()); received != 3 {
+		t.Fatalf("subscriber received %d attempts after the dead letter, want 3", received)
+	}
+
+	sub.answer(http.StatusNoContent)
+	status, body := app.post(fmt.Sprintf("v1/webhooks/%s/deliveries/%s/redeliver", webhookID, deliveryID), uuid.NewString(), "")
+	if status != http.StatusOK {
+		t.Fatalf("redeliver = %d %v", status, body)
+	}
+	redeliveryID := body["delivery"].(map[string]any)["delivery_id"].(string)
+	if redeliveryID == deliveryID {
+		t.Fatalf("redelivery reuses delivery '%s'", deliveryID)
+	}
+
+	app.handler.sendDueWebhookDeliveries(ctx, time.Now())
+
+	received := sub.deliveries()
+	if len(received) != 4 {
+		t.Fatalf("subscriber received %d deliveries, want 4", len(received))
+	}
+	for i, delivery := range received {
+		if !delivery.verified || delivery.event != webhooks.EventTransactionCompleted || delivery.payload != received[0].payload {
+			t.Errorf("delivery %d = %+v, want a verified copy of the event", i, delivery)
+		}
+	}
+	if received[2].id != deliveryID || received[3].id != redeliveryID {
+		t.Errorf("deliveries were sent as '%s' and '%s', want '%s' and '%s'", received[2].id, received[3].id, deliveryID, redeliveryID)
+	}
+
+	for _, delivery := range app.webhookDeliveries(webhookID) {
+		switch delivery.ID {
+		case deliveryID:
+			if delivery.Status != database.WebhookDeliveryDeadLetter {
+				t.Errorf("original delivery is %s, want it left %s", delivery.Status, database.WebhookDeliveryDeadLetter)
+			}
+		case redeliveryID:
+			if delivery.Status != database.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.RedeliveryOf != deliveryID {
+				t.Errorf("redelivery = %+v, want delivered at once as a redelivery of '%s'", delivery, deliveryID)
+			}
+		}
+	}
+}
+
+func TestWebhookClaimLimit(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{timeout: time.Second, want: WEBHOOK_CLAIM_LIMIT},
+		{timeout: webhooks.DEFAULT_TIMEOUT, want: 60},
+		{timeout: 30 * time.Second, want: 20},
+		{timeout: database.WEBHOOK_DELIVERY_LEASE / 2, want: WEBHOOK_SENDERS},
+		{timeout: database.WEBHOOK_DELIVERY_LEASE, want: WEBHOOK_SENDERS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timeout.String(), func(t *testing.T) {
+			if got := webhookClaimLimit(tt.timeout); got != tt.want {
+				t.Errorf("webhookClaimLimit(%s) = %d, want %d", tt.timeout, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWebhookDeliveriesAreSentAtOnce has the subscriber take a while over every delivery. The claimed deliveries must
+// be sent side by side rather than one after the other.
+func TestWebhookDeliveriesAreSentAtOnce(t *testing.T) {
+	const (
+		deposits = WEBHOOK_SENDERS
+		answerIn = 200 * time.Millisecond
+	)
+
+	app := newWebhookTestApp(t)
+	sub := newSubscriber(t)
+	slow := sub.Config.Handler
+	sub.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(answerIn)
+		slow.ServeHTTP(w, r)
+	})
+
+	webhookID := app.createWebhook(sub.URL, webhooks.EventTransactionCompleted)
+	accountID := app.createAccounts(1)[0]
+	for range deposits {
+		app.deposit(accountID, "1")
+	}
+
+	start := time.Now()
+	app.handler.sendDueWebhookDeliveries(context.Background(), time.Now())
+	elapsed := time.Since(start)
+
+	if received := len(sub.deliveries()); received != deposits {
+		t.Fatalf("subscriber received %d deliveries, want %d", received, deposits)
+	}
+	if elapsed >= deposits*answerIn/2 {
+		t.Errorf("sending %d deliveries took %s, want them sent at once", deposits, elapsed)
+	}
+	for _, delivery := range app.webhookDeliveries(webhookID) {
+		if delivery.Status != database.WebhookDeliveryDelivered {
+			t.Errorf("delivery '%s' is %s, want %s", delivery.ID, delivery.Status, database.WebhookDeliveryDelivered)
+		}
+	}
+}
+
+// TestWebhookEventsAreQueuedWithTheirRecords checks that the store queues an event for every record it commits,
+// including the overdraft charges of the background job, and none for a replay or a batch that was rolled back.
+func TestWebhookEventsAreQueuedWithTheirRecords(t *testing.T) {
+	ctx := context.Background()
+	app := newWebhookTestApp(t)
+	sub := newSubscriber(t)
+
+	webhookID := app.createWebhook(sub.URL, webhooks.EventTransactionCompleted, webhooks.EventTransactionFailed, webhooks.EventAccountFrozen)
+	accountIDs := app.createAccounts(2)
+	from, to := accountIDs[0], accountIDs[1]
+
+	key := uuid.NewString()
+	for range 2 {
+		if status, body := app.post("v1/deposit", key, depositBody(from, "100")); status != http.StatusOK {
+			t.Fatalf("deposit = %d %v", status, body)
+		}
+	}
+	if status, body := app.post("v1/withdraw", uuid.NewString(), depositBody(from, "1000")); status != http.StatusUnprocessableEntity {
+		t.Fatalf("withdraw = %d %v, want it refused", status, body)
+	}
+
+	_, err := app.store.BatchTransfer(ctx, &database.BatchTransferParams{
+		BatchID: uuid.NewString(),
+		Mode:    database.BatchModeAtomic,
+		Legs: []*database.TransferParams{
+			{TxnID: uuid.NewString(), From: from, To: to, Amount: decimal.NewFromInt(10), Currency: "USD", ToCurrency: "USD"},
+			{TxnID: uuid.NewString(), From: from, To: to, Amount: decimal.NewFromInt(1000), Currency: "USD", ToCurrency: "USD"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("BatchTransfer() of an unaffordable atomic batch succeeded")
+	}
+
+	err = app.store.SetCreditLimit(ctx, &database.CreditLimitParams{AccountID: from, Currency: "USD", CreditLimit: decimal.NewFromInt(100)})
+	if err != nil {
+		t.Fatalf("SetCreditLimit() error = %v", err)
+	}
+	if status, body := app.post("v1/withdraw", uuid.NewString(), depositBody(from, "150")); status != http.StatusOK {
+		t.Fatalf("withdraw into the overdraft = %d %v", status, body)
+	}
+	charge, err := app.store.ChargeOverdraft(ctx, &database.OverdraftChargeParams{
+		TxnID:     uuid.NewString(),
+		AccountID: from,
+		Currency:  "USD",
+		Terms:     &database.OverdraftTerms{DailyFee: decimal.NewFromInt(5)},
+	})
+	if err != nil || charge == nil {
+		t.Fatalf("ChargeOverdraft() = %v, %v, want a charge", charge, err)
+	}
+
+	_, err = app.store.ChangeAccountStatus(ctx, &database.StatusChangeParams{AccountID: to, Status: database.AccountStatusFrozen, Reason: "review"})
+	if err != nil {
+		t.Fatalf("ChangeAccountStatus() error = %v", err)
+	}
+
+	app.handler.sendDueWebhookDeliveries(ctx, time.Now())
+
+	var events []string
+	for _, delivery := range sub.deliveries() {
+		if !delivery.verified {
+			t.Errorf("delivery '%s' is not verified", delivery.id)
+		}
+		events = append(events, delivery.event)
+	}
+	slices.Sort(events)
+
+	want := []string{
+		webhooks.EventAccountFrozen,
+		webhooks.EventTransactionCompleted, // deposit
+		webhooks.EventTransactionCompleted, // withdrawal into the overdraft
+		webhooks.EventTransactionCompleted, // overdraft charge
+		webhooks.EventTransactionFailed,    // refused withdrawal
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("subscriber received %v, want %v", events, want)
+	}
+	if deliveries := app.webhookDeliveries(webhookID); len(deliveries) != len(want) {
+		t.Errorf("webhook has %d deliveries, want %d", len(deliveries), len(want))
+	}
+}
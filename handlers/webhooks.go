@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/idempotency"
+	"github.com/robinloh/wallet-backend/models"
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/robinloh/wallet-backend/webhooks"
+)
+
+const (
+	createWebhookOp         = "CreateWebhook"
+	listWebhooksOp          = "ListWebhooks"
+	getWebhookOp            = "GetWebhook"
+	disableWebhookOp        = "DisableWebhook"
+	enableWebhookOp         = "EnableWebhook"
+	listWebhookDeliveriesOp = "ListWebhookDeliveries"
+	getWebhookDeliveryOp    = "GetWebhookDelivery"
+	redeliverWebhookOp      = "RedeliverWebhook"
+)
+
+const (
+	MIN_WEBHOOK_SECRET_LENGTH = 16
+	MAX_WEBHOOK_SECRET_LENGTH = 128
+	MAX_WEBHOOK_URL_LENGTH    = 2048
+
+	// WEBHOOK_SECRET_PREFIX marks the secrets generated for webhooks created without one.
+	WEBHOOK_SECRET_PREFIX = "whsec_"
+)
+
+func (a *accountsHandler) CreateWebhook(ctx *fiber.Ctx) error {
+	req, err := a.validateCreateWebhookRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateWebhookHeader(ctx, createWebhookOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	webhook, err := a.handleCreateWebhook(ctx.UserContext(), req, reqHeader)
+	if err != nil {
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	// The secret is given back this once, so that a generated one can be kept by the subscriber. The response recorded
+	// for the Idempotency-Key leaves it out, so that it is not stored outside the webhook and a replay answers without
+	// it.
+	resp := toWebhookResponse(webhook)
+	recorded, err := json.Marshal(fiber.Map{
+		"success": true,
+		"webhook": resp,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to encode response of webhook '%s' : %v", createWebhookOp, webhook.ID, err))
+		return utils.NewError(ctx, err)
+	}
+	idempotency.RecordAs(ctx, recorded)
+	resp.Secret = webhook.Secret
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"webhook": resp,
+		},
+	)
+}
+
+func (a *accountsHandler) handleCreateWebhook(ctx context.Context, req *models.WebhookRequest, reqHeader *models.WebhookRequestHeader) (*database.Webhook, error) {
+	if len(req.Secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			a.logger.Error(fmt.Sprintf("[%s] unable to generate webhook secret : %v", createWebhookOp, err))
+			return nil, err
+		}
+		req.Secret = WEBHOOK_SECRET_PREFIX + hex.EncodeToString(secret)
+	}
+
+	webhook, err := a.store.CreateWebhook(ctx, &database.Webhook{
+		ID:         reqHeader.IdempotencyKey,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     req.Secret,
+		Status:     database.WebhookStatusActive,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to create webhook '%s' : %v", createWebhookOp, reqHeader.IdempotencyKey, err))
+		return nil, err
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] webhook '%s' to '%s' subscribes to %s", createWebhookOp, webhook.ID, webhook.URL, strings.Join(webhook.EventTypes, ", ")))
+
+	return webhook, nil
+}
+
+func (a *accountsHandler) ListWebhooks(ctx *fiber.Ctx) error {
+	found, err := a.store.ListWebhooks(ctx.UserContext())
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to list webhooks : %v", listWebhooksOp, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	subscriptions := make([]*models.WebhookResponse, 0, len(found))
+	for _, webhook := range found {
+		subscriptions = append(subscriptions, toWebhookResponse(webhook))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"webhooks": subscriptions,
+		},
+	)
+}
+
+func (a *accountsHandler) GetWebhook(ctx *fiber.Ctx) error {
+	webhookID, err := a.validateWebhookID(ctx, getWebhookOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	webhook, err := a.store.GetWebhook(ctx.UserContext(), webhookID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find webhook '%s' : %v", getWebhookOp, webhookID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"webhook": toWebhookResponse(webhook),
+		},
+	)
+}
+
+func (a *accountsHandler) DisableWebhook(ctx *fiber.Ctx) error {
+	return a.changeWebhookStatus(ctx, disableWebhookOp, database.WebhookStatusDisabled)
+}
+
+func (a *accountsHandler) EnableWebhook(ctx *fiber.Ctx) error {
+	return a.changeWebhookStatus(ctx, enableWebhookOp, database.WebhookStatusActive)
+}
+
+func (a *accountsHandler) changeWebhookStatus(ctx *fiber.Ctx, op string, status database.WebhookStatus) error {
+	webhookID, err := a.validateWebhookID(ctx, op)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	webhook, err := a.store.ChangeWebhookStatus(ctx.UserContext(), webhookID, status)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to change status of webhook '%s' to '%s' : %v", op, webhookID, status, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] webhook '%s' is now '%s'", op, webhookID, webhook.Status))
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"webhook": toWebhookResponse(webhook),
+		},
+	)
+}
+
+func (a *accountsHandler) ListWebhookDeliveries(ctx *fiber.Ctx) error {
+	req, err := a.validateListWebhookDeliveriesRequest(ctx)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	found, err := a.store.ListWebhookDeliveries(ctx.UserContext(), &database.WebhookDeliveryFilter{
+		WebhookID: req.WebhookID,
+		Status:    database.WebhookDeliveryStatus(req.Status),
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to list deliveries of webhook '%s' : %v", listWebhookDeliveriesOp, req.WebhookID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	deliveries := make([]*models.WebhookDeliveryResponse, 0, len(found))
+	for _, delivery := range found {
+		deliveries = append(deliveries, toWebhookDeliveryResponse(delivery))
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"deliveries": deliveries,
+		},
+	)
+}
+
+func (a *accountsHandler) GetWebhookDelivery(ctx *fiber.Ctx) error {
+	webhookID, deliveryID, err := a.validateWebhookDeliveryID(ctx, getWebhookDeliveryOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	delivery, found, err := a.store.GetWebhookDelivery(ctx.UserContext(), webhookID, deliveryID)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to find delivery '%s' of webhook '%s' : %v", getWebhookDeliveryOp, deliveryID, webhookID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	attempts := make([]models.WebhookAttemptResponse, 0, len(found))
+	for _, attempt := range found {
+		attempts = append(attempts, models.WebhookAttemptResponse{
+			Attempt:     attempt.Attempt,
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			AttemptedAt: utils.ConvertTimezone(attempt.AttemptedAt),
+			DurationMs:  attempt.Duration.Milliseconds(),
+		})
+	}
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"delivery": toWebhookDeliveryResponse(delivery),
+			"attempts": attempts,
+		},
+	)
+}
+
+// RedeliverWebhook sends the event of a delivery again, typically one that was dead lettered, as a new delivery whose
+// ID is the idempotency key.
+func (a *accountsHandler) RedeliverWebhook(ctx *fiber.Ctx) error {
+	webhookID, deliveryID, err := a.validateWebhookDeliveryID(ctx, redeliverWebhookOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	reqHeader, err := a.validateWebhookHeader(ctx, redeliverWebhookOp)
+	if err != nil {
+		return utils.NewError(ctx, err)
+	}
+
+	redelivery, err := a.store.RedeliverWebhook(ctx.UserContext(), webhookID, deliveryID, reqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] unable to redeliver delivery '%s' of webhook '%s' : %v", redeliverWebhookOp, deliveryID, webhookID, err))
+		return utils.NewError(ctx, storeError(err))
+	}
+
+	a.logger.Info(fmt.Sprintf("[%s] delivery '%s' of webhook '%s' is redelivered as '%s'", redeliverWebhookOp, deliveryID, webhookID, redelivery.ID))
+
+	return utils.NewSuccess(
+		ctx,
+		fiber.Map{
+			"delivery": toWebhookDeliveryResponse(redelivery),
+		},
+	)
+}
+
+func toWebhookResponse(webhook *database.Webhook) *models.WebhookResponse {
+	return &models.WebhookResponse{
+		WebhookID:  webhook.ID,
+		URL:        webhook.URL,
+		EventTypes: webhook.EventTypes,
+		Status:     string(webhook.Status),
+		CreatedAt:  utils.ConvertTimezone(webhook.CreatedAt),
+	}
+}
+
+func toWebhookDeliveryResponse(delivery *database.WebhookDelivery) *models.WebhookDeliveryResponse {
+	resp := &models.WebhookDeliveryResponse{
+		DeliveryID:    delivery.ID,
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Status:        string(delivery.Status),
+		Attempts:      delivery.Attempts,
+		LastAttemptAt: optionalTime(delivery.LastAttemptAt),
+		LastStatus:    delivery.LastStatus,
+		LastError:     delivery.LastError,
+		RedeliveryOf:  delivery.RedeliveryOf,
+		Payload:       delivery.Payload,
+		CreatedAt:     utils.ConvertTimezone(delivery.CreatedAt),
+	}
+
+	if delivery.Status == database.WebhookDeliveryPending {
+		resp.NextAttemptAt = optionalTime(delivery.NextAttemptAt)
+	}
+
+	return resp
+}
+
+func (a *accountsHandler) validateCreateWebhookRequest(ctx *fiber.Ctx) (*models.WebhookRequest, error) {
+	req := new(models.WebhookRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", createWebhookOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 || len(req.URL) > MAX_WEBHOOK_URL_LENGTH {
+		a.logger.Error(fmt.Sprintf("[%s] request input url '%s' is invalid", createWebhookOp, req.URL))
+		return nil, utils.Invalid("url", fmt.Sprintf("must be an absolute http or https URL of at most %d characters", MAX_WEBHOOK_URL_LENGTH))
+	}
+	if err = a.webhooks.CheckHost(target.Hostname()); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input url '%s' is refused : %v", createWebhookOp, req.URL, err))
+		return nil, utils.Invalid("url", "must not be on a loopback, link-local or private address")
+	}
+
+	if len(req.EventTypes) == 0 {
+		a.logger.Error(fmt.Sprintf("[%s] request input event types are not specified", createWebhookOp))
+		return nil, utils.Invalid("event_types", "is required")
+	}
+
+	eventTypes := make([]string, 0, len(req.EventTypes))
+	for _, eventType := range req.EventTypes {
+		if !webhooks.IsEventType(eventType) {
+			a.logger.Error(fmt.Sprintf("[%s] request input event type '%s' is invalid", createWebhookOp, eventType))
+			return nil, utils.Invalid("event_types", "must only hold "+strings.Join(webhooks.EventTypes, ", "))
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	req.EventTypes = eventTypes
+
+	if len(req.Secret) > 0 && (len(req.Secret) < MIN_WEBHOOK_SECRET_LENGTH || len(req.Secret) > MAX_WEBHOOK_SECRET_LENGTH) {
+		a.logger.Error(fmt.Sprintf("[%s] request input secret is not between %d and %d characters", createWebhookOp, MIN_WEBHOOK_SECRET_LENGTH, MAX_WEBHOOK_SECRET_LENGTH))
+		return nil, utils.Invalid("secret", fmt.Sprintf("must be between %d and %d characters", MIN_WEBHOOK_SECRET_LENGTH, MAX_WEBHOOK_SECRET_LENGTH))
+	}
+
+	return req, nil
+}
+
+func (a *accountsHandler) validateWebhookHeader(ctx *fiber.Ctx, op string) (*models.WebhookRequestHeader, error) {
+	webhookReqHeader := new(models.WebhookRequestHeader)
+
+	if err := ctx.ReqHeaderParser(webhookReqHeader); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", op, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
+	}
+
+	err := uuid.Validate(webhookReqHeader.IdempotencyKey)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", op, webhookReqHeader.IdempotencyKey))
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
+	}
+
+	return webhookReqHeader, nil
+}
+
+func (a *accountsHandler) validateListWebhookDeliveriesRequest(ctx *fiber.Ctx) (*models.ListWebhookDeliveriesRequest, error) {
+	webhookID, err := a.validateWebhookID(ctx, listWebhookDeliveriesOp)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.ListWebhookDeliveriesRequest{
+		WebhookID: webhookID,
+		Status:    ctx.Query("status"),
+		Limit:     database.DEFAULT_LIST_WEBHOOK_DELIVERIES_LIMIT,
+	}
+
+	if len(req.Status) > 0 && !database.IsWebhookDeliveryStatus(req.Status) {
+		a.logger.Error(fmt.Sprintf("[%s] request input status '%s' is invalid", listWebhookDeliveriesOp, req.Status))
+		return nil, utils.Invalid("status", "must be one of pending, delivered or dead_letter")
+	}
+
+	if limit := ctx.Query("limit"); len(limit) > 0 {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > database.MAX_LIST_WEBHOOK_DELIVERIES_LIMIT {
+			a.logger.Error(fmt.Sprintf("[%s] request input limit '%s' must be between 1 and %d", listWebhookDeliveriesOp, limit, database.MAX_LIST_WEBHOOK_DELIVERIES_LIMIT))
+			return nil, utils.Invalid("limit", fmt.Sprintf("must be between 1 and %d", database.MAX_LIST_WEBHOOK_DELIVERIES_LIMIT))
+		}
+		req.Limit = parsed
+	}
+
+	return req, nil
+}
+
+func (a *accountsHandler) validateWebhookID(ctx *fiber.Ctx, op string) (string, error) {
+	webhookID := ctx.Params("id")
+	if err := uuid.Validate(webhookID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid webhook ID '%s'", op, webhookID))
+		return "", utils.Invalid("id", "must be a webhook UUID")
+	}
+	return webhookID, nil
+}
+
+func (a *accountsHandler) validateWebhookDeliveryID(ctx *fiber.Ctx, op string) (string, string, error) {
+	webhookID, err := a.validateWebhookID(ctx, op)
+	if err != nil {
+		return "", "", err
+	}
+
+	deliveryID := ctx.Params("delivery_id")
+	if err = uuid.Validate(deliveryID); err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Invalid webhook delivery ID '%s'", op, deliveryID))
+		return "", "", utils.Invalid("delivery_id", "must be a webhook delivery UUID")
+	}
+	return webhookID, deliveryID, nil
+}
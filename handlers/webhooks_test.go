@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/idempotency"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+// TestWebhookSecretIsNotRecorded creates a webhook with a generated secret. The secret is returned by the call but
+// kept out of the recorded response, so a replay answers without it.
+func TestWebhookSecretIsNotRecorded(t *testing.T) {
+	app := newTestApp(t)
+	key := uuid.NewString()
+	request := `{"url":"https://example.com/hooks","event_types":["transaction.completed"]}`
+
+	status, body := app.post("v1/webhooks", key, request)
+	if status != http.StatusOK {
+		t.Fatalf("creating webhook = %d %v", status, body)
+	}
+	secret, _ := body["webhook"].(map[string]any)["secret"].(string)
+	if !strings.HasPrefix(secret, WEBHOOK_SECRET_PREFIX) {
+		t.Fatalf("webhook = %v, want a generated secret", body["webhook"])
+	}
+
+	record, err := app.store.(idempotency.RecordStore).GetRecord(context.Background(), idempotency.RecordKey{Key: key, Operation: "/v1/webhooks"})
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if strings.Contains(string(record.Body), secret) {
+		t.Errorf("recorded response %s holds the secret", record.Body)
+	}
+
+	status, body = app.post("v1/webhooks", key, request)
+	if status != http.StatusOK {
+		t.Fatalf("replaying webhook creation = %d %v", status, body)
+	}
+	if webhook := body["webhook"].(map[string]any); webhook["webhook_id"] != key || webhook["secret"] != nil {
+		t.Errorf("replayed webhook = %v, want '%s' without its secret", webhook, key)
+	}
+}
+
+func TestWebhookURLMustBePublic(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, url := range []string{
+		"http://localhost:9090/hooks",
+		"http://127.0.0.1/hooks",
+		"http://[::1]:8080/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"https://10.0.0.8/hooks",
+		"https://192.168.1.20/hooks",
+	} {
+		t.Run(url, func(t *testing.T) {
+			status, body := app.post("v1/webhooks", uuid.NewString(), fmt.Sprintf(`{"url":"%s","event_types":["transaction.completed"]}`, url))
+			wantError(t, status, body, http.StatusBadRequest, utils.ERR_VALIDATION_FAILED)
+		})
+	}
+
+	status, body := app.post("v1/webhooks", uuid.NewString(), `{"url":"https://hooks.example.com/wallet","event_types":["transaction.completed"]}`)
+	if status != http.StatusOK {
+		t.Errorf("creating webhook to a public host = %d %v", status, body)
+	}
+}
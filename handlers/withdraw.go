@@ -3,13 +3,11 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
 	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
 	"github.com/robinloh/wallet-backend/models"
 	"github.com/robinloh/wallet-backend/utils"
 )
@@ -18,145 +16,118 @@ const withdrawOp = "Withdraw"
 
 func (a *accountsHandler) Withdraw(ctx *fiber.Ctx) error {
 	req, err := a.validateWithdrawRequest(ctx)
-	if err != nil || req == nil {
-		return err
+	if err != nil {
+		return utils.NewError(ctx, err)
 	}
 
 	reqHeader, err := a.validateWithdrawHeader(ctx)
-	if err != nil || reqHeader == nil {
-		return utils.NewError(ctx, fiber.StatusBadRequest)
-	}
-
-	redisKey := fmt.Sprintf("%s_%s", reqHeader.IdempotencyKey, withdrawOp)
-
-	redisConn := a.redis.RedisPool.Get()
-	defer func(redisConn redis.Conn) {
-		err := redisConn.Close()
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] Error closing redis connection for redisKey '%s'. error: %s", withdrawOp, redisKey, err.Error()))
-		}
-	}(redisConn)
-
-	ok, err := a.redis.Acquire(redisConn, redisKey)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] error acquiring lock for idempotency key '%s' : %v", withdrawOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	}
-
-	shouldRelease := true
-
-	defer func() {
-		err := a.redis.Release(redisConn, redisKey, shouldRelease)
-		if err != nil {
-			a.logger.Error(fmt.Sprintf("[%s] error releasing lock for idempotency key '%s' : %v", withdrawOp, redisKey, err))
-		}
-	}()
-
-	if !ok {
-		shouldRelease = false
-		results, err := a.redis.HandleMultipleRequests(ctx.UserContext(), redisKey, 5*time.Second)
-		if err != nil || results == nil {
-			a.logger.Error(fmt.Sprintf("[%s] error handling multiple requests '%s' : %v", withdrawOp, redisKey, err))
-			return utils.NewError(ctx, fiber.StatusInternalServerError)
-		}
-		a.logger.Info(fmt.Sprintf("[%s] multiple requests detected for '%s' : Results : %+v", withdrawOp, redisKey, results))
-		return utils.NewSuccess(ctx, results)
+		return utils.NewError(ctx, err)
 	}
 
 	results, err := a.handleWithdraw(ctx.UserContext(), req, reqHeader)
 	if err != nil {
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
+		return utils.NewError(ctx, storeError(err))
 	}
 
 	successResp := fiber.Map{
 		"accounts": results,
 	}
 
-	err = a.redis.Publish(redisConn, redisKey, successResp)
-	if err != nil {
-		a.logger.Error(fmt.Sprintf("[%s] Unable to publish results for idempotency key '%s' : %v", withdrawOp, redisKey, err))
-		return utils.NewError(ctx, fiber.StatusInternalServerError)
-	} else {
-		a.logger.Debug(fmt.Sprintf("[%s] Successfully published results '%+v' for idempotency key '%s'", withdrawOp, results, redisKey))
-	}
-
 	return utils.NewSuccess(ctx, successResp)
 }
 
 func (a *accountsHandler) handleWithdraw(ctx context.Context, req *models.Withdraw, reqHeader *models.WithdrawRequestHeader) (interface{}, error) {
-	var done int64
-
-	err := a.postgresDB.Db.QueryRow(
-		ctx,
-		database.WITHDRAW_QUERY,
-		req.ID,
-		req.Amount,
-		reqHeader.IdempotencyKey,
-		database.TxnTypeWithdraw,
-		"",
-	).Scan(&done)
+	resp := &models.WithdrawResponse{
+		AccountID:     req.ID,
+		Amount:        utils.FormatAmount(req.Amount, req.Currency),
+		Currency:      req.Currency,
+		Status:        utils.FAILED,
+		TransactionID: reqHeader.IdempotencyKey,
+	}
 
+	res, err := a.handleGetTransactions(ctx, reqHeader.IdempotencyKey)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[Withdraw] Error withdrawing from account '%s' : %+v", req.ID, err))
-		return &models.WithdrawResponse{
-			AccountID:     req.ID,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+		a.logger.Error(fmt.Sprintf("[%s] Error finding existing transaction '%s' : %+v", withdrawOp, reqHeader.IdempotencyKey, err))
+		return resp, err
 	}
 
-	if done == 0 {
-		a.logger.Error(fmt.Sprintf("[Withdraw] Withdrawal '%f' was not done from account '%s'", req.Amount, req.ID))
+	if len(res) > 0 {
+		a.logger.Info(fmt.Sprintf("[%s] There was existing transaction '%s' : %+v", withdrawOp, reqHeader.IdempotencyKey, res))
+		res, fee := splitFee(res)
 		return &models.WithdrawResponse{
-			AccountID:     req.ID,
-			Amount:        req.Amount,
-			Status:        utils.FAILED,
-			TransactionID: reqHeader.IdempotencyKey,
-		}, err
+			AccountID:     res[0].AccountID,
+			Amount:        res[0].Amount,
+			Currency:      res[0].Currency,
+			Status:        res[0].Status,
+			TransactionID: res[0].TransactionID,
+			Fee:           fee,
+		}, failureError(database.FailureReason(res[0].FailureReason), res[0].TransactionID)
 	}
 
-	return &models.WithdrawResponse{
-		AccountID:     req.ID,
-		Amount:        req.Amount,
-		Status:        utils.COMPLETED,
-		TransactionID: reqHeader.IdempotencyKey,
-	}, err
+	fee, err := a.fee(ctx, fees.OperationWithdraw, req.ID, req.Currency, req.Amount)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Error pricing withdrawal from account '%s' : %+v", withdrawOp, req.ID, err))
+		return resp, err
+	}
+
+	txn, err := a.store.Withdraw(ctx, &database.WithdrawParams{
+		TxnID:     reqHeader.IdempotencyKey,
+		AccountID: req.ID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Fee:       fee,
+	})
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] Error withdrawing from account '%s' : %+v", withdrawOp, req.ID, err))
+		return resp, err
+	}
+
+	if txn.Status != utils.COMPLETED {
+		a.logger.Error(fmt.Sprintf("[%s] Withdrawal '%s' was not done from account '%s'", withdrawOp, req.Amount, req.ID))
+	} else if fee.IsPositive() {
+		resp.Fee = utils.FormatAmount(fee, req.Currency)
+	}
+
+	resp.Status = txn.Status
+	return resp, failureError(txn.FailureReason, resp.TransactionID)
 }
 
 func (a *accountsHandler) validateWithdrawRequest(ctx *fiber.Ctx) (*models.Withdraw, error) {
 	req := new(models.WithdrawRequest)
 
 	if err := ctx.BodyParser(req); err != nil {
-		a.logger.Error(fmt.Sprintf("[Deposit] error parsing request body : %v", err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		a.logger.Error(fmt.Sprintf("[%s] error parsing request body : %v", withdrawOp, err))
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	err := uuid.Validate((*req).ID)
-	if err != nil {
-		a.logger.Error(fmt.Sprintf("[Deposit] request input account ID '%s' is invalid", (*req).ID))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	if err != nil || database.IsSystemAccount((*req).ID) {
+		a.logger.Error(fmt.Sprintf("[%s] request input account ID '%s' is invalid", withdrawOp, (*req).ID))
+		return nil, utils.Invalid("id", "must be the UUID of a customer account")
 	}
 
 	if len((*req).Amount) == 0 {
-		a.logger.Error(fmt.Sprintf("[Deposit] request input amount '%s' is not specified", (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is not specified", withdrawOp, (*req).Amount))
+		return nil, utils.Invalid("amount", "is required")
 	}
 
-	amount, err := strconv.ParseFloat((*req).Amount, 64)
+	currency, err := utils.ParseCurrency((*req).Currency)
 	if err != nil {
-		a.logger.Error(fmt.Sprintf("[Deposit] request input amount '%s' is invalid", (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		a.logger.Error(fmt.Sprintf("[%s] request input currency '%s' is invalid : %v", withdrawOp, (*req).Currency, err))
+		return nil, utils.Invalid("currency", "is not a supported ISO 4217 currency")
 	}
 
-	if amount <= 0 {
-		a.logger.Error(fmt.Sprintf("[Deposit] request input amount '%s' is not greater than zero", (*req).Amount))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+	amount, err := utils.ParseAmount((*req).Amount, currency)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("[%s] request input amount '%s' is invalid : %v", withdrawOp, (*req).Amount, err))
+		return nil, invalidAmount("amount", err)
 	}
 
 	return &models.Withdraw{
-		ID:     req.ID,
-		Amount: amount,
+		ID:       req.ID,
+		Amount:   amount,
+		Currency: currency,
 	}, nil
 }
 
@@ -165,18 +136,18 @@ func (a *accountsHandler) validateWithdrawHeader(ctx *fiber.Ctx) (*models.Withdr
 
 	if err := ctx.ReqHeaderParser(withdrawReqHeader); err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] error parsing request body header : %v", withdrawOp, err))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MALFORMED_REQUEST)
 	}
 
 	if len(withdrawReqHeader.IdempotencyKey) == 0 {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not supplied", withdrawOp, withdrawReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_MISSING_IDEMPOTENCY_KEY)
 	}
 
 	err := uuid.Validate(withdrawReqHeader.IdempotencyKey)
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("[%s] request header IdempotencyKey '%s' is not valid", withdrawOp, withdrawReqHeader.IdempotencyKey))
-		return nil, utils.NewError(ctx, fiber.StatusBadRequest)
+		return nil, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY)
 	}
 
 	return withdrawReqHeader, nil
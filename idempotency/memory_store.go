@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-process IdempotencyStore for single-node deployments and tests.
+type MemoryStore struct {
+	mu          sync.Mutex
+	locks       map[string]memoryLock
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+type memoryLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		locks:       make(map[string]memoryLock),
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+func (m *MemoryStore) Acquire(_ context.Context, key string, ttl time.Duration) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := m.locks[key]; ok && lock.expiresAt.After(now) {
+		return nil, nil
+	}
+
+	lease := &Lease{
+		Key:   key,
+		Token: uuid.NewString(),
+	}
+	m.locks[key] = memoryLock{
+		token:     lease.Token,
+		expiresAt: now.Add(ttl),
+	}
+	return lease, nil
+}
+
+func (m *MemoryStore) Extend(_ context.Context, lease *Lease, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	lock, ok := m.locks[lease.Key]
+	if !ok || lock.token != lease.Token || !lock.expiresAt.After(now) {
+		return ErrLeaseLost
+	}
+	lock.expiresAt = now.Add(ttl)
+	m.locks[lease.Key] = lock
+	return nil
+}
+
+func (m *MemoryStore) Release(_ context.Context, lease *Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lock, ok := m.locks[lease.Key]; ok && lock.token == lease.Token {
+		delete(m.locks, lease.Key)
+	}
+	return nil
+}
+
+// Publish hands the response to every request currently waiting on the key. Like a pub/sub channel,
+// requests that start waiting afterwards do not see it.
+func (m *MemoryStore) Publish(_ context.Context, key string, record *Record) error {
+	byteResults, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ch := range m.subscribers[key] {
+		select {
+		case ch <- byteResults:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) HandleMultipleRequests(ctx context.Context, key string, timeout time.Duration) (*Record, error) {
+	ch := m.subscribe(key)
+	defer m.unsubscribe(key, ch)
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case <-ctxWithTimeout.Done():
+		return nil, fmt.Errorf("timeout while waiting for reply for key : %s", key)
+
+	case res := <-ch:
+		record := new(Record)
+		if err := json.Unmarshal(res, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+func (m *MemoryStore) subscribe(key string) chan []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan []byte, 1)
+	if _, ok := m.subscribers[key]; !ok {
+		m.subscribers[key] = make(map[chan []byte]struct{})
+	}
+	m.subscribers[key][ch] = struct{}{}
+	return ch
+}
+
+func (m *MemoryStore) unsubscribe(key string, ch chan []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.subscribers[key], ch)
+	if len(m.subscribers[key]) == 0 {
+		delete(m.subscribers, key)
+	}
+}
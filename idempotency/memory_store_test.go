@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const testLeaseTTL = 100 * time.Millisecond
+
+func acquire(t *testing.T, store *MemoryStore, key string) *Lease {
+	t.Helper()
+
+	lease, err := store.Acquire(context.Background(), key, testLeaseTTL)
+	if err != nil || lease == nil {
+		t.Fatalf("Acquire(%s) = %v, %v, want a lease", key, lease, err)
+	}
+	return lease
+}
+
+func TestAcquireRejectsConcurrentHolder(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	holder := acquire(t, store, "key")
+
+	if lease, err := store.Acquire(ctx, "key", testLeaseTTL); err != nil || lease != nil {
+		t.Errorf("Acquire() while held = %v, %v, want no lease", lease, err)
+	}
+	acquire(t, store, "other key")
+
+	if err := store.Release(ctx, holder); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	acquire(t, store, "key")
+}
+
+// TestAcquireTakesOverAbandonedKey lets a lease expire without being extended. The key must be taken over, and the
+// abandoned lease must neither extend nor release its successor.
+func TestAcquireTakesOverAbandonedKey(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	abandoned := acquire(t, store, "key")
+
+	time.Sleep(testLeaseTTL + 10*time.Millisecond)
+	successor := acquire(t, store, "key")
+	if successor.Token == abandoned.Token {
+		t.Fatalf("successor shares the token of the abandoned lease")
+	}
+
+	if err := store.Extend(ctx, abandoned, testLeaseTTL); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Extend() of the abandoned lease error = %v, want %v", err, ErrLeaseLost)
+	}
+	if err := store.Release(ctx, abandoned); err != nil {
+		t.Fatalf("Release() of the abandoned lease error = %v", err)
+	}
+	if lease, _ := store.Acquire(ctx, "key", testLeaseTTL); lease != nil {
+		t.Errorf("the abandoned lease released its successor")
+	}
+
+	if err := store.Extend(ctx, successor, testLeaseTTL); err != nil {
+		t.Errorf("Extend() of the successor error = %v", err)
+	}
+}
+
+func TestExtendKeepsLease(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	lease := acquire(t, store, "key")
+
+	for range 3 {
+		time.Sleep(testLeaseTTL / 2)
+		if err := store.Extend(ctx, lease, testLeaseTTL); err != nil {
+			t.Fatalf("Extend() error = %v", err)
+		}
+	}
+	if other, _ := store.Acquire(ctx, "key", testLeaseTTL); other != nil {
+		t.Errorf("Acquire() took over a lease that was extended")
+	}
+}
+
+// TestKeepLease holds a lease through the middleware for several TTLs. It must be extended in the background until
+// released, and be free once it is.
+func TestKeepLease(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	m := NewMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil)), store, nil)
+
+	held := m.keepLease(ctx, "test", acquire(t, store, "key"), testLeaseTTL)
+	time.Sleep(3 * testLeaseTTL)
+	if lease, _ := store.Acquire(ctx, "key", testLeaseTTL); lease != nil {
+		t.Fatalf("Acquire() took over a lease the middleware kept")
+	}
+
+	held.stop()
+	if err := store.Release(ctx, held.Lease); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	acquire(t, store, "key")
+}
+
+func TestPublishReachesWaitingRequest(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	record := &Record{RecordKey: RecordKey{Key: "key"}, StatusCode: 200, Body: []byte(`{"success":true}`)}
+
+	published := make(chan *Record, 1)
+	go func() {
+		got, _ := store.HandleMultipleRequests(ctx, "key", time.Second)
+		published <- got
+	}()
+
+	// The waiting request subscribes asynchronously, so publish until it has the record.
+	for {
+		if err := store.Publish(ctx, "key", record); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		select {
+		case got := <-published:
+			if got == nil || got.StatusCode != record.StatusCode || string(got.Body) != string(record.Body) {
+				t.Fatalf("HandleMultipleRequests() = %+v, want %+v", got, record)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/utils"
+)
+
+const IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+// recordedBodyLocal holds the body set by RecordAs for the response being recorded.
+const recordedBodyLocal = "idempotency.recordedBody"
+
+// leaseWaitInterval is how long a duplicate request waits for published results before checking the lock again.
+const leaseWaitInterval = 5 * time.Second
+
+var errLeaseBusy = errors.New("idempotency key is still being processed by another request")
+
+// Middleware makes routes idempotent. Requests must carry an Idempotency-Key; the first request with a key runs the
+// handler while concurrent duplicates wait for its response, and later retries get the recorded response back.
+type Middleware struct {
+	logger  *slog.Logger
+	locks   IdempotencyStore
+	records RecordStore
+}
+
+type heldLease struct {
+	*Lease
+	stop context.CancelFunc
+}
+
+func NewMiddleware(logger *slog.Logger, locks IdempotencyStore, records RecordStore) *Middleware {
+	return &Middleware{
+		logger:  logger,
+		locks:   locks,
+		records: records,
+	}
+}
+
+// Handler is attached in front of a route's handler. The route path is the operation that records are kept under.
+func (m *Middleware) Handler() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		op := ctx.Route().Path
+
+		idempotencyKey := ctx.Get(IDEMPOTENCY_KEY_HEADER)
+		if len(idempotencyKey) == 0 {
+			m.logger.Error(fmt.Sprintf("[%s] request header Idempotency-Key is not supplied", op))
+			return utils.NewError(ctx, utils.NewAPIError(utils.ERR_MISSING_IDEMPOTENCY_KEY))
+		}
+		if err := uuid.Validate(idempotencyKey); err != nil {
+			m.logger.Error(fmt.Sprintf("[%s] request header Idempotency-Key '%s' is not valid", op, idempotencyKey))
+			return utils.NewError(ctx, utils.NewAPIError(utils.ERR_INVALID_IDEMPOTENCY_KEY))
+		}
+
+		key := RecordKey{
+			Key:       idempotencyKey,
+			Operation: op,
+			Caller:    ctx.Get(CALLER_ID_HEADER),
+		}
+		requestHash := HashRequest(ctx.Body())
+
+		lease, published, err := m.acquireLease(ctx, key)
+		if errors.Is(err, errLeaseBusy) {
+			m.logger.Error(fmt.Sprintf("[%s] idempotency key '%s' is still being processed", op, idempotencyKey))
+			return utils.NewError(ctx, utils.NewAPIError(utils.ERR_IDEMPOTENCY_KEY_IN_PROGRESS))
+		}
+		if err != nil {
+			m.logger.Error(fmt.Sprintf("[%s] error acquiring lock for idempotency key '%s' : %v", op, idempotencyKey, err))
+			return utils.NewError(ctx, err)
+		}
+		if lease == nil {
+			return m.replay(ctx, published, requestHash)
+		}
+
+		defer m.releaseLease(ctx, lease)
+
+		record, err := m.records.GetRecord(ctx.UserContext(), key)
+		if err == nil {
+			return m.replay(ctx, record, requestHash)
+		}
+		if !errors.Is(err, ErrRecordNotFound) {
+			m.logger.Error(fmt.Sprintf("[%s] error finding idempotency record for key '%s' : %v", op, idempotencyKey, err))
+			return utils.NewError(ctx, err)
+		}
+
+		if err = ctx.Next(); err != nil {
+			return err
+		}
+
+		m.record(ctx, key, requestHash, lease.Key)
+		return nil
+	}
+}
+
+// record keeps the response the handler just wrote, or the body it set with RecordAs, and hands it to waiting
+// duplicates. Server errors are neither recorded nor published, leaving duplicates and retries free to run the request
+// again.
+func (m *Middleware) record(ctx *fiber.Ctx, key RecordKey, requestHash string, lockKey string) {
+	now := time.Now()
+	record := &Record{
+		RecordKey:   key,
+		RequestHash: requestHash,
+		StatusCode:  ctx.Response().StatusCode(),
+		Body:        append([]byte(nil), ctx.Response().Body()...),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(RecordRetention()),
+	}
+	if record.StatusCode >= fiber.StatusInternalServerError {
+		return
+	}
+	if body, ok := ctx.Locals(recordedBodyLocal).([]byte); ok {
+		record.Body = body
+	}
+
+	if err := m.records.SaveRecord(ctx.UserContext(), record); err != nil {
+		m.logger.Error(fmt.Sprintf("[%s] unable to save idempotency record for key '%s' : %v", key.Operation, key.Key, err))
+	}
+
+	if err := m.locks.Publish(ctx.UserContext(), lockKey, record); err != nil {
+		m.logger.Error(fmt.Sprintf("[%s] unable to publish results for idempotency key '%s' : %v", key.Operation, key.Key, err))
+	}
+}
+
+// RecordAs has body recorded and replayed for the request in place of the response the handler writes, for a response
+// that holds what must not be stored, such as a secret shown only once.
+func RecordAs(ctx *fiber.Ctx, body []byte) {
+	ctx.Locals(recordedBodyLocal, body)
+}
+
+// replay answers with a recorded response byte for byte. A different request under the same key is rejected with 422.
+func (m *Middleware) replay(ctx *fiber.Ctx, record *Record, requestHash string) error {
+	if record.RequestHash != requestHash {
+		m.logger.Error(fmt.Sprintf("[%s] idempotency key '%s' was reused with a different request", record.Operation, record.Key))
+		return utils.NewError(ctx, utils.NewAPIError(utils.ERR_IDEMPOTENCY_KEY_REUSED))
+	}
+
+	m.logger.Info(fmt.Sprintf("[%s] replaying recorded response for idempotency key '%s'", record.Operation, record.Key))
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return ctx.Status(record.StatusCode).Send(record.Body)
+}
+
+// acquireLease takes the idempotency lock for a request and keeps extending it until released. When another request
+// holds the lock, it returns that request's published response instead. If none arrives, the lock is taken over once
+// its holder has released it or stopped extending it; errLeaseBusy is returned if the holder is still alive after
+// a full TTL.
+func (m *Middleware) acquireLease(ctx *fiber.Ctx, key RecordKey) (*heldLease, *Record, error) {
+	lockKey := fmt.Sprintf("%s_%s_%s", key.Key, key.Operation, key.Caller)
+	ttl := LockTTL()
+	deadline := time.Now().Add(ttl + leaseWaitInterval)
+
+	for {
+		lease, err := m.locks.Acquire(ctx.UserContext(), lockKey, ttl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if lease != nil {
+			return m.keepLease(ctx.UserContext(), key.Operation, lease, ttl), nil, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, nil, errLeaseBusy
+		}
+
+		published, err := m.locks.HandleMultipleRequests(ctx.UserContext(), lockKey, leaseWaitInterval)
+		if err == nil && published != nil {
+			m.logger.Info(fmt.Sprintf("[%s] multiple requests detected for '%s'", key.Operation, lockKey))
+			return nil, published, nil
+		}
+		m.logger.Info(fmt.Sprintf("[%s] no results yet for '%s', checking whether the lock was abandoned : %v", key.Operation, lockKey, err))
+	}
+}
+
+// keepLease extends the lease at a third of its TTL, so a slow request is not mistaken for an abandoned one.
+func (m *Middleware) keepLease(ctx context.Context, op string, lease *Lease, ttl time.Duration) *heldLease {
+	ctx, stop := context.WithCancel(context.WithoutCancel(ctx))
+
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.locks.Extend(ctx, lease, ttl); err != nil {
+					m.logger.Error(fmt.Sprintf("[%s] unable to extend lock for idempotency key '%s' : %v", op, lease.Key, err))
+					if errors.Is(err, ErrLeaseLost) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return &heldLease{
+		Lease: lease,
+		stop:  stop,
+	}
+}
+
+func (m *Middleware) releaseLease(ctx *fiber.Ctx, lease *heldLease) {
+	lease.stop()
+
+	if err := m.locks.Release(ctx.UserContext(), lease.Lease); err != nil {
+		m.logger.Error(fmt.Sprintf("error releasing lock for idempotency key '%s' : %v", lease.Key, err))
+	}
+}
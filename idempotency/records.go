@@ -0,0 +1,82 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	DEFAULT_RECORD_RETENTION = 24 * time.Hour
+	CALLER_ID_HEADER         = "X-Caller-Id"
+)
+
+var ErrRecordNotFound = errors.New("idempotency record not found")
+
+// RecordKey identifies a request: the same Idempotency-Key may be reused for a different operation or by a
+// different caller without the two colliding.
+type RecordKey struct {
+	Key       string
+	Operation string
+	Caller    string
+}
+
+// Record is the outcome of a finished request, kept so that retries get the original response back.
+type Record struct {
+	RecordKey
+	RequestHash string
+	StatusCode  int
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// RecordStore keeps idempotency records for as long as their retention lasts. GetRecord returns
+// ErrRecordNotFound for missing and expired records, and SaveRecord never replaces an unexpired one.
+type RecordStore interface {
+	GetRecord(ctx context.Context, key RecordKey) (*Record, error)
+	SaveRecord(ctx context.Context, record *Record) error
+	PurgeRecords(ctx context.Context, before time.Time) (int64, error)
+}
+
+// HashRequest fingerprints a request body so a replay can be told apart from a different request under the same key.
+func HashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordRetention is how long records are kept, configurable through IDEMPOTENCY_RECORD_RETENTION.
+func RecordRetention() time.Duration {
+	retention, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_RECORD_RETENTION"))
+	if err != nil || retention <= 0 {
+		return DEFAULT_RECORD_RETENTION
+	}
+	return retention
+}
+
+// PurgeExpiredRecords deletes expired records every interval until ctx is done.
+func PurgeExpiredRecords(ctx context.Context, logger *slog.Logger, records RecordStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := records.PurgeRecords(ctx, now)
+			if err != nil {
+				logger.Error(fmt.Sprintf("[PurgeExpiredRecords] unable to purge idempotency records : %v", err))
+				continue
+			}
+			if purged > 0 {
+				logger.Info(fmt.Sprintf("[PurgeExpiredRecords] purged %d expired idempotency records", purged))
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+const DEFAULT_LOCK_TTL = 30 * time.Second
+
+var ErrLeaseLost = errors.New("idempotency lock is no longer held by this lease")
+
+// IdempotencyStore coordinates requests that share an Idempotency-Key. The first request acquires a lease on the key
+// and publishes its response when done; concurrent duplicates wait for that response instead of running again.
+//
+// A lease expires unless it is extended, so a key whose holder died becomes free again after its TTL. Release and
+// Extend only act on the lease's own token, so a holder that lost its lease cannot disturb the next one.
+type IdempotencyStore interface {
+	// Acquire returns nil when another unexpired lease holds the key.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (*Lease, error)
+	Extend(ctx context.Context, lease *Lease, ttl time.Duration) error
+	Release(ctx context.Context, lease *Lease) error
+	Publish(ctx context.Context, key string, record *Record) error
+	HandleMultipleRequests(ctx context.Context, key string, timeout time.Duration) (*Record, error)
+}
+
+type Lease struct {
+	Key   string
+	Token string
+}
+
+// LockTTL is how long a lease lasts without being extended, configurable through IDEMPOTENCY_LOCK_TTL.
+func LockTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_LOCK_TTL"))
+	if err != nil || ttl <= 0 {
+		return DEFAULT_LOCK_TTL
+	}
+	return ttl
+}
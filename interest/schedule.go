@@ -0,0 +1,163 @@
+package interest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robinloh/wallet-backend/utils"
+	"github.com/shopspring/decimal"
+)
+
+// DAYS_PER_YEAR turns an annual rate into the rate earned for one day.
+const DAYS_PER_YEAR = 365
+
+// Tier is the annual rate of balances up to UpTo, or of every balance above the tier before it when UpTo is not set.
+type Tier struct {
+	UpTo decimal.NullDecimal `json:"up_to"`
+	Rate decimal.Decimal     `json:"rate"`
+}
+
+// Rate is the annual rate, as a fraction, savings balances in a currency earn from the UTC day EffectiveFrom until
+// a later rate takes over. An empty currency matches any. With Tiers, the whole balance earns the rate of the tier it
+// falls in.
+type Rate struct {
+	Currency      string          `json:"currency"`
+	EffectiveFrom string          `json:"effective_from"`
+	Rate          decimal.Decimal `json:"rate"`
+	Tiers         []Tier          `json:"tiers"`
+
+	effectiveFrom time.Time
+}
+
+// Schedule holds the interest rates over time. On a given day a balance earns the latest rate in effect for its
+// currency, and a rate for any currency only when there is none for its own.
+type Schedule struct {
+	rates []Rate
+}
+
+// NewSchedule loads interest rates from a JSON file holding a list of rates. An empty path yields a schedule that
+// pays nothing.
+func NewSchedule(path string) (*Schedule, error) {
+	schedule := &Schedule{
+		rates: make([]Rate, 0),
+	}
+
+	if len(path) == 0 {
+		return schedule, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read interest rates file '%s' : %v", path, err)
+	}
+
+	var rates []Rate
+	if err = json.Unmarshal(content, &rates); err != nil {
+		return nil, fmt.Errorf("unable to parse interest rates file '%s' : %v", path, err)
+	}
+
+	for _, rate := range rates {
+		rate.Currency = strings.ToUpper(rate.Currency)
+		if err = rate.validate(); err != nil {
+			return nil, fmt.Errorf("invalid interest rate for '%s' from '%s' : %v", rate.Currency, rate.EffectiveFrom, err)
+		}
+		schedule.rates = append(schedule.rates, rate)
+	}
+
+	return schedule, nil
+}
+
+func (s *Schedule) IsEmpty() bool {
+	return len(s.rates) == 0
+}
+
+// AnnualRate is the rate a balance in the currency earns on the UTC day of day. It is zero before the first rate
+// takes effect.
+func (s *Schedule) AnnualRate(currency string, balance decimal.Decimal, day time.Time) decimal.Decimal {
+	day = Day(day)
+
+	var match *Rate
+	for i := range s.rates {
+		rate := &s.rates[i]
+		if (len(rate.Currency) > 0 && rate.Currency != currency) || rate.effectiveFrom.After(day) {
+			continue
+		}
+
+		switch {
+		case match == nil:
+			match = rate
+		case len(rate.Currency) != len(match.Currency):
+			if len(rate.Currency) > 0 {
+				match = rate
+			}
+		case rate.effectiveFrom.After(match.effectiveFrom):
+			match = rate
+		}
+	}
+
+	if match == nil {
+		return decimal.Zero
+	}
+	return match.annualRate(balance)
+}
+
+// Daily is the interest a balance earns in one day at an annual rate. A balance that is not positive earns nothing.
+func Daily(balance decimal.Decimal, annualRate decimal.Decimal) decimal.Decimal {
+	if !balance.IsPositive() {
+		return decimal.Zero
+	}
+	return balance.Mul(annualRate).DivRound(decimal.NewFromInt(DAYS_PER_YEAR), 10)
+}
+
+// Day is the start of the UTC day of t.
+func Day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func (r *Rate) annualRate(balance decimal.Decimal) decimal.Decimal {
+	if len(r.Tiers) == 0 {
+		return r.Rate
+	}
+
+	for _, tier := range r.Tiers {
+		if tier.UpTo.Valid && balance.LessThanOrEqual(tier.UpTo.Decimal) {
+			return tier.Rate
+		}
+	}
+	return r.Tiers[len(r.Tiers)-1].Rate
+}
+
+func (r *Rate) validate() error {
+	if len(r.Currency) > 0 {
+		if _, err := utils.ParseCurrency(r.Currency); err != nil {
+			return err
+		}
+	}
+
+	effectiveFrom, err := time.Parse(time.DateOnly, r.EffectiveFrom)
+	if err != nil {
+		return fmt.Errorf("effective_from must be a date such as 2025-01-31")
+	}
+	r.effectiveFrom = effectiveFrom
+
+	if r.Rate.IsNegative() {
+		return fmt.Errorf("rate must not be negative")
+	}
+
+	for i, tier := range r.Tiers {
+		if tier.Rate.IsNegative() {
+			return fmt.Errorf("tier %d : rate must not be negative", i)
+		}
+		if !tier.UpTo.Valid && i < len(r.Tiers)-1 {
+			return fmt.Errorf("tier %d : only the last tier may leave up_to unset", i)
+		}
+		if i > 0 && tier.UpTo.Valid && !tier.UpTo.Decimal.GreaterThan(r.Tiers[i-1].UpTo.Decimal) {
+			return fmt.Errorf("tier %d : up_to must be above that of the tier before", i)
+		}
+	}
+
+	return nil
+}
@@ -4,35 +4,128 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/robinloh/wallet-backend/database"
+	"github.com/robinloh/wallet-backend/fees"
+	"github.com/robinloh/wallet-backend/fx"
 	"github.com/robinloh/wallet-backend/handlers"
+	"github.com/robinloh/wallet-backend/idempotency"
+	"github.com/robinloh/wallet-backend/interest"
 	"github.com/robinloh/wallet-backend/redis"
+	"github.com/robinloh/wallet-backend/utils"
 )
 
 func main() {
 	ctx := context.Background()
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	app := fiber.New()
+	// Request values are kept by the in-memory stores beyond the handler, so they must not alias fasthttp buffers.
+	app := fiber.New(fiber.Config{
+		Immutable:    true,
+		ErrorHandler: utils.ErrorHandler,
+	})
 
-	db := database.ConnectDb(ctx)
-	defer db.CloseDbConnection(ctx, logger)
+	var (
+		store   database.AccountStore
+		records idempotency.RecordStore
+	)
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		logger.Info("using in-memory account store")
+		memoryStore := database.NewMemoryStore()
+		store, records = memoryStore, memoryStore
+	} else {
+		db := database.ConnectDb(ctx)
+		defer db.CloseDbConnection(ctx, logger)
+		store, records = db, db
+	}
 
-	cache := redis.ConnectRedis(logger)
+	go idempotency.PurgeExpiredRecords(ctx, logger, records, time.Hour)
+	go database.ExpireHoldsPeriodically(ctx, logger, store, time.Minute)
+	if terms := database.OverdraftTermsFromEnv(); !terms.IsEmpty() {
+		go database.ChargeOverdraftsPeriodically(ctx, logger, store, terms, time.Hour)
+	}
 
-	handler := handlers.Initialize(logger, db, cache)
+	var idempotencyStore idempotency.IdempotencyStore
+	if os.Getenv("IDEMPOTENCY_BACKEND") == "memory" {
+		logger.Info("using in-memory idempotency store")
+		idempotencyStore = idempotency.NewMemoryStore()
+	} else {
+		idempotencyStore = redis.ConnectRedis(logger)
+	}
 
-	app.Post("v1/accounts", handler.CreateAccounts)
+	fxRates, err := fx.NewStaticRateProvider(os.Getenv("FX_RATES_FILE"))
+	if err != nil {
+		panic("unable to load fx rates : " + err.Error())
+	}
+
+	feeSchedule, err := fees.NewSchedule(os.Getenv("FEE_SCHEDULE_FILE"))
+	if err != nil {
+		panic("unable to load fee schedule : " + err.Error())
+	}
+
+	interestRates, err := interest.NewSchedule(os.Getenv("INTEREST_RATES_FILE"))
+	if err != nil {
+		panic("unable to load interest rates : " + err.Error())
+	}
+	if !interestRates.IsEmpty() {
+		go database.AccrueInterestPeriodically(ctx, logger, store, interestRates, time.Hour)
+	}
+
+	handler := handlers.Initialize(logger, store, fxRates, feeSchedule)
+	idempotent := idempotency.NewMiddleware(logger, idempotencyStore, records).Handler()
+
+	go handler.RunSchedulesPeriodically(ctx, 10*time.Second)
+	go handler.RunWebhookDeliveriesPeriodically(ctx, 5*time.Second)
+
+	app.Get("health", handler.HealthCheck)
+
+	app.Post("v1/accounts", idempotent, handler.CreateAccounts)
+	app.Get("v1/accounts", handler.FindAccounts)
 	app.Get("v1/accounts/:id", handler.GetAccountBalance)
+	app.Post("v1/accounts/:id/freeze", idempotent, handler.FreezeAccount)
+	app.Post("v1/accounts/:id/unfreeze", idempotent, handler.UnfreezeAccount)
+	app.Post("v1/accounts/:id/close", idempotent, handler.CloseAccount)
 
-	app.Post("v1/deposit", handler.Deposit)
-	app.Post("v1/withdraw", handler.Withdraw)
+	app.Post("v1/deposit", idempotent, handler.Deposit)
+	app.Post("v1/withdraw", idempotent, handler.Withdraw)
 
-	app.Post("v1/transfer", handler.Transfer)
+	app.Post("v1/transfer", idempotent, handler.Transfer)
+	app.Post("v1/transfers/batch", idempotent, handler.BatchTransfer)
+	app.Post("v1/transactions/:id/reverse", idempotent, handler.ReverseTransaction)
 
 	app.Get("v1/accounts/transactions/:account_id", handler.GetAccountTransactions)
+	app.Get("v1/accounts/ledger/:account_id", handler.GetAccountLedger)
+
+	app.Post("v1/fx/quotes", idempotent, handler.CreateFxQuote)
+	app.Get("v1/fees/quote", handler.GetFeeQuote)
+
+	app.Post("v1/holds", idempotent, handler.PlaceHold)
+	app.Get("v1/holds/:id", handler.GetHold)
+	app.Post("v1/holds/:id/capture", idempotent, handler.CaptureHold)
+	app.Post("v1/holds/:id/void", idempotent, handler.VoidHold)
+
+	app.Post("v1/schedules", idempotent, handler.CreateSchedule)
+	app.Get("v1/schedules", handler.ListSchedules)
+	app.Get("v1/schedules/:id", handler.GetSchedule)
+	app.Get("v1/schedules/:id/runs", handler.GetScheduleRuns)
+	app.Post("v1/schedules/:id/pause", idempotent, handler.PauseSchedule)
+	app.Post("v1/schedules/:id/resume", idempotent, handler.ResumeSchedule)
+	app.Post("v1/schedules/:id/cancel", idempotent, handler.CancelSchedule)
+
+	app.Get("v1/admin/limits", handler.GetLimits)
+	app.Put("v1/admin/limits", handler.SetLimits)
+	app.Put("v1/admin/accounts/:id/credit-limit", handler.SetCreditLimit)
+
+	app.Post("v1/webhooks", idempotent, handler.CreateWebhook)
+	app.Get("v1/webhooks", handler.ListWebhooks)
+	app.Get("v1/webhooks/:id", handler.GetWebhook)
+	app.Post("v1/webhooks/:id/disable", idempotent, handler.DisableWebhook)
+	app.Post("v1/webhooks/:id/enable", idempotent, handler.EnableWebhook)
+	app.Get("v1/webhooks/:id/deliveries", handler.ListWebhookDeliveries)
+	app.Get("v1/webhooks/:id/deliveries/:delivery_id", handler.GetWebhookDelivery)
+	app.Post("v1/webhooks/:id/deliveries/:delivery_id/redeliver", idempotent, handler.RedeliverWebhook)
 
 	_ = app.Listen(":8080")
 }
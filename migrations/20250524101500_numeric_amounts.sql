@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE accounts
+    ALTER COLUMN balance TYPE NUMERIC(38, 4) USING ROUND(balance::NUMERIC, 4),
+    ALTER COLUMN balance SET DEFAULT 0,
+    ALTER COLUMN balance SET NOT NULL;
+
+ALTER TABLE transactions
+    ALTER COLUMN amount TYPE NUMERIC(38, 4) USING ROUND(amount::NUMERIC, 4);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE transactions
+    ALTER COLUMN amount TYPE FLOAT8 USING amount::FLOAT8;
+
+ALTER TABLE accounts
+    ALTER COLUMN balance DROP NOT NULL,
+    ALTER COLUMN balance DROP DEFAULT,
+    ALTER COLUMN balance TYPE FLOAT8 USING balance::FLOAT8;
+-- +goose StatementEnd
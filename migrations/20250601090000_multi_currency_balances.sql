@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS balances
+(
+    account_id VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    currency   CHAR(3)        NOT NULL,
+    balance    NUMERIC(38, 4) NOT NULL DEFAULT 0,
+    PRIMARY KEY (account_id, currency)
+);
+
+INSERT INTO balances (account_id, currency, balance)
+SELECT id, 'USD', balance
+FROM accounts;
+
+ALTER TABLE accounts
+    DROP COLUMN balance;
+
+ALTER TABLE transactions
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE transactions
+    DROP COLUMN currency;
+
+ALTER TABLE accounts
+    ADD COLUMN balance NUMERIC(38, 4) NOT NULL DEFAULT 0;
+
+UPDATE accounts
+SET balance = b.balance
+FROM balances b
+WHERE b.account_id = accounts.id
+  AND b.currency = 'USD';
+
+DROP TABLE balances;
+-- +goose StatementEnd
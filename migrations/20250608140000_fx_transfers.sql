@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS fx_quotes
+(
+    id            VARCHAR(36) PRIMARY KEY,
+    from_currency CHAR(3)        NOT NULL,
+    to_currency   CHAR(3)        NOT NULL,
+    rate          NUMERIC(38, 18) NOT NULL,
+    spread        NUMERIC(10, 8)  NOT NULL,
+    expires_at    TIMESTAMPTZ     NOT NULL,
+    used_by       VARCHAR(36),
+    created_at    TIMESTAMPTZ     NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE transactions
+    ADD COLUMN fx_rate          NUMERIC(38, 18),
+    ADD COLUMN fx_spread        NUMERIC(10, 8),
+    ADD COLUMN counter_amount   NUMERIC(38, 4),
+    ADD COLUMN counter_currency CHAR(3),
+    ADD COLUMN quote_id         VARCHAR(36);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE transactions
+    DROP COLUMN quote_id,
+    DROP COLUMN counter_currency,
+    DROP COLUMN counter_amount,
+    DROP COLUMN fx_spread,
+    DROP COLUMN fx_rate;
+
+DROP TABLE fx_quotes;
+-- +goose StatementEnd
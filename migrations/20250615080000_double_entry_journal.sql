@@ -0,0 +1,105 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE accounts
+    ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO accounts (id, is_system)
+VALUES ('00000000-0000-0000-0000-000000000001', TRUE),
+       ('00000000-0000-0000-0000-000000000002', TRUE)
+ON CONFLICT (id) DO UPDATE SET is_system = TRUE;
+
+CREATE TABLE IF NOT EXISTS journal_entries
+(
+    id         VARCHAR(36) PRIMARY KEY,
+    txn_id     VARCHAR(36) NOT NULL,
+    operation  TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS journal_entries_txn_id_idx ON journal_entries (txn_id);
+
+CREATE TABLE IF NOT EXISTS postings
+(
+    id            BIGSERIAL PRIMARY KEY,
+    entry_id      VARCHAR(36)    NOT NULL REFERENCES journal_entries (id),
+    account_id    VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    currency      CHAR(3)        NOT NULL,
+    amount        NUMERIC(38, 4) NOT NULL CHECK (amount <> 0),
+    balance_after NUMERIC(38, 4) NOT NULL,
+    created_at    TIMESTAMPTZ    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS postings_entry_id_idx ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id, currency, id);
+
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF EXISTS (SELECT 1
+               FROM postings
+               WHERE entry_id = NEW.entry_id
+               GROUP BY currency
+               HAVING SUM(amount) <> 0) THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT
+    ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+EXECUTE FUNCTION check_journal_entry_balanced();
+
+ALTER TABLE transactions
+    ADD COLUMN entry_id VARCHAR(36) REFERENCES journal_entries (id);
+
+-- Open the journal with one entry per existing balance so that every balance is explained by its postings.
+CREATE TEMPORARY TABLE opening_entries ON COMMIT DROP AS
+SELECT gen_random_uuid()::TEXT AS id, account_id, currency, balance
+FROM balances
+WHERE balance <> 0;
+
+INSERT INTO journal_entries (id, txn_id, operation)
+SELECT id, id, 'opening'
+FROM opening_entries;
+
+INSERT INTO balances (account_id, currency, balance)
+SELECT '00000000-0000-0000-0000-000000000001', currency, -SUM(balance)
+FROM opening_entries
+GROUP BY currency;
+
+INSERT INTO postings (entry_id, account_id, currency, amount, balance_after)
+SELECT id, account_id, currency, balance, balance
+FROM opening_entries
+UNION ALL
+SELECT id, '00000000-0000-0000-0000-000000000001', currency, -balance, SUM(-balance) OVER (PARTITION BY currency ORDER BY id)
+FROM opening_entries;
+
+CREATE VIEW ledger_balances AS
+SELECT account_id, currency, SUM(amount) AS balance
+FROM postings
+GROUP BY account_id, currency;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP VIEW ledger_balances;
+
+ALTER TABLE transactions
+    DROP COLUMN entry_id;
+
+DROP TRIGGER postings_balanced ON postings;
+DROP FUNCTION check_journal_entry_balanced();
+
+DROP TABLE postings;
+DROP TABLE journal_entries;
+
+DELETE FROM balances WHERE account_id IN ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000002');
+DELETE FROM accounts WHERE id IN ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000002');
+
+ALTER TABLE accounts
+    DROP COLUMN is_system;
+-- +goose StatementEnd
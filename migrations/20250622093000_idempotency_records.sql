@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idempotency_records
+(
+    idempotency_key VARCHAR(36) NOT NULL,
+    operation       VARCHAR(64) NOT NULL,
+    caller          VARCHAR(255) NOT NULL DEFAULT '',
+    request_hash    CHAR(64)    NOT NULL,
+    status_code     INTEGER     NOT NULL,
+    response_body   BYTEA       NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (idempotency_key, operation, caller)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_records_expires_at_idx ON idempotency_records (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idempotency_records;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'capture';
+
+CREATE TABLE IF NOT EXISTS holds
+(
+    id              VARCHAR(36) PRIMARY KEY,
+    account_id      VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    currency        CHAR(3)        NOT NULL,
+    amount          NUMERIC(38, 4) NOT NULL CHECK (amount > 0),
+    captured_amount NUMERIC(38, 4) NOT NULL DEFAULT 0,
+    status          VARCHAR(16)    NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'captured', 'voided', 'expired')),
+    capture_txn_id  VARCHAR(36),
+    expires_at      TIMESTAMPTZ    NOT NULL,
+    created_at      TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS holds_active_idx ON holds (account_id, currency) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE holds;
+-- enum values cannot be dropped, so 'capture' stays on txntype.
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'reversal_debit';
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'reversal_credit';
+
+ALTER TABLE transactions
+    ADD COLUMN reverses_id     VARCHAR(36),
+    ADD COLUMN reversed_amount NUMERIC(38, 4) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS transactions_reverses_id_idx ON transactions (reverses_id) WHERE reverses_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX transactions_reverses_id_idx;
+
+ALTER TABLE transactions
+    DROP COLUMN reversed_amount,
+    DROP COLUMN reverses_id;
+-- enum values cannot be dropped, so the reversal types stay on txntype.
+-- +goose StatementEnd
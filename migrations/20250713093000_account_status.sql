@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE accounts
+    ADD COLUMN status            VARCHAR(16) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'frozen', 'closed')),
+    ADD COLUMN status_reason     TEXT,
+    ADD COLUMN freeze_credits    BOOLEAN     NOT NULL DEFAULT FALSE,
+    ADD COLUMN status_updated_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS account_status_changes
+(
+    id          BIGSERIAL PRIMARY KEY,
+    account_id  VARCHAR(36) NOT NULL REFERENCES accounts (id),
+    from_status VARCHAR(16) NOT NULL,
+    to_status   VARCHAR(16) NOT NULL,
+    reason      TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS account_status_changes_account_id_idx ON account_status_changes (account_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE account_status_changes;
+
+ALTER TABLE accounts
+    DROP COLUMN status_updated_at,
+    DROP COLUMN freeze_credits,
+    DROP COLUMN status_reason,
+    DROP COLUMN status;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE accounts
+    ADD COLUMN owner_id     VARCHAR(64),
+    ADD COLUMN account_type VARCHAR(16)  NOT NULL DEFAULT 'checking'
+        CHECK (account_type IN ('checking', 'savings', 'business')),
+    ADD COLUMN display_name VARCHAR(128),
+    ADD COLUMN metadata     JSONB        NOT NULL DEFAULT '{}',
+    ADD COLUMN created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS accounts_owner_id_idx ON accounts (owner_id);
+CREATE INDEX IF NOT EXISTS accounts_metadata_idx ON accounts USING GIN (metadata jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS accounts_metadata_idx;
+DROP INDEX IF EXISTS accounts_owner_id_idx;
+
+ALTER TABLE accounts
+    DROP COLUMN created_at,
+    DROP COLUMN metadata,
+    DROP COLUMN display_name,
+    DROP COLUMN account_type,
+    DROP COLUMN owner_id;
+-- +goose StatementEnd
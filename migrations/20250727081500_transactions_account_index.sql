@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS transactions_account_id_timestamp_idx ON transactions (account_id, timestamp, id, txntype);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transactions_account_id_timestamp_idx;
+-- +goose StatementEnd
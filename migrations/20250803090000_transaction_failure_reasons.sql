@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE transactions
+    ADD COLUMN failure_reason VARCHAR(32)
+        CHECK (failure_reason IN ('insufficient_funds', 'destination_not_found'));
+
+-- Failed withdrawals and transfers of existing accounts were refused for want of funds, unless the receiver of a
+-- transfer was missing.
+UPDATE transactions t
+SET failure_reason = CASE
+    WHEN t.txntype = 'sender' AND NOT EXISTS (SELECT 1 FROM accounts r WHERE r.id = t.receiver_id)
+        THEN 'destination_not_found'
+    ELSE 'insufficient_funds'
+END
+WHERE t.status = 'failed'
+  AND t.txntype IN ('withdraw', 'sender')
+  AND EXISTS (SELECT 1 FROM accounts a WHERE a.id = t.account_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE transactions
+    DROP COLUMN failure_reason;
+-- +goose StatementEnd
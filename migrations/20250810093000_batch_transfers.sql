@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE transactions
+    ADD COLUMN batch_id  VARCHAR(36),
+    ADD COLUMN reference VARCHAR(140);
+
+CREATE INDEX IF NOT EXISTS transactions_batch_id_idx ON transactions (batch_id) WHERE batch_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX transactions_batch_id_idx;
+
+ALTER TABLE transactions
+    DROP COLUMN reference,
+    DROP COLUMN batch_id;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS transfer_schedules
+(
+    id              VARCHAR(36) PRIMARY KEY,
+    from_account_id VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    to_account_id   VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    amount          NUMERIC(38, 4) NOT NULL CHECK (amount > 0),
+    currency        CHAR(3)        NOT NULL,
+    reference       VARCHAR(140),
+    every_seconds   BIGINT CHECK (every_seconds > 0),
+    cron            VARCHAR(128),
+    start_at        TIMESTAMPTZ    NOT NULL,
+    end_at          TIMESTAMPTZ,
+    status          VARCHAR(16)    NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'paused', 'cancelled', 'completed')),
+    next_run_at     TIMESTAMPTZ,
+    occurrence      INT            NOT NULL DEFAULT 1,
+    attempt         INT            NOT NULL DEFAULT 1,
+    locked_until    TIMESTAMPTZ,
+    last_run_at     TIMESTAMPTZ,
+    last_status     VARCHAR(16),
+    last_error      VARCHAR(64),
+    created_at      TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    CHECK (every_seconds IS NULL OR cron IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS transfer_schedules_due_idx ON transfer_schedules (next_run_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS transfer_schedules_from_idx ON transfer_schedules (from_account_id);
+CREATE INDEX IF NOT EXISTS transfer_schedules_to_idx ON transfer_schedules (to_account_id);
+
+-- Every attempt at an occurrence of a schedule, and the transaction it ran as.
+CREATE TABLE IF NOT EXISTS transfer_schedule_runs
+(
+    schedule_id  VARCHAR(36) NOT NULL REFERENCES transfer_schedules (id),
+    occurrence   INT         NOT NULL,
+    attempt      INT         NOT NULL,
+    txn_id       VARCHAR(36) NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    status       VARCHAR(16) NOT NULL CHECK (status IN ('completed', 'failed')),
+    error        VARCHAR(64),
+    ran_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (schedule_id, occurrence, attempt)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE transfer_schedule_runs;
+DROP TABLE transfer_schedules;
+-- +goose StatementEnd
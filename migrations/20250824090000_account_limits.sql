@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Limits of one account, or of every account of a type, in one currency. A limit left NULL does not apply, and the
+-- limits of an account fall back one by one to those of its type.
+CREATE TABLE IF NOT EXISTS account_limits
+(
+    id                BIGSERIAL PRIMARY KEY,
+    account_id        VARCHAR(36) REFERENCES accounts (id),
+    account_type      VARCHAR(16) CHECK (account_type IN ('checking', 'savings', 'business')),
+    currency          CHAR(3)     NOT NULL,
+    max_single_amount NUMERIC(38, 4) CHECK (max_single_amount >= 0),
+    daily_amount      NUMERIC(38, 4) CHECK (daily_amount >= 0),
+    monthly_amount    NUMERIC(38, 4) CHECK (monthly_amount >= 0),
+    daily_count       INT CHECK (daily_count >= 0),
+    monthly_count     INT CHECK (monthly_count >= 0),
+    max_balance       NUMERIC(38, 4) CHECK (max_balance >= 0),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((account_id IS NULL) <> (account_type IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS account_limits_account_idx
+    ON account_limits (account_id, currency) WHERE account_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS account_limits_account_type_idx
+    ON account_limits (account_type, currency) WHERE account_type IS NOT NULL;
+
+-- Outgoing totals are summed over the recent withdrawals and transfers of an account.
+CREATE INDEX IF NOT EXISTS transactions_outgoing_idx
+    ON transactions (account_id, currency, timestamp) WHERE txntype IN ('withdraw', 'sender') AND status = 'completed';
+
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_failure_reason_check,
+    ADD CONSTRAINT transactions_failure_reason_check
+        CHECK (failure_reason IN ('insufficient_funds', 'destination_not_found', 'limit_single_amount',
+                                  'limit_daily_amount', 'limit_monthly_amount', 'limit_daily_count',
+                                  'limit_monthly_count', 'limit_max_balance'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE transactions
+SET failure_reason = NULL
+WHERE failure_reason LIKE 'limit\_%';
+
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_failure_reason_check,
+    ADD CONSTRAINT transactions_failure_reason_check
+        CHECK (failure_reason IN ('insufficient_funds', 'destination_not_found'));
+
+DROP INDEX IF EXISTS transactions_outgoing_idx;
+DROP TABLE IF EXISTS account_limits;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'overdraft_charge';
+
+-- How far below zero the balance may be debited.
+ALTER TABLE balances
+    ADD COLUMN credit_limit NUMERIC(38, 4) NOT NULL DEFAULT 0 CHECK (credit_limit >= 0);
+
+INSERT INTO accounts (id, is_system)
+VALUES ('00000000-0000-0000-0000-000000000003', TRUE)
+ON CONFLICT (id) DO UPDATE SET is_system = TRUE;
+
+CREATE INDEX IF NOT EXISTS balances_overdrawn_idx ON balances (account_id, currency) WHERE balance < 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS balances_overdrawn_idx;
+
+ALTER TABLE balances
+    DROP COLUMN credit_limit;
+-- The revenue account keeps the charges already posted to it, so it stays, and enum values cannot be dropped, so
+-- 'overdraft_charge' stays on txntype.
+-- +goose StatementEnd
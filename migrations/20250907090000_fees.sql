@@ -0,0 +1,8 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A fee is recorded as its own line under the ID of the transaction it was charged for.
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'fee';
+-- +goose StatementEnd
+
+-- +goose Down
+-- enum values cannot be dropped, so 'fee' stays on txntype.
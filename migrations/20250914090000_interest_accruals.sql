@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE txntype ADD VALUE IF NOT EXISTS 'interest';
+
+INSERT INTO accounts (id, is_system)
+VALUES ('00000000-0000-0000-0000-000000000004', TRUE)
+ON CONFLICT (id) DO UPDATE SET is_system = TRUE;
+
+-- One row per savings balance and day. The amount is kept unrounded until it is paid by the interest transaction
+-- txn_id.
+CREATE TABLE IF NOT EXISTS interest_accruals
+(
+    account_id   VARCHAR(36)    NOT NULL REFERENCES accounts (id),
+    currency     CHAR(3)        NOT NULL,
+    accrual_date DATE           NOT NULL,
+    balance      NUMERIC(38, 4) NOT NULL,
+    annual_rate  NUMERIC(12, 8) NOT NULL CHECK (annual_rate >= 0),
+    amount       NUMERIC(38, 10) NOT NULL CHECK (amount >= 0),
+    txn_id       VARCHAR(36),
+    created_at   TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, currency, accrual_date)
+);
+
+CREATE INDEX IF NOT EXISTS interest_accruals_unposted_idx
+    ON interest_accruals (account_id, currency, accrual_date) WHERE txn_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE interest_accruals;
+-- The interest account keeps the payments already posted from it, so it stays, and enum values cannot be dropped, so
+-- 'interest' stays on txntype.
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id          VARCHAR(36) PRIMARY KEY,
+    url         TEXT        NOT NULL,
+    event_types TEXT[]      NOT NULL CHECK (cardinality(event_types) > 0),
+    secret      TEXT        NOT NULL,
+    status      VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Events are only kept while some webhook subscribes to them, as the payload their deliveries send.
+CREATE TABLE IF NOT EXISTS webhook_events
+(
+    id         VARCHAR(36) PRIMARY KEY,
+    type       VARCHAR(64) NOT NULL,
+    payload    JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              VARCHAR(36) PRIMARY KEY,
+    webhook_id      VARCHAR(36) NOT NULL REFERENCES webhooks (id),
+    event_id        VARCHAR(36) NOT NULL REFERENCES webhook_events (id),
+    event_type      VARCHAR(64) NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead_letter')),
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_attempt_at TIMESTAMPTZ,
+    last_status     INT,
+    last_error      TEXT,
+    redelivery_of   VARCHAR(36) REFERENCES webhook_deliveries (id),
+    locked_until    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC);
+
+-- Every attempt at a delivery and how the webhook answered it. A status code is only kept when there was an answer.
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts
+(
+    delivery_id  VARCHAR(36) NOT NULL REFERENCES webhook_deliveries (id),
+    attempt      INT         NOT NULL,
+    status_code  INT,
+    error        TEXT,
+    attempted_at TIMESTAMPTZ NOT NULL,
+    duration_ms  BIGINT      NOT NULL,
+    PRIMARY KEY (delivery_id, attempt)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webhook_delivery_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_events;
+DROP TABLE webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An operation posts a single journal entry, so a transaction ID can never move money twice for the same operation.
+ALTER TABLE journal_entries
+    ADD CONSTRAINT journal_entries_txn_id_operation_key UNIQUE (txn_id, operation);
+
+DROP INDEX IF EXISTS journal_entries_txn_id_idx;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS journal_entries_txn_id_idx ON journal_entries (txn_id);
+
+ALTER TABLE journal_entries
+    DROP CONSTRAINT journal_entries_txn_id_operation_key;
+-- +goose StatementEnd
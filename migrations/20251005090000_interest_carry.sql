@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An interest payment is rounded down to the currency, and what it leaves is carried into the next payment as an
+-- accrual of its own, dated the last day the payment covered.
+ALTER TABLE interest_accruals
+    ADD COLUMN carried BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE interest_accruals
+    DROP CONSTRAINT interest_accruals_pkey,
+    ADD PRIMARY KEY (account_id, currency, accrual_date, carried);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- The remainders still carried are lost with the column.
+DELETE FROM interest_accruals WHERE carried;
+
+ALTER TABLE interest_accruals
+    DROP CONSTRAINT interest_accruals_pkey,
+    ADD PRIMARY KEY (account_id, currency, accrual_date);
+
+ALTER TABLE interest_accruals
+    DROP COLUMN carried;
+-- +goose StatementEnd
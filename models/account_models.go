@@ -1,18 +1,63 @@
 package models
 
-type AccountRequestHeader struct {
-	IdempotencyKey string `reqHeader:"Idempotency-Key"`
-}
-
+// AccountRequest creates Count accounts sharing the details given alongside it, or one account for each entry of
+// Accounts.
 type AccountRequest struct {
 	Count int `json:"count"`
+	AccountDetails
+	Accounts []AccountDetails `json:"accounts"`
+}
+
+type AccountDetails struct {
+	OwnerID     string            `json:"owner_id"`
+	AccountType string            `json:"account_type"`
+	DisplayName string            `json:"display_name"`
+	Metadata    map[string]string `json:"metadata"`
 }
 
 type AccountResponse struct {
-	ID      string `json:"id"`
-	Balance string `json:"balance"`
+	ID            string            `json:"id"`
+	Status        string            `json:"status"`
+	StatusReason  string            `json:"status_reason,omitempty"`
+	FreezeCredits bool              `json:"freeze_credits,omitempty"`
+	OwnerID       string            `json:"owner_id,omitempty"`
+	AccountType   string            `json:"account_type"`
+	DisplayName   string            `json:"display_name,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Balances      []BalanceResponse `json:"balances"`
+}
+
+type FindAccountsRequest struct {
+	OwnerID  string
+	Metadata map[string]string
+	Limit    int
+}
+
+// BalanceResponse reports the ledger balance and what remains available of it after active holds. A balance with a
+// credit limit also reports the limit and how much of it is left.
+type BalanceResponse struct {
+	Currency        string `json:"currency"`
+	Available       string `json:"available"`
+	Ledger          string `json:"ledger"`
+	CreditLimit     string `json:"credit_limit,omitempty"`
+	RemainingCredit string `json:"remaining_credit,omitempty"`
+}
+
+type CreditLimitRequest struct {
+	AccountID   string `json:"-"`
+	Currency    string `json:"currency"`
+	CreditLimit string `json:"credit_limit"`
 }
 
 type GetAccountBalanceRequest struct {
 	Id string `json:"id"`
 }
+
+// AccountStatusRequest freezes, unfreezes or closes an account. FreezeCredits only applies to freezing, and
+// SweepTo only to closing, naming the account that receives whatever balance is left.
+type AccountStatusRequest struct {
+	AccountID     string `json:"-"`
+	Reason        string `json:"reason"`
+	FreezeCredits bool   `json:"freeze_credits"`
+	SweepTo       string `json:"sweep_to"`
+}
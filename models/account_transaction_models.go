@@ -2,17 +2,43 @@ package models
 
 import "time"
 
+// AccountTransactionsRequest is read from the query string of the transaction history endpoint.
 type AccountTransactionsRequest struct {
-	AccountID string `json:"account_id"`
+	AccountID    string   `json:"account_id"`
+	Cursor       string   `query:"cursor"`
+	Limit        int      `query:"limit"`
+	Order        string   `query:"order"`
+	From         string   `query:"from"`
+	To           string   `query:"to"`
+	TxnTypes     []string `query:"txntype"`
+	Statuses     []string `query:"status"`
+	Counterparty string   `query:"counterparty"`
+	Currency     string   `query:"currency"`
+	MinAmount    string   `query:"min_amount"`
+	MaxAmount    string   `query:"max_amount"`
+	IncludeTotal bool     `query:"include_total"`
 }
 
 type AccountTransactionsResponse struct {
 	TransactionID string    `json:"transaction_id"`
 	AccountID     string    `json:"account_id"`
-	Amount        float64   `json:"amount"`
+	Amount        string    `json:"amount"`
+	Currency      string    `json:"currency"`
 	TxnType       string    `json:"txntype"`
 	SenderID      string    `json:"sender_id"`
 	ReceiverID    string    `json:"receiver_id"`
 	Timestamp     time.Time `json:"timestamp"`
 	Status        string    `json:"status"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+
+	CounterAmount   string `json:"counter_amount,omitempty"`
+	CounterCurrency string `json:"counter_currency,omitempty"`
+	FxRate          string `json:"fx_rate,omitempty"`
+	FxSpread        string `json:"fx_spread,omitempty"`
+
+	ReversesTransactionID string `json:"reverses_transaction_id,omitempty"`
+	ReversedAmount        string `json:"reversed_amount,omitempty"`
+
+	BatchID   string `json:"batch_id,omitempty"`
+	Reference string `json:"reference,omitempty"`
 }
@@ -1,22 +1,28 @@
 package models
 
+import "github.com/shopspring/decimal"
+
 type DepositRequestHeader struct {
 	IdempotencyKey string `reqHeader:"Idempotency-Key"`
 }
 
 type DepositRequest struct {
-	ID     string `json:"id"`
-	Amount string `json:"amount"`
+	ID       string `json:"id"`
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
 }
 
 type Deposit struct {
-	ID     string  `json:"id"`
-	Amount float64 `json:"amount"`
+	ID       string          `json:"id"`
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
 }
 
 type DepositResponse struct {
-	AccountID     string  `json:"account_id"`
-	Amount        float64 `json:"amount"`
-	Status        string  `json:"status"`
-	TransactionID string  `json:"transaction_id"`
+	AccountID     string `json:"account_id"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	TransactionID string `json:"transaction_id"`
+	Fee           string `json:"fee,omitempty"`
 }
@@ -0,0 +1,19 @@
+package models
+
+type FeeQuoteRequest struct {
+	Operation string `query:"operation"`
+	AccountID string `query:"account_id"`
+	Amount    string `query:"amount"`
+	Currency  string `query:"currency"`
+}
+
+// FeeQuoteResponse prices an operation. Total is what the account is debited for a withdrawal or a transfer, and
+// what it is credited for a deposit.
+type FeeQuoteResponse struct {
+	Operation string `json:"operation"`
+	AccountID string `json:"account_id"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	Fee       string `json:"fee"`
+	Total     string `json:"total"`
+}
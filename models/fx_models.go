@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type FxQuoteRequest struct {
+	FromCurrency string `json:"from_currency"`
+	ToCurrency   string `json:"to_currency"`
+	Amount       string `json:"amount"`
+}
+
+type FxQuoteResponse struct {
+	QuoteID       string    `json:"quote_id"`
+	FromCurrency  string    `json:"from_currency"`
+	ToCurrency    string    `json:"to_currency"`
+	Rate          string    `json:"rate"`
+	Spread        string    `json:"spread"`
+	EffectiveRate string    `json:"effective_rate"`
+	Amount        string    `json:"amount,omitempty"`
+	ToAmount      string    `json:"to_amount,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
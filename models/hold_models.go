@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type HoldRequestHeader struct {
+	IdempotencyKey string `reqHeader:"Idempotency-Key"`
+}
+
+type HoldRequest struct {
+	AccountID string `json:"account_id"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+type Hold struct {
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  string
+	ExpiresAt time.Time
+}
+
+type CaptureHoldRequestHeader struct {
+	IdempotencyKey string `reqHeader:"Idempotency-Key"`
+}
+
+type CaptureHoldRequest struct {
+	Amount string `json:"amount"`
+}
+
+type HoldResponse struct {
+	HoldID         string    `json:"hold_id"`
+	AccountID      string    `json:"account_id"`
+	Amount         string    `json:"amount"`
+	CapturedAmount string    `json:"captured_amount,omitempty"`
+	Currency       string    `json:"currency"`
+	Status         string    `json:"status"`
+	TransactionID  string    `json:"transaction_id,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type AccountLedgerRequest struct {
+	AccountID string `json:"account_id"`
+}
+
+type LedgerPostingResponse struct {
+	EntryID       string    `json:"entry_id"`
+	TransactionID string    `json:"transaction_id"`
+	Operation     string    `json:"operation"`
+	Currency      string    `json:"currency"`
+	Amount        string    `json:"amount"`
+	BalanceAfter  string    `json:"balance_after"`
+	Timestamp     time.Time `json:"timestamp"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type GetLimitsRequest struct {
+	AccountID   string
+	AccountType string
+}
+
+// SetLimitsRequest replaces the limits of an account, or of every account of a type, in one currency. A limit left
+// out does not apply; leaving every limit out removes them.
+type SetLimitsRequest struct {
+	AccountID       string `json:"account_id"`
+	AccountType     string `json:"account_type"`
+	Currency        string `json:"currency"`
+	MaxSingleAmount string `json:"max_single_amount"`
+	DailyAmount     string `json:"daily_amount"`
+	MonthlyAmount   string `json:"monthly_amount"`
+	DailyCount      *int   `json:"daily_count"`
+	MonthlyCount    *int   `json:"monthly_count"`
+	MaxBalance      string `json:"max_balance"`
+}
+
+type SetLimits struct {
+	AccountID       string
+	AccountType     string
+	Currency        string
+	MaxSingleAmount decimal.NullDecimal
+	DailyAmount     decimal.NullDecimal
+	MonthlyAmount   decimal.NullDecimal
+	DailyCount      *int
+	MonthlyCount    *int
+	MaxBalance      decimal.NullDecimal
+}
+
+type LimitsResponse struct {
+	AccountID       string     `json:"account_id,omitempty"`
+	AccountType     string     `json:"account_type,omitempty"`
+	Currency        string     `json:"currency"`
+	MaxSingleAmount *string    `json:"max_single_amount"`
+	DailyAmount     *string    `json:"daily_amount"`
+	MonthlyAmount   *string    `json:"monthly_amount"`
+	DailyCount      *int       `json:"daily_count"`
+	MonthlyCount    *int       `json:"monthly_count"`
+	MaxBalance      *string    `json:"max_balance"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
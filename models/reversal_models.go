@@ -0,0 +1,10 @@
+package models
+
+type ReverseTransactionRequestHeader struct {
+	IdempotencyKey string `reqHeader:"Idempotency-Key"`
+}
+
+type ReverseTransactionRequest struct {
+	TransactionID string `json:"-"`
+	Amount        string `json:"amount"`
+}
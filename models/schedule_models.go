@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type ScheduleRequestHeader struct {
+	IdempotencyKey string `reqHeader:"Idempotency-Key"`
+}
+
+// ScheduleRequest creates a transfer schedule. Without Every or Cron it runs once at RunAt; with one of them it
+// recurs from RunAt, or from now, until EndAt.
+type ScheduleRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	Reference string `json:"reference"`
+	RunAt     string `json:"run_at"`
+	Every     string `json:"every"`
+	Cron      string `json:"cron"`
+	EndAt     string `json:"end_at"`
+}
+
+type Schedule struct {
+	From      string
+	To        string
+	Amount    decimal.Decimal
+	Currency  string
+	Reference string
+	Every     time.Duration
+	Cron      string
+	StartAt   time.Time
+	EndAt     time.Time
+}
+
+type ListSchedulesRequest struct {
+	AccountID string
+	Status    string
+	Limit     int
+}
+
+type ScheduleResponse struct {
+	ScheduleID string     `json:"schedule_id"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Amount     string     `json:"amount"`
+	Currency   string     `json:"currency"`
+	Reference  string     `json:"reference,omitempty"`
+	Every      string     `json:"every,omitempty"`
+	Cron       string     `json:"cron,omitempty"`
+	StartAt    time.Time  `json:"start_at"`
+	EndAt      *time.Time `json:"end_at,omitempty"`
+	Status     string     `json:"status"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ScheduleRunResponse struct {
+	Occurrence    int       `json:"occurrence"`
+	Attempt       int       `json:"attempt"`
+	TransactionID string    `json:"transaction_id"`
+	ScheduledAt   time.Time `json:"scheduled_at"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	RanAt         time.Time `json:"ran_at"`
+}
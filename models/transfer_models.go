@@ -1,25 +1,91 @@
 package models
 
+import "github.com/shopspring/decimal"
+
 type TransferRequestHeader struct {
 	IdempotencyKey string `reqHeader:"Idempotency-Key"`
 }
 
 type TransferRequest struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Amount string `json:"amount"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Amount     string `json:"amount"`
+	Currency   string `json:"currency"`
+	ToCurrency string `json:"to_currency"`
+	Convert    bool   `json:"convert"`
+	QuoteID    string `json:"quote_id"`
 }
 
 type Transfer struct {
-	From   string  `json:"from"`
-	To     string  `json:"to"`
-	Amount float64 `json:"amount"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Amount     decimal.Decimal `json:"amount"`
+	Currency   string          `json:"currency"`
+	ToCurrency string          `json:"to_currency"`
+	Convert    bool            `json:"convert"`
+	QuoteID    string          `json:"quote_id"`
+	Reference  string          `json:"reference"`
 }
 
 type TransferResponse struct {
-	From          string  `json:"from"`
-	To            string  `json:"to"`
-	Amount        float64 `json:"amount"`
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+	Fee           string `json:"fee,omitempty"`
+
+	ToAmount   string `json:"to_amount,omitempty"`
+	ToCurrency string `json:"to_currency,omitempty"`
+	FxRate     string `json:"fx_rate,omitempty"`
+	FxSpread   string `json:"fx_spread,omitempty"`
+	QuoteID    string `json:"quote_id,omitempty"`
+}
+
+type BatchTransferRequest struct {
+	Mode      string                    `json:"mode"`
+	Transfers []BatchTransferLegRequest `json:"transfers"`
+}
+
+type BatchTransferLegRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	Reference string `json:"reference"`
+}
+
+type BatchTransfer struct {
+	Mode string
+	Legs []BatchTransferLeg
+}
+
+type BatchTransferLeg struct {
+	From      string
+	To        string
+	Amount    decimal.Decimal
+	Currency  string
+	Reference string
+}
+
+type BatchTransferResponse struct {
+	BatchID   string                     `json:"batch_id"`
+	Mode      string                     `json:"mode"`
+	Status    string                     `json:"status"`
+	Transfers []BatchTransferLegResponse `json:"transfers"`
+}
+
+// BatchTransferLegResponse is the outcome of one leg. A failed leg names the error it failed with.
+type BatchTransferLegResponse struct {
+	Index         int    `json:"index"`
+	TransactionID string `json:"transaction_id"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+	Reference     string `json:"reference,omitempty"`
+	Status        string `json:"status"`
+	ErrorCode     int    `json:"error_code,omitempty"`
+	Error         string `json:"error,omitempty"`
 }
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookRequestHeader struct {
+	IdempotencyKey string `reqHeader:"Idempotency-Key"`
+}
+
+// WebhookRequest subscribes URL to the events of EventTypes. A secret is generated when Secret is not given.
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+type ListWebhookDeliveriesRequest struct {
+	WebhookID string
+	Status    string
+	Limit     int
+}
+
+// WebhookResponse describes a webhook. The secret is only given back when the webhook is created.
+type WebhookResponse struct {
+	WebhookID  string    `json:"webhook_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	DeliveryID    string          `json:"delivery_id"`
+	WebhookID     string          `json:"webhook_id"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatus    int             `json:"last_status_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	RedeliveryOf  string          `json:"redelivery_of,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type WebhookAttemptResponse struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// WebhookEventPayload is the body of every delivery. Data is the transaction as the transaction history reports it,
+// or a WebhookAccountEvent.
+type WebhookEventPayload struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type WebhookAccountEvent struct {
+	AccountID     string `json:"account_id"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason,omitempty"`
+	FreezeCredits bool   `json:"freeze_credits,omitempty"`
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"log/slog"
+	"os"
 	"sync"
 
 	"github.com/gomodule/redigo/redis"
@@ -12,17 +13,24 @@ type Redis struct {
 	Logger    *slog.Logger
 }
 
+const DEFAULT_REDIS_ADDR = "redis:6379"
+
 var (
 	redisInstance *Redis
 	redisOnce     sync.Once
 )
 
 func ConnectRedis(logger *slog.Logger) *Redis {
+	addr := os.Getenv("REDIS_ADDR")
+	if len(addr) == 0 {
+		addr = DEFAULT_REDIS_ADDR
+	}
+
 	redisOnce.Do(func() {
 		redisInstance = &Redis{
 			RedisPool: &redis.Pool{
 				Dial: func() (redis.Conn, error) {
-					conn, err := redis.Dial("tcp", "redis:6379")
+					conn, err := redis.Dial("tcp", addr)
 					if err != nil {
 						return nil, err
 					}
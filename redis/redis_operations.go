@@ -3,35 +3,85 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
 	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"github.com/robinloh/wallet-backend/idempotency"
 )
 
-func (r *Redis) Acquire(conn redis.Conn, key string) (bool, error) {
-	return redis.Bool(conn.Do("SETNX", key, "lock"))
+// releaseScript and extendScript only touch the key while it still holds the caller's token.
+var (
+	releaseScript = redis.NewScript(1, `
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("DEL", KEYS[1])
+		end
+		return 0`)
+
+	extendScript = redis.NewScript(1, `
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		end
+		return 0`)
+)
+
+func (r *Redis) Acquire(_ context.Context, key string, ttl time.Duration) (*idempotency.Lease, error) {
+	conn := r.RedisPool.Get()
+	defer r.closeConn(conn, key)
+
+	lease := &idempotency.Lease{
+		Key:   key,
+		Token: uuid.NewString(),
+	}
+
+	_, err := redis.String(conn.Do("SET", key, lease.Token, "NX", "PX", ttl.Milliseconds()))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
 }
 
-func (r *Redis) Release(conn redis.Conn, key string, shouldRelease bool) error {
-	var err error
-	if shouldRelease {
-		_, err = conn.Do("DEL", key)
+func (r *Redis) Extend(_ context.Context, lease *idempotency.Lease, ttl time.Duration) error {
+	conn := r.RedisPool.Get()
+	defer r.closeConn(conn, lease.Key)
+
+	extended, err := redis.Int(extendScript.Do(conn, lease.Key, lease.Token, ttl.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return idempotency.ErrLeaseLost
 	}
+	return nil
+}
+
+func (r *Redis) Release(_ context.Context, lease *idempotency.Lease) error {
+	conn := r.RedisPool.Get()
+	defer r.closeConn(conn, lease.Key)
+
+	_, err := releaseScript.Do(conn, lease.Key, lease.Token)
 	return err
 }
 
-func (r *Redis) Publish(conn redis.Conn, key string, results fiber.Map) error {
-	byteResults, err := json.Marshal(results)
+func (r *Redis) Publish(_ context.Context, key string, record *idempotency.Record) error {
+	byteResults, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
+
+	conn := r.RedisPool.Get()
+	defer r.closeConn(conn, key)
+
 	_, err = conn.Do("PUBLISH", key, byteResults)
 	return err
 }
 
-func (r *Redis) HandleMultipleRequests(ctx context.Context, redisKey string, timeout time.Duration) (fiber.Map, error) {
+func (r *Redis) HandleMultipleRequests(ctx context.Context, redisKey string, timeout time.Duration) (*idempotency.Record, error) {
 	type resCh struct {
 		res []byte
 		ch  string
@@ -39,12 +89,7 @@ func (r *Redis) HandleMultipleRequests(ctx context.Context, redisKey string, tim
 	}
 
 	conn := r.RedisPool.Get()
-	defer func(conn redis.Conn) {
-		err := conn.Close()
-		if err != nil {
-			r.Logger.Error(fmt.Sprintf("Error closing connection for redis pool (for redisKey : %s)", redisKey))
-		}
-	}(conn)
+	defer r.closeConn(conn, redisKey)
 
 	psc := redis.PubSubConn{Conn: conn}
 	ch := make(chan resCh, 1)
@@ -95,12 +140,20 @@ func (r *Redis) HandleMultipleRequests(ctx context.Context, redisKey string, tim
 			return nil, res.err
 		}
 
-		var results fiber.Map
-		err := json.Unmarshal(res.res, &results)
+		record := new(idempotency.Record)
+		err := json.Unmarshal(res.res, record)
 		if err != nil {
 			r.Logger.Info(fmt.Sprintf("Error while unmarshalling response from key '%s' : %+v", redisKey, err))
+			return nil, err
 		}
 
-		return results, nil
+		return record, nil
+	}
+}
+
+func (r *Redis) closeConn(conn redis.Conn, redisKey string) {
+	err := conn.Close()
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Error closing connection for redis pool (for redisKey : %s)", redisKey))
 	}
 }
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CRON_SEARCH_YEARS bounds how far ahead Next looks, enough to reach the next 29 February.
+const CRON_SEARCH_YEARS = 5
+
+var ErrCronNeverRuns = errors.New("cron expression matches no time")
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month, month and day of week. Every field
+// takes '*', a value, a range 'a-b', a step '*/n' or 'a-b/n', or a comma separated list of those. As in Vixie cron,
+// a time matches when either restricted day field matches. Times are matched in UTC.
+type Cron struct {
+	expr    string
+	minutes cronField
+	hours   cronField
+	days    cronField
+	months  cronField
+	weekday cronField
+
+	daysRestricted    bool
+	weekdayRestricted bool
+}
+
+type cronField uint64
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+var cronBounds = [5]struct{ min, max int }{
+	{0, 59},
+	{0, 23},
+	{1, 31},
+	{1, 12},
+	{0, 7},
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronBounds) {
+		return nil, fmt.Errorf("cron expression '%s' must have %d fields", expr, len(cronBounds))
+	}
+
+	var parsed [5]cronField
+	for i, field := range fields {
+		var err error
+		parsed[i], err = parseCronField(field, cronBounds[i].min, cronBounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression '%s' : %w", expr, err)
+		}
+	}
+
+	// Sunday is both 0 and 7.
+	if parsed[4].has(7) {
+		parsed[4] |= 1
+	}
+
+	c := &Cron{
+		expr:              strings.Join(fields, " "),
+		minutes:           parsed[0],
+		hours:             parsed[1],
+		days:              parsed[2],
+		months:            parsed[3],
+		weekday:           parsed[4],
+		daysRestricted:    !strings.HasPrefix(fields[2], "*"),
+		weekdayRestricted: !strings.HasPrefix(fields[4], "*"),
+	}
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w : '%s'", ErrCronNeverRuns, expr)
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (cronField, error) {
+	var parsed cronField
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+
+		from, to := min, max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+
+			var err error
+			if from, err = strconv.Atoi(lo); err != nil {
+				return 0, fmt.Errorf("'%s' is not a number", lo)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(hi); err != nil {
+					return 0, fmt.Errorf("'%s' is not a number", hi)
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("'%s' is outside %d-%d", part, min, max)
+		}
+
+		every := 1
+		if hasStep {
+			var err error
+			if every, err = strconv.Atoi(step); err != nil || every < 1 {
+				return 0, fmt.Errorf("'%s' is not a valid step", step)
+			}
+		}
+
+		for value := from; value <= to; value += every {
+			parsed |= 1 << uint(value)
+		}
+	}
+
+	return parsed, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next is the first time after t that the expression matches, or the zero time when there is none within
+// CRON_SEARCH_YEARS.
+func (c *Cron) Next(t time.Time) time.Time {
+	next := t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(CRON_SEARCH_YEARS, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case !c.months.has(int(next.Month())):
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.hours.has(next.Hour()):
+			next = next.Truncate(time.Hour).Add(time.Hour)
+		case !c.minutes.has(next.Minute()):
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	day := c.days.has(t.Day())
+	weekday := c.weekday.has(int(t.Weekday()))
+
+	if c.daysRestricted && c.weekdayRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
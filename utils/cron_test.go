@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr error
+		invalid bool
+	}{
+		{name: "every minute", expr: "* * * * *", want: "* * * * *"},
+		{name: "extra spaces", expr: " 0  9 * *   1-5 ", want: "0 9 * * 1-5"},
+		{name: "lists, ranges and steps", expr: "0,30 8-18/2 1,15 */3 *", want: "0,30 8-18/2 1,15 */3 *"},
+		{name: "sunday as seven", expr: "0 0 * * 7", want: "0 0 * * 7"},
+		{name: "too few fields", expr: "* * * *", invalid: true},
+		{name: "too many fields", expr: "* * * * * *", invalid: true},
+		{name: "minute out of range", expr: "60 * * * *", invalid: true},
+		{name: "hour out of range", expr: "* 24 * * *", invalid: true},
+		{name: "day of month out of range", expr: "* * 0 * *", invalid: true},
+		{name: "month out of range", expr: "* * * 13 *", invalid: true},
+		{name: "day of week out of range", expr: "* * * * 8", invalid: true},
+		{name: "backwards range", expr: "5-1 * * * *", invalid: true},
+		{name: "zero step", expr: "*/0 * * * *", invalid: true},
+		{name: "not a number", expr: "a * * * *", invalid: true},
+		{name: "range end not a number", expr: "1-x * * * *", invalid: true},
+		{name: "never runs", expr: "0 0 30 2 *", wantErr: ErrCronNeverRuns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+
+			switch {
+			case tt.wantErr != nil || tt.invalid:
+				if err == nil {
+					t.Fatalf("ParseCron(%q) = %s, want an error", tt.expr, cron)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseCron(%q) error = %v, want %v", tt.expr, err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			case cron.String() != tt.want:
+				t.Errorf("ParseCron(%q) = %s, want %s", tt.expr, cron, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 1 January 2025 is a Wednesday.
+	wednesday := time.Date(2025, time.January, 1, 0, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", after: wednesday, want: time.Date(2025, time.January, 1, 0, 1, 0, 0, time.UTC)},
+		{name: "strictly after a match", expr: "* * * * *", after: time.Date(2025, time.January, 1, 0, 1, 0, 0, time.UTC), want: time.Date(2025, time.January, 1, 0, 2, 0, 0, time.UTC)},
+		{name: "daily", expr: "30 9 * * *", after: wednesday, want: time.Date(2025, time.January, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "daily after it ran", expr: "30 9 * * *", after: time.Date(2025, time.January, 1, 9, 30, 0, 0, time.UTC), want: time.Date(2025, time.January, 2, 9, 30, 0, 0, time.UTC)},
+		{name: "step", expr: "*/15 * * * *", after: wednesday, want: time.Date(2025, time.January, 1, 0, 15, 0, 0, time.UTC)},
+		{name: "stepped range", expr: "0 8-18/4 * * *", after: time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC), want: time.Date(2025, time.January, 1, 16, 0, 0, 0, time.UTC)},
+		{name: "monthly", expr: "0 0 1 * *", after: wednesday, want: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "skips short months", expr: "0 12 31 * *", after: time.Date(2025, time.January, 31, 13, 0, 0, 0, time.UTC), want: time.Date(2025, time.March, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "year rollover", expr: "0 0 1 1 *", after: time.Date(2025, time.December, 31, 23, 59, 0, 0, time.UTC), want: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expr: "0 0 29 2 *", after: wednesday, want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "weekdays", expr: "0 9 * * 1-5", after: time.Date(2025, time.January, 3, 10, 0, 0, 0, time.UTC), want: time.Date(2025, time.January, 6, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as zero", expr: "0 9 * * 0", after: wednesday, want: time.Date(2025, time.January, 5, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as seven", expr: "0 9 * * 7", after: wednesday, want: time.Date(2025, time.January, 5, 9, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week", expr: "0 9 13 * 5", after: wednesday, want: time.Date(2025, time.January, 3, 9, 0, 0, 0, time.UTC)},
+		{name: "day of month or day of week by date", expr: "0 9 2 * 5", after: wednesday, want: time.Date(2025, time.January, 2, 9, 0, 0, 0, time.UTC)},
+		{name: "day of month and any day of week", expr: "0 9 13 * *", after: wednesday, want: time.Date(2025, time.January, 13, 9, 0, 0, 0, time.UTC)},
+		{name: "in UTC", expr: "0 9 * * *", after: time.Date(2025, time.January, 1, 10, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)), want: time.Date(2025, time.January, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after.Format(time.RFC3339), got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
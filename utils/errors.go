@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode identifies a failure for clients. Codes are stable: a code keeps its meaning and status once released.
+type ErrorCode int
+
+// FieldError points at a request field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is a failure to report to the client: a code from the catalog and, for validation failures, the fields
+// at fault. Extensions are reported as further members of the body, such as the transaction a failure was recorded
+// as.
+type APIError struct {
+	Code       ErrorCode
+	Details    []FieldError
+	Extensions map[string]any
+}
+
+type errorEntry struct {
+	status  int
+	name    string
+	message string
+}
+
+const (
+	ERR_ACCOUNT_FROZEN        ErrorCode = 1001
+	ERR_ACCOUNT_CLOSED        ErrorCode = 1002
+	ERR_ACCOUNT_NOT_EMPTY     ErrorCode = 1003
+	ERR_INVALID_STATUS_CHANGE ErrorCode = 1004
+	ERR_ACCOUNT_NOT_FOUND     ErrorCode = 1005
+	ERR_INSUFFICIENT_FUNDS    ErrorCode = 1006
+	ERR_DESTINATION_NOT_FOUND ErrorCode = 1007
+	ERR_LIMIT_EXCEEDED        ErrorCode = 1008
+
+	ERR_MALFORMED_REQUEST           ErrorCode = 2001
+	ERR_VALIDATION_FAILED           ErrorCode = 2002
+	ERR_MISSING_IDEMPOTENCY_KEY     ErrorCode = 2003
+	ERR_INVALID_IDEMPOTENCY_KEY     ErrorCode = 2004
+	ERR_IDEMPOTENCY_KEY_IN_PROGRESS ErrorCode = 2005
+	ERR_IDEMPOTENCY_KEY_REUSED      ErrorCode = 2006
+
+	ERR_TRANSACTION_NOT_FOUND     ErrorCode = 3001
+	ERR_NOT_REVERSIBLE            ErrorCode = 3002
+	ERR_ALREADY_REVERSED          ErrorCode = 3003
+	ERR_REVERSAL_EXCEEDS_ORIGINAL ErrorCode = 3004
+	ERR_AMOUNT_TOO_SMALL          ErrorCode = 3005
+
+	ERR_HOLD_NOT_FOUND       ErrorCode = 4001
+	ERR_HOLD_NOT_ACTIVE      ErrorCode = 4002
+	ERR_CAPTURE_EXCEEDS_HOLD ErrorCode = 4003
+
+	ERR_FX_RATE_UNAVAILABLE  ErrorCode = 5001
+	ERR_FX_QUOTE_UNAVAILABLE ErrorCode = 5002
+
+	ERR_SCHEDULE_NOT_FOUND      ErrorCode = 6001
+	ERR_INVALID_SCHEDULE_CHANGE ErrorCode = 6002
+
+	ERR_WEBHOOK_NOT_FOUND          ErrorCode = 7001
+	ERR_WEBHOOK_DELIVERY_NOT_FOUND ErrorCode = 7002
+	ERR_WEBHOOK_DISABLED           ErrorCode = 7003
+
+	ERR_ROUTE_NOT_FOUND     ErrorCode = 9001
+	ERR_METHOD_NOT_ALLOWED  ErrorCode = 9002
+	ERR_SERVICE_UNAVAILABLE ErrorCode = 9003
+	ERR_INTERNAL            ErrorCode = 9999
+)
+
+var errorCatalog = map[ErrorCode]errorEntry{
+	ERR_ACCOUNT_FROZEN:        {http.StatusConflict, "account_frozen", "The account is frozen."},
+	ERR_ACCOUNT_CLOSED:        {http.StatusConflict, "account_closed", "The account is closed."},
+	ERR_ACCOUNT_NOT_EMPTY:     {http.StatusConflict, "account_not_empty", "The account still has a balance or active holds."},
+	ERR_INVALID_STATUS_CHANGE: {http.StatusConflict, "invalid_status_change", "The account status cannot be changed this way."},
+	ERR_ACCOUNT_NOT_FOUND:     {http.StatusNotFound, "account_not_found", "The account does not exist."},
+	ERR_INSUFFICIENT_FUNDS:    {http.StatusUnprocessableEntity, "insufficient_funds", "The available balance does not cover the amount."},
+	ERR_DESTINATION_NOT_FOUND: {http.StatusNotFound, "destination_not_found", "The account to credit does not exist."},
+	ERR_LIMIT_EXCEEDED:        {http.StatusUnprocessableEntity, "limit_exceeded", "The transaction exceeds a limit set on the account."},
+
+	ERR_MALFORMED_REQUEST:           {http.StatusBadRequest, "malformed_request", "The request body or query could not be parsed."},
+	ERR_VALIDATION_FAILED:           {http.StatusBadRequest, "validation_failed", "One or more request fields are invalid."},
+	ERR_MISSING_IDEMPOTENCY_KEY:     {http.StatusBadRequest, "missing_idempotency_key", "The Idempotency-Key header is required."},
+	ERR_INVALID_IDEMPOTENCY_KEY:     {http.StatusBadRequest, "invalid_idempotency_key", "The Idempotency-Key header must be a UUID."},
+	ERR_IDEMPOTENCY_KEY_IN_PROGRESS: {http.StatusConflict, "idempotency_key_in_progress", "A request with this Idempotency-Key is still being processed."},
+	ERR_IDEMPOTENCY_KEY_REUSED:      {http.StatusUnprocessableEntity, "idempotency_key_reused", "The Idempotency-Key was already used with a different request."},
+
+	ERR_TRANSACTION_NOT_FOUND:     {http.StatusNotFound, "transaction_not_found", "The transaction does not exist."},
+	ERR_NOT_REVERSIBLE:            {http.StatusUnprocessableEntity, "not_reversible", "Only completed deposits, withdrawals, transfers and captures can be reversed."},
+	ERR_ALREADY_REVERSED:          {http.StatusConflict, "already_reversed", "The transaction has already been fully reversed."},
+	ERR_REVERSAL_EXCEEDS_ORIGINAL: {http.StatusUnprocessableEntity, "reversal_exceeds_original", "The amount exceeds what is left of the original transaction."},
+	ERR_AMOUNT_TOO_SMALL:          {http.StatusUnprocessableEntity, "amount_too_small", "The amount converts to nothing in the other currency."},
+
+	ERR_HOLD_NOT_FOUND:       {http.StatusNotFound, "hold_not_found", "The hold does not exist."},
+	ERR_HOLD_NOT_ACTIVE:      {http.StatusConflict, "hold_not_active", "The hold has already been captured, voided or has expired."},
+	ERR_CAPTURE_EXCEEDS_HOLD: {http.StatusUnprocessableEntity, "capture_exceeds_hold", "The capture amount exceeds the held amount."},
+
+	ERR_FX_RATE_UNAVAILABLE:  {http.StatusUnprocessableEntity, "fx_rate_unavailable", "No exchange rate is available for the currency pair."},
+	ERR_FX_QUOTE_UNAVAILABLE: {http.StatusUnprocessableEntity, "fx_quote_unavailable", "The fx quote is unknown, expired, already used or for other currencies."},
+
+	ERR_SCHEDULE_NOT_FOUND:      {http.StatusNotFound, "schedule_not_found", "The transfer schedule does not exist."},
+	ERR_INVALID_SCHEDULE_CHANGE: {http.StatusConflict, "invalid_schedule_change", "The transfer schedule cannot be paused, resumed or cancelled from its current status."},
+
+	ERR_WEBHOOK_NOT_FOUND:          {http.StatusNotFound, "webhook_not_found", "The webhook does not exist."},
+	ERR_WEBHOOK_DELIVERY_NOT_FOUND: {http.StatusNotFound, "webhook_delivery_not_found", "The webhook delivery does not exist for the webhook."},
+	ERR_WEBHOOK_DISABLED:           {http.StatusConflict, "webhook_disabled", "The webhook is disabled."},
+
+	ERR_ROUTE_NOT_FOUND:     {http.StatusNotFound, "route_not_found", "No endpoint matches the request path."},
+	ERR_METHOD_NOT_ALLOWED:  {http.StatusMethodNotAllowed, "method_not_allowed", "The endpoint does not accept this method."},
+	ERR_SERVICE_UNAVAILABLE: {http.StatusServiceUnavailable, "service_unavailable", "The service cannot reach its database."},
+	ERR_INTERNAL:            {http.StatusInternalServerError, "internal_error", "The request could not be completed."},
+}
+
+func NewAPIError(code ErrorCode, details ...FieldError) *APIError {
+	return &APIError{
+		Code:    code,
+		Details: details,
+	}
+}
+
+// Invalid reports a validation failure of one request field.
+func Invalid(field string, message string) *APIError {
+	return NewAPIError(ERR_VALIDATION_FAILED, FieldError{Field: field, Message: message})
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s : %s", e.Name(), e.Message())
+}
+
+func (e *APIError) Status() int {
+	return e.entry().status
+}
+
+func (e *APIError) Name() string {
+	return e.entry().name
+}
+
+func (e *APIError) Message() string {
+	return e.entry().message
+}
+
+func (e *APIError) entry() errorEntry {
+	entry, ok := errorCatalog[e.Code]
+	if !ok {
+		return errorCatalog[ERR_INTERNAL]
+	}
+	return entry
+}
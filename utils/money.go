@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DEFAULT_CURRENCY = "USD"
+
+	// MAX_AMOUNT_DIGITS mirrors the integer part of the NUMERIC(38, 4) money columns.
+	MAX_AMOUNT_DIGITS = 34
+)
+
+var (
+	ErrInvalidCurrency   = errors.New("invalid currency")
+	ErrInvalidAmount     = errors.New("invalid amount")
+	ErrAmountScale       = errors.New("amount has too many decimal places")
+	ErrAmountOutOfRange  = errors.New("amount is out of range")
+	ErrAmountNotPositive = errors.New("amount is not greater than zero")
+)
+
+// currencyScales holds the number of minor unit digits for each supported ISO 4217 currency.
+var currencyScales = map[string]int32{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"PHP": 2,
+	"SGD": 2,
+	"THB": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+func CurrencyScale(currency string) (int32, bool) {
+	scale, ok := currencyScales[strings.ToUpper(currency)]
+	return scale, ok
+}
+
+// ParseCurrency normalises an ISO 4217 currency code, falling back to DEFAULT_CURRENCY when it is empty.
+func ParseCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) == 0 {
+		return DEFAULT_CURRENCY, nil
+	}
+	if _, ok := currencyScales[currency]; !ok {
+		return "", fmt.Errorf("%w : '%s' is not supported", ErrInvalidCurrency, currency)
+	}
+	return currency, nil
+}
+
+// ParseAmount parses a positive decimal amount and rejects it if it carries more
+// decimal places than the currency allows, instead of rounding it.
+func ParseAmount(amount string, currency string) (decimal.Decimal, error) {
+	scale, ok := CurrencyScale(currency)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w : unsupported currency '%s'", ErrInvalidAmount, currency)
+	}
+
+	d, err := decimal.NewFromString(strings.TrimSpace(amount))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%w : '%s'", ErrInvalidAmount, amount)
+	}
+
+	if !d.Equal(d.Truncate(scale)) {
+		return decimal.Zero, fmt.Errorf("%w : '%s' exceeds %d decimal places for %s", ErrAmountScale, amount, scale, currency)
+	}
+
+	if !d.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%w : '%s'", ErrAmountNotPositive, amount)
+	}
+
+	if len(d.Truncate(0).String()) > MAX_AMOUNT_DIGITS {
+		return decimal.Zero, fmt.Errorf("%w : '%s'", ErrAmountOutOfRange, amount)
+	}
+
+	return d.Truncate(scale), nil
+}
+
+// FormatAmount renders an amount with exactly the number of decimal places of its currency.
+func FormatAmount(amount decimal.Decimal, currency string) string {
+	scale, ok := CurrencyScale(currency)
+	if !ok {
+		return amount.String()
+	}
+	return amount.StringFixed(scale)
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseAmount(t *testing.T) {
+	largest := strings.Repeat("9", MAX_AMOUNT_DIGITS)
+
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     string
+		wantErr  error
+	}{
+		{name: "whole amount", amount: "100", currency: "USD", want: "100"},
+		{name: "cents", amount: "10.25", currency: "USD", want: "10.25"},
+		{name: "surrounding spaces", amount: " 10.25 ", currency: "USD", want: "10.25"},
+		{name: "trailing zeros past the scale", amount: "10.2500", currency: "USD", want: "10.25"},
+		{name: "three decimals", amount: "1.234", currency: "KWD", want: "1.234"},
+		{name: "no decimals", amount: "500", currency: "JPY", want: "500"},
+		{name: "smallest unit", amount: "0.01", currency: "USD", want: "0.01"},
+		{name: "largest amount", amount: largest + ".99", currency: "USD", want: largest + ".99"},
+		{name: "too many decimals", amount: "10.001", currency: "USD", wantErr: ErrAmountScale},
+		{name: "decimals in a currency without", amount: "500.5", currency: "JPY", wantErr: ErrAmountScale},
+		{name: "four decimals in a currency of three", amount: "1.2345", currency: "BHD", wantErr: ErrAmountScale},
+		{name: "zero", amount: "0", currency: "USD", wantErr: ErrAmountNotPositive},
+		{name: "negative", amount: "-10", currency: "USD", wantErr: ErrAmountNotPositive},
+		{name: "too many digits", amount: "1" + largest, currency: "USD", wantErr: ErrAmountOutOfRange},
+		{name: "not a number", amount: "ten", currency: "USD", wantErr: ErrInvalidAmount},
+		{name: "empty", amount: "", currency: "USD", wantErr: ErrInvalidAmount},
+		{name: "unsupported currency", amount: "10", currency: "XYZ", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAmount(tt.amount, tt.currency)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseAmount(%q, %s) = %s, %v, want %v", tt.amount, tt.currency, got, err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("ParseAmount(%q, %s) error = %v", tt.amount, tt.currency, err)
+			case !got.Equal(decimal.RequireFromString(tt.want)):
+				t.Errorf("ParseAmount(%q, %s) = %s, want %s", tt.amount, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     string
+	}{
+		{name: "two decimals", amount: "10", currency: "USD", want: "10.00"},
+		{name: "two decimals padded", amount: "10.5", currency: "EUR", want: "10.50"},
+		{name: "three decimals", amount: "1.2", currency: "KWD", want: "1.200"},
+		{name: "no decimals", amount: "500", currency: "JPY", want: "500"},
+		{name: "lower case currency", amount: "10", currency: "usd", want: "10.00"},
+		{name: "negative", amount: "-2.5", currency: "USD", want: "-2.50"},
+		{name: "unsupported currency", amount: "10.5", currency: "XYZ", want: "10.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatAmount(decimal.RequireFromString(tt.amount), tt.currency); got != tt.want {
+				t.Errorf("FormatAmount(%s, %s) = %s, want %s", tt.amount, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+		wantErr  error
+	}{
+		{name: "upper case", currency: "EUR", want: "EUR"},
+		{name: "lower case with spaces", currency: " sgd ", want: "SGD"},
+		{name: "empty falls back", currency: "", want: DEFAULT_CURRENCY},
+		{name: "unsupported", currency: "XYZ", wantErr: ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCurrency(tt.currency)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("ParseCurrency(%q) = %s, %v, want %s, %v", tt.currency, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,17 +1,66 @@
 package utils
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-func NewError(ctx *fiber.Ctx, errStatus int, errMsgs ...int) error {
+const (
+	MIME_PROBLEM_JSON = "application/problem+json"
+
+	// PROBLEM_TYPE_PREFIX is prepended to the error name to form the RFC 7807 problem type.
+	PROBLEM_TYPE_PREFIX = "urn:wallet-backend:error:"
+)
+
+// NewError answers the request with err, which is expected to be an *APIError; anything else is reported as an
+// internal error without exposing its text. Clients that accept application/problem+json get an RFC 7807
+// problem document instead of the usual envelope. The extensions of err are added to either, without replacing its
+// members.
+func NewError(ctx *fiber.Ctx, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = NewAPIError(ERR_INTERNAL)
+	}
+
+	details := apiErr.Details
+	if details == nil {
+		details = make([]FieldError, 0)
+	}
+
+	if strings.Contains(ctx.Get(fiber.HeaderAccept), MIME_PROBLEM_JSON) {
+		return ctx.
+			Status(apiErr.Status()).
+			JSON(withExtensions(fiber.Map{
+				"type":     PROBLEM_TYPE_PREFIX + apiErr.Name(),
+				"title":    apiErr.Message(),
+				"status":   apiErr.Status(),
+				"code":     apiErr.Code,
+				"instance": ctx.Path(),
+				"errors":   details,
+			}, apiErr.Extensions), MIME_PROBLEM_JSON)
+	}
+
 	return ctx.
-		Status(errStatus).
-		JSON(fiber.Map{
+		Status(apiErr.Status()).
+		JSON(withExtensions(fiber.Map{
 			"success": false,
-			"error":   errStatus,
-			"message": errMsgs,
-		})
+			"error":   apiErr.Status(),
+			"code":    apiErr.Code,
+			"name":    apiErr.Name(),
+			"message": apiErr.Message(),
+			"details": details,
+		}, apiErr.Extensions))
+}
+
+func withExtensions(body fiber.Map, extensions map[string]any) fiber.Map {
+	for member, value := range extensions {
+		if _, ok := body[member]; !ok {
+			body[member] = value
+		}
+	}
+	return body
 }
 
 func NewSuccess(ctx *fiber.Ctx, details fiber.Map) error {
@@ -20,3 +69,19 @@ func NewSuccess(ctx *fiber.Ctx, details fiber.Map) error {
 		Status(fiber.StatusOK).
 		JSON(details)
 }
+
+// ErrorHandler answers errors that reach Fiber itself, such as unknown routes, from the same catalog.
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		switch fiberErr.Code {
+		case fiber.StatusNotFound:
+			return NewError(ctx, NewAPIError(ERR_ROUTE_NOT_FOUND))
+		case fiber.StatusMethodNotAllowed:
+			return NewError(ctx, NewAPIError(ERR_METHOD_NOT_ALLOWED))
+		case fiber.StatusBadRequest, fiber.StatusRequestEntityTooLarge:
+			return NewError(ctx, NewAPIError(ERR_MALFORMED_REQUEST))
+		}
+	}
+	return NewError(ctx, err)
+}
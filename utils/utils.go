@@ -13,6 +13,7 @@ const (
 const (
 	FAILED    = "failed"
 	COMPLETED = "completed"
+	PARTIAL   = "partial"
 )
 
 func GenerateTxnID() (string, error) {
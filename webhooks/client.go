@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const DEFAULT_TIMEOUT = 10 * time.Second
+
+// Delivery is one attempt at sending an event to a subscriber.
+type Delivery struct {
+	ID        string
+	EventType string
+	URL       string
+	Secret    string
+	Payload   []byte
+}
+
+// Client posts signed deliveries to subscribers. Unless it allows private hosts, it refuses to connect to any address
+// that is not public.
+type Client struct {
+	http              *http.Client
+	allowPrivateHosts bool
+}
+
+func NewClient() *Client {
+	allowPrivateHosts := AllowPrivateHosts()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivateHosts {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   refusePrivateAddress,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &Client{
+		http: &http.Client{
+			Timeout:   Timeout(),
+			Transport: transport,
+		},
+		allowPrivateHosts: allowPrivateHosts,
+	}
+}
+
+// Timeout is how long a subscriber has to answer a delivery, configurable through WEBHOOK_TIMEOUT.
+func Timeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return DEFAULT_TIMEOUT
+	}
+	return timeout
+}
+
+// Send posts the payload to the subscriber, signed with its secret at now. It returns the status code of the
+// answer, and an error when there was none or it was not a 2xx.
+func (c *Client) Send(ctx context.Context, delivery *Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("unable to build request : %v", err)
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_ID, delivery.ID)
+	req.Header.Set(HEADER_EVENT, delivery.EventType)
+	req.Header.Set(HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HEADER_SIGNATURE, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
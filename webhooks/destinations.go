@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrPrivateDestination refuses a webhook destination on a loopback, link-local, private or unspecified address.
+var ErrPrivateDestination = errors.New("webhook destination is not a public address")
+
+// AllowPrivateHosts is whether WEBHOOK_ALLOW_PRIVATE_HOSTS lets webhooks reach loopback, link-local and private
+// addresses, as a receiver on the same host or network needs.
+func AllowPrivateHosts() bool {
+	allow, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_HOSTS"))
+	return err == nil && allow
+}
+
+// CheckHost refuses the host of a webhook URL when it is localhost or an address that is not public, unless private
+// hosts are allowed. Other names are checked against the addresses they resolve to as each delivery connects.
+func (c *Client) CheckHost(host string) error {
+	if c.allowPrivateHosts {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateDestination
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublic(addr) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+// refusePrivateAddress is the dialer control of a client that does not allow private hosts, refusing a connection to
+// an address that is not public whatever name led to it.
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() && !addr.IsUnspecified()
+}
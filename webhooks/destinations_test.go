@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr error
+	}{
+		{host: "example.com"},
+		{host: "93.184.215.14"},
+		{host: "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		{host: "localhost", wantErr: ErrPrivateDestination},
+		{host: "hooks.localhost.", wantErr: ErrPrivateDestination},
+		{host: "127.0.0.1", wantErr: ErrPrivateDestination},
+		{host: "::1", wantErr: ErrPrivateDestination},
+		{host: "::ffff:127.0.0.1", wantErr: ErrPrivateDestination},
+		{host: "0.0.0.0", wantErr: ErrPrivateDestination},
+		{host: "169.254.169.254", wantErr: ErrPrivateDestination},
+		{host: "fe80::1%eth0", wantErr: ErrPrivateDestination},
+		{host: "10.1.2.3", wantErr: ErrPrivateDestination},
+		{host: "172.16.0.1", wantErr: ErrPrivateDestination},
+		{host: "192.168.1.1", wantErr: ErrPrivateDestination},
+		{host: "fd00::1", wantErr: ErrPrivateDestination},
+	}
+
+	client := NewClient()
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if err := client.CheckHost(tt.host); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckHost(%s) error = %v, want %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_HOSTS", "true")
+	if err := NewClient().CheckHost("127.0.0.1"); err != nil {
+		t.Errorf("CheckHost() with private hosts allowed error = %v", err)
+	}
+}
+
+// TestSendRefusesPrivateAddress sends to a receiver on loopback by name. The client must refuse to connect unless
+// private hosts are allowed.
+func TestSendRefusesPrivateAddress(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	delivery := &Delivery{
+		ID:        "delivery",
+		EventType: EventTransactionCompleted,
+		URL:       strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		Secret:    "whsec_test",
+		Payload:   []byte(`{}`),
+	}
+
+	if _, err := NewClient().Send(context.Background(), delivery, time.Now()); !errors.Is(err, ErrPrivateDestination) {
+		t.Errorf("Send() error = %v, want %v", err, ErrPrivateDestination)
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_HOSTS", "true")
+	if _, err := NewClient().Send(context.Background(), delivery, time.Now()); err != nil {
+		t.Errorf("Send() with private hosts allowed error = %v", err)
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("receiver got %d deliveries, want 1", got)
+	}
+}
@@ -0,0 +1,24 @@
+package webhooks
+
+import "slices"
+
+const (
+	EventTransactionCompleted = "transaction.completed"
+	EventTransactionFailed    = "transaction.failed"
+	EventAccountFrozen        = "account.frozen"
+	EventAccountUnfrozen      = "account.unfrozen"
+	EventAccountClosed        = "account.closed"
+)
+
+// EventTypes are the events a webhook may subscribe to.
+var EventTypes = []string{
+	EventTransactionCompleted,
+	EventTransactionFailed,
+	EventAccountFrozen,
+	EventAccountUnfrozen,
+	EventAccountClosed,
+}
+
+func IsEventType(eventType string) bool {
+	return slices.Contains(EventTypes, eventType)
+}
@@ -0,0 +1,50 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HEADER_ID        = "Webhook-Id"
+	HEADER_EVENT     = "Webhook-Event"
+	HEADER_TIMESTAMP = "Webhook-Timestamp"
+	HEADER_SIGNATURE = "Webhook-Signature"
+
+	// SIGNATURE_PREFIX names the scheme of the signature header, which holds the hex HMAC after it.
+	SIGNATURE_PREFIX = "sha256="
+
+	// DEFAULT_TOLERANCE is how far the timestamp of a delivery may be from the clock of its receiver before Verify
+	// refuses it as a possible replay.
+	DEFAULT_TOLERANCE = 5 * time.Minute
+)
+
+// Sign is the signature header of a delivery: the HMAC-SHA256, keyed by the subscription secret, of the Unix
+// timestamp of the delivery, a dot, and the body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the timestamp and signature headers of a delivery received at now. A timestamp further than
+// tolerance from now is refused even when it is signed.
+func Verify(secret string, timestamp string, signature string, body []byte, now time.Time, tolerance time.Duration) bool {
+	unix, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew < -tolerance || skew > tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, unix, body)), []byte(strings.TrimSpace(signature)))
+}
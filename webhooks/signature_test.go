@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"transaction_id":"4b9a4b1e-8f0a-4d43-9c55-5a1f7a0e2f3d","status":"completed"}`)
+	signedAt := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	signature := Sign(secret, signedAt.Unix(), body)
+
+	tests := []struct {
+		name       string
+		secret     string
+		timestamp  string
+		signature  string
+		body       []byte
+		receivedAt time.Time
+		want       bool
+	}{
+		{name: "round trip", secret: secret, timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt, want: true},
+		{name: "received late within tolerance", secret: secret, timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt.Add(DEFAULT_TOLERANCE), want: true},
+		{name: "received early within tolerance", secret: secret, timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt.Add(-DEFAULT_TOLERANCE), want: true},
+		{name: "surrounding spaces", secret: secret, timestamp: " " + timestamp + " ", signature: " " + signature + " ", body: body, receivedAt: signedAt, want: true},
+		{name: "tampered body", secret: secret, timestamp: timestamp, signature: signature, body: []byte(strings.Replace(string(body), "completed", "failed", 1)), receivedAt: signedAt, want: false},
+		{name: "tampered timestamp", secret: secret, timestamp: strconv.FormatInt(signedAt.Unix()+1, 10), signature: signature, body: body, receivedAt: signedAt, want: false},
+		{name: "other secret", secret: "whsec_other", timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt, want: false},
+		{name: "timestamp too old", secret: secret, timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt.Add(DEFAULT_TOLERANCE + time.Second), want: false},
+		{name: "timestamp in the future", secret: secret, timestamp: timestamp, signature: signature, body: body, receivedAt: signedAt.Add(-DEFAULT_TOLERANCE - time.Second), want: false},
+		{name: "timestamp not a number", secret: secret, timestamp: "yesterday", signature: signature, body: body, receivedAt: signedAt, want: false},
+		{name: "signature without prefix", secret: secret, timestamp: timestamp, signature: strings.TrimPrefix(signature, SIGNATURE_PREFIX), body: body, receivedAt: signedAt, want: false},
+		{name: "no signature", secret: secret, timestamp: timestamp, body: body, receivedAt: signedAt, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.signature, tt.body, tt.receivedAt, DEFAULT_TOLERANCE); got != tt.want {
+				t.Errorf("Verify() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("whsec_test", 1735732800, []byte("{}"))
+
+	if !strings.HasPrefix(signature, SIGNATURE_PREFIX) || len(signature) != len(SIGNATURE_PREFIX)+64 {
+		t.Errorf("Sign() = %s, want %s and a hex SHA-256", signature, SIGNATURE_PREFIX)
+	}
+	if Sign("whsec_test", 1735732800, []byte("{}")) != signature {
+		t.Errorf("Sign() is not deterministic")
+	}
+}